@@ -1,12 +1,7 @@
 package conflict
 
 import (
-	"bufio"
-	"errors"
 	"fmt"
-	"math"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
@@ -17,9 +12,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/costaluu/flag/bubbletea/custom/textarea"
 	"github.com/costaluu/flag/constants"
-	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/git"
-	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/merge"
 	"github.com/costaluu/flag/resolver"
 	"github.com/costaluu/flag/types"
 )
@@ -27,139 +21,46 @@ import (
 var conflictMutex sync.Mutex = sync.Mutex{}
 var hardQuit bool = false
 
-// AcceptBothChanges returns the union of the changes from both branches
-func acceptBothChanges(conflict string) (string, error) {
-	sections, err := splitConflict(conflict)
-	
-	if err != nil {
-		return "", err
-	}
-
-	var list []string
-
-	filesystem.FileWriteContentToFile("output", fmt.Sprintf("%+v", sections))
-
-	if len(sections.before) > 0 {
-		list = append(list, sections.before)
-	}
-
-	if len(sections.current) > 0 {
-		list = append(list, sections.current)
-	}
+// contextLines returns the lines of the hunks around a conflict added to it as context.
+func contextLines(hunks []merge.Hunk, conflict types.Conflict) ([]string, []string) {
+	var before []string = []string{}
+	var after []string = []string{}
 
-	if len(sections.incoming) > 0 {
-		list = append(list, sections.incoming)
+	if conflict.Before > 0 {
+		lines := hunks[conflict.Hunk-1].Lines
+		before = lines[len(lines)-conflict.Before:]
 	}
 
-	if len(sections.after) > 0 {
-		list = append(list, sections.after)
+	if conflict.After > 0 {
+		after = hunks[conflict.Hunk+1].Lines[:conflict.After]
 	}
 
-	return strings.Join(list, "\n"), nil
+	return before, after
 }
 
-// AcceptCurrentChanges returns the changes from the current branch
-func acceptCurrentChanges(conflict string) (string, error) {
-	sections, err := splitConflict(conflict)
-
-	if err != nil {
-		return "", err
-	}
-
-	var list []string
-
-	if len(sections.before) > 0 {
-		list = append(list, sections.before)
-	}
-
-	if len(sections.current) > 0 {
-		list = append(list, sections.current)
-	}
-
-	if len(sections.after) > 0 {
-		list = append(list, sections.after)
-	}
-	
-	return strings.Join(list, "\n"), nil
-}
+// joinLines joins lines without their line endings, like the resolver shows them.
+func joinLines(parts ...[]string) string {
+	var lines []string = []string{}
 
-// AcceptIncomingChanges returns the changes from the incoming branch
-func acceptIncomingChanges(conflict string) (string, error) {
-	sections, err := splitConflict(conflict)
-	
-	if err != nil {
-		return "", err
-	}
-	
-	var list []string
-
-	if len(sections.before) > 0 {
-		list = append(list, sections.before)
-	}
-
-	if len(sections.incoming) > 0 {
-		list = append(list, sections.incoming)
-	}
-
-	if len(sections.after) > 0 {
-		list = append(list, sections.after)
+	for _, part := range parts {
+		for _, line := range part {
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
 	}
 
-	return strings.Join(list, "\n"), nil
+	return strings.Join(lines, "\n")
 }
 
-// Helper function to split the conflict into its components
-type conflictSections struct {
-	before string
-	current  string
-	incoming string
-	after string
-}
+// acceptChanges returns the content of a conflict solved with the lines of sides, in
+// order, between its context lines.
+func acceptChanges(hunks []merge.Hunk, conflict types.Conflict, sides ...[]string) string {
+	before, after := contextLines(hunks, conflict)
 
-func splitConflict(conflict string) (conflictSections, error) {
-	// Split the conflict string into its components
-	parts := strings.Split(conflict, "\n")
-
-	var sections conflictSections
-	var beforeSection []string
-	var afterSection []string
-	var currentSection []string
-	var incomingSection []string
-	var inCurrent, inIncoming, afterInIncoming bool
-
-	for _, line := range parts {
-		switch {
-		case strings.HasPrefix(line, "<<<<<<<"):
-			inCurrent = true
-		case strings.HasPrefix(line, "======="):
-			inCurrent = false
-			inIncoming = true
-		case strings.HasPrefix(line, ">>>>>>>"):
-			inIncoming = false
-			afterInIncoming = true
-		default:
-			if !inCurrent && !inIncoming && !afterInIncoming {
-				beforeSection = append(beforeSection, line)
-			} else if inCurrent {
-				currentSection = append(currentSection, line)
-			} else if inIncoming {
-				incomingSection = append(incomingSection, line)
-			} else if afterInIncoming {
-				afterSection = append(afterSection, line)
-			}
-		}
-	}
+	var parts [][]string = [][]string{before}
 
-	if len(currentSection) == 0 && len(incomingSection) == 0 {
-		return sections, errors.New("invalid conflict: no content detected")
-	}
+	parts = append(parts, sides...)
 
-	sections.current = strings.Join(currentSection, "\n")
-	sections.incoming = strings.Join(incomingSection, "\n")
-	sections.after = strings.Join(afterSection, "\n")
-	sections.before = strings.Join(beforeSection, "\n")
-
-	return sections, nil
+	return joinLines(append(parts, after)...)
 }
 
 var (
@@ -228,16 +129,16 @@ type model struct {
 	input textarea.Model
 	conflictIndex int
 	conflicts []resolver.ConflictRecord
-	conflictPath string
+	hunks []merge.Hunk
 	title string
 	fixViewport bool
 }
 
-func newModel(conflicts []resolver.ConflictRecord, conflictPath string, title string) model {
+func newModel(conflicts []resolver.ConflictRecord, hunks []merge.Hunk, title string) model {
 	m := model{
 		fixViewport: false,
 		title: title,
-		conflictPath: conflictPath,
+		hunks: hunks,
 		input: textarea.Model{},
 		help:   help.New(),
 		keymap: keymap{
@@ -290,7 +191,16 @@ func newModel(conflicts []resolver.ConflictRecord, conflictPath string, title st
 		conflictIndex: 0,
 	}
 
-	m.input = newTextarea(conflicts[0].Current.Content)
+	// Conflicts left from a previous round come first
+	for i, conflict := range conflicts {
+		if !conflict.Current.Resolved {
+			m.conflictIndex = i
+
+			break
+		}
+	}
+
+	m.input = newTextarea(conflicts[m.conflictIndex].Current.Content)
 	m.input.Focus()
 	
 	return m
@@ -339,42 +249,33 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 				case key.Matches(msg, m.keymap.both):
 					if !m.conflicts[m.conflictIndex].Current.Resolved {
-						resolvedConflict, err := acceptBothChanges(m.input.Value())
-
-						if err == nil {
-							temp := m.conflicts[m.conflictIndex].Current
-							temp.Content = resolvedConflict
+						hunk := m.hunks[m.conflicts[m.conflictIndex].Current.Hunk]
+						temp := m.conflicts[m.conflictIndex].Current
+						temp.Content = acceptChanges(m.hunks, temp, hunk.Current, hunk.Incoming)
+						temp.Resolved = true
 
-							m.conflicts[m.conflictIndex].RecordChange(temp)
-							m.input.SetValue(resolvedConflict)
-							m.conflicts[m.conflictIndex].Current.Resolved = true
-						}
+						m.conflicts[m.conflictIndex].RecordChange(temp)
+						m.input.SetValue(temp.Content)
 					}
 				case key.Matches(msg, m.keymap.current):
 					if !m.conflicts[m.conflictIndex].Current.Resolved {
-						resolvedConflict, err := acceptCurrentChanges(m.input.Value())
+						hunk := m.hunks[m.conflicts[m.conflictIndex].Current.Hunk]
+						temp := m.conflicts[m.conflictIndex].Current
+						temp.Content = acceptChanges(m.hunks, temp, hunk.Current)
+						temp.Resolved = true
 
-						if err == nil {
-							temp := m.conflicts[m.conflictIndex].Current
-							temp.Content = resolvedConflict
-
-							m.conflicts[m.conflictIndex].RecordChange(temp)
-							m.input.SetValue(resolvedConflict)
-							m.conflicts[m.conflictIndex].Current.Resolved = true
-						}
+						m.conflicts[m.conflictIndex].RecordChange(temp)
+						m.input.SetValue(temp.Content)
 					}
 				case key.Matches(msg, m.keymap.incoming):
 					if !m.conflicts[m.conflictIndex].Current.Resolved {
-						resolvedConflict, err := acceptIncomingChanges(m.input.Value())
-
-						if err == nil {
-							temp := m.conflicts[m.conflictIndex].Current
-							temp.Content = resolvedConflict
+						hunk := m.hunks[m.conflicts[m.conflictIndex].Current.Hunk]
+						temp := m.conflicts[m.conflictIndex].Current
+						temp.Content = acceptChanges(m.hunks, temp, hunk.Incoming)
+						temp.Resolved = true
 
-							m.conflicts[m.conflictIndex].RecordChange(temp)
-							m.input.SetValue(resolvedConflict)
-							m.conflicts[m.conflictIndex].Current.Resolved = true
-						}
+						m.conflicts[m.conflictIndex].RecordChange(temp)
+						m.input.SetValue(temp.Content)
 					}
 				case key.Matches(msg, m.keymap.undo):
 					m.conflicts[m.conflictIndex].Undo()
@@ -385,45 +286,27 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.input.SetValue(m.conflicts[m.conflictIndex].Current.Content)
 					return m, nil
 				case key.Matches(msg, m.keymap.contextup):
-					reader, err := resolver.NewFileLineReader(m.conflictPath)
-					defer reader.Close()
+					temp := m.conflicts[m.conflictIndex].Current
 
-					if err != nil {
-						logger.Fatal[error](err)
-					}
+					if !temp.Resolved && temp.Before < m.contextAvailable(temp.Hunk - 1) {
+						lines := m.hunks[temp.Hunk - 1].Lines
+						temp.Before += 1
+						temp.Content = strings.Join([]string{joinLines([]string{lines[len(lines) - temp.Before]}), temp.Content}, "\n")
+						m.input.SetValue(temp.Content)
 
-					if !m.conflicts[m.conflictIndex].Current.Resolved {
-						lineFetched, err := reader.ReadLine(m.conflicts[m.conflictIndex].Current.LineStart - 1)
-
-						if err == nil {
-							temp := m.conflicts[m.conflictIndex].Current
-							temp.LineStart -= 1
-							temp.Content = strings.Join([]string{lineFetched, m.conflicts[m.conflictIndex].Current.Content}, "\n")
-							m.input.SetValue(temp.Content)
-							
-							m.conflicts[m.conflictIndex].RecordChange(temp)
-						}
+						m.conflicts[m.conflictIndex].RecordChange(temp)
 					}
 				case key.Matches(msg, m.keymap.contextdown):
-					reader, err := resolver.NewFileLineReader(m.conflictPath)
-					defer reader.Close()
-
-					if err != nil {
-						logger.Fatal[error](err)
-					}
-
-					if !m.conflicts[m.conflictIndex].Current.Resolved {
-						lineFetched, err := reader.ReadLine(m.conflicts[m.conflictIndex].Current.LineEnd + 1)
+					temp := m.conflicts[m.conflictIndex].Current
 
-						if err == nil {
-							temp := m.conflicts[m.conflictIndex].Current
-							temp.LineEnd += 1
-							temp.Content = strings.Join([]string{m.conflicts[m.conflictIndex].Current.Content, lineFetched}, "\n")
-							m.input.SetValue(temp.Content)
+					if !temp.Resolved && temp.After < m.contextAvailable(temp.Hunk + 1) {
+						lines := m.hunks[temp.Hunk + 1].Lines
+						temp.After += 1
+						temp.Content = strings.Join([]string{temp.Content, joinLines([]string{lines[temp.After - 1]})}, "\n")
+						m.input.SetValue(temp.Content)
 
-							m.conflicts[m.conflictIndex].RecordChange(temp)
-						}
-					}		
+						m.conflicts[m.conflictIndex].RecordChange(temp)
+					}
 			}
 		case tea.WindowSizeMsg:
 			m.height = msg.Height
@@ -442,6 +325,28 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmd)
 }
 
+// contextAvailable returns how many lines of the hunk at position can be added to the
+// current conflict as context, the lines taken by another conflict are not.
+func (m model) contextAvailable(position int) int {
+	if position < 0 || position >= len(m.hunks) || m.hunks[position].Conflict {
+		return 0
+	}
+
+	available := len(m.hunks[position].Lines)
+
+	for i, conflict := range m.conflicts {
+		if i == m.conflictIndex {
+			continue
+		} else if conflict.Current.Hunk == position + 1 {
+			available -= conflict.Current.Before
+		} else if conflict.Current.Hunk == position - 1 {
+			available -= conflict.Current.After
+		}
+	}
+
+	return available
+}
+
 func (m *model) sizeInputs() {
 		m.input.SetWidth(m.width - 35)
 		m.input.SetHeight(m.height - 3)
@@ -471,122 +376,94 @@ func (m model) View() string {
 	return constants.MergeMark + " " + lipgloss.NewStyle().SetString(m.title).Bold(true).Render() + "\n" + lipgloss.JoinHorizontal(lipgloss.Top, m.input.View(), " ", helpText)
 }
 
-func SolveConflicts(content []resolver.ConflictRecord, conflictPath string, title string) []resolver.ConflictRecord {
+func SolveConflicts(content []resolver.ConflictRecord, hunks []merge.Hunk, title string) ([]resolver.ConflictRecord, error) {
 	if len(content) > 0 {
-		model := newModel(content, conflictPath, title)
+		model := newModel(content, hunks, title)
 		
 		if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
-			logger.Fatal[error](err)
+			return nil, err
 		}
 
 		if hardQuit {
-			os.Exit(0)
+			return nil, errs.New(errs.MergeConflict, "merge aborted with unresolved conflicts")
 		}
 		
-		return model.conflicts
+		return model.conflicts, nil
 	} else {
-		return content
+		return content, nil
 	}
 }
 
-// FindGitConflicts reads a file line by line and prints the lines containing git conflicts
-func FindGitConflicts(filePath string) ([]resolver.ConflictRecord) {
-	file, err := os.Open(filePath)
+// mergedText returns the merged file with each conflict replaced by its content, the
+// lines of the hunks around it added as context are replaced too.
+func mergedText(hunks []merge.Hunk, conflicts []resolver.ConflictRecord) string {
+	var solved map[int]types.Conflict = make(map[int]types.Conflict)
 
-	if err != nil {
-		logger.Fatal[error](err)
+	for _, conflict := range conflicts {
+		solved[conflict.Current.Hunk] = conflict.Current
 	}
 
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	var conflictBlock []string
-	inConflict := false
-	var lineStart int
-	var conflicts []resolver.ConflictRecord = []resolver.ConflictRecord{}
-	var currentLineNumber int = 0
-
-	for scanner.Scan() {
-		currentLineNumber++
-		line := scanner.Text()
+	var text strings.Builder
 
-		if strings.HasPrefix(line, "<<<<<<<") {
-			inConflict = true
-			lineStart = currentLineNumber
-		}
+	for i, hunk := range hunks {
+		if conflict, exists := solved[i]; exists {
+			if conflict.Content != "" {
+				text.WriteString(conflict.Content + "\n")
+			}
 
-		if inConflict {
-			conflictBlock = append(conflictBlock, line)
+			continue
 		}
 
-		if strings.HasPrefix(line, ">>>>>>>") {
-			inConflict = false
-
-			var conflict types.Conflict = types.Conflict{
-				LineStart: lineStart,
-				LineEnd: currentLineNumber,
-				Content: strings.Join(conflictBlock, "\n"),
-				Resolved: false,
-			}
+		lines := hunk.Lines
 
-			conflicts = append(conflicts, resolver.ConflictRecord{
-				Current: conflict,
-				UndoStack: resolver.NewStack[types.Conflict](),
-				RedoStack: resolver.NewStack[types.Conflict](),
-			})
+		if conflict, exists := solved[i - 1]; exists {
+			lines = lines[conflict.After:]
+		}
 
-			conflictBlock = nil // Clear the block after processing
+		if conflict, exists := solved[i + 1]; exists {
+			lines = lines[:len(lines) - conflict.Before]
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		logger.Fatal[error](err)
+		for _, line := range lines {
+			text.WriteString(line)
+		}
 	}
 
-	return conflicts
+	return text.String()
 }
 
-func Resolve(title string) {
-	var rootDir string = git.GetRepositoryRoot()
-	var allConflictsSolved bool = false
-	
-	for !allConflictsSolved {
-		conflicts := FindGitConflicts(filepath.Join(rootDir, ".features", "merge-tmp"))
-		processedConflicts := SolveConflicts(conflicts, filepath.Join(rootDir, ".features", "merge-tmp"), title)
-		var solvedConflicts []resolver.ConflictRecord
-		var unSolvedConflicts []resolver.ConflictRecord
-
-		for _, conflict := range processedConflicts {
-			if !conflict.Current.Resolved {
-				unSolvedConflicts = append(unSolvedConflicts, conflict)
-			} else {
-				solvedConflicts = append(solvedConflicts, conflict)
-			}
+// Resolve asks to solve the conflicts of a merge until none is left and returns the
+// merged file. Conflicts are solved on the hunks of the merge, the context lines come
+// from the hunks around them. It returns errs.ErrMergeConflict when the user quits with
+// conflicts left.
+func Resolve(title string, result merge.Result) (string, error) {
+	var conflicts []resolver.ConflictRecord = []resolver.ConflictRecord{}
+
+	for i, hunk := range result.Hunks {
+		if !hunk.Conflict {
+			continue
 		}
 
-		var lineOffset int = 0
+		conflicts = append(conflicts, resolver.ConflictRecord{
+			Current: types.Conflict{Hunk: i, Content: result.ConflictText(hunk)},
+			UndoStack: resolver.NewStack[types.Conflict](),
+			RedoStack: resolver.NewStack[types.Conflict](),
+		})
+	}
 
-		for _, solvedConflict := range solvedConflicts {
-			stringContent := strings.Split(solvedConflict.Current.Content, "\n")
+	for {
+		var solved bool = true
 
-			err := filesystem.FileReplaceLinesInFile(filepath.Join(rootDir, ".features", "merge-tmp"), solvedConflict.Current.LineStart + lineOffset, solvedConflict.Current.LineEnd + lineOffset, stringContent)
-			
-			if err != nil {
-				logger.Fatal[error](err)
-			}
+		for _, conflict := range conflicts {
+			solved = solved && conflict.Current.Resolved
+		}
 
-			linesCountBefore := (solvedConflict.Current.LineEnd + 1) - solvedConflict.Current.LineStart
-			linesCountAfter := len(stringContent)
-			
-			if linesCountBefore > linesCountAfter {
-				lineOffset -= int(math.Abs(float64(linesCountBefore) - float64(linesCountAfter)))
-			} else if linesCountBefore < linesCountAfter {
-				lineOffset += int(math.Abs(float64(linesCountBefore) - float64(linesCountAfter)))
-			}
+		if solved {
+			return mergedText(result.Hunks, conflicts), nil
 		}
-		
-		if len(unSolvedConflicts) == 0 {
-			allConflictsSolved = true
+
+		if _, err := SolveConflicts(conflicts, result.Hunks, title); err != nil {
+			return "", err
 		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,42 @@
+package conflict
+
+import (
+	"testing"
+
+	"github.com/costaluu/flag/merge"
+	"github.com/costaluu/flag/resolver"
+	"github.com/costaluu/flag/types"
+)
+
+func TestMergedText(t *testing.T) {
+	result, err := merge.Diff3{}.Merge([]byte("a\nb\nc\nd\ne\nf\n"), []byte("1\nb\nc\nd\ne\n6\n"), []byte("2\nb\nc\nd\ne\n7\n"), "one", "two")
+
+	if err != nil || len(result.Hunks) != 3 {
+		t.Fatalf("unexpected merge %+v %v", result.Hunks, err)
+	}
+
+	// The first conflict takes two lines of the hunk after it as context, the second one
+	// takes one line of the same hunk
+	first := types.Conflict{Hunk: 0, After: 2}
+	first.Content = acceptChanges(result.Hunks, first, result.Hunks[0].Current, result.Hunks[0].Incoming)
+
+	second := types.Conflict{Hunk: 2, Before: 1}
+	second.Content = acceptChanges(result.Hunks, second, result.Hunks[2].Incoming)
+
+	if first.Content != "1\n2\nb\nc" || second.Content != "e\n7" {
+		t.Fatalf("unexpected contents %q %q", first.Content, second.Content)
+	}
+
+	text := mergedText(result.Hunks, []resolver.ConflictRecord{{Current: first}, {Current: second}})
+
+	if text != "1\n2\nb\nc\nd\ne\n7\n" {
+		t.Errorf("unexpected merged text %q", text)
+	}
+
+	// A conflict solved with no lines leaves nothing
+	first.Content = ""
+
+	if text := mergedText(result.Hunks, []resolver.ConflictRecord{{Current: first}, {Current: second}}); text != "d\ne\n7\n" {
+		t.Errorf("unexpected merged text %q", text)
+	}
+}
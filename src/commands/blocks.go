@@ -2,198 +2,249 @@ package commands
 
 import (
 	"fmt"
-	"strings"
+	"os"
 
 	"github.com/costaluu/flag/bubbletea/components"
 	"github.com/costaluu/flag/constants"
 	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
 	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/output"
 	"github.com/costaluu/flag/styles"
+	"github.com/costaluu/flag/types"
 	"github.com/costaluu/flag/utils"
 	"github.com/urfave/cli/v2"
 )
 
+// pickBlockFile returns the file given as the argument at index, or asks for one of
+// the files with blocks referencing a feature. The path is empty when nothing was
+// selected.
+func pickBlockFile(rootDir string, ctx *cli.Context, index int, featureName string) (string, []types.BlockFeature, error) {
+	path, err := fileArgument(rootDir, ctx, index, func() (string, error) {
+		blocksSet, err := core.ListAllBlocks(rootDir)
+
+		if err != nil {
+			return "", err
+		}
+
+		var items []components.FileListItem = []components.FileListItem{}
+		
+		for path, blockList := range blocksSet {
+			for _, block := range blockList {
+				if core.BlockReferencesFeature(block, featureName) {
+					items = append(items, components.FileListItem{ ItemTitle: path, Desc: block.Name })
+					break
+				}
+			}
+		}
+
+		return utils.PickCustomFiles("Pick a file and feature", items).ItemTitle, nil
+	})
+
+	if err != nil || path == "" {
+		return "", nil, err
+	}
+
+	blockList, err := core.ListBlocksFromPath(rootDir, path)
+
+	return path, blockList, err
+}
+
 var BlocksFeaturesToggleCommand *cli.Command = &cli.Command{
 	Name:  "toggle",
-	Usage: "toggle a feature to on, off or dev mode",
-	ArgsUsage: `<feature_name|preset_name> <on|off|dev>`,
+	Usage: "toggle a feature to on, off, dev mode or one of its variants",
+	ArgsUsage: `<feature_name|preset_name> <on|off|dev|variant> [file]`,
 	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "toggles a feature in a specific file path."},
+		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "toggles a feature in a specific file path, picked when the file is missing."},
 		&cli.BoolFlag{Name: "preset", Aliases: []string{"p"}, Usage: "uses a preset instead of a feature"},
 	},
-	Action: func(ctx *cli.Context) error {
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 
 		if ctx.Bool("preset") && len(args) == 1 {
-			presets := core.ReadPresets()
+			presets, err := core.ReadPresets(rootDir)
+
+			if err != nil {
+				return err
+			}
+
 			presetName := args[0]
 			
 			preset, exists := presets[presetName]
 
 			if !exists {
-				logger.Result[string](fmt.Sprintf("preset %s doest not exists", presetName))
+				return errs.New(errs.NotFound, "preset %s doest not exists", presetName)
 			}
 
 			for featureName, featureState := range preset {
-				core.ToggleBlockFeature(featureName, featureState)
+				if err := core.ToggleBlockFeature(rootDir, featureName, featureState); err != nil {
+					return err
+				}
 			}
 
 			return nil
 		}
 
 		if len(args) < 2 {
-			logger.Result[string](fmt.Sprintf("usage: %s blocks %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s blocks %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
 		}
 
-		state := strings.ToUpper(args[1])
+		if err := core.CheckFeatureName(rootDir, args[0]); err != nil {
+			return err
+		}
+
+		state := core.NormalizeState(args[1])
 
-		if state != constants.STATE_DEV && state != constants.STATE_ON && state != constants.STATE_OFF {
-			logger.Result[string]("invalid state. use on|off|dev")			
+		if !ctx.Bool("specific") {
+			return core.ToggleBlockFeature(rootDir, args[0], state)
 		}
 
-		if ctx.Bool("specific") {
-			blocksSet := core.ListAllBlocks()
+		path, blockList, err := pickBlockFile(rootDir, ctx, 2, args[0])
 
-			var items []components.FileListItem = []components.FileListItem{}
-			
-			for path, blockList := range blocksSet {
-				for _, block := range blockList {
-					if block.Name == args[0] {
-						items = append(items, components.FileListItem{ ItemTitle: path, Desc: block.Name })
-						break
-					}
-				}
-			}
+		if err != nil {
+			return err
+		}
 
-			result := utils.PickCustomFiles("Pick a file and feature", items)
+		if path == "" {
+			logger.Info[string]("please select one option to continue")
 
-			if result.ItemTitle != "" {
-				core.ToggleFeatureOnPath(args[0], state, result.ItemTitle, core.ListBlocksFromPath(result.ItemTitle))
+			return nil
+		}
 
-				var stateStyle string
+		if err := core.ToggleFeatureOnPath(rootDir, args[0], state, path, blockList); err != nil {
+			return err
+		}
 
-				if state == constants.STATE_DEV {
-					stateStyle = styles.BlueTextStyle(state)
-				} else if state == constants.STATE_ON {
-					stateStyle = styles.GreenTextStyle(state)
-				} else {
-					stateStyle = styles.RedTextStyle(state)
-				}
+		var stateStyle string
 
-				logger.Success[string](fmt.Sprintf("feature %s toggled %s", styles.AccentTextStyle(args[0]), stateStyle))
-			} else {
-				logger.Info[string]("please select one option to continue")
-			}
+		if state == constants.STATE_DEV {
+			stateStyle = styles.BlueTextStyle(state)
+		} else if state == constants.STATE_OFF {
+			stateStyle = styles.RedTextStyle(state)
 		} else {
-			core.ToggleBlockFeature(args[0], state)
+			stateStyle = styles.GreenTextStyle(state)
 		}
 
+		logger.Success[string](fmt.Sprintf("feature %s toggled %s", styles.AccentTextStyle(args[0]), stateStyle))
+
 		return nil
-	},
+	}),
 }
 
 var BlocksFeaturesPromoteCommand *cli.Command = &cli.Command{
 	Name:  "promote",
 	Usage: "promote a feature",
-	ArgsUsage: `<feature_name>`,
+	ArgsUsage: `<feature_name> [file]`,
 	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "promotes a feature in a specific file path."},
+		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "promotes a feature in a specific file path, picked when the file is missing."},
 	},
-	Action: func(ctx *cli.Context) error {
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 
 		if len(args) < 1 {
-			logger.Result[string](fmt.Sprintf("usage: %s blocks %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s blocks %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
 		}
 
-		if ctx.Bool("specific") {
-			blocksSet := core.ListAllBlocks()
+		if !ctx.Bool("specific") {
+			return core.PromoteBlockFeature(rootDir, args[0])
+		}
 
-			var items []components.FileListItem = []components.FileListItem{}
-			
-			for path, blockList := range blocksSet {
-				for _, block := range blockList {
-					if block.Name == args[0] {
-						items = append(items, components.FileListItem{ ItemTitle: path, Desc: block.Name })
-						break
-					}
-				}
-			}
+		path, blockList, err := pickBlockFile(rootDir, ctx, 1, args[0])
 
-			result := utils.PickCustomFiles("Pick a file and feature", items)
+		if err != nil {
+			return err
+		}
 
-			if result.ItemTitle != "" {
-				core.PromoteBlockFeatureOnPath(result.ItemTitle, args[0], core.ListBlocksFromPath(result.ItemTitle))
+		if path == "" {
+			logger.Info[string]("please select one option to continue")
 
-				logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(args[0]), styles.GreenTextStyle("promoted")))
-			} else {
-				logger.Info[string]("please select one option to continue")
-			}
-		} else {
-			core.PromoteBlockFeature(args[0])
+			return nil
 		}
+
+		if err := core.PromoteBlockFeatureOnPath(rootDir, path, args[0], blockList); err != nil {
+			return err
+		}
+
+		logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(args[0]), styles.GreenTextStyle("promoted")))
 		
 		return nil
-	},
+	}),
 }
 
 var BlocksFeaturesDemoteCommand *cli.Command = &cli.Command{
 	Name:  "demote",
 	Usage: "demote a feature",
-	ArgsUsage: `<feature_name>`,
+	ArgsUsage: `<feature_name> [file]`,
 	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "demotes a feature in a specific file path."},
+		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "demotes a feature in a specific file path, picked when the file is missing."},
 	},
-	Action: func(ctx *cli.Context) error {
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 
 		if len(args) < 1 {
-			logger.Result[string](fmt.Sprintf("usage: %s blocks %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s blocks %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
 		}
 
-		if ctx.Bool("specific") {
-			blocksSet := core.ListAllBlocks()
+		if !ctx.Bool("specific") {
+			return core.DemoteBlockFeature(rootDir, args[0])
+		}
 
-			var items []components.FileListItem = []components.FileListItem{}
-			
-			for path, blockList := range blocksSet {
-				for _, block := range blockList {
-					if block.Name == args[0] {
-						items = append(items, components.FileListItem{ ItemTitle: path, Desc: block.Name })
-						break
-					}
-				}
-			}
+		path, blockList, err := pickBlockFile(rootDir, ctx, 1, args[0])
 
-			result := utils.PickCustomFiles("Pick a file and feature", items)
+		if err != nil {
+			return err
+		}
 
-			if result.ItemTitle != "" {
-				core.DemoteBlockFeatureOnPath(result.ItemTitle, args[0], core.ListBlocksFromPath(result.ItemTitle))
+		if path == "" {
+			logger.Info[string]("please select one option to continue")
 
-				logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(args[0]), styles.RedTextStyle("demoted")))
-			} else {
-				logger.Info[string]("please select one option to continue")
-			}
-		} else {
-			core.DemoteBlockFeature(args[0])
+			return nil
 		}
 
+		if err := core.DemoteBlockFeatureOnPath(rootDir, path, args[0], blockList); err != nil {
+			return err
+		}
+
+		logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(args[0]), styles.RedTextStyle("demoted")))
+
 		return nil
-	},
+	}),
 }
 
 var BlocksFeaturesDetailsCommand *cli.Command = &cli.Command{
 	Name:  "details",
 	Usage: "show a report for a file",
-	Action: func(ctx *cli.Context) error {
-		selectedItem := utils.PickAllFiles("Pick a file to show details")
+	ArgsUsage: `[file]`,
+	Flags: []cli.Flag{
+		outputFlag(),
+	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		format, err := outputFormat(ctx)
 
-		if selectedItem.ItemTitle != "" {
-			core.BlockDetails(selectedItem.ItemTitle)
+		if err != nil {
+			return err
 		}
 
-		return nil
-	},
+		path, err := fileArgument(rootDir, ctx, 0, func() (string, error) {
+			return utils.PickAllFiles(rootDir, "Pick a file to show details").ItemTitle, nil
+		})
+
+		if err != nil || path == "" {
+			return err
+		}
+
+		if format == output.Table {
+			return core.BlockDetails(rootDir, path)
+		}
+
+		records, err := core.BlockRecords(rootDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		return output.Write(os.Stdout, format, records)
+	}),
 }
 
 var BlocksFeaturesCommand *cli.Command = &cli.Command{
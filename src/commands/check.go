@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/output"
+	"github.com/urfave/cli/v2"
+)
+
+var CheckCommand *cli.Command = &cli.Command{
+	Name:  "check",
+	Usage: "verifies that the workspace agrees with the files without changing them, fails when it doesn't",
+	Flags: []cli.Flag{
+		outputFlag(),
+	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		format, err := outputFormat(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		problems, err := core.CheckRecords(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		if format != output.Table {
+			// The records go to stdout, messages go to stderr
+			logger.SetOutput(os.Stderr)
+
+			if err := output.Write(os.Stdout, format, problems); err != nil {
+				return err
+			}
+		} else if len(problems) > 0 {
+			core.CheckReport(problems)
+		}
+
+		if len(problems) > 0 {
+			return errs.New(errs.Inconsistent, "%d problems found", len(problems))
+		}
+
+		logger.Success[string]("the workspace is consistent")
+
+		return nil
+	}),
+}
@@ -2,11 +2,13 @@ package commands
 
 import (
 	"fmt"
-	"strings"
+	"os"
 
 	"github.com/costaluu/flag/constants"
 	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
 	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/output"
 	"github.com/costaluu/flag/styles"
 	"github.com/urfave/cli/v2"
 )
@@ -14,64 +16,98 @@ import (
 var DelimeterListCommand *cli.Command = &cli.Command{
 	Name:  "list",
 	Usage: "list all delimeters",
-	Action: func(ctx *cli.Context) error {
-		core.ListDelimeters()
-		return nil
+	Flags: []cli.Flag{
+		outputFlag(),
 	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		format, err := outputFormat(ctx)
+
+		if err != nil {
+			return err
+		} else if format == output.Table {
+			return core.ListDelimeters(rootDir)
+		}
+
+		records, err := core.DelimeterRecords(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		return output.Write(os.Stdout, format, records)
+	}),
 }
 
 var DelimeterSetCommand *cli.Command = &cli.Command{
 	Name:  "set",
-	Usage: "creates or updates an existing delimeter",
-	ArgsUsage: `<file_extension> <delimeter_start> <delimeter_end>`,
-	Action: func(ctx *cli.Context) error {
+	Usage: "adds a delimeter to a file extension",
+	ArgsUsage: `<file_extension|glob> <delimeter_start> <delimeter_end>`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "replace", Aliases: []string{"r"}, Usage: "replaces the delimeters of the rule instead of adding one"},
+		&cli.BoolFlag{Name: "glob", Aliases: []string{"g"}, Usage: "the rule is a glob like **/Dockerfile* or a file name like Makefile"},
+	},
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 		
 		if len(args) < 3 {
-			logger.Result[string](fmt.Sprintf("usage: %s delimeters %s", constants.COMMAND, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s delimeters %s", constants.COMMAND, ctx.Command.ArgsUsage)
 		}
 
 		extension := args[0]
 
-		if !strings.HasPrefix(extension, ".") {
-			logger.Result[string]("invalid extension")
+		if ctx.Bool("glob") {
+			if extension == "default" || core.DelimeterRuleKind(extension) == "extension" {
+				return errs.New(errs.InvalidArgument, "invalid glob %s, use it without --glob for file extensions", extension)
+			}
+		} else if core.DelimeterRuleKind(extension) != "extension" {
+			return errs.New(errs.InvalidArgument, "invalid extension, use --glob for globs and file names")
 		}
 
-		core.SetDelimeter(extension, args[1], args[2])
+		if err := core.SetDelimeter(rootDir, extension, args[1], args[2], ctx.Bool("replace")); err != nil {
+			return err
+		}
 
-		logger.Success[string](fmt.Sprintf("delimeter for file extension %s seted", styles.AccentTextStyle(extension)))
+		logger.Success[string](fmt.Sprintf("delimeter %s %s added to %s", args[1], args[2], styles.AccentTextStyle(extension)))
 
 		return nil
-	},
+	}),
 }
 
 var DelimeterDeleteCommand *cli.Command = &cli.Command{
 	Name:  "delete",
-	Usage: "deletes an existing delimeter",
-	ArgsUsage: `<file_extension>`,
-	Action: func(ctx *cli.Context) error {
+	Usage: "deletes the delimeters of a rule, or only the one with the given start",
+	ArgsUsage: `<file_extension|glob> [delimeter_start]`,
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 		
-		if len(args) != 1 {
-			logger.Result[string](fmt.Sprintf("usage: %s delimeters %s", constants.COMMAND, ctx.Command.ArgsUsage))			
+		if len(args) != 1 && len(args) != 2 {
+			return errs.New(errs.InvalidArgument, "usage: %s delimeters %s", constants.COMMAND, ctx.Command.ArgsUsage)
 		}
 
 		extension := args[0]
 
-		if !strings.HasPrefix(extension, ".") {
-			logger.Result[string]("invalid extension")
+		if extension == "default" {
+			return errs.New(errs.InvalidArgument, "the default delimeter can't be deleted")
 		}
 
-		if extension == "default" {
-			logger.Result[string]("invalid extension")
+		if len(args) == 2 {
+			if err := core.DeleteDelimeter(rootDir, extension, args[1]); err != nil {
+				return err
+			}
+
+			logger.Success[string](fmt.Sprintf("delimeter %s deleted from %s", args[1], styles.AccentTextStyle(extension)))
+
+			return nil
 		}
 
-		core.DeleteDelimeter(extension)
+		if err := core.DeleteDelimeter(rootDir, extension, ""); err != nil {
+			return err
+		}
 
-		logger.Success[string](fmt.Sprintf("delimeter for file extension %s deleted", styles.AccentTextStyle(extension)))
+		logger.Success[string](fmt.Sprintf("delimeters for %s deleted", styles.AccentTextStyle(extension)))
 
 		return nil
-	},
+	}),
 }
 
 var DelimeterCommand *cli.Command = &cli.Command{
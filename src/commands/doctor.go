@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/output"
+	"github.com/urfave/cli/v2"
+)
+
+var DoctorCommand *cli.Command = &cli.Command{
+	Name:  "doctor",
+	Usage: "finds the leftovers of interrupted operations and broken references on .features, --fix repairs them",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "fix", Usage: "repairs the problems that can be fixed"},
+		outputFlag(),
+	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		format, err := outputFormat(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		records, err := core.Doctor(rootDir, ctx.Bool("fix"))
+
+		if err != nil {
+			return err
+		}
+
+		if format != output.Table {
+			// The records go to stdout, messages go to stderr
+			logger.SetOutput(os.Stderr)
+
+			if err := output.Write(os.Stdout, format, records); err != nil {
+				return err
+			}
+		} else if len(records) > 0 {
+			core.DoctorReport(records)
+		}
+
+		var fixed, fixable int = 0, 0
+
+		for _, record := range records {
+			if record.Fixed {
+				fixed++
+			} else if record.Fix != "" {
+				fixable++
+			}
+		}
+
+		if remaining := len(records) - fixed; remaining > 0 {
+			if fixable > 0 {
+				return errs.New(errs.Inconsistent, "%d problems found, %d can be fixed with %s %s --fix", remaining, fixable, constants.COMMAND, ctx.Command.Name)
+			}
+
+			return errs.New(errs.Inconsistent, "%d problems found that must be fixed by hand", remaining)
+		}
+
+		if fixed > 0 {
+			logger.Success[string](fmt.Sprintf("%d problems fixed", fixed))
+		} else {
+			logger.Success[string]("no problems found")
+		}
+
+		return nil
+	}),
+}
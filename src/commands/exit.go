@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"errors"
+	"os"
+
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/logger"
+)
+
+// Exit prints err and ends the process with the exit code of its kind, a canceled
+// operation is not a failure.
+func Exit(err error) {
+	if err == nil {
+		return
+	}
+
+	if !errors.Is(err, errs.ErrCanceled) {
+		logger.Error[string](err.Error())
+	}
+
+	os.Exit(errs.ExitCode(err))
+}
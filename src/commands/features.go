@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/styles"
+	"github.com/urfave/cli/v2"
+)
+
+var FeaturesAddCommand *cli.Command = &cli.Command{
+	Name:  "add",
+	Usage: "registers a feature or updates its registry entry",
+	ArgsUsage: `<feature_name>`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "description", Aliases: []string{"d"}, Usage: "what the feature does"},
+		&cli.StringFlag{Name: "owner", Aliases: []string{"o"}, Usage: "who is responsible for the feature, defaults to the git user"},
+		&cli.StringSliceFlag{Name: "tag", Aliases: []string{"t"}, Usage: "a tag for the feature, can be repeated"},
+		&cli.StringSliceFlag{Name: "states", Aliases: []string{"s"}, Usage: "allowed states (on, off, dev) or the values of a multivariate feature"},
+	},
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
+		args := ctx.Args().Slice()
+
+		if len(args) != 1 {
+			return errs.New(errs.InvalidArgument, "usage: %s features %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
+		}
+
+		created, err := core.AddFeature(rootDir, args[0], ctx.String("description"), ctx.String("owner"), ctx.StringSlice("states"), ctx.StringSlice("tag"))
+
+		if err != nil {
+			return err
+		}
+
+		if created {
+			logger.Success[string](fmt.Sprintf("feature %s registered", styles.AccentTextStyle(args[0])))
+		} else {
+			logger.Success[string](fmt.Sprintf("feature %s updated", styles.AccentTextStyle(args[0])))
+		}
+
+		return nil
+	}),
+}
+
+var FeaturesDescribeCommand *cli.Command = &cli.Command{
+	Name:  "describe",
+	Usage: "shows the registry entry of a feature and where it is used",
+	ArgsUsage: `<feature_name>`,
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		args := ctx.Args().Slice()
+
+		if len(args) != 1 {
+			return errs.New(errs.InvalidArgument, "usage: %s features %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
+		}
+
+		return core.DescribeFeature(rootDir, args[0])
+	}),
+}
+
+var FeaturesListCommand *cli.Command = &cli.Command{
+	Name:  "list",
+	Usage: "lists all registered features",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "tag", Aliases: []string{"t"}, Usage: "only lists features with the tag"},
+	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.ListFeatures(rootDir, ctx.String("tag"))
+	}),
+}
+
+var FeaturesCommand *cli.Command = &cli.Command{
+	Name: "features",
+	Usage: "operations for the feature registry",
+	Subcommands: []*cli.Command{
+		FeaturesAddCommand,
+		FeaturesDescribeCommand,
+		FeaturesListCommand,
+	},
+}
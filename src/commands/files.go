@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// repositoryPath turns a path of the command line, relative to the working directory,
+// into the path relative to the repository root used by core.
+func repositoryPath(rootDir string, path string) (string, error) {
+	absolute, err := filepath.Abs(path)
+
+	if err != nil {
+		return "", errs.Wrap(err, "invalid path %s", path)
+	}
+
+	if !filesystem.FileExists(absolute) {
+		return "", errs.New(errs.NotFound, "file %s not found", path)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(absolute); err == nil {
+		absolute = resolved
+	}
+
+	relative, err := filepath.Rel(rootDir, absolute)
+
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return "", errs.New(errs.InvalidArgument, "%s is outside of the repository", path)
+	}
+
+	return utils.NormalizePath(relative), nil
+}
+
+// fileArgument returns the file given as the argument at index, without one it asks
+// for it with pick. An empty path means that nothing was picked.
+func fileArgument(rootDir string, ctx *cli.Context, index int, pick func() (string, error)) (string, error) {
+	if ctx.Args().Len() > index {
+		return repositoryPath(rootDir, ctx.Args().Get(index))
+	}
+
+	if !core.IsInteractive() {
+		return "", errs.New(errs.InvalidArgument, "a file is required with --non-interactive, usage: %s %s", ctx.Command.HelpName, ctx.Command.ArgsUsage)
+	}
+
+	return pick()
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/urfave/cli/v2"
+)
+
+var HooksInstallCommand *cli.Command = &cli.Command{
+	Name:  "install",
+	Usage: "installs the pre-commit, post-checkout and post-merge hooks, existing hooks keep running",
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.InstallHooks(rootDir)
+	}),
+}
+
+var HooksUninstallCommand *cli.Command = &cli.Command{
+	Name:  "uninstall",
+	Usage: "removes the hooks of flag and restores the previous ones",
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.UninstallHooks(rootDir)
+	}),
+}
+
+var HooksStatusCommand *cli.Command = &cli.Command{
+	Name:  "status",
+	Usage: "shows which hooks are installed",
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.ListHooks(rootDir)
+	}),
+}
+
+var HooksRunCommand *cli.Command = &cli.Command{
+	Name:      "run",
+	Usage:     "runs a hook, called by the installed hooks",
+	ArgsUsage: `<hook> [git_arguments...]`,
+	Hidden:    true,
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		args := ctx.Args().Slice()
+
+		if len(args) < 1 {
+			return errs.New(errs.InvalidArgument, "usage: %s hooks %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
+		}
+
+		return core.RunHook(rootDir, args[0], args[1:])
+	}),
+}
+
+var HooksCommand *cli.Command = &cli.Command{
+	Name:  "hooks",
+	Usage: "operations for git hooks",
+	Subcommands: []*cli.Command{
+		HooksInstallCommand,
+		HooksUninstallCommand,
+		HooksStatusCommand,
+		HooksRunCommand,
+	},
+}
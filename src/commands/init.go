@@ -8,8 +8,7 @@ import (
 var InitCommand *cli.Command = &cli.Command{
 	Name:    "init",
 	Usage:   "creates a new workspace",
-	Action: func(ctx *cli.Context) error {
-		core.CreateNewWorkspace()
-		return nil
-	},    
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.CreateNewWorkspace(rootDir)
+	}),
 }
\ No newline at end of file
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/core"
+	"github.com/urfave/cli/v2"
+)
+
+// journaled runs the action of a command that changes many files as a journaled
+// operation, see core.Journaled.
+func journaled(action repositoryAction) cli.ActionFunc {
+	return inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.Journaled(rootDir, constants.COMMAND+" "+ctx.Command.FullName(), func() error {
+			return action(ctx, rootDir)
+		})
+	})
+}
+
+// locked runs the action of a command that changes the workspace holding its lock, see
+// core.Locked.
+func locked(action repositoryAction) cli.ActionFunc {
+	return inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.Locked(rootDir, constants.COMMAND+" "+ctx.Command.FullName(), func() error {
+			return action(ctx, rootDir)
+		})
+	})
+}
@@ -0,0 +1,15 @@
+package commands
+
+import (
+	"github.com/costaluu/flag/output"
+	"github.com/urfave/cli/v2"
+)
+
+// outputFlag returns the --output flag of the reports, urfave/cli needs a flag per command.
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: string(output.Table), Usage: "table, json, yaml or csv"}
+}
+
+func outputFormat(ctx *cli.Context) (output.Format, error) {
+	return output.ParseFormat(ctx.String("output"))
+}
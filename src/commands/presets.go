@@ -2,11 +2,13 @@ package commands
 
 import (
 	"fmt"
-	"strings"
+	"os"
 
 	"github.com/costaluu/flag/constants"
 	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
 	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/output"
 	"github.com/costaluu/flag/styles"
 	"github.com/urfave/cli/v2"
 )
@@ -14,115 +16,147 @@ import (
 var PresetListCommand *cli.Command = &cli.Command{
 	Name:  "list",
 	Usage: "list all presets and features",
-	Action: func(ctx *cli.Context) error {
-		core.ListPresets()
-		return nil
+	Flags: []cli.Flag{
+		outputFlag(),
 	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		format, err := outputFormat(ctx)
+
+		if err != nil {
+			return err
+		} else if format == output.Table {
+			return core.ListPresets(rootDir)
+		}
+
+		records, err := core.PresetRecords(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		return output.Write(os.Stdout, format, records)
+	}),
 }
 
 var PresetCreateCommand *cli.Command = &cli.Command{
 	Name:  "create",
 	Usage: "creates a preset from scratch or from another preset",
 	ArgsUsage: `<preset_name> <from_preset>`,
-	Action: func(ctx *cli.Context) error {
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 		
 		if len(args) < 1 {
-			logger.Result[string](fmt.Sprintf("usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage)
 		}
 		
 		presetName := args[0]
 		
 		if len(args) == 2 {
-			core.CreatePreset(presetName, args[1])
+			if err := core.CreatePreset(rootDir, presetName, args[1]); err != nil {
+				return err
+			}
+
 			logger.Success[string](fmt.Sprintf("%s preset created from %s", styles.AccentTextStyle(presetName), styles.AccentTextStyle(args[1])))
 		} else {
-			core.CreatePreset(presetName, "")
+			if err := core.CreatePreset(rootDir, presetName, ""); err != nil {
+				return err
+			}
+
 			logger.Success[string](fmt.Sprintf("%s preset created", styles.AccentTextStyle(presetName)))
 		}
 
 		return nil
-	},
+	}),
 }
 
 var PresetSetFeatureCommand *cli.Command = &cli.Command{
 	Name:  "set-feature",
 	Usage: "creates or update a feature in a preset",
-	ArgsUsage: `<preset_name> <feature_name> <state>`,
-	Action: func(ctx *cli.Context) error {
+	ArgsUsage: `<preset_name> <feature_name> <on|off|dev|variant>`,
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 		
 		if len(args) < 3 {
-			logger.Result[string](fmt.Sprintf("usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage)
 		}
 		
 		presetName := args[0]
 		featureName := args[1]
-		state := strings.ToUpper(args[2])
+		state := core.NormalizeState(args[2])
+
+		if err := core.CheckFeatureName(rootDir, featureName); err != nil {
+			return err
+		}
 
-		if state != constants.STATE_DEV && state != constants.STATE_ON && state != constants.STATE_OFF {
-			logger.Result[string]("invalid state. use on|off|dev")			
+		if err := core.ValidateFeatureState(rootDir, featureName, state); err != nil {
+			return err
 		}
 		
-		core.SetFeatureToPreset(presetName, featureName, state)
+		if err := core.SetFeatureToPreset(rootDir, presetName, featureName, state); err != nil {
+			return err
+		}
 
 		var stateStyle string
 
 		if state == constants.STATE_DEV {
 			stateStyle = styles.BlueTextStyle(state)
-		} else if state == constants.STATE_ON {
-			stateStyle = styles.GreenTextStyle(state)
-		} else {
+		} else if state == constants.STATE_OFF {
 			stateStyle = styles.RedTextStyle(state)
+		} else {
+			stateStyle = styles.GreenTextStyle(state)
 		}
 
 		logger.Success[string](fmt.Sprintf("feature %s created/updated on preset %s with state %s", styles.AccentTextStyle(featureName), styles.AccentTextStyle(presetName), stateStyle))
 
 		return nil
-	},
+	}),
 }
 
 var PresetDeleteFeatureCommand *cli.Command = &cli.Command{
 	Name:  "delete-feature",
 	Usage: "deletes a feature in a preset",
 	ArgsUsage: `<preset_name> <feature_name>`,
-	Action: func(ctx *cli.Context) error {
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 		
 		if len(args) < 2 {
-			logger.Result[string](fmt.Sprintf("usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage)
 		}
 		
 		presetName := args[0]
 		featureName := args[1]
 		
-		core.DeleteFeatureToPreset(presetName, featureName)
+		if err := core.DeleteFeatureToPreset(rootDir, presetName, featureName); err != nil {
+			return err
+		}
 
 		logger.Success[string](fmt.Sprintf("feature %s deleted on preset %s", styles.AccentTextStyle(featureName), styles.AccentTextStyle(presetName)))
 
 		return nil
-	},
+	}),
 }
 
 var PresetDeleteCommand *cli.Command = &cli.Command{
 	Name:  "delete",
 	Usage: "deletes a preset",
 	ArgsUsage: `<preset_name>`,
-	Action: func(ctx *cli.Context) error {
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 		
 		if len(args) != 1 {
-			logger.Result[string](fmt.Sprintf("usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage))			
+			return errs.New(errs.InvalidArgument, "usage: %s presets %s", constants.COMMAND, ctx.Command.ArgsUsage)
 		}
 
 		presetName := args[0]
 
-		core.DeletePreset(presetName)
+		if err := core.DeletePreset(rootDir, presetName); err != nil {
+			return err
+		}
 
 		logger.Success[string](fmt.Sprintf("preset %s deleted", styles.AccentTextStyle(presetName)))
 
 		return nil
-	},
+	}),
 }
 
 var PresetCommand *cli.Command = &cli.Command{
@@ -0,0 +1,307 @@
+package commands
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/styles"
+	"github.com/urfave/cli/v2"
+)
+
+// renderStates returns the feature states of --preset with the ones of --set on top.
+func renderStates(rootDir string, ctx *cli.Context) (map[string]string, error) {
+	var states map[string]string = make(map[string]string)
+
+	if presetName := ctx.String("preset"); presetName != "" {
+		presets, err := core.ReadPresets(rootDir)
+
+		if err != nil {
+			return nil, err
+		}
+
+		preset, exists := presets[presetName]
+
+		if !exists {
+			return nil, errs.New(errs.NotFound, "preset %s does not exists", presetName)
+		}
+
+		for featureName, featureState := range preset {
+			states[featureName] = featureState
+		}
+	}
+
+	set, err := core.ParseFeatureStates(ctx.String("set"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for featureName, featureState := range set {
+		states[featureName] = featureState
+	}
+
+	return states, nil
+}
+
+// renderExclude skips the output when it is inside of the repository.
+func renderExclude(rootDir string, out string) (func(path string) bool, error) {
+	absolute, err := filepath.Abs(out)
+
+	if err != nil {
+		return nil, errs.Wrap(err, "invalid output %s", out)
+	}
+
+	relative, err := filepath.Rel(rootDir, absolute)
+
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return nil, nil
+	} else if relative == "." {
+		return nil, errs.New(errs.InvalidArgument, "the output can not be the repository root")
+	}
+
+	relative = filepath.ToSlash(relative)
+
+	return func(path string) bool {
+		return path == relative || strings.HasPrefix(path, relative+"/")
+	}, nil
+}
+
+func writeRenderedFolder(folder string, file core.RenderedFile) error {
+	target := filepath.Join(folder, filepath.FromSlash(file.Path))
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if file.Link != "" {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return os.Symlink(file.Link, target)
+	}
+
+	return os.WriteFile(target, file.Content, file.Mode)
+}
+
+func writeRenderedTar(writer *tar.Writer, file core.RenderedFile) error {
+	header := &tar.Header{
+		Name:    file.Path,
+		Mode:    int64(file.Mode.Perm()),
+		Size:    int64(len(file.Content)),
+		ModTime: time.Now(),
+	}
+
+	if file.Link != "" {
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = file.Link
+		header.Mode = 0777
+	}
+
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(file.Content)
+
+	return err
+}
+
+// renderTar writes the rendered files as a tar and returns how many were written.
+func renderTar(rootDir string, opts core.RenderOptions, output io.Writer) (int, error) {
+	var count int = 0
+
+	writer := tar.NewWriter(output)
+
+	err := core.Render(rootDir, opts, func(file core.RenderedFile) error {
+		count++
+
+		return writeRenderedTar(writer, file)
+	})
+
+	if err != nil {
+		return count, err
+	}
+
+	return count, writer.Close()
+}
+
+// excludeTemp leaves the temporary output of a render out of it, when it is inside of the
+// repository.
+func excludeTemp(rootDir string, opts core.RenderOptions, temp string) (core.RenderOptions, error) {
+	excluded, err := renderExclude(rootDir, temp)
+
+	if err != nil {
+		return opts, err
+	}
+
+	if exclude := opts.Exclude; excluded != nil {
+		opts.Exclude = func(path string) bool {
+			return excluded(path) || (exclude != nil && exclude(path))
+		}
+	}
+
+	return opts, nil
+}
+
+// renderFolder writes the files on a temporary folder next to out and swaps it with out
+// once every file is rendered, a failed render leaves out as it was. The previous files
+// of out are removed, so it holds only the render.
+func renderFolder(rootDir string, opts core.RenderOptions, out string) (int, error) {
+	var count int = 0
+
+	out = filepath.Clean(out)
+
+	if info, err := os.Lstat(out); err == nil && !info.IsDir() {
+		return count, errs.New(errs.InvalidArgument, "the output %s is not a folder", out)
+	} else if err != nil && !os.IsNotExist(err) {
+		return count, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return count, err
+	}
+
+	folder, err := os.MkdirTemp(filepath.Dir(out), ".flag-render-*")
+
+	if err != nil {
+		return count, err
+	}
+
+	defer os.RemoveAll(folder)
+
+	if err := os.Chmod(folder, 0755); err != nil {
+		return count, err
+	}
+
+	if opts, err = excludeTemp(rootDir, opts, folder); err != nil {
+		return count, err
+	}
+
+	err = core.Render(rootDir, opts, func(file core.RenderedFile) error {
+		count++
+
+		return writeRenderedFolder(folder, file)
+	})
+
+	if err != nil {
+		return count, err
+	}
+
+	if _, err := os.Lstat(out); os.IsNotExist(err) {
+		return count, os.Rename(folder, out)
+	}
+
+	// The previous output is moved aside, it is put back when the new one can't take its place
+	previous := folder + "-previous"
+
+	if err := os.Rename(out, previous); err != nil {
+		return count, err
+	}
+
+	if err := os.Rename(folder, out); err != nil {
+		if restoreErr := os.Rename(previous, out); restoreErr != nil {
+			return count, errs.Wrap(err, "the previous output was left on %s", previous)
+		}
+
+		return count, err
+	}
+
+	return count, os.RemoveAll(previous)
+}
+
+// renderTarFile writes the tar on a temporary file renamed to out once it is complete,
+// a failed render leaves nothing behind.
+func renderTarFile(rootDir string, opts core.RenderOptions, out string) (int, error) {
+	tarFile, err := os.CreateTemp(filepath.Dir(out), ".flag-render-*.tar")
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer os.Remove(tarFile.Name())
+	defer tarFile.Close()
+
+	if opts, err = excludeTemp(rootDir, opts, tarFile.Name()); err != nil {
+		return 0, err
+	}
+
+	count, err := renderTar(rootDir, opts, tarFile)
+
+	if err != nil {
+		return count, err
+	}
+
+	if err := tarFile.Close(); err != nil {
+		return count, err
+	}
+
+	return count, os.Rename(tarFile.Name(), out)
+}
+
+var RenderCommand *cli.Command = &cli.Command{
+	Name:  "render",
+	Usage: "writes the repository with a set of features toggled to a folder or tar, without changing it",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "preset", Aliases: []string{"p"}, Usage: "toggles the features of a preset"},
+		&cli.StringFlag{Name: "set", Aliases: []string{"s"}, Usage: "toggles features, like checkout=on,beta=off"},
+		&cli.StringFlag{Name: "out", Aliases: []string{"o"}, Usage: "a folder, a .tar file or - to write a tar to stdout"},
+		&cli.BoolFlag{Name: "strip", Usage: "removes the markers of the blocks and keeps only their active content"},
+		&cli.BoolFlag{Name: "keep-lines", Usage: "like --strip, but replaces the markers with blank lines so line numbers don't change"},
+	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		out := ctx.String("out")
+
+		if out == "" {
+			return errs.New(errs.InvalidArgument, "usage: %s %s --out <folder|file.tar|-> [--preset <preset_name>] [--set <feature=state,...>]", constants.COMMAND, ctx.Command.Name)
+		}
+
+		if err := core.RequireWorkspace(rootDir); err != nil {
+			return err
+		}
+
+		states, err := renderStates(rootDir, ctx)
+
+		if err != nil {
+			return err
+		}
+
+		var opts core.RenderOptions = core.RenderOptions{States: states, Strip: ctx.Bool("strip") || ctx.Bool("keep-lines"), KeepLines: ctx.Bool("keep-lines")}
+
+		if out != "-" {
+			if opts.Exclude, err = renderExclude(rootDir, out); err != nil {
+				return err
+			}
+		}
+
+		var count int = 0
+
+		if out == "-" {
+			// The tar goes to stdout, messages go to stderr
+			logger.SetOutput(os.Stderr)
+
+			count, err = renderTar(rootDir, opts, os.Stdout)
+		} else if strings.HasSuffix(out, ".tar") {
+			count, err = renderTarFile(rootDir, opts, out)
+		} else {
+			count, err = renderFolder(rootDir, opts, out)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		logger.Success[string](fmt.Sprintf("%d files rendered to %s", count, styles.AccentTextStyle(out)))
+
+		return nil
+	}),
+}
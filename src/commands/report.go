@@ -1,7 +1,11 @@
 package commands
 
 import (
+	"os"
+
 	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/output"
+	"github.com/costaluu/flag/types"
 	"github.com/urfave/cli/v2"
 )
 
@@ -11,18 +15,50 @@ var ReportCommand *cli.Command = &cli.Command{
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "versions", Aliases: []string{"c"}},
 		&cli.BoolFlag{Name: "blocks", Aliases: []string{"b"}},
+		outputFlag(),
 	},
-	Action: func(ctx *cli.Context) error {
-		if ctx.Bool("versions") && ctx.Bool("blocks") {
-			core.WorkspaceReport()
-		} else if ctx.Bool("versions") {
-			core.AllVersionFeatureDetails()
-		} else if ctx.Bool("blocks") {
-			core.AllBlocksDetails()
-		} else {
-			core.WorkspaceReport()
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		format, err := outputFormat(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		var versions bool = ctx.Bool("versions") || !ctx.Bool("blocks")
+		var blocks bool = ctx.Bool("blocks") || !ctx.Bool("versions")
+
+		if format == output.Table {
+			if !blocks {
+				return core.AllVersionFeatureDetails(rootDir)
+			} else if !versions {
+				return core.AllBlocksDetails(rootDir)
+			}
+
+			return core.WorkspaceReport(rootDir)
+		}
+
+		var records []types.FeatureRecord = []types.FeatureRecord{}
+
+		if blocks {
+			blockRecords, err := core.AllBlockRecords(rootDir)
+
+			if err != nil {
+				return err
+			}
+
+			records = append(records, blockRecords...)
+		}
+
+		if versions {
+			versionRecords, err := core.AllVersionRecords(rootDir)
+
+			if err != nil {
+				return err
+			}
+
+			records = append(records, versionRecords...)
 		}
 
-		return nil
-	},    
+		return output.Write(os.Stdout, format, records)
+	}),
 }
\ No newline at end of file
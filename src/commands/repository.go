@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/git"
+	"github.com/urfave/cli/v2"
+)
+
+// repositoryAction is the action of a command that works on the repository at rootDir.
+type repositoryAction func(ctx *cli.Context, rootDir string) error
+
+// repositoryRoot returns the root of the repository of the working directory, flag
+// fails outside of one.
+func repositoryRoot() (string, error) {
+	rootDir, err := git.RepositoryRoot()
+
+	if err != nil {
+		return "", errs.Wrap(err, "flag needs a git repository")
+	}
+
+	return rootDir, nil
+}
+
+// inRepository runs the action of a command on the repository of the working directory.
+func inRepository(action repositoryAction) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		rootDir, err := repositoryRoot()
+
+		if err != nil {
+			return err
+		}
+
+		return action(ctx, rootDir)
+	}
+}
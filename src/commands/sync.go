@@ -10,9 +10,14 @@ var SyncCommand *cli.Command = &cli.Command{
 	Usage:     "updates all features on created, modifed, deleted files",
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "all", Usage: "check all files tracked by flag"},
+		&cli.StringFlag{Name: "on-untracked", Usage: "what to do with untracked changes on version bases: save-current, save:<state>, new-feature:<name>, rebase, update-base, restore or fail"},
+		&cli.IntFlag{Name: "jobs", Aliases: []string{"j"}, Usage: "number of files scanned at the same time, 0 uses one per CPU"},
 	},
-	Action: func(ctx *cli.Context) error {
-		core.Sync(ctx.Bool("all"))
-		return nil
-	},
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
+		return core.Sync(rootDir, core.SyncOptions{
+			All: ctx.Bool("all"),
+			OnUntracked: ctx.String("on-untracked"),
+			Jobs: ctx.Int("jobs"),
+		})
+	}),
 }
\ No newline at end of file
@@ -1,46 +1,54 @@
 package commands
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/costaluu/flag/constants"
 	"github.com/costaluu/flag/core"
-	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/errs"
 	"github.com/urfave/cli/v2"
 )
 
 var ToggleCommand *cli.Command = &cli.Command{
 	Name:  "toggle",
-	Usage: "toggles a feature to on, off or dev",
-	ArgsUsage: `<feature_name|preset_name> <on|off|dev>`,
+	Usage: "toggles a feature to on, off, dev or one of its variants",
+	ArgsUsage: `<feature_name|preset_name> <on|off|dev|variant>`,
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "versions", Aliases: []string{"v"}},
 		&cli.BoolFlag{Name: "blocks", Aliases: []string{"b"}},
 		&cli.BoolFlag{Name: "preset", Aliases: []string{"p"}, Usage: "uses a preset instead of a feature"},
 	},
-	Action: func(ctx *cli.Context) error {
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 
+		toggle := func(featureName string, featureState string) error {
+			if ctx.Bool("versions") && ctx.Bool("blocks") {
+				return core.GlobalToggle(rootDir, featureName, featureState)
+			} else if ctx.Bool("versions") {
+				return core.ToggleVersionFeature(rootDir, featureName, featureState)
+			} else if ctx.Bool("blocks") {
+				return core.ToggleBlockFeature(rootDir, featureName,featureState)
+			}
+
+			return core.GlobalToggle(rootDir, featureName, featureState)
+		}
+
 		if ctx.Bool("preset") && len(args) == 1 {
-			presets := core.ReadPresets()
+			presets, err := core.ReadPresets(rootDir)
+
+			if err != nil {
+				return err
+			}
+
 			presetName := args[0]
 			
 			preset, exists := presets[presetName]
 
 			if !exists {
-				logger.Result[string](fmt.Sprintf("preset %s doest not exists", presetName))
+				return errs.New(errs.NotFound, "preset %s doest not exists", presetName)
 			}
 
 			for featureName, featureState := range preset {
-				if ctx.Bool("versions") && ctx.Bool("blocks") {
-					core.GlobalToggle(featureName, featureState)
-				} else if ctx.Bool("versions") {
-					core.ToggleVersionFeature(featureName, featureState)
-				} else if ctx.Bool("blocks") {
-					core.ToggleBlockFeature(featureName,featureState)
-				} else {
-					core.GlobalToggle(featureName, featureState)
+				if err := toggle(featureName, featureState); err != nil {
+					return err
 				}
 			}
 
@@ -48,25 +56,13 @@ var ToggleCommand *cli.Command = &cli.Command{
 		}
 		
 		if len(args) < 2 {
-			logger.Result[string](fmt.Sprintf("usage: %s %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage))			
-		}
-
-		state := strings.ToUpper(args[1])
-
-		if state != constants.STATE_DEV && state != constants.STATE_ON && state != constants.STATE_OFF {
-			logger.Result[string]("invalid state. use on|off|dev")			
+			return errs.New(errs.InvalidArgument, "usage: %s %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
 		}
 
-		if ctx.Bool("versions") && ctx.Bool("blocks") {
-			core.GlobalToggle(args[0], state)
-		} else if ctx.Bool("versions") {
-			core.ToggleVersionFeature(args[0], state)
-		} else if ctx.Bool("blocks") {
-			core.ToggleBlockFeature(args[0],state)
-		} else {
-			core.GlobalToggle(args[0], state)
+		if err := core.CheckFeatureName(rootDir, args[0]); err != nil {
+			return err
 		}
 
-		return nil
-	},
-}
\ No newline at end of file
+		return toggle(args[0], core.NormalizeState(args[1]))
+	}),
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/charmbracelet/huh/spinner"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	"github.com/costaluu/flag/logger"
 	"github.com/urfave/cli/v2"
 )
@@ -21,14 +22,14 @@ import (
 const repoURL = "https://github.com/costaluu/flag/releases/latest/download/%s"
 
 // getBinaryPath gets the path of the currently running binary
-func getBinaryPath() string {
+func getBinaryPath() (string, error) {
 	executable, err := os.Executable()
 	
 	if err != nil {
-		logger.Result[error](err)
+		return "", errs.Wrap(err, "could not find the flag binary")
 	}
 
-	return executable
+	return executable, nil
 }
 
 // downloadLatestRelease downloads the latest binary zip file for the current OS
@@ -233,46 +234,49 @@ var UpdateCommand *cli.Command = &cli.Command{
 		}
 
 		var zipPath string
-		var err error
 
-		binaryPath := getBinaryPath()
+		binaryPath, err := getBinaryPath()
+
+		if err != nil {
+			return err
+		}
 
 		downloadBinaryAction := func () {
 			zipPath, err = downloadLatestRelease(binaryPath)
-
-			if err != nil {
-				logger.Result[error](err)
-			}
 		}
-		defer os.Remove(zipPath)
+		defer func () { os.Remove(zipPath) }()
 
 		extractBinaryAction := func () {
 			// Extract the new binary and prepare for replacement
-			newBinaryPath, err := extractAndPrepareBinary(binaryPath, zipPath)
+			var newBinaryPath string
+
+			newBinaryPath, err = extractAndPrepareBinary(binaryPath, zipPath)
 			
 			if err != nil {
-				logger.Result[error](err)
+				return
 			}
 
 			osType := runtime.GOOS
 
 			if osType == "windows" {
-				err := runPowerShellUpdater(binaryPath, newBinaryPath, filepath.Join(filepath.Dir(binaryPath), "new-flag-version.zip"))
-				
-				if err != nil {
-					logger.Result[error](err)
-				}
+				err = runPowerShellUpdater(binaryPath, newBinaryPath, filepath.Join(filepath.Dir(binaryPath), "new-flag-version.zip"))
 			} else {
-				err := runBashUpdater(binaryPath, newBinaryPath, filepath.Join(filepath.Dir(binaryPath), "new-flag-version.zip"))
-				
-				if err != nil {
-					logger.Result[error](err)
-				}
+				err = runBashUpdater(binaryPath, newBinaryPath, filepath.Join(filepath.Dir(binaryPath), "new-flag-version.zip"))
 			}
 		}
 		
 		_ = spinner.New().Title("downloading the latest version...").Style(lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor))).Action(downloadBinaryAction).Run()
+
+		if err != nil {
+			return err
+		}
+
 		_ = spinner.New().Title("extracting binary...").Style(lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor))).Action(extractBinaryAction).Run()
+
+		if err != nil {
+			return err
+		}
+
 		_ = spinner.New().Title("cleaning up...").Style(lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor))).Action(action).Run()
 
 		logger.Success[string]("binary updated")
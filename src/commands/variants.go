@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/styles"
+	"github.com/urfave/cli/v2"
+)
+
+var VariantsListCommand *cli.Command = &cli.Command{
+	Name:  "list",
+	Usage: "list the values declared for each multivariate feature",
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		return core.ListVariants(rootDir)
+	}),
+}
+
+var VariantsSetCommand *cli.Command = &cli.Command{
+	Name:  "set",
+	Usage: "declares the values of a multivariate feature",
+	ArgsUsage: `<feature_name> <value> [value...]`,
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
+		args := ctx.Args().Slice()
+
+		if len(args) < 2 {
+			return errs.New(errs.InvalidArgument, "usage: %s variants %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
+		}
+
+		if err := core.SetFeatureVariants(rootDir, args[0], args[1:]); err != nil {
+			return err
+		}
+
+		logger.Success[string](fmt.Sprintf("feature %s declared with values %s", styles.AccentTextStyle(args[0]), styles.AccentTextStyle(strings.Join(args[1:], "|"))))
+
+		return nil
+	}),
+}
+
+var VariantsDeleteCommand *cli.Command = &cli.Command{
+	Name:  "delete",
+	Usage: "deletes the values declared for a feature",
+	ArgsUsage: `<feature_name>`,
+	Action: locked(func(ctx *cli.Context, rootDir string) error {
+		args := ctx.Args().Slice()
+
+		if len(args) != 1 {
+			return errs.New(errs.InvalidArgument, "usage: %s variants %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
+		}
+
+		if err := core.DeleteFeatureVariants(rootDir, args[0]); err != nil {
+			return err
+		}
+
+		logger.Success[string](fmt.Sprintf("variants of feature %s deleted", styles.AccentTextStyle(args[0])))
+
+		return nil
+	}),
+}
+
+var VariantsCommand *cli.Command = &cli.Command{
+	Name: "variants",
+	Usage: "operations for multivariate features",
+	Subcommands: []*cli.Command{
+		VariantsListCommand,
+		VariantsSetCommand,
+		VariantsDeleteCommand,
+	},
+}
@@ -2,15 +2,14 @@ package commands
 
 import (
 	"fmt"
-	"path/filepath"
-	"strings"
+	"os"
 
 	"github.com/costaluu/flag/bubbletea/components"
 	"github.com/costaluu/flag/constants"
 	"github.com/costaluu/flag/core"
-	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/errs"
 	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/output"
 	"github.com/costaluu/flag/styles"
 	"github.com/costaluu/flag/utils"
 	"github.com/urfave/cli/v2"
@@ -18,322 +17,319 @@ import (
 
 var VersionsFeaturesToggleCommand *cli.Command = &cli.Command{
 	Name:      "toggle",
-	Usage:     "toggle a feature to on or off",
-	ArgsUsage: `<feature_name|preset_name> <on|off>`,
+	Usage:     "toggle a feature to on, off or one of its variants",
+	ArgsUsage: `<feature_name|preset_name> <on|off|variant> [file]`,
 	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "toggles a feature in a specific file path."},
+		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "toggles a feature in a specific file path, picked when the file is missing."},
 		&cli.BoolFlag{Name: "preset", Aliases: []string{"p"}, Usage: "uses a preset instead of a feature"},
 	},
-	Action: func(ctx *cli.Context) error {
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 
 		if ctx.Bool("preset") && len(args) == 1 {
-			presets := core.ReadPresets()
+			presets, err := core.ReadPresets(rootDir)
+
+			if err != nil {
+				return err
+			}
+
 			presetName := args[0]
 			
 			preset, exists := presets[presetName]
 
 			if !exists {
-				logger.Result[string](fmt.Sprintf("preset %s doest not exists", presetName))
+				return errs.New(errs.NotFound, "preset %s doest not exists", presetName)
 			}
 
 			for featureName, featureState := range preset {
-				core.ToggleVersionFeature(featureName, featureState)
+				if err := core.ToggleVersionFeature(rootDir, featureName, featureState); err != nil {
+					return err
+				}
 			}
 
 			return nil
 		}
 
 		if len(args) < 2 {
-			logger.Result[string](fmt.Sprintf("usage: %s versions %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage))
+			return errs.New(errs.InvalidArgument, "usage: %s versions %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
 		}
 
-		state := strings.ToUpper(args[1])
+		if err := core.CheckFeatureName(rootDir, args[0]); err != nil {
+			return err
+		}
+
+		state := core.NormalizeState(args[1])
 
-		if state != constants.STATE_ON && state != constants.STATE_OFF {
-			logger.Result[string]("invalid state. use on|off")
+		if state == constants.STATE_DEV {
+			return errs.New(errs.InvalidState, "invalid state. use on|off|variant")
 		}
 
-		if ctx.Bool("specific") {
-			versionsSet := core.ListAllVersionsFeature()
+		if err := core.ValidateFeatureState(rootDir, args[0], state); err != nil {
+			return err
+		}
+
+		if !ctx.Bool("specific") {
+			return core.ToggleVersionFeature(rootDir, args[0], state)
+		}
+
+		path, err := fileArgument(rootDir, ctx, 2, func() (string, error) {
+			versionsSet, err := core.ListAllVersionsFeature(rootDir)
+
+			if err != nil {
+				return "", err
+			}
 
 			var items []components.FileListItem = []components.FileListItem{}
 			
 			for path, versionList := range versionsSet {
 				for _, version := range versionList {
-					if version.Name == args[0] {
+					if name, _ := core.SplitFeatureValue(version.Name); name == args[0] {
 						items = append(items, components.FileListItem{ ItemTitle: path, Desc: version.Name })
 						break
 					}
 				}
 			}
 
-			result := utils.PickCustomFiles("Pick a version base", items)
-
-			if result.ItemTitle != "" {
-				hashedPath := utils.HashPath(result.ItemTitle)
-				core.ToggleVersionFeatureOnPath(result.ItemTitle, args[0], state, core.GetVersionFeaturesFromPath(hashedPath))
+			return utils.PickCustomFiles("Pick a version base", items).ItemTitle, nil
+		})
 
-				var stateStyle string
-
-				if state == constants.STATE_ON {
-					stateStyle = styles.GreenTextStyle(state)
-				} else {
-					stateStyle = styles.RedTextStyle(state)
-				}
-
-				logger.Success[string](fmt.Sprintf("feature %s toggled %s", styles.AccentTextStyle(args[0]), stateStyle))
-			} else {
-				logger.Info[string]("please select one option to continue")
-			}
-		} else {
-			core.ToggleVersionFeature(args[0], state)
+		if err != nil {
+			return err
 		}
 
-		return nil
-	},
-}
+		if path == "" {
+			logger.Info[string]("please select one option to continue")
 
-var VersionsFeaturesPromoteCommand *cli.Command = &cli.Command{
-	Name:      "promote",
-	Usage:     "promote a feature or state",
-	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "toggles a feature in a specific file path."},
-	},
-	Action: func(ctx *cli.Context) error {
-		if ctx.Bool("specific") {
-			featureStateListByPath := core.ListAllFeatureStateOptions()
-			var items []components.ListItem = []components.ListItem{}
-			
-			for path, featureStates := range featureStateListByPath {
-				items = append(items, components.ListItem{ ItemTitle: path, ItemDesc: fmt.Sprintf("%d features|states", len(featureStates)) })
-			}
+			return nil
+		}
 
-			selected := components.PickerList("Select a filepath", items)
+		features, err := core.GetVersionFeaturesFromPath(rootDir, utils.HashPath(path))
 
-			if selected.ItemTitle != "" {
-				path := selected.ItemTitle
+		if err != nil {
+			return err
+		}
 
-				selected.ItemTitle = ""
-				selected.ItemDesc = ""
-				selected.ItemValue = ""
+		if err := core.ToggleVersionFeatureOnPath(rootDir, path, args[0], state, features); err != nil {
+			return err
+		}
 
-				featureStateList := core.GetVersionFeaturesStatesFromPath(path)
+		var stateStyle string
 
-				items = []components.ListItem{}
+		if state == constants.STATE_OFF {
+			stateStyle = styles.RedTextStyle(state)
+		} else {
+			stateStyle = styles.GreenTextStyle(state)
+		}
 
-				for _, featureState := range featureStateList {
-					var isFeatureText string = "feature"
+		logger.Success[string](fmt.Sprintf("feature %s toggled %s", styles.AccentTextStyle(args[0]), stateStyle))
 
-					if len(featureState.Names) > 1 {
-						isFeatureText = "state"
-					}
+		return nil
+	}),
+}
 
-					items = append(items, components.ListItem{ 
-						ItemTitle: fmt.Sprintf("%s", strings.Join(featureState.Names, "+")),
-						ItemDesc: isFeatureText,
-						ItemValue: strings.Join(featureState.Names, "@_separator_@"),
-					})
+// pickVersionBase asks for one of the version bases.
+func pickVersionBase(rootDir string) (string, error) {
+	featureStateListByPath, err := core.ListAllFeatureStateOptions(rootDir)
 
-					selected = components.PickerList("Select a feature or state to promote", items)
+	if err != nil {
+		return "", err
+	}
 
-					if selected.ItemTitle != "" {
-						namesToPromote := strings.Split(selected.ItemValue, "@_separator_@")
+	var items []components.ListItem = []components.ListItem{}
+	
+	for path, featureStates := range featureStateListByPath {
+		items = append(items, components.ListItem{ ItemTitle: path, ItemDesc: fmt.Sprintf("%d features|states", len(featureStates)) })
+	}
 
-						var rootDir string = git.GetRepositoryRoot()
-						hashedPath := utils.HashPath(path)
+	return components.PickerList("Select a filepath", items).ItemTitle, nil
+}
 
-						folderToDelete := core.VersionPromoteOnPath(filepath.Join(rootDir, ".features", "versions", hashedPath), path, namesToPromote)
+var VersionsFeaturesPromoteCommand *cli.Command = &cli.Command{
+	Name:      "promote",
+	Usage:     "promote a feature or state",
+	ArgsUsage: `[file]`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "promotes a feature in a specific file path, picked when the file is missing."},
+		&cli.StringFlag{Name: "feature", Aliases: []string{"f"}, Usage: "the feature or state to promote, like checkout or checkout+beta"},
+	},
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
+		if !ctx.Bool("specific") {
+			return core.VersionPromote(rootDir, ctx.String("feature"), true)
+		}
 
-						for _, folderToDelete := range folderToDelete {
-							filesystem.FileDeleteFolder(folderToDelete)
-						}
+		path, err := fileArgument(rootDir, ctx, 0, func() (string, error) {
+			return pickVersionBase(rootDir)
+		})
 
-						var plural string
+		if err != nil {
+			return err
+		}
 
-						if strings.Contains(selected.ItemTitle, "+") {
-							plural = "s"
-						}
+		if path == "" {
+			logger.Info[string]("please select one option to continue")
 
-						logger.Success[string](fmt.Sprintf("feature%s %s %s on %s", plural, styles.AccentTextStyle(selected.ItemTitle), styles.GreenTextStyle("promoted"), styles.AccentTextStyle(path)))
-					} else {
-						logger.Info[string]("please select one option to continue")
-					}
-				}
-			} else {
-				logger.Info[string]("please select one option to continue")
-			}
-		} else {
-			core.VersionPromote(true)
+			return nil
 		}
 
-		return nil
-	},
+		return core.VersionPromoteFile(rootDir, path, ctx.String("feature"), true)
+	}),
 }
 
 var VersionsFeaturesDemoteCommand *cli.Command = &cli.Command{
 	Name:      "demote",
-	Usage:     "demote a feature",
-	ArgsUsage: `<feature_name>`,
+	Usage:     "demote a feature or state",
+	ArgsUsage: `[file]`,
 	Flags: []cli.Flag{
-		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "toggles a feature in a specific file path."},
+		&cli.BoolFlag{Name: "specific", Aliases: []string{"s"}, Usage: "demotes a feature in a specific file path, picked when the file is missing."},
+		&cli.StringFlag{Name: "feature", Aliases: []string{"f"}, Usage: "the feature or state to demote, like checkout or checkout+beta"},
 	},
-	Action: func(ctx *cli.Context) error {
-		if ctx.Bool("specific") {
-			featureStateListByPath := core.ListAllFeatureStateOptions()
-			var items []components.ListItem = []components.ListItem{}
-			
-			for path, featureStates := range featureStateListByPath {
-				items = append(items, components.ListItem{ ItemTitle: path, ItemDesc: fmt.Sprintf("%d features|states", len(featureStates)) })
-			}
-
-			selected := components.PickerList("Select a filepath", items)
-
-			if selected.ItemTitle != "" {
-				path := selected.ItemTitle
-
-				selected.ItemTitle = ""
-				selected.ItemDesc = ""
-				selected.ItemValue = ""
-
-				featureStateList := core.GetVersionFeaturesStatesFromPath(path)
-
-				items = []components.ListItem{}
-
-				for _, featureState := range featureStateList {
-					var isFeatureText string = "feature"
-
-					if len(featureState.Names) > 1 {
-						isFeatureText = "state"
-					}
-
-					items = append(items, components.ListItem{ 
-						ItemTitle: fmt.Sprintf("%s", strings.Join(featureState.Names, "+")),
-						ItemDesc: isFeatureText,
-						ItemValue: strings.Join(featureState.Names, "@_separator_@"),
-					})
-
-					selected = components.PickerList("Select a feature or state to demote", items)
-
-					if selected.ItemTitle != "" {
-						namesToPromote := strings.Split(selected.ItemValue, "@_separator_@")
-
-						var rootDir string = git.GetRepositoryRoot()
-						hashedPath := utils.HashPath(path)
-
-						folderToDelete := core.VersionDemoteOnPath(filepath.Join(rootDir, ".features", "versions", hashedPath), path, namesToPromote)
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
+		if !ctx.Bool("specific") {
+			return core.VersionDemote(rootDir, ctx.String("feature"), true)
+		}
 
-						for _, folderToDelete := range folderToDelete {
-							filesystem.FileDeleteFolder(folderToDelete)
-						}
+		path, err := fileArgument(rootDir, ctx, 0, func() (string, error) {
+			return pickVersionBase(rootDir)
+		})
 
-						var plural string
+		if err != nil {
+			return err
+		}
 
-						if strings.Contains(selected.ItemTitle, "+") {
-							plural = "s"
-						}
+		if path == "" {
+			logger.Info[string]("please select one option to continue")
 
-						logger.Success[string](fmt.Sprintf("feature%s %s %s on %s", plural, styles.AccentTextStyle(selected.ItemTitle), styles.RedTextStyle("demoted"), styles.AccentTextStyle(path)))
-					} else {
-						logger.Info[string]("please select one option to continue")
-					}
-				}
-			} else {
-				logger.Info[string]("please select one option to continue")
-			}
-		} else {
-			core.VersionDemote(true)
+			return nil
 		}
 
-		return nil
-	},
+		return core.VersionDemoteFile(rootDir, path, ctx.String("feature"), true)
+	}),
 }
 
 var VersionsFeaturesBaseCommand *cli.Command = &cli.Command{
 	Name:      "base",
 	Usage:     "create a base for a feature",
+	ArgsUsage: `[file]`,
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "skip-form", Aliases: []string{"sf"}},
 	},
-	Action: func(ctx *cli.Context) error {
-		selectedItem := utils.PickAllFiles("Pick a file to make a base verrsion")
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
+		path, err := fileArgument(rootDir, ctx, 0, func() (string, error) {
+			return utils.PickAllFiles(rootDir, "Pick a file to make a base verrsion").ItemTitle, nil
+		})
 
-		if selectedItem.ItemTitle != "" {
-			core.VersionBase(selectedItem.ItemTitle, ctx.Bool("skip-form"))
+		if err != nil || path == "" {
+			return err
 		}
 
-		return nil
-	},
+		return core.VersionBase(rootDir, path, ctx.Bool("skip-form"))
+	}),
 }
 
 var VersionsFeaturesNewFeatureCommand *cli.Command = &cli.Command{
 	Name:      "new-feature",
 	Usage:     "create a new feature with the current changes of a file",
-	ArgsUsage: `<feature_name>`,
+	ArgsUsage: `<feature_name> [file]`,
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "skip-form", Aliases: []string{"sf"}},
 	},
-	Action: func(ctx *cli.Context) error {
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
 		args := ctx.Args().Slice()
 
 		if len(args) < 1 {
-			logger.Result[string](fmt.Sprintf("usage: %s versions %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage))
+			return errs.New(errs.InvalidArgument, "usage: %s versions %s %s", constants.COMMAND, ctx.Command.Name, ctx.Command.ArgsUsage)
 		}
 
 		if len(args[0]) < constants.MIN_FEATURE_CHARACTERS {
-			logger.Result[string](fmt.Sprintf("a feature name should have at least %d characters", constants.MIN_FEATURE_CHARACTERS))
+			return errs.New(errs.InvalidArgument, "a feature name should have at least %d characters", constants.MIN_FEATURE_CHARACTERS)
 		}
 
-		selectedItem := utils.PickModifedOrUntrackedFiles("Select the base version that the new feature will be created")
+		path, err := fileArgument(rootDir, ctx, 1, func() (string, error) {
+			return utils.PickModifedOrUntrackedFiles(rootDir, "Select the base version that the new feature will be created").ItemTitle, nil
+		})
 
-		if selectedItem.ItemTitle != "" {
-			core.VersionNewFeature(selectedItem.ItemTitle, args[0], ctx.Bool("skip-form"), true)
+		if err != nil || path == "" {
+			return err
 		}
 
-		return nil
-	},
+		return core.VersionNewFeature(rootDir, path, args[0], ctx.Bool("skip-form"), true)
+	}),
 }
 
 var VersionsFeaturesSaveCommand *cli.Command = &cli.Command{
 	Name:      "save",
 	Usage:     "save current changes of a file to a feature or state",
-	Action: func(ctx *cli.Context) error {
-		selectedItem := utils.PickModifedOrUntrackedFiles("Select the base version that the changes will be saved")
+	ArgsUsage: `[file]`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "state", Aliases: []string{"s"}, Usage: "the feature or state to save to, like checkout or checkout+beta"},
+	},
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
+		path, err := fileArgument(rootDir, ctx, 0, func() (string, error) {
+			return utils.PickModifedOrUntrackedFiles(rootDir, "Select the base version that the changes will be saved").ItemTitle, nil
+		})
 
-		if selectedItem.ItemTitle != "" {
-			core.VersionSave(selectedItem.ItemTitle, true)
+		if err != nil || path == "" {
+			return err
 		}
 
-		return nil
-	},
+		return core.VersionSave(rootDir, path, ctx.String("state"), true)
+	}),
 }
 
 var VersionsFeaturesDeleteCommand *cli.Command = &cli.Command{
 	Name:      "delete",
 	Usage:     "delete a feature or state",
-	Action: func(ctx *cli.Context) error {
-		selectedItem := utils.PickModifedOrUntrackedFiles("Select the base version base to delete")
+	ArgsUsage: `[file]`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "feature", Aliases: []string{"f"}, Usage: "the feature to delete"},
+	},
+	Action: journaled(func(ctx *cli.Context, rootDir string) error {
+		path, err := fileArgument(rootDir, ctx, 0, func() (string, error) {
+			return utils.PickModifedOrUntrackedFiles(rootDir, "Select the base version base to delete").ItemTitle, nil
+		})
 
-		if selectedItem.ItemTitle != "" {
-			core.VersionDelete(selectedItem.ItemTitle, true)
+		if err != nil || path == "" {
+			return err
 		}
 
-		return nil
-	},
+		return core.VersionDelete(rootDir, path, ctx.String("feature"), true)
+	}),
 }
 
 var VersionsFeaturesDetailsCommand *cli.Command = &cli.Command{
 	Name:      "details",
 	Usage:     "shows a feature report of a base version",
-	Action: func(ctx *cli.Context) error {
-		selectedItem := utils.PickAllFiles("Pick a file to show details")
+	ArgsUsage: `[file]`,
+	Flags: []cli.Flag{
+		outputFlag(),
+	},
+	Action: inRepository(func(ctx *cli.Context, rootDir string) error {
+		format, err := outputFormat(ctx)
 
-		if selectedItem.ItemTitle != "" {
-			core.VersionFeatureDetailsFromPath(selectedItem.ItemTitle)
+		if err != nil {
+			return err
 		}
 
-		return nil
-	},
+		path, err := fileArgument(rootDir, ctx, 0, func() (string, error) {
+			return utils.PickAllFiles(rootDir, "Pick a file to show details").ItemTitle, nil
+		})
+
+		if err != nil || path == "" {
+			return err
+		}
+
+		if format == output.Table {
+			return core.VersionFeatureDetailsFromPath(rootDir, path)
+		}
+
+		records, err := core.VersionRecordsFromPath(rootDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		return output.Write(os.Stdout, format, records)
+	}),
 }
 
 var VersionsFeaturesCommand *cli.Command = &cli.Command{
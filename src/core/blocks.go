@@ -2,146 +2,298 @@ package core
 
 import (
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	filesystem "github.com/costaluu/flag/fs"
 	"github.com/costaluu/flag/git"
 	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/parser"
 	"github.com/costaluu/flag/styles"
 	"github.com/costaluu/flag/table"
 	"github.com/costaluu/flag/types"
 	"github.com/costaluu/flag/utils"
 )
 
-func findFirstLineMatch(path string, matchContent string) int {
-	splitedMatchConent := strings.Split(matchContent, "\n")
-	data := filesystem.FileRead(path)
-	splitedData := strings.Split(data, "\n")
-	
-	for i := 0; i < len(splitedData); i++ {
-		var found bool = true
+// ParseFile reads a file and builds its block tree using the delimeters of the file.
+func ParseFile(rootDir string, path string) (*parser.Document, error) {
+	data, err := filesystem.FileRead(path)
 
-		for j := 0; j < len(splitedMatchConent) && i + j < len(splitedData); j++ {
-			if strings.TrimSpace(splitedData[i + j]) != strings.TrimSpace(splitedMatchConent[j]) {
-				found = false
-				break;
-			}
+	if err != nil {
+		return nil, err
+	}
+
+	delimeters, err := parserDelimetersFromFile(rootDir, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.ParseWithDelimeters(data, delimeters), nil
+}
+
+func ReportParseErrors(path string, document *parser.Document) {
+	for _, parseError := range document.Errors {
+		logger.Warning[string](fmt.Sprintf("%s:%s", path, parseError.Error()))
+	}
+}
+
+func ExtractMatchDataFromFile(rootDir string, path string) ([]types.Match, error) {
+	document, err := ParseFile(rootDir, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ReportParseErrors(path, document)
+
+	return extractMatchData(path, document), nil
+}
+
+// ExtractMatchDataFromContent parses a content that belongs to path, like the
+// swap content of a block, using the delimeters of path.
+func ExtractMatchDataFromContent(rootDir string, path string, content string) ([]types.Match, error) {
+	delimeters, err := parserDelimetersFromFile(rootDir, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return extractMatchData(path, parser.ParseWithDelimeters(content, delimeters)), nil
+}
+
+func extractMatchData(path string, document *parser.Document) []types.Match {
+	var result []types.Match
+
+	for _, block := range document.AllBlocks() {
+		var contents parser.BlockContents = parser.BlockContents{Variants: []string{}}
+
+		if block.Feature != nil {
+			contents.Feature = block.Feature.Content
+		}
+
+		for _, variant := range block.Variants {
+			contents.Variants = append(contents.Variants, variant.Content)
 		}
 
-		if found {
-			return i + 1
+		if block.Default != nil {
+			contents.Default = block.Default.Content
 		}
+
+		matchContent := document.Content[block.Start.Offset:block.End.Offset]
+
+		result = append(result, matchFromBlock(path, block, matchContent, contents))
 	}
 
-	return -1
+	return result
 }
 
-func ExtractMatchDataFromFile(path string) []types.Match {
-	delimeterStartRegex, delimeterEndRegex := GetDelimetersFromFileParsedRegex(path)
-	delimeterStart, delimeterEnd := GetDelimetersFromFile(path)
+// matchFromBlock builds the match of a block, the block is rendered again with the
+// delimeters of the marker that opens it.
+func matchFromBlock(path string, block *parser.Block, matchContent string, contents parser.BlockContents) types.Match {
+	foundId := block.Id != ""
+	id := block.Id
 
-	data := filesystem.FileRead(path)
+	if !foundId {
+		id = utils.GenerateId(path, block.Name, fmt.Sprintf("%d", block.Start.Line))
+	}
 
-	regexStr := fmt.Sprintf(`%s@(feature|default)\(([^)]{%d,})\)\s*([^\s]+)?\s*%s([\s\S]*?)%s!feature%s`, delimeterStartRegex, constants.MIN_FEATURE_CHARACTERS, delimeterEndRegex, delimeterStartRegex, delimeterEndRegex)
+	featureContent := contents.Feature
+	defaultContent := contents.Default
 
-	featureRegex := regexp.MustCompile(regexStr)
+	var matchType string
+	var variants []types.Variant
 
-	matches := featureRegex.FindAllStringSubmatch(string(data), -1)
+	if block.Form != parser.FormBlock {
+		matchType = lineMatchType(block)
+	} else if block.IsMultivariate() {
+		variants = append(variants, types.Variant{Value: block.Feature.Value, Content: contents.Feature})
 
-	var result []types.Match
+		for i, variant := range block.Variants {
+			variants = append(variants, types.Variant{Value: variant.Value, Content: contents.Variants[i]})
+		}
 
-	for _, match := range matches {
-		matchContent := match[0]
-		feature := match[2]
-		foundId := false
-		var id string
-		var matchType string
-
-		if len(match) == 5 && match[3] != "" {
-			foundId = true
-			id = match[3]
+		if block.Default != nil {
+			matchType = "VARIANTS + DEFAULT"
 		} else {
-			salt := findFirstLineMatch(path, matchContent)
+			matchType = "VARIANTS"
+			defaultContent = ""
+		}
+	} else if block.Feature != nil && block.Default != nil {
+		matchType = "FEATURE + DEFAULT"
+	} else if block.Default != nil {
+		matchType = "DEFAULT"
+		featureContent = ""
+	} else {
+		matchType = "FEATURE"
+		defaultContent = ""
+	}
 
-			if salt == -1 {
-				continue
-			}
+	return types.Match{
+		Id:             id,
+		MatchContent:   matchContent,
+		MatchType:      matchType,
+		Type:           "CODE",
+		FoundId:        foundId,
+		FeatureName:    block.Name,
+		FeatureContent: featureContent,
+		DefaultContent: defaultContent,
+		Variants:       variants,
+		Separator:      block.Separator,
+		DelimeterStart: block.Delimeter.Start,
+		DelimeterEnd:   block.Delimeter.End,
+		Start:          block.Start.Offset,
+		End:            block.End.Offset,
+		Line:           block.Start.Line,
+		Column:         block.Start.Column,
+	}
+}
 
-			id = utils.GenerateId(path, feature, fmt.Sprintf("%d", salt))
-		}
+// lineMatchType returns the match type of an inline or next line block, it tells which
+// content is code on the file.
+func lineMatchType(block *parser.Block) string {
+	form := "INLINE"
+
+	if block.Form == parser.FormNextLine {
+		form = "NEXT"
+	}
 
-		var featureContent string
-		var defaultContent string
+	if block.Visible == block.Feature {
+		return form + " FEATURE"
+	}
 
-		defaultExists := strings.Contains(matchContent, "@default")
-		hasDefault := strings.Contains(match[0], fmt.Sprintf("@default(%s)", feature))
+	return form + " DEFAULT"
+}
 
-		if defaultExists && !hasDefault {
-			// not valid!
-			continue
+// IsLineMatch reports if the match is an inline or next line block.
+func IsLineMatch(match types.Match) bool {
+	return strings.HasPrefix(match.MatchType, "INLINE ") || strings.HasPrefix(match.MatchType, "NEXT ")
+}
+
+// hiddenContentsOf returns the contents of a block that are not visible on the file,
+// the swap content and the content of the variants that are not selected.
+func hiddenContentsOf(block *types.BlockFeature) []*string {
+	var contents []*string = []*string{&block.SwapContent}
+
+	for i := range block.Variants {
+		contents = append(contents, &block.Variants[i].Content)
+	}
+
+	return contents
+}
+
+// RewriteBlocksOnPath renders again every block accepted by render with a single read
+// and a single write of the file. Blocks hidden on the swap content of a block from
+// blockList are rewritten there and the holder is updated on blockList. It returns the
+// ids of the rendered blocks and the ids of the holders that had their swap content changed.
+func RewriteBlocksOnPath(rootDir string, path string, blockList []types.BlockFeature, render func(match types.Match) (string, bool)) (map[string]bool, map[string]bool, error) {
+	document, err := ParseFile(rootDir, filepath.Join(rootDir, path))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ReportParseErrors(path, document)
+
+	content, rendered, holders, err := rewriteDocument(rootDir, path, document, blockList, render)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if content != document.Content {
+		if err := filesystem.FileAtomicWriteContentToFile(filepath.Join(rootDir, path), content); err != nil {
+			return nil, nil, err
 		}
+	}
+
+	return rendered, holders, nil
+}
 
-		if hasDefault {
-			regexStr := fmt.Sprintf(`%s@feature\(%s\)\s*([^\s]+)?\s*%s([\s\S]*?)%s@default\(%s\)\s*([^\s]+)?\s*%s([\s\S]*?)%s!feature%s`, delimeterStartRegex, feature, delimeterEndRegex, delimeterStartRegex, feature, delimeterEndRegex, delimeterStartRegex, delimeterEndRegex)
-			completeRegex := regexp.MustCompile(regexStr)
+// RewriteBlocks is RewriteBlocksOnPath on a content of path, it returns the new content
+// instead of writing it.
+func RewriteBlocks(rootDir string, path string, content string, blockList []types.BlockFeature, render func(match types.Match) (string, bool)) (string, map[string]bool, map[string]bool, error) {
+	delimeters, err := parserDelimetersFromFile(rootDir, path)
 
-			tempMatches := completeRegex.FindStringSubmatch(matchContent)
+	if err != nil {
+		return "", nil, nil, err
+	}
 
-			if tempMatches != nil {
-				matchType = "FEATURE + DEFAULT"
-				featureContent = tempMatches[2]
-				defaultContent = tempMatches[4]
-			} else {
-				regexString := fmt.Sprintf(`%s@default\(%s\)\s*([^\s]+)?%s([\s\S]*?)%s!feature%s`, delimeterStartRegex, feature, delimeterEndRegex, delimeterStartRegex, delimeterEndRegex)
-				onlyDefaultRegex := regexp.MustCompile(regexString)
+	return rewriteDocument(rootDir, path, parser.ParseWithDelimeters(content, delimeters), blockList, render)
+}
 
-				tempMatches := onlyDefaultRegex.FindStringSubmatch(matchContent)
+func rewriteDocument(rootDir string, path string, document *parser.Document, blockList []types.BlockFeature, render func(match types.Match) (string, bool)) (string, map[string]bool, map[string]bool, error) {
+	delimeters, err := parserDelimetersFromFile(rootDir, path)
 
-				if tempMatches == nil {
-					continue
-				}
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var rendered map[string]bool = make(map[string]bool)
+	var holders map[string]bool = make(map[string]bool)
+
+	// A block rendered on the file or on a swap content is not rendered again on another one
+	var rewrite func(document *parser.Document) string
+
+	rewrite = func(document *parser.Document) string {
+		var renderedBefore map[string]bool = make(map[string]bool)
+
+		for id := range rendered {
+			renderedBefore[id] = true
+		}
 
-				featureContent = ""
-				defaultContent = tempMatches[2]
-				matchType = "DEFAULT"
+		return document.Rewrite(func(block *parser.Block, contents parser.BlockContents) (string, bool) {
+			matchContent := document.Content[block.Start.Offset:block.End.Offset]
+			match := matchFromBlock(filepath.Join(rootDir, path), block, matchContent, contents)
+
+			if renderedBefore[match.Id] {
+				return "", false
 			}
-		} else {
-			regexStr := fmt.Sprintf(`%s@feature\(%s\)\s*([^\s]+)?\s*%s([\s\S]*?)%s!feature%s`, delimeterStartRegex, feature, delimeterEndRegex, delimeterStartRegex, delimeterEndRegex)
 
-			onlyFeatureRegex := regexp.MustCompile(regexStr)
+			text, ok := render(match)
 
-			tempMatch := onlyFeatureRegex.FindStringSubmatch(matchContent)
+			if ok {
+				rendered[match.Id] = true
 
-			if tempMatch == nil {
-				continue
+				// The text may bring back blocks that were hidden on a swap content
+				text = rewrite(parser.ParseWithDelimeters(text, delimeters))
 			}
 
-			featureContent = tempMatch[2]
-			defaultContent = ""
-			matchType = "FEATURE"
-		}
-
-		result = append(result, types.Match{
-			Id:             id,
-			MatchContent:   matchContent,
-			MatchType:      matchType,
-			Type:           "CODE",
-			FoundId:        foundId,
-			FeatureName:    feature,
-			FeatureContent: featureContent,
-			DefaultContent: defaultContent,
-			DelimeterStart: delimeterStart,
-			DelimeterEnd:   delimeterEnd,
+			return text, ok
 		})
 	}
 
-	return result
+	content := rewrite(document)
+
+	var changed bool = true
+
+	for changed {
+		changed = false
+
+		for i := range blockList {
+			for _, hiddenContent := range hiddenContentsOf(&blockList[i]) {
+				if *hiddenContent == "" {
+					continue
+				}
+
+				hidden := rewrite(parser.ParseWithDelimeters(*hiddenContent, delimeters))
+
+				if hidden != *hiddenContent {
+					*hiddenContent = hidden
+					holders[blockList[i].Id] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	return content, rendered, holders, nil
 }
 
 func GetFeatureReplaceString(match types.Match, featureId bool) string {
@@ -167,6 +319,14 @@ func GetFeatureReplaceString(match types.Match, featureId bool) string {
 }
 
 func GetFeatureTypeDelimeterString(featureMatch types.Match, insertFeatureId bool) string {
+	if featureMatch.MatchType == "VARIANTS" || featureMatch.MatchType == "VARIANTS + DEFAULT" {
+		return getVariantsDelimeterString(featureMatch, insertFeatureId)
+	}
+
+	if IsLineMatch(featureMatch) {
+		return getLineDelimeterString(featureMatch, insertFeatureId)
+	}
+
 	if featureMatch.MatchType == "FEATURE" {
 		if insertFeatureId {
 			return fmt.Sprintf(`%s@feature(%s) %s%s%s%s!feature%s`, featureMatch.DelimeterStart, featureMatch.FeatureName, featureMatch.Id, featureMatch.DelimeterEnd, featureMatch.FeatureContent, featureMatch.DelimeterStart, featureMatch.DelimeterEnd)
@@ -188,55 +348,80 @@ func GetFeatureTypeDelimeterString(featureMatch types.Match, insertFeatureId boo
 	}
 }
 
-func ReplaceStringInFile(path string, oldString string, newString string) {
-	data := filesystem.FileRead(path)
+func getVariantsDelimeterString(featureMatch types.Match, insertFeatureId bool) string {
+	var id string
 
-	updatedContent := strings.ReplaceAll(data, oldString, newString)
+	if insertFeatureId {
+		id = " " + featureMatch.Id
+	}
 
-	err := os.WriteFile(path, []byte(updatedContent), 0644)
+	var builder strings.Builder
 
-	if err != nil {
-		logger.Fatal[error](err)
+	for i, variant := range featureMatch.Variants {
+		keyword := "@variant"
+
+		if i == 0 {
+			keyword = "@feature"
+		}
+
+		builder.WriteString(fmt.Sprintf(`%s%s(%s=%s)%s%s%s`, featureMatch.DelimeterStart, keyword, featureMatch.FeatureName, variant.Value, id, featureMatch.DelimeterEnd, variant.Content))
+	}
+
+	if featureMatch.MatchType == "VARIANTS + DEFAULT" {
+		builder.WriteString(fmt.Sprintf(`%s@default(%s)%s%s%s`, featureMatch.DelimeterStart, featureMatch.FeatureName, id, featureMatch.DelimeterEnd, featureMatch.DefaultContent))
 	}
-}
 
-func ListAllBlocks() map[string][]types.BlockFeature {
-	var blockSet map[string][]types.BlockFeature = make(map[string][]types.BlockFeature)
+	builder.WriteString(fmt.Sprintf(`%s!feature%s`, featureMatch.DelimeterStart, featureMatch.DelimeterEnd))
 
-	var rootDir string = git.GetRepositoryRoot()
+	return builder.String()
+}
 
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "blocks"), func (path string, d os.DirEntry, err error) error {
-		if err != nil {
-			logger.Fatal[error](err)
-		}
+// getLineDelimeterString renders an inline or next line block, the content that is not
+// code on the file is written on the marker.
+func getLineDelimeterString(featureMatch types.Match, insertFeatureId bool) string {
+	var keyword, code, markerContent string
+
+	switch featureMatch.MatchType {
+	case "INLINE FEATURE":
+		keyword, code, markerContent = "@default", featureMatch.FeatureContent, featureMatch.DefaultContent
+	case "INLINE DEFAULT":
+		keyword, code, markerContent = "@feature", featureMatch.DefaultContent, featureMatch.FeatureContent
+	case "NEXT FEATURE":
+		keyword, code, markerContent = "@feature-next", featureMatch.FeatureContent, featureMatch.DefaultContent
+	default:
+		keyword, code, markerContent = "@default-next", featureMatch.DefaultContent, featureMatch.FeatureContent
+	}
 
-		if d.IsDir() && filepath.Join(rootDir, ".features", "blocks") != path {
-			recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
-			blockSet[recoveredPath] = ListBlocksFromPath(recoveredPath)
-			
-			return fs.SkipDir
-		}
+	var text string = markerContent
 
-		return nil
-	})
+	if insertFeatureId {
+		text = strings.TrimSpace(fmt.Sprintf("%s: %s", featureMatch.Id, markerContent))
+	}
 
-	if err != nil {
-		logger.Fatal[error](err)
+	marker := fmt.Sprintf(`%s%s(%s) %s%s`, featureMatch.DelimeterStart, keyword, featureMatch.FeatureName, text, featureMatch.DelimeterEnd)
+
+	if strings.HasPrefix(featureMatch.MatchType, "INLINE ") {
+		return code + featureMatch.Separator + marker
 	}
 
-	return blockSet
+	return marker + featureMatch.Separator + code
 }
 
-func ListBlocksFromPath(path string) []types.BlockFeature {
-	var rootDir string = git.GetRepositoryRoot()
+func ListAllBlocks(rootDir string) (map[string][]types.BlockFeature, error) {
+	return blocksWithFeature(rootDir, "")
+}
 
-	var features []types.BlockFeature = []types.BlockFeature{}
+func ListBlocksFromPath(rootDir string, path string) ([]types.BlockFeature, error) {
+	return readBlocksFolder(filepath.Join(rootDir, ".features", "blocks", utils.HashPath(path)))
+}
 
-	hashedPath := utils.HashPath(path)
+// readBlocksFolder reads the .block files of a folder of .features/blocks.
+func readBlocksFolder(folder string) ([]types.BlockFeature, error) {
+	var features []types.BlockFeature = []types.BlockFeature{}
 
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "blocks", hashedPath), func(path string, d os.DirEntry, err error) error {
+	err := filepath.WalkDir(folder, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
-			logger.Fatal[error](err)
+			return err
 		}
 
 		if d.IsDir() {
@@ -248,7 +433,9 @@ func ListBlocksFromPath(path string) []types.BlockFeature {
 		if extension == ".block" {
 			var feature types.BlockFeature
 
-			filesystem.FileReadJSONFromFile(path, &feature)
+			if err := filesystem.FileReadJSONFromFile(path, &feature); err != nil {
+				return err
+			}
 
 			features = append(features, feature)
 		}
@@ -256,41 +443,129 @@ func ListBlocksFromPath(path string) []types.BlockFeature {
 		return nil
 	})
 
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return features, nil
+}
+
+// BlockRecords returns a record for each block of path.
+func BlockRecords(rootDir string, path string) ([]types.FeatureRecord, error) {
+	blocks, err := ListBlocksFromPath(rootDir, path)
+
+	if err != nil || len(blocks) == 0 {
+		return []types.FeatureRecord{}, err
+	}
+
+	author, date, err := git.GetLastCommitInfo(rootDir, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []types.FeatureRecord = []types.FeatureRecord{}
+
+	for _, block := range blocks {
+		state := block.State
+
+		if block.Value != "" {
+			state = block.Value
+		}
+
+		records = append(records, types.FeatureRecord{
+			Path:    path,
+			Feature: block.Name,
+			Id:      block.Id,
+			Kind:    "block",
+			Type:    "FEATURE",
+			State:   state,
+			Active:  block.State != constants.STATE_OFF,
+			Author:  author,
+			Date:    date.Format(time.RFC3339),
+		})
+	}
+
+	return records, nil
+}
+
+// AllBlockRecords returns a record for each block of the workspace.
+func AllBlockRecords(rootDir string) ([]types.FeatureRecord, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
+	}
+
+	blocksByPath, err := ListAllBlocks(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string = []string{}
+
+	for path := range blocksByPath {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	var records []types.FeatureRecord = []types.FeatureRecord{}
+
+	for _, path := range paths {
+		pathRecords, err := BlockRecords(rootDir, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, pathRecords...)
+	}
+
+	return records, nil
+}
+
+// tableDate returns the date of a record with the short layout of the tables.
+func tableDate(date string) string {
+	parsed, err := time.Parse(time.RFC3339, date)
+
 	if err != nil {
-		logger.Fatal[error](err)
+		return date
 	}
 
-	return features
+	return parsed.Format(git.TableDateLayout)
 }
 
-func BlockDetails(path string) {
-	blocks := ListBlocksFromPath(path)
+func BlockDetails(rootDir string, path string) error {
+	records, err := BlockRecords(rootDir, path)
+
+	if err != nil {
+		return err
+	}
 	
-	var featureSet map[string]types.BlockFeature = make(map[string]types.BlockFeature)
+	var featureSet map[string]types.FeatureRecord = make(map[string]types.FeatureRecord)
 	
-	for _, block := range blocks {
-		featureSet[block.Name] = block
+	for _, record := range records {
+		featureSet[record.Feature] = record
 	}
 	
 	headers := []string{"NAME", "STATE", "AUTHOR", "DATE"}
 	var data [][]string = [][]string{}
 
-	for _, feature := range featureSet {
-		author, date := git.GetLastCommitInfo(path)
-		data = append(data, []string{feature.Name, feature.State, author, date})
+	for _, record := range featureSet {
+		data = append(data, []string{record.Feature, record.State, record.Author, tableDate(record.Date)})
 	}
 
 	if len(featureSet) > 0 {
 		fmt.Printf("%s\n", styles.AccentTextStyle(path))
 		table.RenderTable(headers, data)
 	}
-}
 
-func AllBlocksDetails() {
-	exists := CheckWorkspaceFolder()
+	return nil
+}
 
-	if !exists {
-		logger.Result[string]("workspace not found, use flag init")
+func AllBlocksDetails(rootDir string) error {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return err
 	}
 	
 	var titleStyle = 
@@ -305,463 +580,696 @@ func AllBlocksDetails() {
 
 	fmt.Printf("\n\n%s\n\n", titleStyle.Render())
 	
-	var rootDir string = git.GetRepositoryRoot()
-
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "blocks"), func (path string, d os.DirEntry, err error) error {
-		if err != nil {
-			logger.Fatal[error](err)
-		}
-
-		if d.IsDir() && filepath.Join(rootDir, ".features", "blocks") != path {
-			recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
-			BlockDetails(recoveredPath)
-
-			return fs.SkipDir
-		}
-
-		return nil
-	})
+	index, err := loadIndex(rootDir)
 
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
-}
 
-func UnSyncAllBlocksFromPath(path string) {
-	var rootDir string = git.GetRepositoryRoot()
-	var hashedPath = utils.HashPath(path)
+	var folders []string = []string{}
 
-	features := ListBlocksFromPath(path)
+	for folder := range index.Blocks {
+		folders = append(folders, folder)
+	}
 
-	for _, feature := range features {
-		feature.Synced = false
+	sort.Strings(folders)
 
-		filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", feature.Id)), feature)
+	for _, folder := range folders {
+		if err := BlockDetails(rootDir, index.Blocks[folder].Path); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
-func RemoveAllUnsyncedBlocksFromPath(path string) {
-	var rootDir string = git.GetRepositoryRoot()
+func RemoveAllUnsyncedBlocksFromPath(rootDir string, path string) error {
 	var hashedPath = utils.HashPath(path)
 
-	features := ListBlocksFromPath(path)
+	features, err := ListBlocksFromPath(rootDir, path)
+
+	if err != nil {
+		return err
+	}
 
 	for _, feature := range features {
 		if feature.Synced == false {
-			filesystem.RemoveFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", feature.Id)))
+			if err := filesystem.RemoveFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", feature.Id))); err != nil {
+				return err
+			}
 		}
 	}
 
-	features = ListBlocksFromPath(path)
+	return removeEmptyBlocksFolder(rootDir, path)
+}
+
+// removeEmptyBlocksFolder deletes the blocks folder of path once it has no blocks left.
+func removeEmptyBlocksFolder(rootDir string, path string) error {
+	features, err := ListBlocksFromPath(rootDir, path)
+
+	if err != nil {
+		return err
+	}
 
 	if len(features) == 0 {
-		filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features", "blocks", hashedPath))
+		return filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features", "blocks", utils.HashPath(path)))
 	}
-}
 
-func ToggleBlockFeature(featureName string, state string) {
-	blocksSet := ListAllBlocks()
+	return nil
+}
 
-	var foundFeature bool = false
+func ToggleBlockFeature(rootDir string, featureName string, state string) error {
+	if err := ValidateFeatureState(rootDir, featureName, state); err != nil {
+		return err
+	}
 
-	for _, blockList := range blocksSet {
-		if foundFeature {
-			break
-		}
+	// Only the files that use the feature are read
+	blocksSet, err := blocksWithFeature(rootDir, featureName)
 
-		for _, block := range blockList {
-			if block.Name == featureName {
-				foundFeature = true
-				
-				break;
-			}
-		}
+	if err != nil {
+		return err
 	}
 
-	if !foundFeature {
+	if len(blocksSet) == 0 {
 		logger.Info[string](fmt.Sprintf("feature %s does not exists on blocks", featureName))
 		
-		return
+		return nil
 	}
 
 	for path, blockList := range blocksSet {
-		ToggleFeatureOnPath(featureName, state, path, blockList)
+		if err := ToggleFeatureOnPath(rootDir, featureName, state, path, blockList); err != nil {
+			return err
+		}
 	}
 
 	var stateStyle string
 
 	if state == constants.STATE_DEV {
 		stateStyle = styles.BlueTextStyle(state)
-	} else if state == constants.STATE_ON {
-		stateStyle = styles.GreenTextStyle(state)
-	} else {
+	} else if state == constants.STATE_OFF {
 		stateStyle = styles.RedTextStyle(state)
+	} else {
+		stateStyle = styles.GreenTextStyle(state)
 	}
 
 	logger.Success[string](fmt.Sprintf("feature %s toggled %s", styles.AccentTextStyle(featureName), stateStyle))
+
+	return nil
+}
+
+// NormalizeState returns ON, OFF or DEV for a binary state argument, any other
+// argument is kept as the value of a variant.
+func NormalizeState(state string) string {
+	upper := strings.ToUpper(state)
+
+	if upper == constants.STATE_ON || upper == constants.STATE_OFF || upper == constants.STATE_DEV {
+		return upper
+	}
+
+	return state
+}
+
+func IsVariantState(state string) bool {
+	return state != constants.STATE_ON && state != constants.STATE_OFF && state != constants.STATE_DEV
 }
 
-func ToggleFeatureOnPath(featureName string, state string, path string, blockList []types.BlockFeature) {
-	var rootDir string = git.GetRepositoryRoot()
-	featuresMatch := ExtractMatchDataFromFile(filepath.Join(rootDir, path))
+// splitState returns the binary state and the selected variant of a toggle state,
+// selecting a variant turns the feature ON.
+func splitState(state string) (string, string) {
+	if IsVariantState(state) {
+		return constants.STATE_ON, state
+	}
+
+	return state, ""
+}
 
+func blockFilePath(rootDir string, path string, id string) string {
+	return filepath.Join(rootDir, ".features", "blocks", utils.HashPath(path), fmt.Sprintf("%s.block", id))
+}
+
+func findBlockById(blockList []types.BlockFeature, id string) int {
+	for i := range blockList {
+		if blockList[i].Id == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// saveBlocks writes the .block files of blockList that are on one of the given id sets
+// and that were not removed.
+func saveBlocks(rootDir string, path string, blockList []types.BlockFeature, idSets ...map[string]bool) error {
 	for _, block := range blockList {
-		if block.State == constants.STATE_DEV {
-			if state == constants.STATE_ON {
-				var foundBlockById *types.Match = nil
-				
-				for _, match := range featuresMatch {
-					if match.Id == block.Id && match.FeatureName == featureName {
-						foundBlockById = &match
-						break;
-					}
+		for _, ids := range idSets {
+			if ids[block.Id] && filesystem.FileExists(blockFilePath(rootDir, path, block.Id)) {
+				if err := filesystem.FileWriteJSONToFile(blockFilePath(rootDir, path, block.Id), block); err != nil {
+					return err
 				}
 
-				if foundBlockById == nil {
-					continue
-				}
+				break
+			}
+		}
+	}
 
-				tempBlock := block
-				tempBlock.State = state
-				tempBlock.SwapContent = foundBlockById.DefaultContent
+	return nil
+}
 
-				newMatch := *foundBlockById
-				newMatch.MatchType = "FEATURE"
+// toggleMatch returns the match rendered for the new state and the block with
+// the content that is not visible anymore on its swap content.
+func toggleMatch(match types.Match, block types.BlockFeature, state string) (types.Match, types.BlockFeature) {
+	newMatch := match
+	newBlock := block
+	newBlock.State = state
+
+	// Both contents of inline and next line blocks stay on the file, DEV keeps the line as it is
+	if IsLineMatch(match) {
+		form := strings.Fields(match.MatchType)[0]
+
+		if state == constants.STATE_ON {
+			newMatch.MatchType = form + " FEATURE"
+		} else if state == constants.STATE_OFF {
+			newMatch.MatchType = form + " DEFAULT"
+		}
 
-				oldString := GetFeatureTypeDelimeterString(*foundBlockById, true)
-				newString := GetFeatureTypeDelimeterString(newMatch, true)
+		return newMatch, newBlock
+	}
 
-				ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+	if block.State == constants.STATE_DEV {
+		if state == constants.STATE_ON {
+			newBlock.SwapContent = match.DefaultContent
+			newMatch.MatchType = "FEATURE"
+		} else {
+			newBlock.SwapContent = match.FeatureContent
+			newMatch.MatchType = "DEFAULT"
+		}
+	} else if block.State == constants.STATE_OFF {
+		newMatch.FeatureContent = block.SwapContent
 
-				hashedPath := utils.HashPath(path)
-				filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", tempBlock.Id)), tempBlock)
-			} else if state == constants.STATE_OFF {
-				var foundBlockById *types.Match = nil
-				
-				for _, match := range featuresMatch {
-					if match.Id == block.Id && match.FeatureName == featureName {
-						foundBlockById = &match
-						break;
-					}
-				}
+		if state == constants.STATE_ON {
+			newBlock.SwapContent = match.DefaultContent
+			newMatch.MatchType = "FEATURE"
+		} else {
+			newBlock.SwapContent = ""
+			newMatch.MatchType = "FEATURE + DEFAULT"
+		}
+	} else {
+		newMatch.DefaultContent = block.SwapContent
 
-				if foundBlockById == nil {
-					continue
-				}
+		if state == constants.STATE_OFF {
+			newBlock.SwapContent = match.FeatureContent
+			newMatch.MatchType = "DEFAULT"
+		} else {
+			newBlock.SwapContent = ""
+			newMatch.MatchType = "FEATURE + DEFAULT"
+		}
+	}
 
-				tempBlock := block
-				tempBlock.State = state
-				tempBlock.SwapContent = foundBlockById.FeatureContent
+	return newMatch, newBlock
+}
 
-				newMatch := *foundBlockById
-				newMatch.MatchType = "DEFAULT"
+// BlockReferencesFeature reports if the header expression of the block uses the feature.
+func BlockReferencesFeature(block types.BlockFeature, featureName string) bool {
+	if len(block.Features) == 0 {
+		return block.Name == featureName
+	}
 
-				oldString := GetFeatureTypeDelimeterString(*foundBlockById, true)
-				newString := GetFeatureTypeDelimeterString(newMatch, true)
+	_, exists := block.Features[featureName]
 
-				ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+	return exists
+}
 
-				hashedPath := utils.HashPath(path)
-				filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", tempBlock.Id)), tempBlock)
-			} else {
-				continue
-			}
-		} else if block.State == constants.STATE_OFF {
-			if state == constants.STATE_ON {
-				var foundBlockById *types.Match = nil
-					
-				for _, match := range featuresMatch {
-					if match.Id == block.Id && match.FeatureName == featureName {
-						foundBlockById = &match
-						break;
-					}
-				}
+// blockFeatureStates returns the state of every feature used by the block expression.
+func blockFeatureStates(block types.BlockFeature) map[string]string {
+	var states map[string]string = make(map[string]string)
 
-				if foundBlockById == nil {
-					continue
-				}
+	if len(block.Features) == 0 {
+		states[block.Name] = block.State
 
-				tempBlock := block
-				tempBlock.State = state
-				tempBlock.SwapContent = foundBlockById.DefaultContent
+		return states
+	}
 
-				newMatch := *foundBlockById
-				newMatch.MatchType = "FEATURE"
-				newMatch.FeatureContent = block.SwapContent
+	for name, state := range block.Features {
+		states[name] = state
+	}
 
-				oldString := GetFeatureTypeDelimeterString(*foundBlockById, true)
-				newString := GetFeatureTypeDelimeterString(newMatch, true)
+	return states
+}
 
-				ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+// NewBlockFeatureStates returns the initial feature states of a block, expressions
+// start with every feature on DEV.
+func NewBlockFeatureStates(expression string) map[string]string {
+	parsed, err := parser.ParseExpression(expression)
 
-				hashedPath := utils.HashPath(path)
-				filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", tempBlock.Id)), tempBlock)
-			} else if state == constants.STATE_OFF {
-				continue
-			} else {
-				var foundBlockById *types.Match = nil
-					
-				for _, match := range featuresMatch {
-					if match.Id == block.Id && match.FeatureName == featureName {
-						foundBlockById = &match
-						break;
-					}
-				}
+	if err != nil {
+		return nil
+	}
 
-				if foundBlockById == nil {
-					continue
-				}
+	if _, ok := parsed.(parser.Identifier); ok {
+		return nil
+	}
 
-				tempBlock := block
-				tempBlock.State = state
-				tempBlock.SwapContent = ""
+	var states map[string]string = make(map[string]string)
 
-				newMatch := *foundBlockById
-				newMatch.MatchType = "FEATURE + DEFAULT"
-				newMatch.FeatureContent = block.SwapContent
+	for _, name := range parser.Features(parsed) {
+		states[name] = constants.STATE_DEV
+	}
 
-				oldString := GetFeatureTypeDelimeterString(*foundBlockById, true)
-				newString := GetFeatureTypeDelimeterString(newMatch, true)
+	return states
+}
+
+// variantContents returns every variant of a multivariate block with its content,
+// visible on the file or hidden on the block, and the default content.
+func variantContents(match types.Match, block types.BlockFeature) ([]types.Variant, string) {
+	var variants []types.Variant = []types.Variant{}
+	var known map[string]bool = make(map[string]bool)
 
-				ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+	for _, variant := range block.Variants {
+		known[variant.Value] = true
 
-				hashedPath := utils.HashPath(path)
-				filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", tempBlock.Id)), tempBlock)
+		for _, visible := range match.Variants {
+			if visible.Value == variant.Value {
+				variant.Content = visible.Content
 			}
-		} else {
-			if state == constants.STATE_ON {
-				continue
-			} else if state == constants.STATE_OFF {
-				var foundBlockById *types.Match = nil
-					
-				for _, match := range featuresMatch {
-					if match.Id == block.Id && match.FeatureName == featureName {
-						foundBlockById = &match
-						break;
-					}
-				}
+		}
 
-				if foundBlockById == nil {
-					continue
-				}
+		variants = append(variants, variant)
+	}
 
-				tempBlock := block
-				tempBlock.State = state
-				tempBlock.SwapContent = foundBlockById.FeatureContent
+	for _, visible := range match.Variants {
+		if !known[visible.Value] {
+			variants = append(variants, visible)
+		}
+	}
 
-				newMatch := *foundBlockById
-				newMatch.MatchType = "DEFAULT"
-				newMatch.DefaultContent = block.SwapContent
+	defaultContent := block.SwapContent
 
-				oldString := GetFeatureTypeDelimeterString(*foundBlockById, true)
-				newString := GetFeatureTypeDelimeterString(newMatch, true)
+	if match.MatchType == "DEFAULT" || match.MatchType == "VARIANTS + DEFAULT" {
+		defaultContent = match.DefaultContent
+	}
 
-				ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+	return variants, defaultContent
+}
 
-				hashedPath := utils.HashPath(path)
-				filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", tempBlock.Id)), tempBlock)
-			} else {
-				var foundBlockById *types.Match = nil
-					
-				for _, match := range featuresMatch {
-					if match.Id == block.Id && match.FeatureName == featureName {
-						foundBlockById = &match
-						break;
-					}
-				}
+// toggleVariantMatch renders a multivariate block with the selected variant, every
+// variant on DEV or only the default content on OFF. The contents that are not
+// visible are kept on the block.
+func toggleVariantMatch(match types.Match, block types.BlockFeature, state string, value string) (types.Match, types.BlockFeature) {
+	variants, defaultContent := variantContents(match, block)
 
-				if foundBlockById == nil {
-					continue
-				}
+	if state == constants.STATE_ON && value == "" && len(variants) > 0 {
+		value = variants[0].Value
+	}
+
+	newMatch := match
+	newMatch.Variants = []types.Variant{}
+	newMatch.DefaultContent = defaultContent
 
-				tempBlock := block
-				tempBlock.State = state
-				tempBlock.SwapContent = ""
+	newBlock := block
+	newBlock.Variants = []types.Variant{}
+	newBlock.SwapContent = ""
+	newBlock.State = state
+	newBlock.Value = ""
+
+	for _, variant := range variants {
+		if state == constants.STATE_DEV || (state == constants.STATE_ON && variant.Value == value) {
+			newMatch.Variants = append(newMatch.Variants, variant)
+			newBlock.Variants = append(newBlock.Variants, types.Variant{Value: variant.Value})
+		} else {
+			newBlock.Variants = append(newBlock.Variants, variant)
+		}
+	}
 
-				newMatch := *foundBlockById
-				newMatch.MatchType = "FEATURE + DEFAULT"
-				newMatch.DefaultContent = block.SwapContent
+	if state == constants.STATE_DEV {
+		newMatch.MatchType = "VARIANTS + DEFAULT"
+	} else if state == constants.STATE_ON && len(newMatch.Variants) > 0 {
+		newMatch.MatchType = "VARIANTS"
+		newBlock.SwapContent = defaultContent
+		newBlock.Value = value
+	} else {
+		// A variant that the block doesn't declare shows the default content
+		newMatch.MatchType = "DEFAULT"
+		newBlock.State = constants.STATE_OFF
+	}
 
-				oldString := GetFeatureTypeDelimeterString(*foundBlockById, true)
-				newString := GetFeatureTypeDelimeterString(newMatch, true)
+	return newMatch, newBlock
+}
 
-				ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+// ToggleFeatureOnPath sets the state of a feature on every block of path that uses it
+// and renders again the blocks whose expression changed its value.
+func ToggleFeatureOnPath(rootDir string, featureName string, state string, path string, blockList []types.BlockFeature) error {
+	render, updated := toggleFeatureRender(featureName, state, blockList)
 
-				hashedPath := utils.HashPath(path)
-				filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", tempBlock.Id)), tempBlock)
-			}
-		}
+	rendered, holders, err := RewriteBlocksOnPath(rootDir, path, blockList, render)
+
+	if err != nil {
+		return err
 	}
+
+	return saveBlocks(rootDir, path, blockList, rendered, holders, updated)
 }
 
-func PromoteBlockFeature(featureName string) {
-	var rootDir string = git.GetRepositoryRoot()
-	blocksSet := ListAllBlocks()
+// toggleFeatureRender returns the render of RewriteBlocks that toggles a feature, the
+// blocks are updated on blockList and the ids of the blocks with new feature states
+// are added to the returned set.
+func toggleFeatureRender(featureName string, state string, blockList []types.BlockFeature) (func(match types.Match) (string, bool), map[string]bool) {
+	var previousBlocks []types.BlockFeature = append([]types.BlockFeature{}, blockList...)
+	var updated map[string]bool = make(map[string]bool)
 
-	var foundFeature bool = false
+	return func(match types.Match) (string, bool) {
+		i := findBlockById(previousBlocks, match.Id)
 
-	for _, blockList := range blocksSet {
-		if foundFeature {
-			break
+		if i == -1 || !BlockReferencesFeature(previousBlocks[i], featureName) {
+			return "", false
 		}
 
-		for _, block := range blockList {
-			if block.Name == featureName {
-				foundFeature = true
-				
-				break;
+		expression, err := parser.ParseExpression(match.FeatureName)
+
+		if err != nil {
+			return "", false
+		}
+
+		// The hidden contents may already hold the inner blocks rendered by this toggle
+		block := previousBlocks[i]
+		block.SwapContent = blockList[i].SwapContent
+		block.Variants = blockList[i].Variants
+
+		state, value := splitState(state)
+
+		if len(block.Variants) > 0 {
+			newMatch, newBlock := toggleVariantMatch(match, block, state, value)
+
+			if newBlock.State == block.State && newBlock.Value == block.Value {
+				return "", false
 			}
+
+			blockList[i] = newBlock
+
+			return GetFeatureTypeDelimeterString(newMatch, true), true
 		}
-	}
 
-	if !foundFeature {
-		logger.Result[string](fmt.Sprintf("feature %s does not exists on blocks"))
-	}
+		states := blockFeatureStates(block)
+		states[featureName] = state
 
-	for path, blockList := range blocksSet {
-		hashedPath := utils.HashPath(path)
-		PromoteBlockFeatureOnPath(path, featureName, blockList)
+		newBlock := block
 
-		blocks := ListBlocksFromPath(path)
+		if len(block.Features) > 0 {
+			newBlock.Features = states
+			updated[block.Id] = true
+		}
 
-		if len(blocks) == 0 {
-			filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features", "blocks", hashedPath))
+		newState := expression.Evaluate(states)
+
+		if newState == block.State {
+			blockList[i] = newBlock
+
+			return "", false
 		}
-	}
-	
-	logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(featureName), styles.GreenTextStyle("promoted")))
+
+		newMatch, newBlock := toggleMatch(match, newBlock, newState)
+		blockList[i] = newBlock
+
+		return GetFeatureTypeDelimeterString(newMatch, true), true
+	}, updated
 }
 
-func PromoteBlockFeatureOnPath(path string, featureName string, blockList []types.BlockFeature) {
-	var rootDir string = git.GetRepositoryRoot()
-	featuresMatch := ExtractMatchDataFromFile(filepath.Join(rootDir, path))
-	hashedPath := utils.HashPath(path)
-		
-	for _, block := range blockList {
-		if block.State == constants.STATE_DEV || block.State == constants.STATE_ON {
-			var foundFeatureById *types.Match = nil
-				
-			for _, match := range featuresMatch {
-				if match.Id == block.Id && match.FeatureName == featureName {
-					foundFeatureById = &match
-					break;
-				}
-			}
+// SyncHiddenBlocks marks as synced the blocks that are not on the file because they
+// live on the hidden contents of a synced block.
+func SyncHiddenBlocks(rootDir string, path string, features []types.BlockFeature) error {
+	var changed bool = true
+
+	for changed {
+		changed = false
 
-			if foundFeatureById == nil {
+		for i := range features {
+			if !features[i].Synced {
 				continue
 			}
 
-			oldString := GetFeatureTypeDelimeterString(*foundFeatureById, true)
-			newString := foundFeatureById.FeatureContent
+			for _, hiddenContent := range hiddenContentsOf(&features[i]) {
+				if *hiddenContent == "" {
+					continue
+				}
 
-			ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
-		} else {
-			var foundFeatureById *types.Match = nil
-				
-			for _, match := range featuresMatch {
-				if match.Id == block.Id && match.FeatureName == featureName {
-					foundFeatureById = &match
-					break;
+				matches, err := ExtractMatchDataFromContent(rootDir, path, *hiddenContent)
+
+				if err != nil {
+					return err
 				}
-			}
 
-			if foundFeatureById == nil {
-				continue
+				for _, match := range matches {
+					for j := range features {
+						if features[j].Id == match.Id && !features[j].Synced {
+							features[j].Synced = true
+							changed = true
+						}
+					}
+				}
 			}
+		}
+	}
+
+	return nil
+}
 
-			oldString := GetFeatureTypeDelimeterString(*foundFeatureById, true)
-			newString := block.SwapContent
+// removeNestedBlocks deletes the .block files of the blocks declared on a content that
+// is being dropped, including the ones on their hidden contents.
+func removeNestedBlocks(rootDir string, path string, content string, blockList []types.BlockFeature) error {
+	matches, err := ExtractMatchDataFromContent(rootDir, path, content)
 
-			ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		i := findBlockById(blockList, match.Id)
+
+		if i != -1 && filesystem.FileExists(blockFilePath(rootDir, path, match.Id)) {
+			if err := filesystem.RemoveFile(blockFilePath(rootDir, path, match.Id)); err != nil {
+				return err
+			}
+
+			for _, hiddenContent := range hiddenContentsOf(&blockList[i]) {
+				if err := removeNestedBlocks(rootDir, path, *hiddenContent, blockList); err != nil {
+					return err
+				}
+			}
 		}
-		
-		filesystem.RemoveFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", block.Id)))
 	}
+
+	return nil
 }
 
-func DemoteBlockFeature(featureName string) {
-	var rootDir string = git.GetRepositoryRoot()
-	blocksSet := ListAllBlocks()
+func PromoteBlockFeature(rootDir string, featureName string) error {
+	// Only the files that use the feature are read
+	blocksSet, err := blocksWithFeature(rootDir, featureName)
 
-	var foundFeature bool = false
+	if err != nil {
+		return err
+	}
 
-	for _, blockList := range blocksSet {
-		if foundFeature {
-			break
-		}
+	if len(blocksSet) == 0 {
+		return errs.New(errs.UnknownFeature, "feature %s does not exists on blocks", featureName)
+	}
 
+	for _, blockList := range blocksSet {
 		for _, block := range blockList {
-			if block.Name == featureName {
-				foundFeature = true
-				
-				break;
+			if block.Name == featureName && len(block.Variants) > 0 && block.Value == "" {
+				return errs.New(errs.InvalidState, "feature %s has variants, select one with %s toggle %s <variant> before promoting", featureName, constants.COMMAND, featureName)
 			}
 		}
 	}
 
-	if !foundFeature {
-		logger.Result[string](fmt.Sprintf("feature %s does not exists"))
+	for path, blockList := range blocksSet {
+		if err := PromoteBlockFeatureOnPath(rootDir, path, featureName, blockList); err != nil {
+			return err
+		}
+
+		if err := removeEmptyBlocksFolder(rootDir, path); err != nil {
+			return err
+		}
 	}
+	
+	logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(featureName), styles.GreenTextStyle("promoted")))
 
-	for path, blockList := range blocksSet {
-		hashedPath := utils.HashPath(path)
-		DemoteBlockFeatureOnPath(path, featureName, blockList)
+	return nil
+}
 
-		blocks := ListBlocksFromPath(path)
+func PromoteBlockFeatureOnPath(rootDir string, path string, featureName string, blockList []types.BlockFeature) error {
+	return resolveBlockFeatureOnPath(rootDir, path, featureName, true, blockList)
+}
 
-		if len(blocks) == 0 {
-			filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features", "blocks", hashedPath))
-		}
+// keepFeatureContent returns the content left by a promoted block and the content it drops.
+func keepFeatureContent(match types.Match, block types.BlockFeature) (string, string) {
+	if IsLineMatch(match) {
+		return match.FeatureContent, match.DefaultContent
 	}
 
-	logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(featureName), styles.RedTextStyle("demoted")))
+	if block.State == constants.STATE_ON {
+		return match.FeatureContent, block.SwapContent
+	} else if block.State == constants.STATE_OFF {
+		return block.SwapContent, match.DefaultContent
+	}
+
+	return match.FeatureContent, match.DefaultContent
 }
 
-func DemoteBlockFeatureOnPath(path string, featureName string, blockList []types.BlockFeature) {
-	var rootDir string = git.GetRepositoryRoot()
-	featuresMatch := ExtractMatchDataFromFile(filepath.Join(rootDir, path))
-	hashedPath := utils.HashPath(path)
+// keepDefaultContent returns the content left by a demoted block and the content it drops.
+func keepDefaultContent(match types.Match, block types.BlockFeature) (string, string) {
+	if IsLineMatch(match) {
+		return match.DefaultContent, match.FeatureContent
+	}
 
-	for _, block := range blockList {
-		if block.State == constants.STATE_DEV || block.State == constants.STATE_OFF {
-			var foundFeatureById *types.Match = nil
-				
-			for _, match := range featuresMatch {
-				if match.Id == block.Id && match.FeatureName == featureName {
-					foundFeatureById = &match
-					break;
-				}
-			}
+	if block.State == constants.STATE_OFF {
+		return match.DefaultContent, block.SwapContent
+	} else if block.State == constants.STATE_ON {
+		return block.SwapContent, match.FeatureContent
+	}
 
-			if foundFeatureById == nil {
-				continue
-			}
+	return match.DefaultContent, match.FeatureContent
+}
 
-			oldString := GetFeatureTypeDelimeterString(*foundFeatureById, true)
-			newString := foundFeatureById.DefaultContent
+// resolveBlockFeatureOnPath promotes (value true) or demotes a feature on path. Blocks
+// whose expression becomes constant are replaced by the content that stays, the others
+// keep their markers with the feature removed from the expression.
+func resolveBlockFeatureOnPath(rootDir string, path string, featureName string, value bool, blockList []types.BlockFeature) error {
+	var droppedContents []string = []string{}
+	var removed map[string]bool = make(map[string]bool)
+	var updated map[string]bool = make(map[string]bool)
 
-			ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
-		} else {
-			var foundFeatureById *types.Match = nil
-				
-			for _, match := range featuresMatch {
-				if match.Id == block.Id && match.FeatureName == featureName {
-					foundFeatureById = &match
-					break;
+	_, holders, err := RewriteBlocksOnPath(rootDir, path, blockList, func(match types.Match) (string, bool) {
+		i := findBlockById(blockList, match.Id)
+
+		if i == -1 || !BlockReferencesFeature(blockList[i], featureName) {
+			return "", false
+		}
+
+		expression, err := parser.ParseExpression(match.FeatureName)
+
+		if err != nil {
+			return "", false
+		}
+
+		block := blockList[i]
+
+		if len(block.Variants) > 0 {
+			variants, defaultContent := variantContents(match, block)
+			kept := defaultContent
+
+			if value {
+				droppedContents = append(droppedContents, defaultContent)
+			}
+
+			for _, variant := range variants {
+				if value && variant.Value == block.Value {
+					kept = variant.Content
+				} else {
+					droppedContents = append(droppedContents, variant.Content)
 				}
 			}
 
-			if foundFeatureById == nil {
-				continue
+			removed[block.Id] = true
+
+			return kept, true
+		}
+
+		simplified := expression.Substitute(featureName, value)
+
+		if constant, ok := parser.ConstantValue(simplified); ok {
+			var kept, dropped string
+
+			if constant {
+				kept, dropped = keepFeatureContent(match, block)
+			} else {
+				kept, dropped = keepDefaultContent(match, block)
 			}
 
-			oldString := GetFeatureTypeDelimeterString(*foundFeatureById, true)
-			newString := block.SwapContent
+			droppedContents = append(droppedContents, dropped)
+			removed[block.Id] = true
+
+			return kept, true
+		}
+
+		states := blockFeatureStates(block)
+		delete(states, featureName)
+
+		newBlock := block
+		newBlock.Name = simplified.String()
+		newBlock.Features = states
+
+		if _, ok := simplified.(parser.Identifier); ok {
+			newBlock.Features = nil
+		}
+
+		newMatch := match
+		newMatch.FeatureName = newBlock.Name
+
+		if newState := simplified.Evaluate(states); newState != block.State {
+			newMatch, newBlock = toggleMatch(newMatch, newBlock, newState)
+		}
+
+		blockList[i] = newBlock
+		updated[block.Id] = true
+
+		return GetFeatureTypeDelimeterString(newMatch, true), true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for id := range holders {
+		updated[id] = true
+	}
+
+	return removeRenderedBlocks(rootDir, path, blockList, removed, updated, droppedContents)
+}
+
+// removeRenderedBlocks deletes the .block files of promoted or demoted blocks and of the
+// blocks declared on the contents they dropped, then saves the blocks that are left.
+func removeRenderedBlocks(rootDir string, path string, blockList []types.BlockFeature, removed map[string]bool, updated map[string]bool, droppedContents []string) error {
+	for id := range removed {
+		if err := filesystem.RemoveFile(blockFilePath(rootDir, path, id)); err != nil {
+			return err
+		}
+	}
+
+	for _, droppedContent := range droppedContents {
+		if err := removeNestedBlocks(rootDir, path, droppedContent, blockList); err != nil {
+			return err
+		}
+	}
+
+	return saveBlocks(rootDir, path, blockList, updated)
+}
 
-			ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+func DemoteBlockFeature(rootDir string, featureName string) error {
+	// Only the files that use the feature are read
+	blocksSet, err := blocksWithFeature(rootDir, featureName)
+
+	if err != nil {
+		return err
+	}
+
+	if len(blocksSet) == 0 {
+		return errs.New(errs.UnknownFeature, "feature %s does not exists", featureName)
+	}
+
+	for path, blockList := range blocksSet {
+		if err := DemoteBlockFeatureOnPath(rootDir, path, featureName, blockList); err != nil {
+			return err
 		}
 
-		filesystem.RemoveFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", block.Id)))
+		if err := removeEmptyBlocksFolder(rootDir, path); err != nil {
+			return err
+		}
 	}
-}
\ No newline at end of file
+
+	logger.Success[string](fmt.Sprintf("feature %s %s", styles.AccentTextStyle(featureName), styles.RedTextStyle("demoted")))
+
+	return nil
+}
+
+func DemoteBlockFeatureOnPath(rootDir string, path string, featureName string, blockList []types.BlockFeature) error {
+	return resolveBlockFeatureOnPath(rootDir, path, featureName, false, blockList)
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type blockStep struct {
+	action  string
+	feature string
+	state   string
+}
+
+// newBlockWorkspace creates a workspace with a synced main.go and returns its root and a
+// replacer from {name} to the id of each block of the file
+func newBlockWorkspace(t *testing.T, content string) (string, *strings.Replacer) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	root := t.TempDir()
+
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v %s", err, out)
+	}
+
+	SetInteractive(false)
+
+	if err := CreateNewWorkspace(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Sync(root, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := ListBlocksFromPath(root, "main.go")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+
+	for _, block := range blocks {
+		ids = append(ids, "{"+block.Name+"}", block.Id)
+	}
+
+	return root, strings.NewReplacer(ids...)
+}
+
+func TestBlockRewrites(t *testing.T) {
+	var nested string = "a\n// @feature(outer) //\nfeat\n// @feature(innerA) //\nia\n// @default(innerA) //\nda\n// !feature //\n// @default(outer) //\ndef\n// @feature(innerB) //\nib\n// @default(innerB) //\ndb\n// !feature //\n// !feature //\nz\n"
+	var expression string = "a\n// @feature(checkout && !legacy) //\nnew\n// @default(checkout && !legacy) //\nold\n// !feature //\nz\n"
+	var variant string = "a\n// @feature(theme=dark) //\ndark\n// @variant(theme=light) //\nlight\n// @default(theme) //\nnone\n// !feature //\nz\n"
+	var inline string = "timeout = 30 // @feature(fastTimeout) timeout = 5 //\n// @feature-next(useCache) return slowPath() //\nreturn cachedPath()\n"
+
+	// Sync gives an id to every marker of the fixtures
+	synced := map[string]string{}
+
+	synced[nested] = "a\n// @feature(outer) {outer} //\nfeat\n// @feature(innerA) {innerA} //\nia\n// @default(innerA) {innerA} //\nda\n// !feature //\n// @default(outer) {outer} //\ndef\n// @feature(innerB) {innerB} //\nib\n// @default(innerB) {innerB} //\ndb\n// !feature //\n// !feature //\nz\n"
+	synced[inline] = "timeout = 30 // @feature(fastTimeout) {fastTimeout}: timeout = 5 //\n// @feature-next(useCache) {useCache}: return slowPath() //\nreturn cachedPath()\n"
+
+	tests := []struct {
+		name     string
+		content  string
+		steps    []blockStep
+		expected string
+		err      string
+	}{
+		{
+			name:     "nested toggle off",
+			content:  nested,
+			steps:    []blockStep{{"toggle", "outer", "off"}},
+			expected: "a\n// @default(outer) {outer} //\ndef\n// @feature(innerB) {innerB} //\nib\n// @default(innerB) {innerB} //\ndb\n// !feature //\n// !feature //\nz\n",
+		},
+		{
+			name:     "nested toggle off and on",
+			content:  nested,
+			steps:    []blockStep{{"toggle", "outer", "off"}, {"toggle", "outer", "on"}},
+			expected: "a\n// @feature(outer) {outer} //\nfeat\n// @feature(innerA) {innerA} //\nia\n// @default(innerA) {innerA} //\nda\n// !feature //\n// !feature //\nz\n",
+		},
+		{
+			name:     "nested promote keeps the inner block of the feature",
+			content:  nested,
+			steps:    []blockStep{{"toggle", "innerA", "on"}, {"promote", "outer", ""}},
+			expected: "a\n\nfeat\n// @feature(innerA) {innerA} //\nia\n// !feature //\n\nz\n",
+		},
+		{
+			name:     "nested promote of a toggled off block",
+			content:  nested,
+			steps:    []blockStep{{"toggle", "outer", "off"}, {"promote", "outer", ""}},
+			expected: "a\n\nfeat\n// @feature(innerA) {innerA} //\nia\n// @default(innerA) {innerA} //\nda\n// !feature //\n\nz\n",
+		},
+		{
+			name:     "nested demote keeps the inner block of the default",
+			content:  nested,
+			steps:    []blockStep{{"demote", "outer", ""}},
+			expected: "a\n\ndef\n// @feature(innerB) {innerB} //\nib\n// @default(innerB) {innerB} //\ndb\n// !feature //\n\nz\n",
+		},
+		{
+			name:     "expression waits for every feature",
+			content:  expression,
+			steps:    []blockStep{{"toggle", "checkout", "on"}},
+			expected: "a\n// @feature(checkout && !legacy) {checkout && !legacy} //\nnew\n// @default(checkout && !legacy) {checkout && !legacy} //\nold\n// !feature //\nz\n",
+		},
+		{
+			name:     "expression toggle",
+			content:  expression,
+			steps:    []blockStep{{"toggle", "checkout", "on"}, {"toggle", "legacy", "off"}},
+			expected: "a\n// @feature(checkout && !legacy) {checkout && !legacy} //\nnew\n// !feature //\nz\n",
+		},
+		{
+			name:     "expression promote decides the block",
+			content:  expression,
+			steps:    []blockStep{{"promote", "legacy", ""}},
+			expected: "a\n\nold\n\nz\n",
+		},
+		{
+			name:     "expression demote simplifies the header",
+			content:  expression,
+			steps:    []blockStep{{"demote", "legacy", ""}},
+			expected: "a\n// @feature(checkout) {checkout && !legacy} //\nnew\n// @default(checkout) {checkout && !legacy} //\nold\n// !feature //\nz\n",
+		},
+		{
+			name:     "expression promote simplifies the header",
+			content:  expression,
+			steps:    []blockStep{{"promote", "checkout", ""}},
+			expected: "a\n// @feature(!legacy) {checkout && !legacy} //\nnew\n// @default(!legacy) {checkout && !legacy} //\nold\n// !feature //\nz\n",
+		},
+		{
+			name:     "variant toggle",
+			content:  variant,
+			steps:    []blockStep{{"toggle", "theme", "light"}},
+			expected: "a\n// @feature(theme=light) {theme} //\nlight\n// !feature //\nz\n",
+		},
+		{
+			name:     "variant toggle back to dev",
+			content:  variant,
+			steps:    []blockStep{{"toggle", "theme", "light"}, {"toggle", "theme", "dev"}},
+			expected: "a\n// @feature(theme=dark) {theme} //\ndark\n// @variant(theme=light) {theme} //\nlight\n// @default(theme) {theme} //\nnone\n// !feature //\nz\n",
+		},
+		{
+			name:     "variant toggle to an undeclared value",
+			content:  variant,
+			steps:    []blockStep{{"toggle", "theme", "blue"}},
+			expected: "a\n// @feature(theme=dark) {theme} //\ndark\n// @variant(theme=light) {theme} //\nlight\n// @default(theme) {theme} //\nnone\n// !feature //\nz\n",
+			err:      "feature theme has no variant blue. use dark|light",
+		},
+		{
+			name:     "variant promote",
+			content:  variant,
+			steps:    []blockStep{{"toggle", "theme", "dark"}, {"promote", "theme", ""}},
+			expected: "a\n\ndark\n\nz\n",
+		},
+		{
+			name:     "variant promote without a variant",
+			content:  variant,
+			steps:    []blockStep{{"promote", "theme", ""}},
+			expected: "a\n// @feature(theme=dark) {theme} //\ndark\n// @variant(theme=light) {theme} //\nlight\n// @default(theme) {theme} //\nnone\n// !feature //\nz\n",
+			err:      "feature theme has variants, select one with flag toggle theme <variant> before promoting",
+		},
+		{
+			name:     "variant demote",
+			content:  variant,
+			steps:    []blockStep{{"demote", "theme", ""}},
+			expected: "a\n\nnone\n\nz\n",
+		},
+		{
+			name:     "inline toggle",
+			content:  inline,
+			steps:    []blockStep{{"toggle", "fastTimeout", "on"}, {"toggle", "useCache", "off"}},
+			expected: "timeout = 5 // @default(fastTimeout) {fastTimeout}: timeout = 30 //\n// @default-next(useCache) {useCache}: return cachedPath() //\nreturn slowPath()\n",
+		},
+		{
+			name:     "inline toggle on and off",
+			content:  inline,
+			steps:    []blockStep{{"toggle", "fastTimeout", "on"}, {"toggle", "fastTimeout", "off"}},
+			expected: synced[inline],
+		},
+		{
+			name:     "inline promote",
+			content:  inline,
+			steps:    []blockStep{{"promote", "fastTimeout", ""}, {"promote", "useCache", ""}},
+			expected: "timeout = 5\nreturn cachedPath()\n",
+		},
+		{
+			name:     "inline demote",
+			content:  inline,
+			steps:    []blockStep{{"demote", "fastTimeout", ""}, {"demote", "useCache", ""}},
+			expected: "timeout = 30\nreturn slowPath()\n",
+		},
+		{
+			name:     "inline demote of a toggled block",
+			content:  inline,
+			steps:    []blockStep{{"toggle", "fastTimeout", "on"}, {"demote", "fastTimeout", ""}},
+			expected: "timeout = 30\n// @feature-next(useCache) {useCache}: return slowPath() //\nreturn cachedPath()\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, ids := newBlockWorkspace(t, test.content)
+
+			if expected, ok := synced[test.content]; ok {
+				if content, _ := os.ReadFile(filepath.Join(root, "main.go")); string(content) != ids.Replace(expected) {
+					t.Fatalf("expected synced content %q, got %q", ids.Replace(expected), content)
+				}
+			}
+
+			var err error
+
+			for _, step := range test.steps {
+				switch step.action {
+				case "toggle":
+					err = ToggleBlockFeature(root, step.feature, NormalizeState(step.state))
+				case "promote":
+					err = PromoteBlockFeature(root, step.feature)
+				case "demote":
+					err = DemoteBlockFeature(root, step.feature)
+				}
+
+				if err != nil {
+					break
+				}
+			}
+
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(root, "main.go"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(content) != ids.Replace(test.expected) {
+				t.Errorf("expected %q, got %q", ids.Replace(test.expected), content)
+			}
+		})
+	}
+}
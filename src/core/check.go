@@ -0,0 +1,494 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/styles"
+	"github.com/costaluu/flag/table"
+	"github.com/costaluu/flag/types"
+	"github.com/costaluu/flag/workingtree"
+)
+
+// Checks reported by flag check.
+const (
+	CheckParseError      = "parse-error"
+	CheckMissingId       = "missing-id"
+	CheckUnsyncedBlock   = "unsynced-block"
+	CheckOrphanBlock     = "orphan-block"
+	CheckBlockState      = "block-state"
+	CheckMissingPath     = "missing-path"
+	CheckMissingSnapshot = "missing-snapshot"
+	CheckUnsavedChanges  = "unsaved-changes"
+	CheckUnknownFeature  = "unknown-feature"
+	CheckInterrupted     = "interrupted-operation"
+	CheckMissingFile     = "missing-workspace-file"
+)
+
+// checker collects the problems found by CheckRecords.
+type checker struct {
+	rootDir  string
+	problems []types.ProblemRecord
+}
+
+func (c *checker) report(path string, check string, format string, args ...any) {
+	c.problems = append(c.problems, types.ProblemRecord{Path: path, Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// trackedPath reads the _path of a workspace folder, it reports the folder when _path is
+// missing or points at a file that does not exist.
+func (c *checker) trackedPath(folder string) (string, bool) {
+	relativeFolder, _ := filepath.Rel(c.rootDir, folder)
+	relativeFolder = filepath.ToSlash(relativeFolder)
+
+	if !filesystem.FileExists(filepath.Join(folder, "_path")) {
+		c.report(relativeFolder, CheckMissingPath, "_path is missing, run %s doctor --fix", constants.COMMAND)
+
+		return "", false
+	}
+
+	path, err := filesystem.FileRead(filepath.Join(folder, "_path"))
+
+	if err != nil {
+		c.report(relativeFolder, CheckMissingPath, "can not read _path: %s", err.Error())
+
+		return "", false
+	}
+
+	if !filesystem.FileExists(filepath.Join(c.rootDir, path)) {
+		c.report(path, CheckMissingPath, "%s points at a file that does not exist, run %s sync --all", relativeFolder, constants.COMMAND)
+
+		return path, false
+	}
+
+	return path, true
+}
+
+// workspaceFolders returns the folders of .features/<kind>, one for each tracked file.
+func (c *checker) workspaceFolders(kind string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(c.rootDir, ".features", kind))
+
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var folders []string = []string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			folders = append(folders, filepath.Join(c.rootDir, ".features", kind, entry.Name()))
+		}
+	}
+
+	return folders, nil
+}
+
+// parse parses a file of the repository, parse errors are reported.
+func (c *checker) parse(path string) ([]types.Match, bool, error) {
+	document, err := ParseFile(c.rootDir, filepath.Join(c.rootDir, path))
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, parseError := range document.Errors {
+		c.report(path, CheckParseError, "%s", strings.TrimSpace(parseError.Error()))
+	}
+
+	return extractMatchData(path, document), len(document.Errors) == 0, nil
+}
+
+// expectedMatchTypes returns the match types a block on state shows on the file, nil
+// when any is fine. A block on DEV keeps the contents it had when it was synced.
+func expectedMatchTypes(match types.Match, block types.BlockFeature) []string {
+	var state, _ = splitState(block.State)
+
+	if state == constants.STATE_DEV {
+		return nil
+	}
+
+	if IsLineMatch(match) {
+		form, _, _ := strings.Cut(match.MatchType, " ")
+
+		if state == constants.STATE_OFF {
+			return []string{form + " DEFAULT"}
+		}
+
+		return []string{form + " FEATURE"}
+	}
+
+	if state == constants.STATE_OFF {
+		return []string{"DEFAULT"}
+	}
+
+	return []string{"FEATURE", "VARIANTS"}
+}
+
+// checkBlocks compares the blocks of a file with its .block files.
+func (c *checker) checkBlocks(path string, blockList []types.BlockFeature) error {
+	matches, parsed, err := c.parse(path)
+
+	if err != nil || !parsed {
+		return err
+	}
+
+	var reachable map[string]bool = make(map[string]bool)
+	var pending []string = []string{}
+
+	for _, match := range matches {
+		if !match.FoundId {
+			c.report(path, CheckMissingId, "line %d: block %s has no id, run %s sync", match.Line, match.FeatureName, constants.COMMAND)
+
+			continue
+		}
+
+		i := findBlockById(blockList, match.Id)
+
+		if i == -1 {
+			c.report(path, CheckUnsyncedBlock, "line %d: block %s (%s) has no .block file, run %s sync", match.Line, match.FeatureName, match.Id, constants.COMMAND)
+
+			continue
+		}
+
+		reachable[match.Id] = true
+		pending = append(pending, match.Id)
+
+		if expected := expectedMatchTypes(match, blockList[i]); expected != nil && !slices.Contains(expected, match.MatchType) {
+			c.report(path, CheckBlockState, "line %d: block %s (%s) is %s but the file shows %s", match.Line, match.FeatureName, match.Id, blockList[i].State, strings.ToLower(match.MatchType))
+		}
+	}
+
+	// Blocks hidden on the contents of a reachable block are reachable too
+	for len(pending) > 0 {
+		i := findBlockById(blockList, pending[0])
+		pending = pending[1:]
+
+		for _, hiddenContent := range hiddenContentsOf(&blockList[i]) {
+			if *hiddenContent == "" {
+				continue
+			}
+
+			hiddenMatches, err := ExtractMatchDataFromContent(c.rootDir, path, *hiddenContent)
+
+			if err != nil {
+				return err
+			}
+
+			for _, match := range hiddenMatches {
+				if !reachable[match.Id] && findBlockById(blockList, match.Id) != -1 {
+					reachable[match.Id] = true
+					pending = append(pending, match.Id)
+				}
+			}
+		}
+	}
+
+	for _, block := range blockList {
+		if !reachable[block.Id] {
+			c.report(path, CheckOrphanBlock, "block %s (%s) is not on the file anymore, run %s sync", block.Name, block.Id, constants.COMMAND)
+		}
+	}
+
+	return nil
+}
+
+// checkUntrackedFiles reports the blocks of files without a blocks folder.
+func (c *checker) checkUntrackedFiles(tracked map[string]bool) error {
+	files, err := git.ListFiles(c.rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if tracked[path] {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(c.rootDir, path))
+
+		if err != nil || !(strings.Contains(string(data), "@feature") || strings.Contains(string(data), "@default")) {
+			continue
+		}
+
+		matches, _, err := c.parse(path)
+
+		if err != nil {
+			return err
+		}
+
+		for _, match := range matches {
+			if !match.FoundId {
+				c.report(path, CheckMissingId, "line %d: block %s has no id, run %s sync", match.Line, match.FeatureName, constants.COMMAND)
+			} else {
+				c.report(path, CheckUnsyncedBlock, "line %d: block %s (%s) has no .block file, run %s sync", match.Line, match.FeatureName, match.Id, constants.COMMAND)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkVersion checks the saved files of a version base and compares the file with
+// the state of its features.
+func (c *checker) checkVersion(folder string, path string) error {
+	baseExists := filesystem.FileExists(filepath.Join(folder, "base"))
+
+	if !baseExists {
+		c.report(path, CheckMissingSnapshot, "the base of the file is missing")
+	}
+
+	tree, err := workingtree.LoadWorkingTree(folder)
+
+	if errs.KindOf(err) == errs.NotFound {
+		c.report(path, CheckMissingSnapshot, "%s is missing, run %s doctor --fix", constants.WorkingTreeFile, constants.COMMAND)
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	features, err := GetVersionFeaturesFromPath(c.rootDir, filepath.Base(folder))
+
+	if err != nil {
+		return err
+	}
+
+	var featureNames map[string]string = make(map[string]string)
+
+	for _, feature := range features {
+		featureNames[feature.Id] = feature.Name
+	}
+
+	var keys []string = []string{}
+
+	for key := range tree {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if filesystem.FileExists(filepath.Join(folder, constants.WorkingTreeDirectory, tree[key].SavedCheckSum)) {
+			continue
+		}
+
+		var names []string = []string{}
+
+		for _, featureId := range workingtree.StringToStringSlice(key) {
+			if name, exists := featureNames[featureId]; exists {
+				names = append(names, name)
+			} else {
+				names = append(names, featureId)
+			}
+		}
+
+		c.report(path, CheckMissingSnapshot, "the saved file of state %s is missing, run %s doctor --fix", strings.Join(names, "+"), constants.COMMAND)
+	}
+
+	var featureIdsTurnedOn []string = []string{}
+
+	for _, feature := range features {
+		if feature.State == constants.STATE_ON {
+			featureIdsTurnedOn = append(featureIdsTurnedOn, feature.Id)
+		}
+	}
+
+	currentCheckSum, err := filesystem.FileGenerateCheckSum(filepath.Join(c.rootDir, path))
+
+	if err != nil {
+		return err
+	}
+
+	if len(featureIdsTurnedOn) == 0 {
+		if !baseExists {
+			return nil
+		}
+
+		baseCheckSum, err := filesystem.FileGenerateCheckSum(filepath.Join(folder, "base"))
+
+		if err != nil {
+			return err
+		}
+
+		if baseCheckSum != currentCheckSum {
+			c.report(path, CheckUnsavedChanges, "the file has changes that are not saved on the base, run %s sync", constants.COMMAND)
+		}
+
+		return nil
+	}
+
+	value, exists := tree[workingtree.NormalizeFeatures(featureIdsTurnedOn)]
+
+	if !exists {
+		c.report(path, CheckMissingSnapshot, "the current state has no saved file, run %s sync", constants.COMMAND)
+	} else if value.FileCheckSum != currentCheckSum {
+		c.report(path, CheckUnsavedChanges, "the file has changes that are not saved on the current state, run %s sync", constants.COMMAND)
+	}
+
+	return nil
+}
+
+// checkPresets reports presets with features that are not known.
+func (c *checker) checkPresets() error {
+	presets, err := ReadPresets(c.rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	var presetNames []string = []string{}
+
+	for presetName := range presets {
+		presetNames = append(presetNames, presetName)
+	}
+
+	sort.Strings(presetNames)
+
+	for _, presetName := range presetNames {
+		var featureNames []string = []string{}
+
+		for featureName := range presets[presetName] {
+			featureNames = append(featureNames, featureName)
+		}
+
+		sort.Strings(featureNames)
+
+		for _, featureName := range featureNames {
+			err := CheckFeatureName(c.rootDir, featureName)
+
+			if errs.KindOf(err) == errs.UnknownFeature {
+				c.report(".features/presets", CheckUnknownFeature, "preset %s: %s", presetName, err.Error())
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckRecords verifies that the workspace agrees with the files of the repository and
+// returns the problems found, nothing is written.
+func CheckRecords(rootDir string) ([]types.ProblemRecord, error) {
+	exists, missing, err := probeWorkspace(rootDir)
+
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, errs.ErrWorkspaceNotFound
+	}
+
+	c := &checker{rootDir: rootDir, problems: []types.ProblemRecord{}}
+
+	operation, interrupted, err := interruptedOperation(rootDir)
+
+	if err != nil {
+		return nil, err
+	} else if interrupted {
+		c.report(".features/journal", CheckInterrupted, "%s was interrupted, %s doctor --fix or the next command that changes files rolls it back", operation, constants.COMMAND)
+	}
+
+	for _, part := range missing {
+		c.report(".features/"+part.name, CheckMissingFile, "%s is missing from the workspace, run %s sync", part.name, constants.COMMAND)
+	}
+
+	// Files can't be parsed without their delimeters
+	if hasCheck(c.problems, CheckMissingFile) && !filesystem.FileExists(filepath.Join(rootDir, ".features", "delimeters")) {
+		return c.problems, nil
+	}
+
+	blockFolders, err := c.workspaceFolders("blocks")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tracked map[string]bool = make(map[string]bool)
+
+	for _, folder := range blockFolders {
+		path, exists := c.trackedPath(folder)
+
+		if path != "" {
+			tracked[path] = true
+		}
+
+		if !exists {
+			continue
+		}
+
+		blockList, err := ListBlocksFromPath(rootDir, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.checkBlocks(path, blockList); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.checkUntrackedFiles(tracked); err != nil {
+		return nil, err
+	}
+
+	versionFolders, err := c.workspaceFolders("versions")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, folder := range versionFolders {
+		path, exists := c.trackedPath(folder)
+
+		if !exists {
+			continue
+		}
+
+		if err := c.checkVersion(folder, path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The names of the features come from every tracked file, they can't be listed
+	// when a folder is broken
+	if !hasCheck(c.problems, CheckMissingPath) {
+		if err := c.checkPresets(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.problems, nil
+}
+
+func hasCheck(problems []types.ProblemRecord, check string) bool {
+	for _, problem := range problems {
+		if problem.Check == check {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckReport renders the problems found by CheckRecords.
+func CheckReport(problems []types.ProblemRecord) {
+	var headers []string = []string{"PATH", "CHECK", "MESSAGE"}
+	var data [][]string = [][]string{}
+
+	for _, problem := range problems {
+		data = append(data, []string{problem.Path, styles.RedTextStyle(problem.Check), problem.Message})
+	}
+
+	table.RenderTable(headers, data)
+}
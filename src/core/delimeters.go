@@ -1,119 +1,344 @@
 package core
 
 import (
-	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/git"
-	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/parser"
 	"github.com/costaluu/flag/table"
 	"github.com/costaluu/flag/types"
 )
 
-func ReadDelimeters() types.Delimeters {
-	workspaceExists := CheckWorkspaceFolder()
+// cachedDelimeters is the content of a delimeters file with the state it was read at.
+type cachedDelimeters struct {
+	modTime    time.Time
+	size       int64
+	delimeters types.Delimeters
+}
+
+var delimetersMutex sync.Mutex = sync.Mutex{}
+
+// delimetersCache keeps the .features/delimeters of each workspace by path while it
+// doesn't change, sync looks up the delimeters of every file it scans.
+var delimetersCache map[string]cachedDelimeters = make(map[string]cachedDelimeters)
 
-	if !workspaceExists {
-		logger.Result[string]("folder .features doesn't exists, please use switch init")
+func ReadDelimeters(rootDir string) (types.Delimeters, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
 	}
 
-	var rootDir string = git.GetRepositoryRoot()
+	var path string = filepath.Join(rootDir, ".features", "delimeters")
+
+	info, err := os.Stat(path)
+
+	if os.IsNotExist(err) {
+		return nil, errs.New(errs.Inconsistent, "the workspace has no delimeters file, run %s sync to write the default one", constants.COMMAND)
+	} else if err != nil {
+		return nil, errs.Wrap(err, "could not read delimeters")
+	}
 
-	var delimeters types.Delimeters
+	delimetersMutex.Lock()
+	defer delimetersMutex.Unlock()
+
+	cached, exists := delimetersCache[path]
+
+	if !exists || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() {
+		var delimeters types.Delimeters
+
+		if err := filesystem.FileReadJSONFromFile(path, &delimeters); err != nil {
+			return nil, errs.Wrap(err, "could not read delimeters")
+		}
+
+		cached = cachedDelimeters{modTime: info.ModTime(), size: info.Size(), delimeters: delimeters}
+		delimetersCache[path] = cached
+	}
 
-	filesystem.FileReadJSONFromFile(filepath.Join(rootDir, ".features", "delimeters"), &delimeters)
+	// Callers change the map they get
+	var delimeters types.Delimeters = make(types.Delimeters)
 
-	return delimeters
+	for rule, list := range cached.delimeters {
+		delimeters[rule] = append(types.DelimeterList{}, list...)
+	}
+
+	return delimeters, nil
 }
 
-func SetDelimeter(extension string, start string, end string) {
-	delimeters := ReadDelimeters()
+// SetDelimeter adds a delimeter pair to a rule, replace drops the pairs it had before.
+func SetDelimeter(rootDir string, rule string, start string, end string, replace bool) error {
+	if err := ValidateDelimeterRule(rule); err != nil {
+		return err
+	}
+
+	delimeters, err := ReadDelimeters(rootDir)
+
+	if err != nil {
+		return err
+	}
 
-	delimeters[extension] = types.Delimeter{
+	delimeter := types.Delimeter{
 		Start: strings.TrimSpace(start) + " ",
 		End: " " + strings.TrimSpace(end),
 	}
 
-	var rootDir string = git.GetRepositoryRoot()
+	if replace {
+		delimeters[rule] = types.DelimeterList{}
+	}
+
+	for _, existing := range delimeters[rule] {
+		if existing == delimeter {
+			return errs.New(errs.AlreadyExists, "delimeter %s%s already exists for %s", delimeter.Start, delimeter.End, rule)
+		}
+	}
+
+	delimeters[rule] = append(delimeters[rule], delimeter)
 
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "delimeters"), delimeters)
+	return writeDelimeters(rootDir, delimeters)
 }
 
-func DeleteDelimeter(extension string) {
-	delimeters := ReadDelimeters()
+// DeleteDelimeter deletes the pair that starts with start from a rule, or all of
+// its pairs when start is empty.
+func DeleteDelimeter(rootDir string, rule string, start string) error {
+	delimeters, err := ReadDelimeters(rootDir)
 
-	_, exists := delimeters[extension]
+	if err != nil {
+		return err
+	}
+
+	list, exists := delimeters[rule]
 
 	if !exists {
-		logger.Result[string](fmt.Sprintf("Delimeter %s doesn't exists", extension))
+		return errs.New(errs.NotFound, "Delimeter %s doesn't exists", rule)
 	}
 
-	delete(delimeters, extension)
+	if start == "" {
+		delete(delimeters, rule)
+	} else {
+		var kept types.DelimeterList = types.DelimeterList{}
+
+		for _, delimeter := range list {
+			if strings.TrimSpace(delimeter.Start) != strings.TrimSpace(start) {
+				kept = append(kept, delimeter)
+			}
+		}
+
+		if len(kept) == len(list) {
+			return errs.New(errs.NotFound, "Delimeter %s doesn't exists for %s", strings.TrimSpace(start), rule)
+		}
+
+		if len(kept) == 0 {
+			delete(delimeters, rule)
+		} else {
+			delimeters[rule] = kept
+		}
+	}
+
+	return writeDelimeters(rootDir, delimeters)
+}
+
+// writeDelimeters writes .features/delimeters, the next read doesn't trust the cache on
+// file systems with a coarse modification time.
+func writeDelimeters(rootDir string, delimeters types.Delimeters) error {
+	var path string = filepath.Join(rootDir, ".features", "delimeters")
 
-	var rootDir string = git.GetRepositoryRoot()
+	delimetersMutex.Lock()
+	delete(delimetersCache, path)
+	delimetersMutex.Unlock()
 
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "delimeters"), delimeters)
+	return filesystem.FileWriteJSONToFile(path, delimeters)
 }
 
-func ListDelimeters() {
-	delimeters := ReadDelimeters()
+// DelimeterRuleKind tells how a rule of .features/delimeters matches a file. Rules with
+// `*`, `?`, `[` or `/` are globs, rules like `.go` are extensions and any other rule is
+// an exact file name, like `Makefile`.
+func DelimeterRuleKind(rule string) string {
+	if rule == "default" {
+		return "default"
+	} else if strings.ContainsAny(rule, "*?[/") {
+		return "glob"
+	} else if strings.HasPrefix(rule, ".") && !strings.Contains(rule[1:], ".") {
+		return "extension"
+	}
 
-	var headers []string = []string{"EXTENSION", "START", "END"}
+	return "name"
+}
 
-	var data [][]string
+var delimeterRulePrecedence map[string]int = map[string]int{
+	"name":      0,
+	"glob":      1,
+	"extension": 2,
+	"default":   3,
+}
+
+// sortedDelimeterRules returns the rules in the order they are tried: file names, globs
+// from the longest pattern, extensions and the default rule.
+func sortedDelimeterRules(delimeters types.Delimeters) []string {
+	var rules []string = []string{}
+
+	for rule := range delimeters {
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := delimeterRulePrecedence[DelimeterRuleKind(rules[i])], delimeterRulePrecedence[DelimeterRuleKind(rules[j])]
+
+		if a != b {
+			return a < b
+		} else if len(rules[i]) != len(rules[j]) && DelimeterRuleKind(rules[i]) == "glob" {
+			return len(rules[i]) > len(rules[j])
+		}
+
+		return rules[i] < rules[j]
+	})
+
+	return rules
+}
+
+// ValidateDelimeterRule returns an error when a glob rule is malformed.
+func ValidateDelimeterRule(rule string) error {
+	for _, segment := range strings.Split(rule, "/") {
+		if _, err := filepath.Match(segment, ""); err != nil {
+			return errs.New(errs.InvalidArgument, "invalid glob %s", rule)
+		}
+	}
+
+	return nil
+}
+
+// matchGlob matches a slash separated path against a glob where `**` matches any number
+// of folders. Globs without a `/` are matched against the file name.
+func matchGlob(pattern string, path string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := filepath.Match(pattern, filepath.Base(path))
+
+		return matched
+	}
+
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(path, "/"))
+}
+
+func matchGlobSegments(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchGlobSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	if matched, _ := filepath.Match(pattern[0], path[0]); !matched {
+		return false
+	}
+
+	return matchGlobSegments(pattern[1:], path[1:])
+}
+
+// matchesDelimeterRule reports if the rule applies to a path relative to the repository.
+func matchesDelimeterRule(rule string, path string) bool {
+	switch DelimeterRuleKind(rule) {
+	case "name":
+		return filepath.Base(path) == rule
+	case "glob":
+		return matchGlob(rule, path)
+	case "extension":
+		return filepath.Ext(path) == rule
+	}
+
+	return true
+}
+
+// DelimeterRecords returns a record for each delimeter pair, in the order rules are tried.
+func DelimeterRecords(rootDir string) ([]types.DelimeterRecord, error) {
+	delimeters, err := ReadDelimeters(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []types.DelimeterRecord = []types.DelimeterRecord{}
 	
-	for extension, delimeter := range delimeters {
-		data = append(data, []string{extension, delimeter.Start, delimeter.End})
+	for _, rule := range sortedDelimeterRules(delimeters) {
+		for _, delimeter := range delimeters[rule] {
+			records = append(records, types.DelimeterRecord{Rule: rule, Start: delimeter.Start, End: delimeter.End, Type: DelimeterRuleKind(rule)})
+		}
 	}
 
-	table.RenderTable(headers, data)
+	return records, nil
 }
 
-func parseDelimeterRegex(delimeter string) string {
-	delimeter = strings.ReplaceAll(delimeter, `\`, `\\`)
+func ListDelimeters(rootDir string) error {
+	records, err := DelimeterRecords(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	var headers []string = []string{"RULE", "START", "END", "TYPE"}
+
+	var data [][]string
 	
-	delimeter = strings.ReplaceAll(delimeter, `(`, `\(`)
-	delimeter = strings.ReplaceAll(delimeter, `)`, `\)`)
-	delimeter = strings.ReplaceAll(delimeter, `.`, `\.`)
-	delimeter = strings.ReplaceAll(delimeter, `^`, `\^`)
-	delimeter = strings.ReplaceAll(delimeter, `$`, `\$`)
-	delimeter = strings.ReplaceAll(delimeter, `+`, `\+`)
-	delimeter = strings.ReplaceAll(delimeter, `?`, `\?`)
-	delimeter = strings.ReplaceAll(delimeter, `{`, `\{`)
-	delimeter = strings.ReplaceAll(delimeter, `}`, `\}`)
-	delimeter = strings.ReplaceAll(delimeter, `[`, `\[`)
-	delimeter = strings.ReplaceAll(delimeter, `]`, `\]`)
-	delimeter = strings.ReplaceAll(delimeter, `|`, `\|`)
+	for _, record := range records {
+		data = append(data, []string{record.Rule, record.Start, record.End, record.Type})
+	}
+
+	table.RenderTable(headers, data)
 
-	return delimeter
+	return nil
 }
 
-func GetDelimetersFromFileParsedRegex(path string) (string, string) {
-	delimeters := ReadDelimeters()
+// GetDelimetersFromFile returns every delimeter pair accepted on path from the first
+// rule that matches it.
+func GetDelimetersFromFile(rootDir string, path string) (types.DelimeterList, error) {
+	delimeters, err := ReadDelimeters(rootDir)
 
-	extension := filepath.Ext(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if relative, err := filepath.Rel(rootDir, path); filepath.IsAbs(path) && err == nil {
+		path = relative
+	}
 
-	delimeter, exists := delimeters[extension]
+	path = filepath.ToSlash(path)
 
-	if exists {
-		return parseDelimeterRegex(delimeter.Start), parseDelimeterRegex(delimeter.End)
+	for _, rule := range sortedDelimeterRules(delimeters) {
+		if list := delimeters[rule]; len(list) > 0 && matchesDelimeterRule(rule, path) {
+			return list, nil
+		}
 	}
 
-	return delimeters["default"].Start, delimeters["default"].End
+	return types.DelimeterList{}, nil
 }
 
-func GetDelimetersFromFile(path string) (string, string) {
-	delimeters := ReadDelimeters()
+// parserDelimetersFromFile returns the delimeters of path in the form used by the parser.
+func parserDelimetersFromFile(rootDir string, path string) ([]parser.Delimeter, error) {
+	var result []parser.Delimeter = []parser.Delimeter{}
 
-	extension := filepath.Ext(path)
+	delimeters, err := GetDelimetersFromFile(rootDir, path)
 
-	delimeter, exists := delimeters[extension]
+	if err != nil {
+		return nil, err
+	}
 
-	if exists {
-		return delimeter.Start, delimeter.End
+	for _, delimeter := range delimeters {
+		result = append(result, parser.Delimeter{Start: delimeter.Start, End: delimeter.End})
 	}
 
-	return delimeters["default"].Start, delimeters["default"].End
-}
\ No newline at end of file
+	return result, nil
+}
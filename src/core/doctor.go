@@ -0,0 +1,601 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/styles"
+	"github.com/costaluu/flag/table"
+	"github.com/costaluu/flag/types"
+	"github.com/costaluu/flag/utils"
+	"github.com/costaluu/flag/workingtree"
+)
+
+// Problems reported by flag doctor.
+const (
+	DoctorTempFile           = "temp-file"
+	DoctorMissingPath        = "missing-path"
+	DoctorMissingWorkingTree = "missing-working-tree"
+	DoctorMissingSnapshot    = "missing-snapshot"
+	DoctorOrphanSnapshot     = "orphan-snapshot"
+	DoctorInterrupted        = "interrupted-operation"
+	DoctorStaleLock          = "stale-lock"
+	DoctorMissingFile        = "missing-workspace-file"
+	DoctorOrphanFolder       = "orphan-folder"
+)
+
+// tempFiles are left on .features by operations that were interrupted.
+var tempFiles []string = []string{"merge-tmp", "feature-tmp", "tmp-folder"}
+
+// maxRecoveredFeatures limits the feature combinations tried to recover a working tree.
+const maxRecoveredFeatures = 8
+
+// doctor collects the problems found by Doctor and repairs them with fix.
+type doctor struct {
+	rootDir string
+	fix     bool
+	files   []string
+	records []types.DiagnosisRecord
+}
+
+// diagnose records a problem, repair is nil when it can not be fixed by flag.
+func (d *doctor) diagnose(path string, problem string, message string, fix string, repair func() error) error {
+	var record types.DiagnosisRecord = types.DiagnosisRecord{Path: path, Problem: problem, Message: message, Fix: fix}
+
+	if d.fix && repair != nil {
+		if err := repair(); err != nil {
+			return errs.Wrap(err, "can not fix %s", path)
+		}
+
+		record.Fixed = true
+	}
+
+	d.records = append(d.records, record)
+
+	return nil
+}
+
+func (d *doctor) relative(path string) string {
+	relative, _ := filepath.Rel(d.rootDir, path)
+
+	return filepath.ToSlash(relative)
+}
+
+// checkJournal reports the journal of an operation that was interrupted, with fix the
+// other checks see the workspace as it is after the rollback.
+func (d *doctor) checkJournal() error {
+	operation, interrupted, err := interruptedOperation(d.rootDir)
+
+	if err != nil || !interrupted {
+		return err
+	}
+
+	return d.diagnose(d.relative(journalFolder(d.rootDir)), DoctorInterrupted, fmt.Sprintf("%s was interrupted", operation), "roll it back", func() error {
+		kept, err := filesystem.RollbackJournal(journalFolder(d.rootDir))
+
+		warnKept(d.rootDir, operation, kept)
+
+		return err
+	})
+}
+
+// checkLock reports a lock left by a process that is gone, commands take it over but
+// it tells which operation was interrupted.
+func (d *doctor) checkLock() error {
+	holder, held, err := lockHeld(d.rootDir)
+
+	if err != nil || held || !filesystem.FileExists(lockPath(d.rootDir)) {
+		return err
+	}
+
+	return d.diagnose(d.relative(lockPath(d.rootDir)), DoctorStaleLock, fmt.Sprintf("left behind by %s", describeHolder(holder)), "remove it", func() error {
+		return takeOverLock(d.rootDir, holder)
+	})
+}
+
+// checkTempFiles reports the temporary files of interrupted operations, including the
+// ones of writes that never got renamed over their file.
+func (d *doctor) checkTempFiles() error {
+	var paths map[string]string = make(map[string]string)
+
+	for _, name := range tempFiles {
+		path := filepath.Join(d.rootDir, ".features", name)
+
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		paths[path] = "left behind by an interrupted merge"
+	}
+
+	entries, err := os.ReadDir(filepath.Join(d.rootDir, ".features"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// The temporary folders of running processes are in use
+		if pid, ok := git.TempFolderPid(entry.Name()); ok && entry.IsDir() && pid != os.Getpid() && !processRunning(pid) {
+			paths[filepath.Join(d.rootDir, ".features", entry.Name())] = fmt.Sprintf("left behind by an interrupted merge of pid %d", pid)
+		}
+	}
+
+	err = filepath.WalkDir(filepath.Join(d.rootDir, ".features"), func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		_, isTempFolder := git.TempFolderPid(entry.Name())
+
+		// The temporary folders are removed with their content
+		if _, exists := paths[path]; entry.IsDir() && (path == journalFolder(d.rootDir) || exists || isTempFolder) {
+			return filepath.SkipDir
+		}
+
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && strings.Contains(entry.Name(), ".tmp-") {
+			paths[path] = "left behind by an interrupted write"
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var sortedPaths []string = []string{}
+
+	for path := range paths {
+		sortedPaths = append(sortedPaths, path)
+	}
+
+	sort.Strings(sortedPaths)
+
+	for _, path := range sortedPaths {
+		err := d.diagnose(d.relative(path), DoctorTempFile, paths[path], "remove it", func() error {
+			return os.RemoveAll(path)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recoverPath finds the file of a workspace folder, the folder is named after the hash
+// of its path. The ids of the .block files confirm the file of a blocks folder.
+func (d *doctor) recoverPath(folder string, ids []string) (string, error) {
+	if d.files == nil {
+		files, err := git.ListFiles(d.rootDir)
+
+		if err != nil {
+			return "", err
+		}
+
+		d.files = files
+	}
+
+	for _, path := range d.files {
+		if utils.HashPath(path) != filepath.Base(folder) {
+			continue
+		}
+
+		if len(ids) == 0 {
+			return path, nil
+		}
+
+		content, err := filesystem.FileRead(filepath.Join(d.rootDir, path))
+
+		if err != nil {
+			return "", nil
+		}
+
+		for _, id := range ids {
+			if strings.Contains(content, id) {
+				return path, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// checkPath reports a folder without _path and returns the path of its file.
+func (d *doctor) checkPath(folder string, ids []string) (string, error) {
+	if filesystem.FileExists(filepath.Join(folder, "_path")) {
+		return filesystem.FileRead(filepath.Join(folder, "_path"))
+	}
+
+	path, err := d.recoverPath(folder, ids)
+
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		return "", d.diagnose(d.relative(folder), DoctorMissingPath, "_path is missing and no file of the repository matches the folder", "", nil)
+	}
+
+	return path, d.diagnose(d.relative(folder), DoctorMissingPath, fmt.Sprintf("_path is missing, the folder belongs to %s", path), "write _path", func() error {
+		return filesystem.FileWriteContentToFile(filepath.Join(folder, "_path"), path)
+	})
+}
+
+// checkOrphanFolder reports a folder whose file was deleted, it is left behind when the
+// file is deleted without a sync.
+func (d *doctor) checkOrphanFolder(folder string, path string) (bool, error) {
+	if path == "" || filesystem.FileExists(filepath.Join(d.rootDir, path)) {
+		return false, nil
+	}
+
+	return true, d.diagnose(d.relative(folder), DoctorOrphanFolder, fmt.Sprintf("%s no longer exists", path), "remove the folder", func() error {
+		return filesystem.FileDeleteFolder(folder)
+	})
+}
+
+// checkBlocksFolder reports a blocks folder without _path or whose file was deleted.
+func (d *doctor) checkBlocksFolder(folder string) error {
+	entries, err := os.ReadDir(folder)
+
+	if err != nil {
+		return err
+	}
+
+	var ids []string = []string{}
+
+	for _, entry := range entries {
+		if id, found := strings.CutSuffix(entry.Name(), ".block"); found {
+			var block types.BlockFeature
+
+			if err := filesystem.FileReadJSONFromFile(filepath.Join(folder, entry.Name()), &block); err == nil && block.Id != "" {
+				id = block.Id
+			}
+
+			ids = append(ids, id)
+		}
+	}
+
+	path, err := d.checkPath(folder, ids)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = d.checkOrphanFolder(folder, path)
+
+	return err
+}
+
+// findSavedFeatures looks for the feature ids that named a saved file, in the order they
+// were given when the state was saved.
+func findSavedFeatures(prefix []string, featureIds []string, fileCheckSum string, savedCheckSum string) ([]string, bool) {
+	for i, featureId := range featureIds {
+		ids := append(append([]string{}, prefix...), featureId)
+
+		if utils.GenerateCheckSumFromString(append(append([]string{}, ids...), fileCheckSum)...) == savedCheckSum {
+			return ids, true
+		}
+
+		remaining := append(append([]string{}, featureIds[:i]...), featureIds[i+1:]...)
+
+		if found, ok := findSavedFeatures(ids, remaining, fileCheckSum, savedCheckSum); ok {
+			return found, true
+		}
+	}
+
+	return nil, false
+}
+
+// recoverWorkingTree rebuilds the entries of a working tree from its saved files, the
+// name of a saved file is the checksum of its content and the ids of its features.
+func recoverWorkingTree(rootDir string, folder string) (workingtree.WorkingTree, error) {
+	var tree workingtree.WorkingTree = make(workingtree.WorkingTree)
+
+	features, err := GetVersionFeaturesFromPath(rootDir, filepath.Base(folder))
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(folder, constants.WorkingTreeDirectory))
+
+	if os.IsNotExist(err) || len(features) > maxRecoveredFeatures {
+		return tree, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var featureIds []string = []string{}
+
+	for _, feature := range features {
+		featureIds = append(featureIds, feature.Id)
+	}
+
+	for _, entry := range entries {
+		fileCheckSum, err := filesystem.FileGenerateCheckSum(filepath.Join(folder, constants.WorkingTreeDirectory, entry.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ids, found := findSavedFeatures(nil, featureIds, fileCheckSum, entry.Name()); found {
+			tree[workingtree.NormalizeFeatures(ids)] = workingtree.WorkingTreeValue{FileCheckSum: fileCheckSum, SavedCheckSum: entry.Name()}
+		}
+	}
+
+	return tree, nil
+}
+
+// checkVersionFolder reports the problems of the working tree of a version base.
+func (d *doctor) checkVersionFolder(folder string) error {
+	path, err := d.checkPath(folder, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if orphan, err := d.checkOrphanFolder(folder, path); err != nil || orphan {
+		return err
+	}
+
+	var pathKnown bool = path != ""
+
+	if !pathKnown {
+		path = d.relative(folder)
+	}
+
+	if !filesystem.FileExists(filepath.Join(folder, constants.WorkingTreeFile)) {
+		tree, err := recoverWorkingTree(d.rootDir, folder)
+
+		if err != nil {
+			return err
+		}
+
+		// Saved files that can not be recovered show up as orphans on the next run
+		return d.diagnose(path, DoctorMissingWorkingTree, fmt.Sprintf("%s is missing", constants.WorkingTreeFile), fmt.Sprintf("recreate it with %d states recovered from the saved files", len(tree)), func() error {
+			return workingtree.SaveWorkingTree(folder, tree)
+		})
+	}
+
+	tree, err := workingtree.LoadWorkingTree(folder)
+
+	if err != nil {
+		return err
+	}
+
+	features, err := GetVersionFeaturesFromPath(d.rootDir, filepath.Base(folder))
+
+	if err != nil {
+		return err
+	}
+
+	var featureNames map[string]string = make(map[string]string)
+	var featureIdsTurnedOn []string = []string{}
+
+	for _, feature := range features {
+		featureNames[feature.Id] = feature.Name
+
+		if feature.State == constants.STATE_ON {
+			featureIdsTurnedOn = append(featureIdsTurnedOn, feature.Id)
+		}
+	}
+
+	currentKey := workingtree.NormalizeFeatures(featureIdsTurnedOn)
+
+	var keys []string = []string{}
+	var referenced map[string]bool = make(map[string]bool)
+
+	for key, value := range tree {
+		keys = append(keys, key)
+		referenced[value.SavedCheckSum] = true
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		key, value := key, tree[key]
+		snapshot := filepath.Join(folder, constants.WorkingTreeDirectory, value.SavedCheckSum)
+
+		if filesystem.FileExists(snapshot) {
+			continue
+		}
+
+		var names []string = []string{}
+
+		for _, featureId := range workingtree.StringToStringSlice(key) {
+			if name, exists := featureNames[featureId]; exists {
+				names = append(names, name)
+			} else {
+				names = append(names, featureId)
+			}
+		}
+
+		message := fmt.Sprintf("state %s points at a deleted saved file", strings.Join(names, "+"))
+
+		// The file still has the content of the current state, it can be saved again
+		if key == currentKey && pathKnown {
+			if checkSum, err := filesystem.FileGenerateCheckSum(filepath.Join(d.rootDir, path)); err == nil && checkSum == value.FileCheckSum {
+				err := d.diagnose(path, DoctorMissingSnapshot, message, "save the file again, it has the content of the state", func() error {
+					if err := os.MkdirAll(filepath.Dir(snapshot), 0755); err != nil {
+						return err
+					}
+
+					return filesystem.FileCopy(filepath.Join(d.rootDir, path), snapshot)
+				})
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		err := d.diagnose(path, DoctorMissingSnapshot, message, fmt.Sprintf("remove the state, save it again with %s versions save", constants.COMMAND), func() error {
+			tree, err := workingtree.LoadWorkingTree(folder)
+
+			if err != nil {
+				return err
+			}
+
+			delete(tree, key)
+
+			return workingtree.SaveWorkingTree(folder, tree)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(folder, constants.WorkingTreeDirectory))
+
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if referenced[entry.Name()] {
+			continue
+		}
+
+		snapshot := filepath.Join(folder, constants.WorkingTreeDirectory, entry.Name())
+
+		err := d.diagnose(d.relative(snapshot), DoctorOrphanSnapshot, fmt.Sprintf("saved file of %s that no state uses", path), "remove it", func() error {
+			return os.RemoveAll(snapshot)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkWorkspaceFiles finds the folders and files missing from the workspace, they are
+// created as new workspaces have them.
+func (d *doctor) checkWorkspaceFiles() error {
+	_, missing, err := probeWorkspace(d.rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, part := range missing {
+		err := d.diagnose(".features/"+part.name, DoctorMissingFile, part.name+" is missing from the workspace", "create it", func() error {
+			return part.create(d.rootDir)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Doctor finds the leftovers of interrupted operations and the broken references of the
+// workspace, with fix it repairs the ones it can.
+func Doctor(rootDir string, fix bool) ([]types.DiagnosisRecord, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
+	}
+
+	d := &doctor{rootDir: rootDir, fix: fix, records: []types.DiagnosisRecord{}}
+
+	if err := d.checkLock(); err != nil {
+		return nil, err
+	}
+
+	var err error
+
+	if fix {
+		// The repairs must not run while another command changes the workspace
+		err = Locked(rootDir, constants.COMMAND+" doctor --fix", d.run)
+	} else {
+		err = d.run()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.records, nil
+}
+
+func (d *doctor) run() error {
+	if err := d.checkJournal(); err != nil {
+		return err
+	}
+
+	if err := d.checkWorkspaceFiles(); err != nil {
+		return err
+	}
+
+	if err := d.checkTempFiles(); err != nil {
+		return err
+	}
+
+	c := &checker{rootDir: d.rootDir}
+
+	blockFolders, err := c.workspaceFolders("blocks")
+
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range blockFolders {
+		if err := d.checkBlocksFolder(folder); err != nil {
+			return err
+		}
+	}
+
+	versionFolders, err := c.workspaceFolders("versions")
+
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range versionFolders {
+		if err := d.checkVersionFolder(folder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DoctorReport renders the problems found by Doctor.
+func DoctorReport(records []types.DiagnosisRecord) {
+	var headers []string = []string{"PATH", "PROBLEM", "MESSAGE", "FIX"}
+	var data [][]string = [][]string{}
+
+	for _, record := range records {
+		var fix string = styles.RedTextStyle("fix by hand")
+
+		if record.Fixed {
+			fix = styles.GreenTextStyle("fixed: " + record.Fix)
+		} else if record.Fix != "" {
+			fix = record.Fix
+		}
+
+		data = append(data, []string{record.Path, record.Problem, record.Message, fix})
+	}
+
+	table.RenderTable(headers, data)
+}
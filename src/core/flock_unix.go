@@ -0,0 +1,13 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile waits for the exclusive lock of file, it is released when the file is closed.
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
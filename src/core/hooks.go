@@ -0,0 +1,273 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/styles"
+	"github.com/costaluu/flag/table"
+	"github.com/costaluu/flag/utils"
+)
+
+// Hooks are the git hooks installed by flag hooks install.
+var Hooks []string = []string{"pre-commit", "post-checkout", "post-merge"}
+
+// hookMarker is the line that tells the hooks written by flag apart.
+const hookMarker = "# Installed by flag hooks install"
+
+// chainedHookSuffix is added to a hook that existed before the install, the hook of flag
+// runs it first.
+const chainedHookSuffix = ".flag-chained"
+
+// HookStatus is the state of a git hook.
+type HookStatus struct {
+	Name string
+	Path string
+	// Installed is true when the hook was written by flag.
+	Installed bool
+	// Chained is true when a previous hook runs before the one of flag.
+	Chained bool
+	// Foreign is true when another hook is in place of the one of flag.
+	Foreign bool
+}
+
+// shellQuote quotes value for sh, nothing is expanded inside single quotes and a single
+// quote is written as '\''.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func hookScript(name string, binary string) string {
+	return fmt.Sprintf(`#!/bin/sh
+%s, flag hooks uninstall restores the previous hook.
+FLAG=%s
+command -v "$FLAG" >/dev/null 2>&1 || FLAG=%s
+
+if [ -x "$0%s" ]; then
+	"$0%s" "$@" || exit $?
+fi
+
+exec "$FLAG" --non-interactive hooks run %s "$@"
+`, hookMarker, shellQuote(binary), constants.COMMAND, chainedHookSuffix, chainedHookSuffix, name)
+}
+
+func isFlagHook(path string) bool {
+	content, err := filesystem.FileRead(path)
+
+	return err == nil && strings.Contains(content, hookMarker)
+}
+
+// HooksStatus returns the state of every hook of Hooks.
+func HooksStatus(rootDir string) ([]HookStatus, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
+	}
+
+	hooksPath, err := git.HooksPath(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []HookStatus = []HookStatus{}
+
+	for _, name := range Hooks {
+		path := filepath.Join(hooksPath, name)
+		installed := isFlagHook(path)
+
+		statuses = append(statuses, HookStatus{
+			Name:      name,
+			Path:      path,
+			Installed: installed,
+			Chained:   installed && filesystem.FileExists(path+chainedHookSuffix),
+			Foreign:   !installed && filesystem.FileExists(path),
+		})
+	}
+
+	return statuses, nil
+}
+
+// InstallHooks writes the hooks of flag, a hook that is already in place is kept and
+// runs before the one of flag. Installing again updates the hooks.
+func InstallHooks(rootDir string) error {
+	statuses, err := HooksStatus(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	binary, err := os.Executable()
+
+	if err != nil {
+		binary = constants.COMMAND
+	}
+
+	if err := os.MkdirAll(filepath.Dir(statuses[0].Path), 0755); err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if status.Foreign {
+			if filesystem.FileExists(status.Path + chainedHookSuffix) {
+				return errs.New(errs.AlreadyExists, "%s already exists, remove it to chain %s", status.Path+chainedHookSuffix, status.Path)
+			}
+
+			if err := os.Rename(status.Path, status.Path+chainedHookSuffix); err != nil {
+				return err
+			}
+		}
+
+		if err := os.WriteFile(status.Path, []byte(hookScript(status.Name, binary)), 0755); err != nil {
+			return err
+		}
+
+		// WriteFile keeps the mode of a hook that is updated
+		if err := os.Chmod(status.Path, 0755); err != nil {
+			return err
+		}
+
+		if status.Foreign {
+			logger.Success[string](fmt.Sprintf("hook %s installed, the previous hook runs first", styles.AccentTextStyle(status.Name)))
+		} else {
+			logger.Success[string](fmt.Sprintf("hook %s installed", styles.AccentTextStyle(status.Name)))
+		}
+	}
+
+	return nil
+}
+
+// UninstallHooks removes the hooks of flag and puts back the hooks they chained.
+func UninstallHooks(rootDir string) error {
+	statuses, err := HooksStatus(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if !status.Installed {
+			continue
+		}
+
+		if err := filesystem.RemoveFile(status.Path); err != nil {
+			return err
+		}
+
+		if status.Chained {
+			if err := os.Rename(status.Path+chainedHookSuffix, status.Path); err != nil {
+				return err
+			}
+		}
+
+		logger.Success[string](fmt.Sprintf("hook %s uninstalled", styles.AccentTextStyle(status.Name)))
+	}
+
+	return nil
+}
+
+// ListHooks renders the state of the hooks.
+func ListHooks(rootDir string) error {
+	statuses, err := HooksStatus(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	var headers []string = []string{"HOOK", "STATUS", "PATH"}
+	var data [][]string = [][]string{}
+
+	for _, status := range statuses {
+		var state string = styles.RedTextStyle("not installed")
+
+		if status.Chained {
+			state = styles.GreenTextStyle("installed, chained")
+		} else if status.Installed {
+			state = styles.GreenTextStyle("installed")
+		} else if status.Foreign {
+			state = styles.BlueTextStyle("other hook")
+		}
+
+		data = append(data, []string{status.Name, state, status.Path})
+	}
+
+	table.RenderTable(headers, data)
+
+	return nil
+}
+
+// RunHook runs the hook of flag for a git hook, args are the arguments given by git.
+func RunHook(rootDir string, name string, args []string) error {
+	switch name {
+	case "pre-commit":
+		return preCommitHook(rootDir)
+	case "post-checkout", "post-merge":
+		// The third argument of post-checkout is 0 when files were checked out, not a branch
+		if name == "post-checkout" && len(args) > 2 && args[2] == "0" {
+			return nil
+		}
+
+		// The checkout is done, a failed sync can only be reported
+		if err := hookSync(rootDir, name, SyncOptions{All: true, OnUntracked: UntrackedFail}); err != nil {
+			logger.Warning[string](fmt.Sprintf("%s: %s, run %s sync", name, err.Error(), constants.COMMAND))
+		}
+
+		return nil
+	}
+
+	return errs.New(errs.InvalidArgument, "unknown hook %s, use %s", name, strings.Join(Hooks, ", "))
+}
+
+// hookSync runs the sync of a hook as a journaled operation. Only the sync is journaled,
+// the changes it makes stay when the hook refuses the commit so they can be reviewed.
+func hookSync(rootDir string, name string, opts SyncOptions) error {
+	return Journaled(rootDir, fmt.Sprintf("%s hooks run %s", constants.COMMAND, name), func() error {
+		return Sync(rootDir, opts)
+	})
+}
+
+// preCommitHook syncs the workspace and refuses the commit when the sync changed a file
+// or when .features has changes that are not staged.
+func preCommitHook(rootDir string) error {
+	before, err := git.WorkingTreeState(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	if err := hookSync(rootDir, "pre-commit", SyncOptions{OnUntracked: UntrackedFail}); err != nil {
+		return errs.Wrap(err, "commit refused, flag sync failed")
+	}
+
+	after, err := git.WorkingTreeState(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	if before != after {
+		return errs.New(errs.InvalidState, "commit refused, flag sync updated the workspace. review and stage the changes, then commit again")
+	}
+
+	unstaged, err := git.GetUnstagedFiles(rootDir, ".features")
+
+	if err != nil {
+		return err
+	}
+
+	unstaged = utils.ArrayFilter[string](unstaged, func (path string) bool {
+		return !isRuntimePath(path)
+	})
+
+	if len(unstaged) > 0 {
+		return errs.New(errs.InvalidState, "commit refused, .features has changes that are not staged: %s. stage them with git add .features", strings.Join(unstaged, ", "))
+	}
+
+	return nil
+}
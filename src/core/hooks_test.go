@@ -0,0 +1,20 @@
+package core
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	for _, value := range []string{"/usr/bin/flag", "/tmp/it's here/flag", `/tmp/$HOME "x" \n/flag`, "/tmp/`id`/flag"} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(value)).Output()
+
+		if err != nil || string(out) != value {
+			t.Errorf("expected %q, got %q %v", value, out, err)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/types"
+	"github.com/costaluu/flag/utils"
+)
+
+// indexVersion changes with the format of the index, an index of another version is
+// built again.
+const indexVersion = 1
+
+// indexFile is the name of the index on the git folder of the repository.
+const indexFile = "flag-index"
+
+// generationFile is the name of the generation of the workspace on the git folder, flag
+// changes it before it changes blocks or versions.
+const generationFile = "flag-generation"
+
+// indexedFolder is a folder of .features/blocks or .features/versions on the index.
+type indexedFolder struct {
+	Path        string `json:"path"`
+	Fingerprint string `json:"fingerprint"`
+	// Features maps each feature used by the file to the ids of its blocks or versions.
+	Features map[string][]string `json:"features"`
+	// Variants maps each feature to the variant values used by the file.
+	Variants map[string][]string `json:"variants,omitempty"`
+}
+
+// workspaceIndex tells which files use each feature without reading every .block and
+// .feature file. It is kept on the git folder and never committed, a folder is read
+// again when its fingerprint changes. Stamp is the state of the workspace it was saved
+// at, the folders are only looked at when it changes.
+type workspaceIndex struct {
+	Version  int                      `json:"version"`
+	Stamp    string                   `json:"stamp"`
+	Blocks   map[string]indexedFolder `json:"blocks"`
+	Versions map[string]indexedFolder `json:"versions"`
+}
+
+// folderFingerprint hashes the names, sizes and modification times of the entries of a
+// folder. flag replaces a file on every write, so any change on the folder changes it.
+func folderFingerprint(folder string) (string, error) {
+	entries, err := os.ReadDir(folder)
+
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string = []string{}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, fmt.Sprintf("%s %d %d\n", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+
+	return utils.GenerateCheckSumFromString(parts...), nil
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+func indexBlocksFolder(folder string) (indexedFolder, error) {
+	path, err := filesystem.FileRead(filepath.Join(folder, "_path"))
+
+	if err != nil {
+		return indexedFolder{}, err
+	}
+
+	blocks, err := readBlocksFolder(folder)
+
+	if err != nil {
+		return indexedFolder{}, err
+	}
+
+	var indexed indexedFolder = indexedFolder{Path: path, Features: make(map[string][]string), Variants: make(map[string][]string)}
+
+	for _, block := range blocks {
+		if len(block.Features) > 0 {
+			for name := range block.Features {
+				indexed.Features[name] = append(indexed.Features[name], block.Id)
+			}
+
+			continue
+		}
+
+		indexed.Features[block.Name] = append(indexed.Features[block.Name], block.Id)
+
+		for _, variant := range block.Variants {
+			indexed.Variants[block.Name] = appendUnique(indexed.Variants[block.Name], variant.Value)
+		}
+	}
+
+	return indexed, nil
+}
+
+func indexVersionsFolder(rootDir string, folder string) (indexedFolder, error) {
+	path, err := filesystem.FileRead(filepath.Join(folder, "_path"))
+
+	if err != nil {
+		return indexedFolder{}, err
+	}
+
+	features, err := GetVersionFeaturesFromPath(rootDir, filepath.Base(folder))
+
+	if err != nil {
+		return indexedFolder{}, err
+	}
+
+	var indexed indexedFolder = indexedFolder{Path: path, Features: make(map[string][]string), Variants: make(map[string][]string)}
+
+	for _, feature := range features {
+		name, value := SplitFeatureValue(feature.Name)
+
+		indexed.Features[name] = append(indexed.Features[name], feature.Id)
+
+		if value != "" {
+			indexed.Variants[name] = appendUnique(indexed.Variants[name], value)
+		}
+	}
+
+	return indexed, nil
+}
+
+// updateIndexFolders indexes again the folders of .features/<kind> that changed, it
+// reports if folders changed.
+func updateIndexFolders(rootDir string, kind string, folders map[string]indexedFolder, index func(folder string) (indexedFolder, error)) (bool, error) {
+	var changed bool = false
+
+	entries, err := os.ReadDir(filepath.Join(rootDir, ".features", kind))
+
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	var seen map[string]bool = make(map[string]bool)
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		folder := filepath.Join(rootDir, ".features", kind, entry.Name())
+		seen[entry.Name()] = true
+
+		// The fingerprint is taken first, a change made while the folder is read is seen next time
+		fingerprint, err := folderFingerprint(folder)
+
+		if err != nil {
+			return false, err
+		}
+
+		if cached, exists := folders[entry.Name()]; exists && cached.Fingerprint == fingerprint {
+			continue
+		}
+
+		indexed, err := index(folder)
+
+		if err != nil {
+			return false, err
+		}
+
+		indexed.Fingerprint = fingerprint
+		folders[entry.Name()] = indexed
+		changed = true
+	}
+
+	for name := range folders {
+		if !seen[name] {
+			delete(folders, name)
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+var indexMutex sync.Mutex = sync.Mutex{}
+
+// changedWorkspaces are the roots whose blocks or versions this process changed since
+// their index was loaded, their generation was already changed.
+var changedWorkspaces map[string]bool = make(map[string]bool)
+
+func init() {
+	filesystem.OnChange(workspaceChanged)
+}
+
+// workspaceChanged changes the generation of the workspace that holds path, when it is
+// on .features/blocks or .features/versions. It runs once until the index is loaded again.
+func workspaceChanged(path string) {
+	for _, kind := range []string{"blocks", "versions"} {
+		marker := string(filepath.Separator) + filepath.Join(".features", kind)
+		i := strings.LastIndex(path, marker)
+
+		if i == -1 || (len(path) > i+len(marker) && path[i+len(marker)] != filepath.Separator) {
+			continue
+		}
+
+		rootDir := path[:i]
+
+		indexMutex.Lock()
+		changed := changedWorkspaces[rootDir]
+		changedWorkspaces[rootDir] = true
+		indexMutex.Unlock()
+
+		if !changed {
+			invalidateIndex(rootDir)
+		}
+
+		return
+	}
+}
+
+// invalidateIndex changes the generation of the workspace, an index that can't be
+// invalidated is removed so no process reads it.
+func invalidateIndex(rootDir string) {
+	generation, err := git.GitPath(rootDir, generationFile)
+
+	if err == nil {
+		err = os.WriteFile(generation, []byte(fmt.Sprintf("%d %d", os.Getpid(), time.Now().UnixNano())), 0644)
+	}
+
+	if err == nil {
+		return
+	}
+
+	if path, pathErr := git.GitPath(rootDir, indexFile); pathErr == nil {
+		if removeErr := os.Remove(path); removeErr == nil || os.IsNotExist(removeErr) {
+			return
+		}
+	}
+
+	logger.Warning[string](fmt.Sprintf("could not invalidate the index of the workspace: %s", err.Error()))
+}
+
+// indexStamp returns the state of the workspace an index is valid for: its generation,
+// the blocks and versions folders and the index of git, which changes when git checks
+// files out.
+func indexStamp(rootDir string) (string, error) {
+	generation, err := git.GitPath(rootDir, generationFile)
+
+	if err != nil {
+		return "", err
+	}
+
+	gitIndex, err := git.GitPath(rootDir, "index")
+
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(generation)
+
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var parts []string = []string{string(content)}
+
+	for _, path := range []string{filepath.Join(rootDir, ".features", "blocks"), filepath.Join(rootDir, ".features", "versions"), gitIndex} {
+		info, err := os.Stat(path)
+
+		if os.IsNotExist(err) {
+			parts = append(parts, "-")
+
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano()))
+	}
+
+	return strings.Join(parts, "\n"), nil
+}
+
+// loadIndex returns the index of the workspace, updated with the folders that changed
+// when the workspace changed since it was saved.
+func loadIndex(rootDir string) (workspaceIndex, error) {
+	var index workspaceIndex
+
+	path, err := git.GitPath(rootDir, indexFile)
+
+	if err != nil {
+		return index, err
+	}
+
+	// A missing or unreadable index is built again
+	if filesystem.FileExists(path) {
+		if err := filesystem.FileReadJSONFromFile(path, &index); err != nil {
+			index = workspaceIndex{}
+		}
+	}
+
+	if index.Version != indexVersion || index.Blocks == nil || index.Versions == nil {
+		index = workspaceIndex{Version: indexVersion, Blocks: make(map[string]indexedFolder), Versions: make(map[string]indexedFolder)}
+	}
+
+	// The next change of this process changes the generation again
+	indexMutex.Lock()
+	delete(changedWorkspaces, rootDir)
+	indexMutex.Unlock()
+
+	// The stamp is taken first, a change made while the folders are read is seen next time
+	stamp, err := indexStamp(rootDir)
+
+	if err != nil {
+		return index, err
+	}
+
+	if index.Stamp == stamp {
+		return index, nil
+	}
+
+	if _, err := updateIndexFolders(rootDir, "blocks", index.Blocks, indexBlocksFolder); err != nil {
+		return index, err
+	}
+
+	_, err = updateIndexFolders(rootDir, "versions", index.Versions, func(folder string) (indexedFolder, error) {
+		return indexVersionsFolder(rootDir, folder)
+	})
+
+	if err != nil {
+		return index, err
+	}
+
+	index.Stamp = stamp
+
+	// The index is only a cache, when it can not be saved it is built again next time
+	if err := filesystem.FileWriteJSONToFile(path, index); err != nil {
+		logger.Warning[string](fmt.Sprintf("could not save the index of the workspace: %s", err.Error()))
+
+		os.Remove(path)
+	}
+
+	return index, nil
+}
+
+// sortedIndexPaths returns the paths of the folders that use featureName, or of every
+// folder when featureName is empty.
+func sortedIndexPaths(folders map[string]indexedFolder, featureName string) []string {
+	var paths []string = []string{}
+
+	for _, folder := range folders {
+		if _, exists := folder.Features[featureName]; exists || featureName == "" {
+			paths = append(paths, folder.Path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// blocksWithFeature returns the blocks of the files that use featureName, the other
+// files are not read.
+func blocksWithFeature(rootDir string, featureName string) (map[string][]types.BlockFeature, error) {
+	index, err := loadIndex(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var blockSet map[string][]types.BlockFeature = make(map[string][]types.BlockFeature)
+
+	for _, path := range sortedIndexPaths(index.Blocks, featureName) {
+		blocks, err := ListBlocksFromPath(rootDir, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		blockSet[path] = blocks
+	}
+
+	return blockSet, nil
+}
+
+// versionsWithFeature returns the features of the version bases that use featureName,
+// the other bases are not read.
+func versionsWithFeature(rootDir string, featureName string) (map[string][]types.VersionFeature, error) {
+	index, err := loadIndex(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var versionsSet map[string][]types.VersionFeature = make(map[string][]types.VersionFeature)
+
+	for _, path := range sortedIndexPaths(index.Versions, featureName) {
+		features, err := GetVersionFeaturesFromPath(rootDir, utils.HashPath(path))
+
+		if err != nil {
+			return nil, err
+		}
+
+		versionsSet[path] = features
+	}
+
+	return versionsSet, nil
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/costaluu/flag/bubbletea/components"
+	"github.com/costaluu/flag/errs"
+)
+
+// interactive tells whether core may ask questions on the terminal. Embedders and
+// flag --non-interactive turn it off, then confirmations are accepted and every other
+// prompt fails with the decision it was waiting for.
+var interactive bool = true
+
+// SetInteractive enables or disables the prompts of core.
+func SetInteractive(value bool) {
+	interactive = value
+}
+
+// IsInteractive reports whether core may prompt.
+func IsInteractive() bool {
+	return interactive
+}
+
+// requireDecision fails when a decision would need a prompt and prompts are disabled,
+// option names the flag that gives the decision.
+func requireDecision(option string, decision string, args ...any) error {
+	if interactive {
+		return nil
+	}
+
+	return errs.New(errs.InvalidArgument, "%s: prompts are disabled, use %s", fmt.Sprintf(decision, args...), option)
+}
+
+// confirm asks a yes/no question, it is accepted when prompts are disabled.
+func confirm(title string, affirmative string, negative string) bool {
+	if !interactive {
+		return true
+	}
+
+	return components.FormConfirm(title, affirmative, negative)
+}
+
+// ParseStateNames splits a feature/state like checkout+beta into its feature names.
+func ParseStateNames(value string) []string {
+	var names []string = []string{}
+
+	for _, name := range strings.Split(value, "+") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// sameStateNames compares the feature names of two feature/states in any order.
+func sameStateNames(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := slices.Clone(a)
+	sortedB := slices.Clone(b)
+
+	slices.Sort(sortedA)
+	slices.Sort(sortedB)
+
+	return slices.Equal(sortedA, sortedB)
+}
+
+// selectState returns the option of the feature/state named by state, or asks for one
+// when state is empty. Options are titled with their feature names, like a+b.
+func selectState(title string, options []components.ListItem, state string, option string, decision string, args ...any) (components.ListItem, error) {
+	if state == "" {
+		if err := requireDecision(option, decision, args...); err != nil {
+			return components.ListItem{}, err
+		}
+
+		return components.PickerList(title, options), nil
+	}
+
+	var available []string = []string{}
+
+	for _, item := range options {
+		itemTitle := strings.TrimSuffix(item.ItemTitle, currentStateSuffix)
+
+		if sameStateNames(ParseStateNames(itemTitle), ParseStateNames(state)) {
+			return item, nil
+		}
+
+		available = append(available, itemTitle)
+	}
+
+	return components.ListItem{}, errs.New(errs.NotFound, "feature/state %s not found, use one of %s", state, strings.Join(available, ", "))
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/logger"
+)
+
+// journalFolder holds the journal of the operation in progress.
+func journalFolder(rootDir string) string {
+	return filepath.Join(rootDir, ".features", "journal")
+}
+
+// Journaled runs an operation that changes many files, like a toggle or a sync, holding
+// the lock of the workspace. The files written by fn are restored when it fails, or by
+// the next journaled operation when it is interrupted. Operations called by fn join its
+// journal.
+func Journaled(rootDir string, operation string, fn func() error) error {
+	return Locked(rootDir, operation, func() error {
+		exists, err := CheckWorkspaceFolder(rootDir)
+
+		if err != nil || !exists || filesystem.JournalActive(rootDir) {
+			return fn()
+		}
+
+		if err := recoverJournal(rootDir); err != nil {
+			return err
+		}
+
+		// The temporary files of the merges are removed by them
+		if err := filesystem.BeginJournal(rootDir, journalFolder(rootDir), operation, git.TempFolder(rootDir)); err != nil {
+			return errs.Wrap(err, "can not start the journal of %s", operation)
+		}
+
+		if err := fn(); err != nil {
+			kept, rollbackErr := filesystem.EndJournal(rootDir, false)
+
+			if rollbackErr != nil {
+				return errs.New(errs.Internal, "%s failed: %s, and its changes could not be rolled back: %s. run %s doctor --fix", operation, err.Error(), rollbackErr.Error(), constants.COMMAND)
+			}
+
+			warnKept(rootDir, operation, kept)
+
+			return err
+		}
+
+		_, err = filesystem.EndJournal(rootDir, true)
+
+		return err
+	})
+}
+
+// interruptedOperation returns the operation of a journal left by a command that was
+// interrupted, the journal of a command that still holds the lock is in progress.
+func interruptedOperation(rootDir string) (string, bool, error) {
+	if lockedByOther(rootDir) {
+		return "", false, nil
+	}
+
+	operation, exists, err := filesystem.ReadJournal(journalFolder(rootDir))
+
+	if err != nil {
+		return "", false, errs.Wrap(err, "can not read the journal of an interrupted operation, run %s doctor", constants.COMMAND)
+	}
+
+	if operation == "" {
+		operation = "an operation"
+	}
+
+	return operation, exists, nil
+}
+
+// recoverJournal rolls back the operation of a command that was interrupted.
+func recoverJournal(rootDir string) error {
+	if filesystem.JournalActive(rootDir) {
+		return nil
+	}
+
+	operation, exists, err := interruptedOperation(rootDir)
+
+	if err != nil || !exists {
+		return err
+	}
+
+	kept, err := filesystem.RollbackJournal(journalFolder(rootDir))
+
+	if err != nil {
+		return errs.Wrap(err, "can not roll back %s that was interrupted", operation)
+	}
+
+	logger.Warning[string](fmt.Sprintf("%s was interrupted, its changes were rolled back", operation))
+	warnKept(rootDir, operation, kept)
+
+	return nil
+}
+
+// warnKept tells about the files a rollback of operation did not restore because they
+// changed after it wrote them.
+func warnKept(rootDir string, operation string, kept []string) {
+	for _, path := range kept {
+		if relative, err := filepath.Rel(rootDir, path); err == nil {
+			path = filepath.ToSlash(relative)
+		}
+
+		logger.Warning[string](fmt.Sprintf("%s changed after %s wrote it, it was kept as it is", path, operation))
+	}
+}
@@ -0,0 +1,318 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/logger"
+)
+
+// lockHolder is written on the lock file by the process that holds it.
+type lockHolder struct {
+	Pid       int    `json:"pid"`
+	Host      string `json:"host"`
+	Operation string `json:"operation"`
+	Started   string `json:"started"`
+}
+
+// DefaultLockTimeout is how long a command waits for the lock held by another one.
+const DefaultLockTimeout = 10 * time.Second
+
+// lockRetryInterval is how often a busy lock is tried again.
+const lockRetryInterval = 100 * time.Millisecond
+
+var lockTimeout time.Duration = DefaultLockTimeout
+
+// workspaceLock is the lock of a workspace as seen by this process.
+type workspaceLock struct {
+	mutex sync.Mutex
+	// depth counts the operations of this process running with the lock.
+	depth int
+}
+
+var locksMutex sync.Mutex = sync.Mutex{}
+
+// locks are the workspace locks of this process by repository root, operations on
+// different repositories never wait for each other.
+var locks map[string]*workspaceLock = make(map[string]*workspaceLock)
+
+func lockOf(rootDir string) *workspaceLock {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	l, exists := locks[rootDir]
+
+	if !exists {
+		l = &workspaceLock{}
+		locks[rootDir] = l
+	}
+
+	return l
+}
+
+// SetLockTimeout sets how long commands wait for the workspace lock, zero fails at once
+// when another process holds it.
+func SetLockTimeout(timeout time.Duration) {
+	lockTimeout = timeout
+}
+
+// lockPath is the lock file of the workspace.
+func lockPath(rootDir string) string {
+	return filepath.Join(rootDir, ".features", "lock")
+}
+
+// Locked runs an operation that changes the workspace holding its lock, so two flag runs
+// never change it at the same time. A lock held by another process is waited for until
+// the lock timeout, a lock left by a process that is gone is taken over. Operations
+// called by fn run with the same lock.
+func Locked(rootDir string, operation string, fn func() error) error {
+	exists, err := CheckWorkspaceFolder(rootDir)
+
+	if err != nil || !exists {
+		return fn()
+	}
+
+	l := lockOf(rootDir)
+	l.mutex.Lock()
+
+	if l.depth > 0 {
+		l.depth++
+		l.mutex.Unlock()
+
+		defer releaseLock(rootDir)
+
+		return fn()
+	}
+
+	if err := acquireLock(rootDir, operation); err != nil {
+		l.mutex.Unlock()
+
+		return err
+	}
+
+	l.depth = 1
+	l.mutex.Unlock()
+
+	defer releaseLock(rootDir)
+
+	return fn()
+}
+
+// acquireLock creates the lock file, waiting for the process that holds it.
+func acquireLock(rootDir string, operation string) error {
+	host, _ := os.Hostname()
+
+	data, err := json.Marshal(lockHolder{
+		Pid:       os.Getpid(),
+		Host:      host,
+		Operation: operation,
+		Started:   time.Now().Format(time.RFC3339),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	path := lockPath(rootDir)
+	deadline := time.Now().Add(lockTimeout)
+	waiting := false
+
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+
+		if err == nil {
+			_, err = file.Write(data)
+
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				os.Remove(path)
+
+				return errs.Wrap(err, "can not write the lock of the workspace")
+			}
+
+			return nil
+		} else if !os.IsExist(err) {
+			return errs.Wrap(err, "can not lock the workspace")
+		}
+
+		holder, held, err := lockHeld(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		if !held {
+			// The lock was left by a process that is gone
+			if err := takeOverLock(rootDir, holder); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return errs.New(errs.Locked, "the workspace is locked by %s, wait for it to finish or remove %s if no %s command is running", describeHolder(holder), path, constants.COMMAND)
+		}
+
+		if !waiting {
+			logger.Info[string](fmt.Sprintf("waiting for %s to finish", describeHolder(holder)))
+			waiting = true
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// lockGuardFile is the name of the file on the git folder that processes lock while
+// they look at a stale lock and remove it.
+const lockGuardFile = "flag-lock-guard"
+
+// takeOverLock removes the stale lock of stale. Processes hold the lock of the guard
+// file while they do it, so a lock taken by another process after stale was read is
+// seen and never removed.
+func takeOverLock(rootDir string, stale lockHolder) error {
+	path, err := git.GitPath(rootDir, lockGuardFile)
+
+	if err != nil {
+		return errs.Wrap(err, "can not find the lock guard of the workspace")
+	}
+
+	guard, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+
+	if err != nil {
+		return errs.Wrap(err, "can not open the lock guard of the workspace")
+	}
+
+	defer guard.Close()
+
+	if err := lockFile(guard); err != nil {
+		return errs.Wrap(err, "can not lock the lock guard of the workspace")
+	}
+
+	holder, held, err := lockHeld(rootDir)
+
+	if err != nil || held || holder != stale {
+		// Another process took it over first
+		return err
+	}
+
+	if err := os.Remove(lockPath(rootDir)); err != nil && !os.IsNotExist(err) {
+		return errs.Wrap(err, "can not remove the stale lock of the workspace")
+	}
+
+	return nil
+}
+
+// releaseLock removes the lock file when the first operation that took it ends.
+func releaseLock(rootDir string) {
+	l := lockOf(rootDir)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.depth--; l.depth > 0 {
+		return
+	}
+
+	if holder, err := readLockHolder(lockPath(rootDir)); err == nil && holder.Pid == os.Getpid() {
+		os.Remove(lockPath(rootDir))
+	}
+}
+
+func readLockHolder(path string) (lockHolder, error) {
+	var holder lockHolder
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return holder, err
+	}
+
+	err = json.Unmarshal(data, &holder)
+
+	return holder, err
+}
+
+// lockHeld returns the holder of the lock file and reports if it is still held, by a
+// process of this host that is running or by another host.
+func lockHeld(rootDir string) (lockHolder, bool, error) {
+	path := lockPath(rootDir)
+	holder, err := readLockHolder(path)
+
+	if os.IsNotExist(err) {
+		return holder, false, nil
+	} else if err != nil {
+		info, statErr := os.Stat(path)
+
+		if os.IsNotExist(statErr) {
+			return holder, false, nil
+		} else if statErr != nil {
+			return holder, false, errs.Wrap(statErr, "can not read the lock of the workspace")
+		}
+
+		// The holder may be writing it, an unreadable lock older than that is stale
+		return holder, time.Since(info.ModTime()) < time.Minute, nil
+	}
+
+	host, _ := os.Hostname()
+
+	if holder.Host != host {
+		return holder, true, nil
+	}
+
+	// This process does not hold the lock, a lock with its pid was left by another one
+	return holder, holder.Pid != os.Getpid() && processRunning(holder.Pid), nil
+}
+
+// lockedByOther reports if another process holds the lock of the workspace right now.
+func lockedByOther(rootDir string) bool {
+	l := lockOf(rootDir)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.depth > 0 {
+		return false
+	}
+
+	_, held, err := lockHeld(rootDir)
+
+	return err == nil && held
+}
+
+// isRuntimePath reports if path, relative to the repository root, is the lock, the
+// journal or a temporary folder of a running command, they are never committed.
+func isRuntimePath(path string) bool {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+
+	if len(parts) < 2 || parts[0] != ".features" {
+		return false
+	}
+
+	_, isTempFolder := git.TempFolderPid(parts[1])
+
+	return parts[1] == "lock" || parts[1] == "journal" || isTempFolder
+}
+
+func describeHolder(holder lockHolder) string {
+	if holder.Pid == 0 {
+		return "another process"
+	}
+
+	operation := holder.Operation
+
+	if operation == "" {
+		operation = constants.COMMAND
+	}
+
+	return fmt.Sprintf("%s (pid %d on %s since %s)", operation, holder.Pid, holder.Host, holder.Started)
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/costaluu/flag/errs"
+)
+
+// TestLockProcess is run by TestStaleLockRace as one of the processes that take over the
+// lock, it holds the lock it gets until its stdin is closed.
+func TestLockProcess(t *testing.T) {
+	rootDir := os.Getenv("FLAG_LOCK_ROOT")
+
+	if rootDir == "" {
+		t.Skip("only run by TestStaleLockRace")
+	}
+
+	SetLockTimeout(0)
+
+	err := acquireLock(rootDir, "race")
+
+	if err == nil {
+		fmt.Println("locked")
+	} else if errors.Is(err, errs.ErrLocked) {
+		fmt.Println("busy")
+	} else {
+		fmt.Println(err.Error())
+	}
+
+	io.Copy(io.Discard, os.Stdin)
+}
+
+func TestStaleLockRace(t *testing.T) {
+	rootDir := t.TempDir()
+
+	if out, err := exec.Command("git", "-C", rootDir, "init", "-q").CombinedOutput(); err != nil {
+		t.Skipf("git is not available: %v %s", err, out)
+	}
+
+	if err := os.MkdirAll(filepath.Join(rootDir, ".features"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A process that exited leaves a stale lock
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	host, _ := os.Hostname()
+	stale := fmt.Sprintf(`{"pid":%d,"host":%q,"operation":"flag sync"}`, exited.Process.Pid, host)
+
+	for round := 0; round < 10; round++ {
+		if err := os.WriteFile(lockPath(rootDir), []byte(stale), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var stdins []io.WriteCloser
+		var results []*bufio.Reader
+		var processes []*exec.Cmd
+
+		for i := 0; i < 4; i++ {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestLockProcess$")
+			cmd.Env = append(os.Environ(), "FLAG_LOCK_ROOT="+rootDir)
+
+			stdin, err := cmd.StdinPipe()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stdout, err := cmd.StdoutPipe()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			stdins = append(stdins, stdin)
+			results = append(results, bufio.NewReader(stdout))
+			processes = append(processes, cmd)
+		}
+
+		var locked []int
+
+		for i, result := range results {
+			line, err := result.ReadString('\n')
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch strings.TrimSpace(line) {
+			case "locked":
+				locked = append(locked, processes[i].Process.Pid)
+			case "busy":
+			default:
+				t.Errorf("round %d: process %d failed: %s", round, i, line)
+			}
+		}
+
+		holder, err := readLockHolder(lockPath(rootDir))
+
+		if len(locked) != 1 {
+			t.Errorf("round %d: %d processes hold the lock, want 1", round, len(locked))
+		} else if err != nil || holder.Pid != locked[0] {
+			t.Errorf("round %d: the lock is held by %+v %v, want pid %d", round, holder, err, locked[0])
+		}
+
+		for i, stdin := range stdins {
+			stdin.Close()
+			processes[i].Wait()
+		}
+
+		entries, err := os.ReadDir(filepath.Join(rootDir, ".features"))
+
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("round %d: expected only the lock on .features, got %v %v", round, entries, err)
+		}
+	}
+}
@@ -3,35 +3,48 @@ package core
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/git"
 	"github.com/costaluu/flag/logger"
 	"github.com/costaluu/flag/styles"
 	"github.com/costaluu/flag/table"
 	"github.com/costaluu/flag/types"
 )
 
-func ReadPresets() types.Presets {
-	workspaceExists := CheckWorkspaceFolder()
-
-	if !workspaceExists {
-		logger.Result[string]("folder .features doesn't exists, please use switch init")
+func ReadPresets(rootDir string) (types.Presets, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
 	}
 
-	var rootDir string = git.GetRepositoryRoot()
+	var presets types.Presets = make(types.Presets)
+	var path string = filepath.Join(rootDir, ".features", "presets")
 
-	var presets types.Presets
+	// A missing presets file has no presets, flag sync writes it back
+	if !filesystem.FileExists(path) {
+		return presets, nil
+	}
 
-	filesystem.FileReadJSONFromFile(filepath.Join(rootDir, ".features", "presets"), &presets)
+	if err := filesystem.FileReadJSONFromFile(path, &presets); err != nil {
+		return nil, errs.Wrap(err, "could not read presets")
+	}
 
-	return presets
+	return presets, nil
 }
 
-func ListPresets() {
-	presets := ReadPresets()
+func writePresets(rootDir string, presets types.Presets) error {
+	return filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "presets"), presets)
+}
+
+func ListPresets(rootDir string) error {
+	presets, err := ReadPresets(rootDir)
+
+	if err != nil {
+		return err
+	}
 
 	if len(presets) == 0 {
 		logger.Info[string]("No presets created")
@@ -63,24 +76,55 @@ func ListPresets() {
 			table.RenderTable(headers, data)
 		}
 	}
+
+	return nil
+}
+
+// PresetRecords returns a record for each feature of every preset, sorted by preset and feature.
+func PresetRecords(rootDir string) ([]types.PresetRecord, error) {
+	presets, err := ReadPresets(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []types.PresetRecord = []types.PresetRecord{}
+
+	for presetName, featureList := range presets {
+		for featureName, featureState := range featureList {
+			records = append(records, types.PresetRecord{Preset: presetName, Feature: featureName, State: featureState})
+		}
+	}
+
+	sort.Slice(records, func (i, j int) bool {
+		if records[i].Preset != records[j].Preset {
+			return records[i].Preset < records[j].Preset
+		}
+
+		return records[i].Feature < records[j].Feature
+	})
+
+	return records, nil
 }
 
-func CreatePreset(name string, from string) {
-	var rootDir string = git.GetRepositoryRoot()
+func CreatePreset(rootDir string, name string, from string) error {
+	presets, err := ReadPresets(rootDir)
 
-	presets := ReadPresets()
+	if err != nil {
+		return err
+	}
 
 	_, exists := presets[name]
 
 	if exists {
-		logger.Result[string](fmt.Sprintf("preset %s already exists", styles.AccentTextStyle(name)))
+		return errs.New(errs.AlreadyExists, "preset %s already exists", styles.AccentTextStyle(name))
 	}
 
 	if from != "" {
 		_, exists = presets[from]
 
 		if !exists {
-			logger.Result[string](fmt.Sprintf("preset %s does not exists", styles.AccentTextStyle(from)))
+			return errs.New(errs.NotFound, "preset %s does not exists", styles.AccentTextStyle(from))
 		}
 
 		presets[name] = presets[from]
@@ -88,59 +132,65 @@ func CreatePreset(name string, from string) {
 		presets[name] = make(map[string]string)
 	}
 
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "presets"), presets)
+	return writePresets(rootDir, presets)
 }
 
-func SetFeatureToPreset(presetName string, featureName string, featureState string) {
-	var rootDir string = git.GetRepositoryRoot()
+func SetFeatureToPreset(rootDir string, presetName string, featureName string, featureState string) error {
+	presets, err := ReadPresets(rootDir)
 
-	presets := ReadPresets()
+	if err != nil {
+		return err
+	}
 
 	_, exists := presets[presetName]
 
 	if !exists {
-		logger.Result[string](fmt.Sprintf("preset %s doest not exists", styles.AccentTextStyle(presetName)))
+		return errs.New(errs.NotFound, "preset %s doest not exists", styles.AccentTextStyle(presetName))
 	}
 
 	presets[presetName][featureName] = featureState
 
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "presets"), presets)
+	return writePresets(rootDir, presets)
 }
 
-func DeleteFeatureToPreset(presetName string, featureName string) {
-	var rootDir string = git.GetRepositoryRoot()
+func DeleteFeatureToPreset(rootDir string, presetName string, featureName string) error {
+	presets, err := ReadPresets(rootDir)
 
-	presets := ReadPresets()
+	if err != nil {
+		return err
+	}
 
 	_, exists := presets[presetName]
 
 	if !exists {
-		logger.Result[string](fmt.Sprintf("preset %s doest not exists", styles.AccentTextStyle(presetName)))
+		return errs.New(errs.NotFound, "preset %s doest not exists", styles.AccentTextStyle(presetName))
 	}
 
 	_, exists = presets[presetName][featureName]
 
 	if !exists {
-		logger.Result[string](fmt.Sprintf("feature %s does not exists on %s preset", styles.AccentTextStyle(featureName), styles.AccentTextStyle(presetName)))
+		return errs.New(errs.NotFound, "feature %s does not exists on %s preset", styles.AccentTextStyle(featureName), styles.AccentTextStyle(presetName))
 	}
 
 	delete(presets[presetName], featureName)
 
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "presets"), presets)
+	return writePresets(rootDir, presets)
 }
 
-func DeletePreset(name string) {
-	var rootDir string = git.GetRepositoryRoot()
-	
-	presets := ReadPresets()
+func DeletePreset(rootDir string, name string) error {
+	presets, err := ReadPresets(rootDir)
+
+	if err != nil {
+		return err
+	}
 
 	_, exists := presets[name]
 
 	if !exists {
-		logger.Result[string](fmt.Sprintf("preset %s does not exists", styles.AccentTextStyle(name)))
+		return errs.New(errs.NotFound, "preset %s does not exists", styles.AccentTextStyle(name))
 	}
 
 	delete(presets, name)
 
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "presets"), presets)
+	return writePresets(rootDir, presets)
 }
\ No newline at end of file
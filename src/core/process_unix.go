@@ -0,0 +1,16 @@
+//go:build !windows
+
+package core
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning reports if the process pid of this host is running.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+
+	// The process exists but belongs to another user
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
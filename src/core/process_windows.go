@@ -0,0 +1,21 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+)
+
+// processRunning reports if the process pid of this host is running.
+func processRunning(pid int) bool {
+	// FindProcess opens the process on windows, it fails when there is none
+	process, err := os.FindProcess(pid)
+
+	if err != nil {
+		return false
+	}
+
+	process.Release()
+
+	return true
+}
@@ -0,0 +1,386 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/styles"
+	"github.com/costaluu/flag/table"
+	"github.com/costaluu/flag/types"
+)
+
+func defaultFeatureStates() []string {
+	return []string{constants.STATE_ON, constants.STATE_OFF, constants.STATE_DEV}
+}
+
+func ReadRegistry(rootDir string) (types.Registry, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
+	}
+
+	var result types.Registry = make(types.Registry)
+	var path string = filepath.Join(rootDir, ".features", "registry")
+
+	// A missing registry has no features, flag sync writes it back
+	if !filesystem.FileExists(path) {
+		return result, nil
+	}
+
+	if err := filesystem.FileReadJSONFromFile(path, &result); err != nil {
+		return nil, errs.Wrap(err, "could not read the registry")
+	}
+
+	return result, nil
+}
+
+func writeRegistry(rootDir string, registry types.Registry) error {
+	return filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "registry"), registry)
+}
+
+func newRegistryFeature(rootDir string) types.RegistryFeature {
+	return types.RegistryFeature{
+		Owner:     git.GetUserName(rootDir),
+		CreatedAt: time.Now().Format("2006-01-02"),
+		States:    defaultFeatureStates(),
+		Tags:      []string{},
+	}
+}
+
+// variantStates returns the values of a multivariate registry feature.
+func variantStates(feature types.RegistryFeature) []string {
+	var result []string = []string{}
+
+	for _, state := range feature.States {
+		if IsVariantState(state) {
+			result = append(result, state)
+		}
+	}
+
+	return result
+}
+
+// workspaceFeatures returns the features used by blocks and versions with the
+// variants each one uses.
+func workspaceFeatures(rootDir string) (map[string][]string, error) {
+	var features map[string][]string = make(map[string][]string)
+
+	addFeature := func(name string, value string) {
+		values, exists := features[name]
+
+		if !exists {
+			values = []string{}
+		}
+
+		if value != "" && !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+
+		features[name] = values
+	}
+
+	index, err := loadIndex(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, folders := range []map[string]indexedFolder{index.Blocks, index.Versions} {
+		for _, folder := range folders {
+			for name := range folder.Features {
+				addFeature(name, "")
+			}
+
+			for name, values := range folder.Variants {
+				for _, value := range values {
+					addFeature(name, value)
+				}
+			}
+		}
+	}
+
+	return features, nil
+}
+
+// RegisterWorkspaceFeatures adds to the registry the features used by blocks and
+// versions that are not registered yet, it returns their names.
+func RegisterWorkspaceFeatures(rootDir string) ([]string, error) {
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	features, err := workspaceFeatures(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string = []string{}
+
+	for name, values := range features {
+		if _, exists := registry[name]; exists {
+			continue
+		}
+
+		feature := newRegistryFeature(rootDir)
+
+		if len(values) > 0 {
+			feature.States = values
+		}
+
+		registry[name] = feature
+		added = append(added, name)
+	}
+
+	if len(added) > 0 {
+		sort.Strings(added)
+
+		if err := writeRegistry(rootDir, registry); err != nil {
+			return nil, err
+		}
+	}
+
+	return added, nil
+}
+
+// AddFeature registers a feature or updates the fields given for a registered one.
+func AddFeature(rootDir string, name string, description string, owner string, states []string, tags []string) (bool, error) {
+	if len(name) < constants.MIN_FEATURE_CHARACTERS {
+		return false, errs.New(errs.InvalidArgument, "a feature name should have at least %d characters", constants.MIN_FEATURE_CHARACTERS)
+	}
+
+	if strings.ContainsAny(name, " \t()!&|=+") {
+		return false, errs.New(errs.InvalidArgument, "invalid feature name %s", name)
+	}
+
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return false, err
+	}
+
+	feature, exists := registry[name]
+
+	if !exists {
+		feature = newRegistryFeature(rootDir)
+	}
+
+	if description != "" {
+		feature.Description = description
+	}
+
+	if owner != "" {
+		feature.Owner = owner
+	}
+
+	if len(states) > 0 {
+		var normalized []string = []string{}
+
+		for _, state := range states {
+			normalized = append(normalized, NormalizeState(state))
+		}
+
+		variants := variantStates(types.RegistryFeature{States: normalized})
+
+		if len(variants) > 0 && len(variants) != len(normalized) {
+			return false, errs.New(errs.InvalidArgument, "states should be a list of on|off|dev or a list of variants")
+		}
+
+		if len(variants) > 0 {
+			if err := validateVariants(variants); err != nil {
+				return false, err
+			}
+		}
+
+		feature.States = normalized
+	}
+
+	if len(tags) > 0 {
+		feature.Tags = tags
+	}
+
+	registry[name] = feature
+
+	if err := writeRegistry(rootDir, registry); err != nil {
+		return false, err
+	}
+
+	return !exists, nil
+}
+
+func DescribeFeature(rootDir string, name string) error {
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	feature, exists := registry[name]
+
+	if !exists {
+		if err := CheckFeatureName(rootDir, name); err != nil {
+			return err
+		}
+
+		return errs.New(errs.UnknownFeature, "feature %s is not registered, use %s features add %s", name, constants.COMMAND, name)
+	}
+
+	index, err := loadIndex(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	var blocks, blockFiles, versionFiles int
+
+	for _, folder := range index.Blocks {
+		if ids, exists := folder.Features[name]; exists {
+			blocks += len(ids)
+			blockFiles++
+		}
+	}
+
+	for _, folder := range index.Versions {
+		if _, exists := folder.Features[name]; exists {
+			versionFiles++
+		}
+	}
+
+	fmt.Printf("%s\n", styles.AccentTextStyle(name))
+
+	table.RenderTable([]string{"FIELD", "VALUE"}, [][]string{
+		{"DESCRIPTION", feature.Description},
+		{"OWNER", feature.Owner},
+		{"CREATED", feature.CreatedAt},
+		{"STATES", strings.Join(feature.States, ", ")},
+		{"TAGS", strings.Join(feature.Tags, ", ")},
+		{"BLOCKS", fmt.Sprintf("%d block(s) in %d file(s)", blocks, blockFiles)},
+		{"VERSIONS", fmt.Sprintf("%d file(s)", versionFiles)},
+	})
+
+	return nil
+}
+
+func ListFeatures(rootDir string, tag string) error {
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	var titleStyle = 
+			lipgloss.
+				NewStyle().
+				Padding(0, 1).
+				SetString("Features").
+				Background(lipgloss.Color(constants.AccentColor)).
+				Foreground(lipgloss.Color("255")).
+				Bold(true)
+
+	fmt.Printf("\n\n%s\n\n", titleStyle.Render())
+
+	var headers []string = []string{"NAME", "STATES", "OWNER", "CREATED", "TAGS", "DESCRIPTION"}
+	var data [][]string = [][]string{}
+
+	for name, feature := range registry {
+		if tag != "" && !slices.Contains(feature.Tags, tag) {
+			continue
+		}
+
+		data = append(data, []string{name, strings.Join(feature.States, ", "), feature.Owner, feature.CreatedAt, strings.Join(feature.Tags, ", "), feature.Description})
+	}
+
+	if len(data) == 0 {
+		logger.Info[string]("No features registered")
+
+		return nil
+	}
+
+	sort.Slice(data, func(i, j int) bool {
+		return data[i][0] < data[j][0]
+	})
+
+	table.RenderTable(headers, data)
+
+	return nil
+}
+
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// CheckFeatureName returns errs.ErrUnknownFeature when the feature is not registered nor
+// used by blocks and versions, suggesting the closest registered name when it looks like a typo.
+func CheckFeatureName(rootDir string, name string) error {
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	if _, exists := registry[name]; exists {
+		return nil
+	}
+
+	features, err := workspaceFeatures(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	if _, exists := features[name]; exists {
+		return nil
+	}
+
+	var suggestion string
+	var bestDistance int = max(2, len(name)/4) + 1
+
+	for registered := range registry {
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(registered))
+
+		if distance < bestDistance || (distance == bestDistance && registered < suggestion) {
+			suggestion = registered
+			bestDistance = distance
+		}
+	}
+
+	if suggestion != "" {
+		return errs.New(errs.UnknownFeature, "feature %s does not exists, did you mean %s?", name, styles.AccentTextStyle(suggestion))
+	}
+
+	return errs.New(errs.UnknownFeature, "feature %s does not exists, register it with %s features add %s", name, constants.COMMAND, name)
+}
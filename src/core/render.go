@@ -0,0 +1,433 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	filesystem "github.com/costaluu/flag/fs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/merge"
+	"github.com/costaluu/flag/parser"
+	"github.com/costaluu/flag/types"
+	"github.com/costaluu/flag/utils"
+	"github.com/costaluu/flag/workingtree"
+)
+
+// RenderedFile is a file of the repository rendered for a set of feature states.
+type RenderedFile struct {
+	// Path is relative to the repository root.
+	Path    string
+	Content []byte
+	Mode    fs.FileMode
+	// Link is the target of a symbolic link, Content is empty for links.
+	Link string
+}
+
+// RenderOptions configures Render.
+type RenderOptions struct {
+	// States maps features to on, off, dev or a variant, the other features keep
+	// their current state.
+	States map[string]string
+	// Exclude skips the files it accepts, like the output folder.
+	Exclude func(path string) bool
+	// Strip removes the markers of the blocks and keeps only their active content.
+	Strip bool
+	// KeepLines replaces the stripped markers with blank lines, so line numbers don't change.
+	KeepLines bool
+}
+
+// ParseFeatureStates parses a list of feature states like checkout=on,beta=off.
+func ParseFeatureStates(value string) (map[string]string, error) {
+	var states map[string]string = make(map[string]string)
+
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+
+		name, state, found := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		state = strings.TrimSpace(state)
+
+		if !found || name == "" || state == "" {
+			return nil, errs.New(errs.InvalidArgument, "invalid feature state %s, use feature=state", item)
+		}
+
+		states[name] = NormalizeState(state)
+	}
+
+	return states, nil
+}
+
+// Render renders every file of the repository that is not ignored with the features of
+// opts.States toggled, like a toggle of each one followed by a copy of the repository.
+// Files are read from the working tree and the workspace and passed to emit, nothing
+// is written on them.
+func Render(rootDir string, opts RenderOptions, emit func(file RenderedFile) error) error {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return err
+	}
+
+	var names []string = []string{}
+
+	for name, state := range opts.States {
+		if err := CheckFeatureName(rootDir, name); err != nil {
+			return err
+		}
+
+		if err := ValidateFeatureState(rootDir, name, state); err != nil {
+			return err
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	blocksByPath, err := ListAllBlocks(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	versionsByPath, err := ListAllVersionsFeature(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	files, err := git.ListFiles(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if opts.Exclude != nil && opts.Exclude(path) {
+			continue
+		}
+
+		info, err := os.Lstat(filepath.Join(rootDir, path))
+
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			link, err := os.Readlink(filepath.Join(rootDir, path))
+
+			if err != nil {
+				return err
+			}
+
+			if err := emit(RenderedFile{Path: path, Mode: info.Mode(), Link: link}); err != nil {
+				return err
+			}
+
+			continue
+		} else if !info.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := renderFile(rootDir, path, names, opts, blocksByPath[path], versionsByPath[path])
+
+		if err != nil {
+			return err
+		}
+
+		if err := emit(RenderedFile{Path: path, Content: content, Mode: info.Mode().Perm()}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renderFile returns the content of path after toggling names. A version base that
+// changes its state is built from the workspace like BuildBaseForFile, then the blocks
+// are toggled on the content, the one of the file or the built one.
+func renderFile(rootDir string, path string, names []string, opts RenderOptions, blockList []types.BlockFeature, features []types.VersionFeature) ([]byte, error) {
+	var content string
+
+	changed := false
+
+	if len(features) > 0 {
+		versionContent, versionChanged, err := renderVersion(rootDir, path, names, opts.States, features)
+
+		if err != nil {
+			return nil, err
+		}
+
+		content, changed = versionContent, versionChanged
+	}
+
+	if !changed {
+		data, err := os.ReadFile(filepath.Join(rootDir, path))
+
+		if err != nil || len(blockList) == 0 {
+			return data, err
+		}
+
+		content = string(data)
+	}
+
+	if len(names) > 0 && len(blockList) > 0 {
+		var err error
+
+		if content, err = renderBlocks(rootDir, path, content, names, opts.States, blockList); err != nil {
+			return nil, err
+		}
+	}
+
+	// A built version may hold markers of blocks the file does not have anymore
+	if opts.Strip && (len(blockList) > 0 || changed) {
+		return stripBlocks(rootDir, path, content, opts.KeepLines)
+	}
+
+	return []byte(content), nil
+}
+
+// stripBlocks removes the markers of every block of a rendered content, which is like
+// promoting the features that are on and demoting the others without changing the
+// workspace. A block on DEV shows more than one content and can't be stripped. Markers
+// alone on their line are removed with the line, or left as a blank line with keepLines.
+func stripBlocks(rootDir string, path string, content string, keepLines bool) ([]byte, error) {
+	delimeters, err := parserDelimetersFromFile(rootDir, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	document := parser.ParseWithDelimeters(content, delimeters)
+
+	if len(document.Errors) > 0 {
+		return nil, errs.New(errs.InvalidArgument, "can not strip %s:%s", path, document.Errors[0].Error())
+	}
+
+	// Each cut is the [start, end) range of a marker
+	var cuts [][2]int = [][2]int{}
+
+	for _, block := range document.AllBlocks() {
+		if block.Form == parser.FormInline {
+			cuts = append(cuts, [2]int{block.Visible.ContentEnd, block.End.Offset})
+
+			continue
+		} else if block.Form == parser.FormNextLine {
+			cuts = append(cuts, [2]int{block.Start.Offset, block.Visible.Marker.End.Offset})
+
+			continue
+		}
+
+		sections := block.Sections()
+
+		if len(sections) != 1 {
+			return nil, errs.New(errs.InvalidState, "can not strip %s:%d: %s is on dev, set it on or off", path, block.Start.Line, block.Name)
+		}
+
+		cuts = append(cuts, [2]int{sections[0].Marker.Start.Offset, sections[0].Marker.End.Offset})
+		cuts = append(cuts, [2]int{block.Close.Start.Offset, block.Close.End.Offset})
+	}
+
+	for i, cut := range cuts {
+		lineStart := strings.LastIndex(content[:cut[0]], "\n") + 1
+		lineEnd := len(content)
+
+		if next := strings.Index(content[cut[1]:], "\n"); next != -1 {
+			lineEnd = cut[1] + next + 1
+		}
+
+		if strings.TrimSpace(content[lineStart:cut[0]]) == "" && strings.TrimSpace(content[cut[1]:lineEnd]) == "" {
+			cuts[i] = [2]int{lineStart, lineEnd}
+		}
+	}
+
+	sort.Slice(cuts, func(i, j int) bool {
+		return cuts[i][0] < cuts[j][0]
+	})
+
+	var builder strings.Builder
+
+	cursor := 0
+
+	for _, cut := range cuts {
+		if cut[1] <= cursor {
+			continue
+		} else if cut[0] < cursor {
+			cut[0] = cursor
+		}
+
+		builder.WriteString(content[cursor:cut[0]])
+
+		if keepLines {
+			builder.WriteString(strings.Repeat("\n", strings.Count(content[cut[0]:cut[1]], "\n")))
+		}
+
+		cursor = cut[1]
+	}
+
+	builder.WriteString(content[cursor:])
+
+	return []byte(builder.String()), nil
+}
+
+// renderBlocks toggles names on a content of path, blockList is not changed.
+func renderBlocks(rootDir string, path string, content string, names []string, states map[string]string, blockList []types.BlockFeature) (string, error) {
+	blockList = append([]types.BlockFeature{}, blockList...)
+
+	for _, name := range names {
+		render, _ := toggleFeatureRender(name, states[name], blockList)
+
+		newContent, _, _, err := RewriteBlocks(rootDir, path, content, blockList, render)
+
+		if err != nil {
+			return "", err
+		}
+
+		content = newContent
+	}
+
+	return content, nil
+}
+
+// renderVersion returns the content of a version base after toggling names, changed is
+// false when the features turned on stay the same.
+func renderVersion(rootDir string, path string, names []string, states map[string]string, features []types.VersionFeature) (string, bool, error) {
+	var changed bool = false
+	var featuresTurnedOn []types.VersionFeature = []types.VersionFeature{}
+
+	for _, feature := range features {
+		state := feature.State
+
+		for _, name := range names {
+			// Versions have no DEV state, a toggle to DEV turns them on
+			toggle := states[name]
+
+			if toggle == constants.STATE_DEV {
+				toggle = constants.STATE_ON
+			}
+
+			if newState, ok := toggledVersionState(feature, name, toggle); ok {
+				state = newState
+			}
+		}
+
+		if state != feature.State {
+			changed = true
+		}
+
+		if state == constants.STATE_ON {
+			featuresTurnedOn = append(featuresTurnedOn, feature)
+		}
+	}
+
+	if !changed {
+		return "", false, nil
+	}
+
+	content, err := versionContent(rootDir, path, featuresTurnedOn)
+
+	return content, true, err
+}
+
+// versionContent returns the content of a version base with featuresTurnedOn, a state
+// that was never built is merged on a temporary folder and is not saved.
+func versionContent(rootDir string, path string, featuresTurnedOn []types.VersionFeature) (string, error) {
+	folder := filepath.Join(rootDir, ".features", "versions", utils.HashPath(path))
+
+	if len(featuresTurnedOn) == 0 {
+		return filesystem.FileRead(filepath.Join(folder, "base"))
+	}
+
+	var featureIdsTurnedOn []string = []string{}
+	var featureNames map[string]string = make(map[string]string)
+
+	for _, feature := range featuresTurnedOn {
+		featureIdsTurnedOn = append(featureIdsTurnedOn, feature.Id)
+		featureNames[feature.Id] = feature.Name
+	}
+
+	_, workingTreeValue, exists, err := workingtree.FindKeyValue(folder, featureIdsTurnedOn)
+
+	if err != nil {
+		return "", err
+	} else if exists {
+		return filesystem.FileRead(filepath.Join(folder, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
+	}
+
+	nearPrefix, remaining, err := workingtree.FindNearestPrefix(folder, featureIdsTurnedOn)
+
+	if err != nil {
+		return "", err
+	}
+
+	tree, err := workingtree.LoadWorkingTree(folder)
+
+	if err != nil {
+		return "", err
+	}
+
+	var stateNames []string = []string{}
+
+	for _, featureId := range nearPrefix {
+		stateNames = append(stateNames, featureNames[featureId])
+	}
+
+	tempState, exists := tree[workingtree.NormalizeFeatures(nearPrefix)]
+
+	if !exists {
+		return "", errs.New(errs.NotFound, "render %s: couldn't find a state to build %s", path, strings.Join(stateNames, "+"))
+	}
+
+	tempFolder, err := os.MkdirTemp("", "flag-render-")
+
+	if err != nil {
+		return "", err
+	}
+
+	defer os.RemoveAll(tempFolder)
+
+	current := filepath.Join(folder, constants.WorkingTreeDirectory, tempState.SavedCheckSum)
+
+	for _, featureRemainingId := range remaining {
+		soloFeature, exists := tree[fmt.Sprintf("[%s]", featureRemainingId)]
+
+		if !exists {
+			return "", errs.New(errs.NotFound, "render %s: couldn't find feature %s", path, featureNames[featureRemainingId])
+		}
+
+		stateName := strings.Join(stateNames, "+")
+		featureName := featureNames[featureRemainingId]
+
+		result, err := merge.Files(
+			filepath.Join(folder, "base"),
+			current,
+			filepath.Join(folder, constants.WorkingTreeDirectory, soloFeature.SavedCheckSum),
+			stateName,
+			featureName,
+		)
+
+		if err != nil {
+			return "", err
+		} else if result.HasConflicts() {
+			return "", errs.New(errs.MergeConflict, "render %s: merging %s and %s has conflicts, build the state with %s toggle first", path, stateName, featureName, constants.COMMAND)
+		}
+
+		current = filepath.Join(tempFolder, "merge-tmp")
+
+		if err := os.WriteFile(current, []byte(result.Text()), 0644); err != nil {
+			return "", err
+		}
+
+		stateNames = append(stateNames, featureName)
+	}
+
+	return filesystem.FileRead(current)
+}
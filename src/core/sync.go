@@ -5,11 +5,17 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/costaluu/flag/bubbletea/components"
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	filesystem "github.com/costaluu/flag/fs"
 	"github.com/costaluu/flag/git"
 	"github.com/costaluu/flag/logger"
@@ -18,206 +24,469 @@ import (
 	"github.com/costaluu/flag/workingtree"
 )
 
-func handleDeleted(path string) {
-	var rootDir string = git.GetRepositoryRoot()
+func handleDeleted(rootDir string, path string) error {
+	hashedPath := utils.HashPath(path)
+
+	for _, folder := range []string{"blocks", "versions"} {
+		if err := filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features", folder, hashedPath)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Actions for untracked changes on a version base, flag sync --on-untracked takes one
+// of them. save and new-feature take a value, like save:checkout+beta.
+const (
+	UntrackedSaveCurrent string = "save-current"
+	UntrackedSave        string = "save"
+	UntrackedNewFeature  string = "new-feature"
+	UntrackedRebase      string = "rebase"
+	UntrackedUpdateBase  string = "update-base"
+	UntrackedRestore     string = "restore"
+	UntrackedFail        string = "fail"
+)
+
+// SyncOptions configures Sync. OnUntracked is the action for untracked changes on
+// version bases, empty asks for one.
+type SyncOptions struct {
+	All         bool
+	OnUntracked string
+	// Jobs is the number of files scanned at the same time, zero uses one per CPU.
+	Jobs        int
+}
+
+// ParseUntrackedAction splits an --on-untracked value into its action and value.
+func ParseUntrackedAction(value string) (string, string, error) {
+	action, argument, _ := strings.Cut(value, ":")
+
+	switch action {
+	case "", UntrackedSaveCurrent, UntrackedRebase, UntrackedUpdateBase, UntrackedRestore, UntrackedFail:
+		if argument != "" {
+			return "", "", errs.New(errs.InvalidArgument, "--on-untracked %s doesn't take a value", action)
+		}
 
+		return action, "", nil
+	case UntrackedSave, UntrackedNewFeature:
+		if argument == "" {
+			return "", "", errs.New(errs.InvalidArgument, "--on-untracked %s needs a value, like %s:<name>", action, action)
+		}
+
+		return action, argument, nil
+	}
+
+	return "", "", errs.New(errs.InvalidArgument, "invalid --on-untracked %s, use save-current, save:<state>, new-feature:<name>, rebase, update-base, restore or fail", value)
+}
+
+func validateNewFeatureName(path string, features []types.VersionFeature, value string) error {
+	for _, feature := range features {
+		if feature.Name == value {
+			return errs.New(errs.AlreadyExists, "%s already exists for %s", value, path)
+		}
+	}
+
+	if len(value) < constants.MIN_FEATURE_CHARACTERS {
+		return errs.New(errs.InvalidArgument, "please provide a name with at least %d characters", constants.MIN_FEATURE_CHARACTERS)
+	} else if strings.Contains(value, "+") {
+		return errs.New(errs.InvalidArgument, "strings can not contain special characters")
+	}
+
+	return nil
+}
+
+// askUntrackedAction asks what to do with the untracked changes of a version base.
+func askUntrackedAction(rootDir string, path string, features []types.VersionFeature) (string, string, error) {
 	hashedPath := utils.HashPath(path)
 
-	blockExists := filesystem.FileFolderExists(filepath.Join(rootDir, "blocks", hashedPath))
-	
-	if blockExists {
-		filesystem.FileDeleteFolder(filepath.Join(rootDir, "blocks", hashedPath))
+	name, err := GetCurrentStateName(rootDir, path)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return "", "", err
 	}
 
-	versionExists := filesystem.FileFolderExists(filepath.Join(rootDir, "versions", hashedPath))
+	var options []huh.Option[string] = []huh.Option[string]{
+				{
+					Key: "Save changes to the current feature/state" + fmt.Sprintf(" (%s)", name),
+					Value: UntrackedSaveCurrent,
+				},
+				{
+					Key: "Save changes to a specific feature/state",
+					Value: UntrackedSave,
+				},
+				{
+					Key: "Create a new feature with the change",
+					Value: UntrackedNewFeature,
+				},
+				{
+					Key: fmt.Sprintf("Rebase (merge changes to all [%d] features/states)", len(tree)),
+					Value: UntrackedRebase,
+				},
+				{
+					Key: "See diff between files",
+					Value: "diff",
+				},
+				{
+					Key: "Restore changes",
+					Value: UntrackedRestore,
+				},
+			}
+
+	if len(features) == 0 {
+		var newOptions []huh.Option[string] = []huh.Option[string]{
+			{
+				Key: "Update base",
+				Value: UntrackedUpdateBase,
+			},
+			{
+				Key: "Create a new feature with the change",
+				Value: UntrackedNewFeature,
+			},
+			{
+				Key: "See diff between files",
+				Value: "diff",
+			},
+			{
+				Key: "Restore changes",
+				Value: UntrackedRestore,
+			},
+		}
+
+		options = newOptions
+	}
+				
+	logger.Info[string](fmt.Sprintf("we detected untracked changes on %s that is a version base\n", path))
 	
-	if versionExists {
-		filesystem.FileDeleteFolder(filepath.Join(rootDir, "versions", hashedPath))
+	for {
+		selected := components.FormSelect("What should we do?", options)
+
+		if selected == UntrackedNewFeature {
+			featureName := components.FormInput("What's the name of the feature?", func (value string) error {
+				return validateNewFeatureName(path, features, value)
+			})
+
+			return selected, featureName, nil
+		} else if selected != "diff" {
+			return selected, "", nil
+		}
+
+		currentTrackedPath, currentStateName, err := VersionsGetCurrentStatePath(rootDir, path)
+
+		if err != nil {
+			return "", "", err
+		}
+
+		utils.DiffCurrentTrackedVersionWithCurrentVersion(rootDir, currentStateName, currentTrackedPath, filepath.Join(rootDir, path))
 	}
 }
 
-func handleVersion(path string) {
-	var rootDir string = git.GetRepositoryRoot()
-
+func handleVersion(rootDir string, path string, onUntracked string) error {
 	hashedPath := utils.HashPath(path)
 
 	versionExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
 
-	if versionExists {	
-		hasChangesWithoutSave := VersionLookForUntrackedChanges(path)
-
-		name := GetCurrentStateName(path)
-		tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
-		features := GetVersionFeaturesFromPath(hashedPath)
-
-		if hasChangesWithoutSave {
-			var options []huh.Option[string] = []huh.Option[string]{
-						{
-							Key: "Save changes to the current feature/state" + fmt.Sprintf(" (%s)", name),
-							Value: "save to current state",
-						},
-						{
-							Key: "Save changes to a specific feature/state",
-							Value: "save to feature/state",
-						},
-						{
-							Key: "Create a new feature with the change",
-							Value: "create feature",
-						},
-						{
-							Key: fmt.Sprintf("Rebase (merge changes to all [%d] features/states)", len(tree)),
-							Value: "rebase",
-						},
-						{
-							Key: "See diff between files",
-							Value: "diff",
-						},
-						{
-							Key: "Restore changes",
-							Value: "cancel",
-						},
-					}
-
-			if len(features) == 0 {
-				var newOptions []huh.Option[string] = []huh.Option[string]{
-					{
-						Key: "Update base",
-						Value: "update base",
-					},
-					{
-						Key: "Create a new feature with the change",
-						Value: "create feature",
-					},
-					{
-						Key: "See diff between files",
-						Value: "diff",
-					},
-					{
-						Key: "Restore changes",
-						Value: "cancel",
-					},
-				}
+	if !versionExists {
+		return nil
+	}
 
-				options = newOptions
-			}
-						
-			logger.Info[string](fmt.Sprintf("we detected untracked changes on %s that is a version base\n", path))
-			stayInLoop := true
-			
-			for stayInLoop {
-				stayInLoop = false
-				selected := components.FormSelect("What should we do?", options)
-
-				if selected == "update base" {
-					VersionUpdateBase(path, false)
-				} else if selected == "rebase" {
-					RebaseFile(path, false)
-				} else if selected == "create feature" {
-					featureName := components.FormInput("What's the name of the feature?", func (value string) error {
-						for _, feature := range features {
-							if feature.Name == value {
-								return fmt.Errorf("%s already exists for %s", value, path)
-							}
-						}
-
-						if len(value) < constants.MIN_FEATURE_CHARACTERS {
-							return fmt.Errorf("please provide a name with at least %d characters", constants.MIN_FEATURE_CHARACTERS)
-						} else if strings.Contains(value, "+") {
-							return fmt.Errorf("strings can not contain special characters")
-						}
-
-						return nil
-					})
+	hasChangesWithoutSave, err := VersionLookForUntrackedChanges(rootDir, path)
 
-					VersionNewFeature(path, featureName, false, false)
-				} else if selected == "save to current state" {
-					VersionSaveToCurrentState(path)
-				} else if selected == "save to feature/state" {
-					VersionSave(path, false)
-				} else if selected == "diff" {
-					stayInLoop = true
-					currentTrackedPath, currentStateName := VersionsGetCurrentStatePath(path)
+	if err != nil || !hasChangesWithoutSave {
+		return err
+	}
 
-					utils.DiffCurrentTrackedVersionWithCurrentVersion(currentStateName, currentTrackedPath, filepath.Join(rootDir, path))
-				} else {
-					BuildBaseForFile(path)
-				}
-			}
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return err
+	}
+
+	action, argument, err := ParseUntrackedAction(onUntracked)
+
+	if err != nil {
+		return err
+	}
+
+	if action == "" {
+		if err := requireDecision("--on-untracked", "untracked changes on %s that is a version base", path); err != nil {
+			return err
+		}
+
+		action, argument, err = askUntrackedAction(rootDir, path, features)
+
+		if err != nil {
+			return err
 		}
 	}
+
+	if len(features) == 0 && (action == UntrackedSaveCurrent || action == UntrackedSave || action == UntrackedRebase) {
+		return errs.New(errs.InvalidState, "%s has no features yet, use update-base or new-feature", path)
+	} else if len(features) > 0 && action == UntrackedUpdateBase {
+		return errs.New(errs.InvalidState, "%s has features, use rebase to change all of them", path)
+	}
+
+	switch action {
+	case UntrackedUpdateBase:
+		return VersionUpdateBase(rootDir, path, false)
+	case UntrackedRebase:
+		return RebaseFile(rootDir, path, false)
+	case UntrackedNewFeature:
+		if err := validateNewFeatureName(path, features, argument); err != nil {
+			return err
+		}
+
+		return VersionNewFeature(rootDir, path, argument, false, false)
+	case UntrackedSaveCurrent:
+		return VersionSaveToCurrentState(rootDir, path)
+	case UntrackedSave:
+		return VersionSave(rootDir, path, argument, false)
+	case UntrackedFail:
+		return errs.New(errs.InvalidState, "%s has untracked changes and is a version base", path)
+	}
+
+	return BuildBaseForFile(rootDir, path)
+}
+
+// variantValues returns the variants of a block without their contents, the contents
+// are only kept on the .block file while a variant is not visible.
+func variantValues(variants []types.Variant) []types.Variant {
+	var result []types.Variant
+
+	for _, variant := range variants {
+		result = append(result, types.Variant{Value: variant.Value})
+	}
+
+	return result
 }
 
-func HandleBlock(path string) {
-	var rootDir string = git.GetRepositoryRoot()
+func warnUndeclaredVariants(path string, match types.Match, featureVariants types.FeatureVariants) {
+	declared, exists := featureVariants[match.FeatureName]
+
+	if !exists {
+		return
+	}
+
+	for _, variant := range match.Variants {
+		if !slices.Contains(declared, variant.Value) {
+			logger.Warning[string](fmt.Sprintf("%s:%d:%d: variant %s=%s is not declared, use %s", path, match.Line, match.Column, match.FeatureName, variant.Value, strings.Join(declared, "|")))
+		}
+	}
+}
 
+func HandleBlock(rootDir string, path string) error {
 	hashedPath := utils.HashPath(path)
 
 	blockExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "blocks", hashedPath))
 
-	matches := ExtractMatchDataFromFile(filepath.Join(rootDir, path))
-	
-	if len(matches) > 0 && !blockExists {
-		filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "blocks", hashedPath))
-		filesystem.FileWriteContentToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, "_path"), path)
-	} else if blockExists && len(matches) == 0 {
-		filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features", "blocks", hashedPath))
+	var features []types.BlockFeature = []types.BlockFeature{}
+
+	if blockExists {
+		blocks, err := ListBlocksFromPath(rootDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		features = blocks
 	}
 
-	if len(matches) > 0 {
-		UnSyncAllBlocksFromPath(path)
+	for i := range features {
+		features[i].Synced = false
+	}
 
-		features := ListBlocksFromPath(path)
+	var foundBlocks int = 0
 
-		for _, match := range matches {
-			if match.FoundId {
-				var found bool = false
+	featureVariants, err := ReadVariants(rootDir)
 
-				for i := 0; i < len(features); i++ {
-					if features[i].Id == match.Id {
-						found = true;
-						features[i].Synced = true
-						break;
-					}
-				}
-				
-				if found {
-					continue
+	if err != nil {
+		return err
+	}
+
+	_, _, err = RewriteBlocksOnPath(rootDir, path, nil, func(match types.Match) (string, bool) {
+		foundBlocks++
+
+		warnUndeclaredVariants(path, match, featureVariants)
+
+		if match.FoundId {
+			if i := findBlockById(features, match.Id); i != -1 {
+				features[i].Synced = true
+
+				// Variants added while the block shows all of them
+				if features[i].State == constants.STATE_DEV && len(match.Variants) > 0 {
+					features[i].Variants = variantValues(match.Variants)
 				}
+
+				return "", false
 			}
+		}
+
+		features = append(features, types.BlockFeature{
+			Id: match.Id,
+			Name: match.FeatureName,
+			Synced: true,
+			State: constants.STATE_DEV,
+			Features: NewBlockFeatureStates(match.FeatureName),
+			Variants: variantValues(match.Variants),
+			SwapContent: "",
+		})
 
-			oldString := GetFeatureTypeDelimeterString(match, match.FoundId)
+		if len(match.Variants) > 0 {
+			match.MatchType = "VARIANTS + DEFAULT"
+		} else if !IsLineMatch(match) {
 			match.MatchType = "FEATURE + DEFAULT"
-			newString := GetFeatureTypeDelimeterString(match, true)
+		}
 
-			ReplaceStringInFile(filepath.Join(rootDir, path), oldString, newString)
+		return GetFeatureTypeDelimeterString(match, true), true
+	})
 
-			features = append(features, types.BlockFeature{
-				Id: match.Id,
-				Name: match.FeatureName,
-				Synced: true,
-				State: constants.STATE_DEV,
-				SwapContent: "",
-			})
+	if err != nil {
+		return err
+	}
+
+	if foundBlocks > 0 && !blockExists {
+		if err := filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "blocks", hashedPath)); err != nil {
+			return err
+		}
+
+		if err := filesystem.FileWriteContentToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, "_path"), path); err != nil {
+			return err
+		}
+	} else if blockExists && foundBlocks == 0 {
+		return filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features", "blocks", hashedPath))
+	}
+
+	if foundBlocks == 0 {
+		return nil
+	}
+
+	if err := SyncHiddenBlocks(rootDir, path, features); err != nil {
+		return err
+	}
+
+	for _, feature := range features {
+		if err := filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", feature.Id)), feature); err != nil {
+			return err
+		}
+	}
+
+	return RemoveAllUnsyncedBlocksFromPath(rootDir, path)
+}
+
+// recoverTrackedPaths marks as untracked every file with a folder on .features/<folder>.
+func recoverTrackedPaths(rootDir string, folder string, files map[string]types.FilePathCategory) error {
+	return filepath.WalkDir(filepath.Join(rootDir, ".features", folder), func (path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
 
-		for _, feature := range features {
-			filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "blocks", hashedPath, fmt.Sprintf("%s.block", feature.Id)), feature)
+		if d.IsDir() && filepath.Join(rootDir, ".features", folder) != path {
+			recoveredPath, err := filesystem.FileRead(filepath.Join(path, "_path"))
+
+			if err != nil {
+				return err
+			}
+
+			var action string = "untracked"
+
+			// The file was deleted by a commit, its folder is removed
+			if !filesystem.FileExists(filepath.Join(rootDir, recoveredPath)) {
+				action = "delete"
+			}
+
+			files[recoveredPath] = types.FilePathCategory{
+				Path: recoveredPath,
+				Action: []string{action},
+			}
+
+			return fs.SkipDir
 		}
 
-		RemoveAllUnsyncedBlocksFromPath(path)		
+		return nil
+	})
+}
+
+// scanFiles updates the blocks of the files, and the workspace folders of the deleted
+// ones, with a pool of jobs workers. The first error stops the files not started yet.
+func scanFiles(rootDir string, files []types.FilePathCategory, jobs int) error {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	var queue chan types.FilePathCategory = make(chan types.FilePathCategory)
+	var stop chan struct{} = make(chan struct{})
+	var stopOnce sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+
+	for i := 0; i < min(jobs, len(files)); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for path := range queue {
+				var err error
+
+				if slices.Contains(path.Action, "delete") {
+					err = handleDeleted(rootDir, path.Path)
+				} else {
+					err = HandleBlock(rootDir, path.Path)
+				}
+
+				if err != nil {
+					stopOnce.Do(func() {
+						firstErr = errs.Wrap(err, "%s", path.Path)
+						close(stop)
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, path := range files {
+		select {
+		case queue <- path:
+		case <-stop:
+			break feed
+		}
 	}
+
+	close(queue)
+	wg.Wait()
+
+	return firstErr
 }
 
-func Sync(hardSync bool) {
-	modified := git.GetModifedFiles()
-	untracked := git.GetUntrackedFiles()
-	deleted := git.GetDeletedFiles()
+func Sync(rootDir string, opts SyncOptions) error {
+	// Sync is the command that brings back the missing parts of a workspace
+	exists, err := RepairWorkspace(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errs.ErrWorkspaceNotFound
+	}
+
+	if _, _, err := ParseUntrackedAction(opts.OnUntracked); err != nil {
+		return err
+	}
 
-	workspaceExists := CheckWorkspaceFolder()
+	status, err := git.GetStatus(rootDir)
 
-	if !workspaceExists {
-		logger.Result[string]("workspace not found, use flag init")
+	if err != nil {
+		return err
 	}
+
+	modified, untracked, deleted := status.Modified, status.Untracked, status.Deleted
 	
 	var files map[string]types.FilePathCategory = make(map[string]types.FilePathCategory)
 
@@ -250,79 +519,54 @@ func Sync(hardSync bool) {
 			}
 	}
 
-	if hardSync {
-		var rootDir string = git.GetRepositoryRoot()
-
-		err := filepath.WalkDir(filepath.Join(rootDir, ".features", "blocks"), func (path string, d os.DirEntry, err error) error {
-			if err != nil {
-				logger.Fatal[error](err)
+	if opts.All {
+		for _, folder := range []string{"blocks", "versions"} {
+			if err := recoverTrackedPaths(rootDir, folder, files); err != nil {
+				return errs.Wrap(err, "couldn't get all files")
 			}
+		}
+	}
 
-			if d.IsDir() && filepath.Join(rootDir, ".features", "blocks") != path {
-				recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
-
-				files[recoveredPath] = types.FilePathCategory{
-					Path: recoveredPath,
-					Action: []string{"untracked"},
-				}
-
-				return fs.SkipDir
-			}
+	var arrayFile []types.FilePathCategory = []types.FilePathCategory{}
 
-			return nil
-		})
+	for _, file := range files {
+		arrayFile = append(arrayFile, file)
+	}
 
-		if err != nil {
-			logger.Result[string](fmt.Sprintf("couldn't get all files"))
-		}
+	sort.Slice(arrayFile, func(i, j int) bool {
+		return arrayFile[i].Path < arrayFile[j].Path
+	})
 
-		err = filepath.WalkDir(filepath.Join(rootDir, ".features", "versions"), func (path string, d os.DirEntry, err error) error {
-			if err != nil {
-				logger.Fatal[error](err)
-			}
+	start := time.Now()
 
-			if d.IsDir() && filepath.Join(rootDir, ".features", "versions") != path {
-				recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
+	if err := scanFiles(rootDir, arrayFile, opts.Jobs); err != nil {
+		return err
+	}
 
-				files[recoveredPath] = types.FilePathCategory{
-					Path: recoveredPath,
-					Action: []string{"untracked"},
-				}
-				
-				return fs.SkipDir
+	// Versions may prompt and merge, they are handled one file at a time
+	for _, path := range arrayFile {
+		if !slices.Contains(path.Action, "delete") {
+			if err := handleVersion(rootDir, path.Path, opts.OnUntracked); err != nil {
+				return errs.Wrap(err, "%s", path.Path)
 			}
+		}
 
-			return nil
-		})
+		fmt.Fprintf(logger.Output(), "%s %s\n", constants.CheckMark.Render(), path.Path)
+	}
 
-		if err != nil {
-			logger.Result[string](fmt.Sprintf("couldn't get all files"))
-		}
+	if len(arrayFile) > 0 {
+		logger.Info[string](fmt.Sprintf("%d file(s) synced in %s", len(arrayFile), time.Since(start).Round(time.Millisecond)))
 	}
 
-	var arrayFile []types.FilePathCategory = []types.FilePathCategory{}
+	added, err := RegisterWorkspaceFeatures(rootDir)
 
-	for _, file := range files {
-		arrayFile = append(arrayFile, file)
+	if err != nil {
+		return err
 	}
 
-	runner := func (path types.FilePathCategory) {
-		for _, action := range path.Action {
-			if action == "delete" {
-				handleDeleted(path.Path)
-			} else if action == "modified" {
-				HandleBlock(path.Path)
-				handleVersion(path.Path)
-			} else {
-				HandleBlock(path.Path)
-				handleVersion(path.Path)
-			}
-		}
+	if len(added) > 0 {
+		logger.Info[string](fmt.Sprintf("%d feature(s) added to the registry: %s", len(added), strings.Join(added, ", ")))
 	}
 
-	for _, path := range arrayFile {
-		runner(path)
-
-		fmt.Printf("%s %s\n", constants.CheckMark.Render(), path.Path)
-	}
-}
\ No newline at end of file
+	return nil
+}
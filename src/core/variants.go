@@ -0,0 +1,235 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/styles"
+	"github.com/costaluu/flag/table"
+	"github.com/costaluu/flag/types"
+)
+
+// ReadVariants returns the values of the multivariate features on the registry.
+func ReadVariants(rootDir string) (types.FeatureVariants, error) {
+	var featureVariants types.FeatureVariants = make(types.FeatureVariants)
+
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, feature := range registry {
+		if values := variantStates(feature); len(values) > 0 {
+			featureVariants[name] = values
+		}
+	}
+
+	return featureVariants, nil
+}
+
+func ListVariants(rootDir string) error {
+	featureVariants, err := ReadVariants(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	if len(featureVariants) == 0 {
+		logger.Info[string]("No variants declared")
+
+		return nil
+	}
+
+	var titleStyle = 
+			lipgloss.
+				NewStyle().
+				Padding(0, 1).
+				SetString("Variants").
+				Background(lipgloss.Color(constants.AccentColor)).
+				Foreground(lipgloss.Color("255")).
+				Bold(true)
+
+	fmt.Printf("\n\n%s\n\n", titleStyle.Render())
+
+	var headers []string = []string{"FEATURE", "VALUES"}
+	var data [][]string = [][]string{}
+
+	for featureName, values := range featureVariants {
+		data = append(data, []string{featureName, strings.Join(values, ", ")})
+	}
+
+	sort.Slice(data, func(i, j int) bool {
+		return data[i][0] < data[j][0]
+	})
+
+	table.RenderTable(headers, data)
+
+	return nil
+}
+
+func validateVariants(values []string) error {
+	var seen map[string]bool = make(map[string]bool)
+
+	for _, value := range values {
+		if !IsVariantState(NormalizeState(value)) {
+			return errs.New(errs.InvalidArgument, "%s is a reserved state and can't be a variant", value)
+		}
+
+		if strings.ContainsAny(value, " \t()!&|=+") {
+			return errs.New(errs.InvalidArgument, "invalid variant %s", value)
+		}
+
+		if seen[value] {
+			return errs.New(errs.InvalidArgument, "variant %s is repeated", value)
+		}
+
+		seen[value] = true
+	}
+
+	return nil
+}
+
+func SetFeatureVariants(rootDir string, featureName string, values []string) error {
+	if len(featureName) < constants.MIN_FEATURE_CHARACTERS {
+		return errs.New(errs.InvalidArgument, "a feature name should have at least %d characters", constants.MIN_FEATURE_CHARACTERS)
+	}
+
+	if err := validateVariants(values); err != nil {
+		return err
+	}
+
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	feature, exists := registry[featureName]
+
+	if !exists {
+		feature = newRegistryFeature(rootDir)
+	}
+
+	feature.States = values
+	registry[featureName] = feature
+
+	return writeRegistry(rootDir, registry)
+}
+
+// DeleteFeatureVariants turns a multivariate feature back into an on/off feature.
+func DeleteFeatureVariants(rootDir string, featureName string) error {
+	registry, err := ReadRegistry(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	feature, exists := registry[featureName]
+
+	if !exists || len(variantStates(feature)) == 0 {
+		return errs.New(errs.NotFound, "feature %s has no variants declared", styles.AccentTextStyle(featureName))
+	}
+
+	feature.States = defaultFeatureStates()
+	registry[featureName] = feature
+
+	return writeRegistry(rootDir, registry)
+}
+
+// SplitFeatureValue splits a `name=value` feature name, the value is empty for
+// features that are not multivariate.
+func SplitFeatureValue(name string) (string, string) {
+	index := strings.IndexByte(name, '=')
+
+	if index == -1 {
+		return name, ""
+	}
+
+	return name[:index], name[index+1:]
+}
+
+// FeatureValues returns the values allowed for a feature. Declared values take
+// precedence, features that were never declared accept the variants already used by
+// blocks and versions.
+func FeatureValues(rootDir string, featureName string) ([]string, error) {
+	featureVariants, err := ReadVariants(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if declared, exists := featureVariants[featureName]; exists {
+		return declared, nil
+	}
+
+	index, err := loadIndex(rootDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string = []string{}
+
+	for _, folders := range []map[string]indexedFolder{index.Blocks, index.Versions} {
+		var names []string = []string{}
+
+		for name := range folders {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			for _, value := range folders[name].Variants[featureName] {
+				values = appendUnique(values, value)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// ValidateFeatureState returns errs.ErrInvalidState when state is not allowed for the
+// feature, either a variant that is not declared or a state left out of its registry entry.
+func ValidateFeatureState(rootDir string, featureName string, state string) error {
+	if !IsVariantState(state) {
+		registry, err := ReadRegistry(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		feature, exists := registry[featureName]
+
+		if exists && len(variantStates(feature)) == 0 && !slices.Contains(feature.States, state) {
+			return errs.New(errs.InvalidState, "feature %s does not allow %s. use %s", featureName, strings.ToLower(state), strings.ToLower(strings.Join(feature.States, "|")))
+		}
+
+		return nil
+	}
+
+	values, err := FeatureValues(rootDir, featureName)
+
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if value == state {
+			return nil
+		}
+	}
+
+	if len(values) == 0 {
+		return errs.New(errs.InvalidState, "feature %s has no variants, use on|off|dev or declare them with %s variants set", featureName, constants.COMMAND)
+	}
+
+	return errs.New(errs.InvalidState, "feature %s has no variant %s. use %s", featureName, state, strings.Join(values, "|"))
+}
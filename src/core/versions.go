@@ -8,14 +8,17 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/costaluu/flag/bubbletea/components"
 	"github.com/costaluu/flag/bubbletea/conflict"
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	filesystem "github.com/costaluu/flag/fs"
 	"github.com/costaluu/flag/git"
 	"github.com/costaluu/flag/logger"
+	"github.com/costaluu/flag/merge"
 	"github.com/costaluu/flag/styles"
 	"github.com/costaluu/flag/table"
 	"github.com/costaluu/flag/types"
@@ -23,85 +26,153 @@ import (
 	"github.com/costaluu/flag/workingtree"
 )
 
-func ListAllVersionsFeature() map[string][]types.VersionFeature {
-	var versionsSet map[string][]types.VersionFeature = make(map[string][]types.VersionFeature)
+// walkVersionBases calls fn with the folder and the path of every version base.
+func walkVersionBases(rootDir string, fn func(folder string, path string) error) error {
+	var versionsFolder string = filepath.Join(rootDir, ".features", "versions")
 
-	var rootDir string = git.GetRepositoryRoot()
+	// flag sync brings back a missing versions folder
+	if !filesystem.FileFolderExists(versionsFolder) {
+		return nil
+	}
 
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "versions"), func (path string, d os.DirEntry, err error) error {
+	return filepath.WalkDir(versionsFolder, func (path string, d os.DirEntry, err error) error {
 		if err != nil {
-			logger.Fatal[error](err)
+			return err
 		}
 
-		if d.IsDir() && filepath.Join(rootDir, ".features", "versions") != path {
-			recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
-			versionsSet[recoveredPath] = GetVersionFeaturesFromPath(utils.HashPath(recoveredPath))
-			
+		if d.IsDir() && versionsFolder != path {
+			recoveredPath, err := filesystem.FileRead(filepath.Join(path, "_path"))
+
+			if err != nil {
+				return err
+			}
+
+			if err := fn(path, recoveredPath); err != nil {
+				return err
+			}
+
 			return fs.SkipDir
 		}
 
 		return nil
 	})
+}
 
-	if err != nil {
-		logger.Fatal[error](err)
+// requireVersionBase returns errs.ErrNotBaseFile when path is not a version base.
+func requireVersionBase(rootDir string, path string) error {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return err
+	}
+
+	if !filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", utils.HashPath(path))) {
+		return errs.New(errs.NotBaseFile, "%s is not a base file", path)
 	}
 
-	return versionsSet
+	return nil
 }
 
-func ToggleVersionFeature(featureName string, state string) {
-	versionsSet := ListAllVersionsFeature()
+func ListAllVersionsFeature(rootDir string) (map[string][]types.VersionFeature, error) {
+	var versionsSet map[string][]types.VersionFeature = make(map[string][]types.VersionFeature)
 
-	var foundFeature bool = false
+	err := walkVersionBases(rootDir, func(folder string, path string) error {
+		features, err := GetVersionFeaturesFromPath(rootDir, utils.HashPath(path))
 
-	for _, blockList := range versionsSet {
-		if foundFeature {
-			break
+		if err != nil {
+			return err
 		}
 
-		for _, block := range blockList {
-			if block.Name == featureName {
-				foundFeature = true
-				
-				break;
-			}
-		}
+		versionsSet[path] = features
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return versionsSet, nil
+}
+
+func ToggleVersionFeature(rootDir string, featureName string, state string) error {
+	// Only the bases that have the feature are read and built again
+	versionsSet, err := versionsWithFeature(rootDir, featureName)
+
+	if err != nil {
+		return err
 	}
 
-	if !foundFeature {
+	if len(versionsSet) == 0 {
 		logger.Info[string](fmt.Sprintf("feature %s does not exists on versions", featureName))
-		return
+		return nil
+	}
+
+	if err := ValidateFeatureState(rootDir, featureName, state); err != nil {
+		return err
 	}
 
 	for path, features := range versionsSet {
-		ToggleVersionFeatureOnPath(path, featureName, state, features)
+		if err := ToggleVersionFeatureOnPath(rootDir, path, featureName, state, features); err != nil {
+			return err
+		}
 	}
 
 	var stateStyle string
 
-	if state == constants.STATE_ON {
-		stateStyle = styles.GreenTextStyle(state)
-	} else {
+	if state == constants.STATE_OFF {
 		stateStyle = styles.RedTextStyle(state)
+	} else {
+		stateStyle = styles.GreenTextStyle(state)
 	}
 
 	logger.Success[string](fmt.Sprintf("feature %s toggled %s", styles.AccentTextStyle(featureName), stateStyle))
-}
 
-func ToggleVersionFeatureOnPath(path string, featureName string, state string, features []types.VersionFeature) {
-	var rootDir string = git.GetRepositoryRoot()
+	return nil
+}
 
+func ToggleVersionFeatureOnPath(rootDir string, path string, featureName string, state string, features []types.VersionFeature) error {
 	for _, feature := range features {
-		if feature.Name == featureName {
-			feature.State = state
+		newState, ok := toggledVersionState(feature, featureName, state)
+
+		if !ok {
+			continue
+		}
+
+		feature.State = newState
+
+		hashedPath := utils.HashPath(path)
+
+		if err := filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", feature.Id)), feature); err != nil {
+			return err
+		}
+	}
+
+	return BuildBaseForFile(rootDir, path)
+}
 
-			hashedPath := utils.HashPath(path)
-			filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", feature.Id)), feature)
+// toggledVersionState returns the state of a feature of a version base after toggling
+// featureName to state, ok is false when the toggle doesn't change the feature.
+func toggledVersionState(feature types.VersionFeature, featureName string, state string) (string, bool) {
+	name, value := SplitFeatureValue(feature.Name)
+
+	if name != featureName {
+		return "", false
+	}
+
+	// Each value of a multivariate feature is saved as its own feature, selecting
+	// a value turns it on and the other values off
+	if value == "" && IsVariantState(state) {
+		return constants.STATE_ON, true
+	} else if value == "" || state == constants.STATE_OFF {
+		return state, true
+	} else if IsVariantState(state) {
+		if value == state {
+			return constants.STATE_ON, true
 		}
+
+		return constants.STATE_OFF, true
 	}
 
-	BuildBaseForFile(path)
+	return "", false
 }
 
 type FeatureStateOption struct {
@@ -109,50 +180,50 @@ type FeatureStateOption struct {
 	Names []string
 }
 
-func ListAllFeatureStateOptions() map[string]map[string]FeatureStateOption {
+func ListAllFeatureStateOptions(rootDir string) (map[string]map[string]FeatureStateOption, error) {
 	var featureStateOptionsSet map[string]map[string]FeatureStateOption = make(map[string]map[string]FeatureStateOption)
 
-	var rootDir string = git.GetRepositoryRoot()
+	err := walkVersionBases(rootDir, func(folder string, parsedPath string) error {
+		featureStateList, err := GetVersionFeaturesStatesFromPath(rootDir, parsedPath)
 
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "versions"), func (path string, d os.DirEntry, err error) error {
 		if err != nil {
-			logger.Fatal[error](err)
+			return err
 		}
 
-		if d.IsDir() && filepath.Join(rootDir, ".features", "versions") != path {
-			parsedPath := filesystem.FileRead(filepath.Join(path, "_path"))
+		var featureStateSet map[string]FeatureStateOption = make(map[string]FeatureStateOption)
 
-			featureStateList := GetVersionFeaturesStatesFromPath(parsedPath)
-			var featureStateSet map[string]FeatureStateOption = make(map[string]FeatureStateOption)
-
-			for _, featureStateItem := range featureStateList {
-				featureStateSet[strings.Join(featureStateItem.Ids, "+")] = FeatureStateOption{
-					Ids: featureStateItem.Ids,
-					Names: featureStateItem.Names,
-				}
-			} 
-
-			featureStateOptionsSet[parsedPath] = featureStateSet
-			
-			return fs.SkipDir
+		for _, featureStateItem := range featureStateList {
+			featureStateSet[strings.Join(featureStateItem.Ids, "+")] = FeatureStateOption{
+				Ids: featureStateItem.Ids,
+				Names: featureStateItem.Names,
+			}
 		}
 
+		featureStateOptionsSet[parsedPath] = featureStateSet
+
 		return nil
 	})
 
 	if err != nil {
-		logger.Fatal[error](err)
+		return nil, err
 	}
 
-	return featureStateOptionsSet
+	return featureStateOptionsSet, nil
 }
 
-func GetVersionFeaturesStatesFromPath(filePath string) []FeatureStateOption {
-	var rootDir string = git.GetRepositoryRoot()
-
+func GetVersionFeaturesStatesFromPath(rootDir string, filePath string) ([]FeatureStateOption, error) {
 	hashedPath := utils.HashPath(filePath)
-	features := GetVersionFeaturesFromPath(hashedPath)
-	tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return nil, err
+	}
 
 	var options []FeatureStateOption = []FeatureStateOption{}
 
@@ -169,17 +240,20 @@ func GetVersionFeaturesStatesFromPath(filePath string) []FeatureStateOption {
 				}
 			}
 		}
-		
+
 		options = append(options, FeatureStateOption{ Ids: idsSlice, Names: names })
 	}
 
-	return options
+	return options, nil
 }
 
-func GetVersionFeaturesFromPath(filePath string) []types.VersionFeature {
-	var rootDir string = git.GetRepositoryRoot()
+func GetVersionFeaturesFromPath(rootDir string, filePath string) ([]types.VersionFeature, error) {
+	featurePaths, err := filesystem.FileListDir(filepath.Join(rootDir, ".features", "versions", filePath))
+
+	if err != nil {
+		return nil, err
+	}
 
-	featurePaths := filesystem.FileListDir(filepath.Join(rootDir, ".features", "versions", filePath))
 	var features []types.VersionFeature = []types.VersionFeature{}
 	var paths []string = []string{}
 
@@ -188,51 +262,51 @@ func GetVersionFeaturesFromPath(filePath string) []types.VersionFeature {
 	}
 
 	sort.Strings(paths)
-	
+
 	for _, path := range paths {
 		var feature types.VersionFeature
 
 		_, fileName := filepath.Split(path)
-		
+
 		if fileName == "base" || fileName == constants.WorkingTreeFile || fileName == "_path" {
 			continue
 		}
 
-		filesystem.FileReadJSONFromFile(path, &feature)
-		
+		if err := filesystem.FileReadJSONFromFile(path, &feature); err != nil {
+			return nil, err
+		}
+
 		features = append(features, feature)
 	}
 
-	return features
+	return features, nil
 }
 
-func VersionUpdateBase(path string, finalMessage bool) {
-	var rootDir string = git.GetRepositoryRoot()
-
+func VersionUpdateBase(rootDir string, path string, finalMessage bool) error {
 	hashedPath := utils.HashPath(path)
 
-	baseExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
-
-	if !baseExists {
-		logger.Result[string](fmt.Sprintf("%s is not a base file", path))
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return err
 	}
 
-	filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, "base"))
+	if err := filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, "base")); err != nil {
+		return err
+	}
 
-	BuildBaseForFile(path)
+	if err := BuildBaseForFile(rootDir, path); err != nil {
+		return err
+	}
 
 	if finalMessage {
 		logger.Success[string](fmt.Sprintf("%s version base updated", styles.AccentTextStyle(path)))
 	}
-}
 
-func VersionBase(path string, skipForm bool) {
-	workspaceExists := CheckWorkspaceFolder()
-
-	var rootDir string = git.GetRepositoryRoot()
+	return nil
+}
 
-	if !workspaceExists {
-		logger.Result[string]("workspace not found, use flag init")
+func VersionBase(rootDir string, path string, skipForm bool) error {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return err
 	}
 
 	hashedPath := utils.HashPath(path)
@@ -240,39 +314,81 @@ func VersionBase(path string, skipForm bool) {
 	baseExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
 
 	if baseExists {
-		logger.Result[string](fmt.Sprintf("%s is already a base version", path))
+		return errs.New(errs.AlreadyExists, "%s is already a base version", path)
 	}
 
 	if !skipForm {
 		logger.Warning("\nOnce you execute the base command and create the base, it becomes your responsibility to keep the features updated. To ensure all features are synchronized, please use the save command regularly. Failure to do so may lead to inconsistencies or outdated features.\n")
-		proceed := components.FormConfirm("Do you want to continue?", "Yes", "Cancel")
+		proceed := confirm("Do you want to continue?", "Yes", "Cancel")
 
 		if !proceed {
-			os.Exit(0)
+			return errs.ErrCanceled
 		}
 	}
 
-	filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "versions", hashedPath))
-	filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory))
+	if err := filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "versions", hashedPath)); err != nil {
+		return err
+	}
+
+	if err := filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory)); err != nil {
+		return err
+	}
+
+	if err := workingtree.CreateWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath)); err != nil {
+		return err
+	}
 
-	workingtree.CreateWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	if err := filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, "base")); err != nil {
+		return err
+	}
 
-	filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, "base"))
-	filesystem.FileWriteContentToFile(filepath.Join(rootDir, ".features", "versions", hashedPath, "_path"), path)
+	if err := filesystem.FileWriteContentToFile(filepath.Join(rootDir, ".features", "versions", hashedPath, "_path"), path); err != nil {
+		return err
+	}
 
 	logger.Success[string](fmt.Sprintf("%s is now a version base", styles.AccentTextStyle(path)))
+
+	return nil
+}
+
+// saveState records the current content of path as the saved file of a feature/state.
+func saveState(rootDir string, path string, featureIds []string) error {
+	hashedPath := utils.HashPath(path)
+
+	fileCheckSum, err := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, path))
+
+	if err != nil {
+		return err
+	}
+
+	savedCheckSum := utils.GenerateCheckSumFromString(append(featureIds, fileCheckSum)...)
+
+	err = workingtree.Add(
+		filepath.Join(rootDir, ".features", "versions", hashedPath),
+		featureIds,
+		workingtree.WorkingTreeValue{ FileCheckSum: fileCheckSum, SavedCheckSum: savedCheckSum },
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedCheckSum))
 }
 
-func VersionNewFeature(path string, name string, skipForm bool, finalMessage bool) {
-	var rootDir string = git.GetRepositoryRoot()
+func VersionNewFeature(rootDir string, path string, name string, skipForm bool, finalMessage bool) error {
 	hashedPath := utils.HashPath(path)
-	features := GetVersionFeaturesFromPath(hashedPath)
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return err
+	}
 
 	var featureExists bool = false
 	var hasOtherFeaturesTurnedOn bool
 	var featureIdsTurnedOn []string = []string{}
 	var featureNamesTurnedOn []string = []string{}
-	
+
 	for _, feature := range features {
 		if feature.State == constants.STATE_ON {
 			if feature.Name != name {
@@ -287,9 +403,29 @@ func VersionNewFeature(path string, name string, skipForm bool, finalMessage boo
 	}
 
 	if featureExists {
-		logger.Result[string](fmt.Sprintf("feature %s already exists"))
+		return errs.New(errs.AlreadyExists, "feature %s already exists", name)
+	}
+
+	if featureName, value := SplitFeatureValue(name); value != "" {
+		featureVariants, err := ReadVariants(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		if _, declared := featureVariants[featureName]; declared {
+			if err := ValidateFeatureState(rootDir, featureName, value); err != nil {
+				return err
+			}
+		}
+
+		for _, feature := range features {
+			if otherName, otherValue := SplitFeatureValue(feature.Name); otherName == featureName && otherValue != value && feature.State == constants.STATE_ON {
+				return errs.New(errs.InvalidState, "feature %s is on, turn it off before saving the variant %s", feature.Name, value)
+			}
+		}
 	}
-		
+
 	if !skipForm && hasOtherFeaturesTurnedOn {
 		var warningMessage string = fmt.Sprintf("A total of %d feature(s) are currently turned on and they also change %s\n", len(features), path)
 
@@ -301,10 +437,10 @@ func VersionNewFeature(path string, name string, skipForm bool, finalMessage boo
 
 		logger.Warning[string](warningMessage)
 
-		proceed := components.FormConfirm("You want to continue?", "Yes", "Cancel")
+		proceed := confirm("You want to continue?", "Yes", "Cancel")
 
 		if !proceed {
-			os.Exit(0)
+			return errs.ErrCanceled
 		}
 	}
 
@@ -321,80 +457,95 @@ func VersionNewFeature(path string, name string, skipForm bool, finalMessage boo
 
 	featureNamesTurnedOn = append(featureNamesTurnedOn, name)
 
-	fileChecksum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, path))
-	savedChecksum := utils.GenerateCheckSumFromString(newFeature.Id, fileChecksum)
-
-	workingtree.Add(
-		filepath.Join(rootDir, ".features", "versions", hashedPath), []string{newFeature.Id},
-		workingtree.WorkingTreeValue{ FileCheckSum: fileChecksum, SavedCheckSum: savedChecksum },
-	)
+	if err := saveState(rootDir, path, []string{newFeature.Id}); err != nil {
+		return err
+	}
 
-	filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedChecksum))
-	
 	if hasOtherFeaturesTurnedOn {
-		savedChecksum := utils.GenerateCheckSumFromString(append(featureIdsTurnedOn, fileChecksum)...)
-
-		workingtree.Add(
-			filepath.Join(rootDir, ".features", "versions", hashedPath),
-			featureIdsTurnedOn,
-			workingtree.WorkingTreeValue{ FileCheckSum: fileChecksum, SavedCheckSum: savedChecksum },
-		)
-
-		filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedChecksum))
+		if err := saveState(rootDir, path, featureIdsTurnedOn); err != nil {
+			return err
+		}
 	}
 
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", newFeature.Id)), newFeature)
+	if err := filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", newFeature.Id)), newFeature); err != nil {
+		return err
+	}
 
-	BuildBaseForFile(path)
+	if err := BuildBaseForFile(rootDir, path); err != nil {
+		return err
+	}
 
 	if finalMessage {
 		logger.Success[string](fmt.Sprintf("saved version for %s with feature %s", styles.AccentTextStyle(path), styles.AccentTextStyle(newFeature.Name)))
 	}
+
+	return nil
 }
 
-func VersionSaveToCurrentState(path string) {
-	var rootDir string = git.GetRepositoryRoot()
-	
+// replaceState drops the saved file of a feature/state and saves the current content of
+// path in its place.
+func replaceState(rootDir string, path string, featureIds []string) error {
 	hashedPath := utils.HashPath(path)
 
-	features := GetVersionFeaturesFromPath(hashedPath)
-	var currentFeaturesIdsTurnedOn []string = []string{}
+	key, workingTreeValue, exists, err := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", hashedPath), featureIds)
 
-	for _, feature := range features {
-		if feature.State == constants.STATE_ON {
-			currentFeaturesIdsTurnedOn = append(currentFeaturesIdsTurnedOn, feature.Id)
-		}
+	if err != nil {
+		return err
 	}
 
-	key := workingtree.NormalizeFeatures(currentFeaturesIdsTurnedOn)
+	if !exists {
+		return errs.New(errs.NotFound, "could not found state")
+	}
 
-	_, workingTreeValue, exists := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", hashedPath), workingtree.StringToStringSlice(key))
+	if err := workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), key); err != nil {
+		return err
+	}
 
-	if !exists {
-		logger.Result[string]("could not found state")
+	if err := filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum)); err != nil {
+		return err
+	}
+
+	if err := saveState(rootDir, path, featureIds); err != nil {
+		return err
 	}
 
-	workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), key)
-	filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
+	return BuildBaseForFile(rootDir, path)
+}
 
-	fileCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, path))
-	savedCheckSum := utils.GenerateCheckSumFromString(append(currentFeaturesIdsTurnedOn, fileCheckSum)...)
+func VersionSaveToCurrentState(rootDir string, path string) error {
+	hashedPath := utils.HashPath(path)
 
-	workingtree.Add(
-		filepath.Join(rootDir, ".features", "versions", hashedPath),
-		currentFeaturesIdsTurnedOn,
-		workingtree.WorkingTreeValue{ FileCheckSum: fileCheckSum, SavedCheckSum: savedCheckSum },
-	)
-	filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedCheckSum))
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return err
+	}
+
+	var currentFeaturesIdsTurnedOn []string = []string{}
+
+	for _, feature := range features {
+		if feature.State == constants.STATE_ON {
+			currentFeaturesIdsTurnedOn = append(currentFeaturesIdsTurnedOn, feature.Id)
+		}
+	}
 
-	BuildBaseForFile(path)
+	return replaceState(rootDir, path, currentFeaturesIdsTurnedOn)
 }
 
-func VersionSave(path string, finalMessage bool) {
-	var rootDir string = git.GetRepositoryRoot()
+// currentStateSuffix marks the option of the current state on the save picker.
+const currentStateSuffix string = " (current state)"
+
+// VersionSave saves the current content of path to the feature/state named by state,
+// an empty state asks for it.
+func VersionSave(rootDir string, path string, state string, finalMessage bool) error {
 	hashedPath := utils.HashPath(path)
 
-	features := GetVersionFeaturesFromPath(hashedPath)
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return err
+	}
+
 	var currentFeaturesTurnedOn []string = []string{}
 
 	for _, feature := range features {
@@ -403,7 +554,11 @@ func VersionSave(path string, finalMessage bool) {
 		}
 	}
 
-	tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return err
+	}
 
 	var statesNames [][]string = [][]string{}
 	var statesIds []string = []string{}
@@ -418,7 +573,7 @@ func VersionSave(path string, finalMessage bool) {
 			for _, feature := range features {
 				if feature.Id == id {
 					names = append(names, feature.Name)
-					break;			
+					break;
 				}
 			}
 		}
@@ -427,7 +582,7 @@ func VersionSave(path string, finalMessage bool) {
 	}
 
 	var options []components.ListItem = []components.ListItem{}
-	
+
 	for i := 0 ; i < len(statesIds); i++ {
 		featuresId := workingtree.StringToStringSlice(statesIds[i])
 		var desc string
@@ -440,7 +595,7 @@ func VersionSave(path string, finalMessage bool) {
 
 		if reflect.DeepEqual(currentFeaturesTurnedOn, featuresId) {
 			options = append(options, components.ListItem{
-				ItemTitle: strings.Join(statesNames[i], "+") + " (current state)",
+				ItemTitle: strings.Join(statesNames[i], "+") + currentStateSuffix,
 				ItemDesc: desc,
 				ItemValue: statesIds[i],
 			})
@@ -456,60 +611,48 @@ func VersionSave(path string, finalMessage bool) {
 	sort.Slice(options, func(i, j int) bool {
 		return len(options[i].ItemTitle) > len(options[j].ItemTitle)
 	})
-	
-	selected := components.PickerList("Select a feature/state to save", options)
 
-	if selected.ItemTitle == "" {
-		os.Exit(0)
-	}
-		
-	_, workingTreeValue, exists := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", hashedPath), workingtree.StringToStringSlice(selected.ItemValue))
+	selected, err := selectState("Select a feature/state to save", options, state, "--state", "the feature/state of %s to save", path)
 
-	if !exists {
-		logger.Result[string]("could not found state")
+	if err != nil {
+		return err
 	}
 
-	workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), selected.ItemValue)
-	filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
-
-	fileCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, path))
-	savedCheckSum := utils.GenerateCheckSumFromString(append(workingtree.StringToStringSlice(selected.ItemValue), fileCheckSum)...)
-
-	workingtree.Add(
-		filepath.Join(rootDir, ".features", "versions", hashedPath),
-		workingtree.StringToStringSlice(selected.ItemValue),
-		workingtree.WorkingTreeValue{ FileCheckSum: fileCheckSum, SavedCheckSum: savedCheckSum },
-	)
-
-	filesystem.FileCopy(filepath.Join(rootDir, path), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedCheckSum))
+	if selected.ItemTitle == "" {
+		return errs.ErrCanceled
+	}
 
-	BuildBaseForFile(path)
+	if err := replaceState(rootDir, path, workingtree.StringToStringSlice(selected.ItemValue)); err != nil {
+		return err
+	}
 
 	if finalMessage {
 		logger.Success[string](fmt.Sprintf("Saved to %s", styles.AccentTextStyle(selected.ItemTitle)))
 	}
+
+	return nil
 }
 
-func VersionDelete(path string, finalMessage bool) {
-	var rootDir string = git.GetRepositoryRoot()
+// VersionDelete deletes the feature named by featureName from path, an empty name asks
+// for it.
+func VersionDelete(rootDir string, path string, featureName string, finalMessage bool) error {
 	hashedPath := utils.HashPath(path)
 
-	versionExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
-
-	if !versionExists {
-		logger.Result[string](fmt.Sprintf("%s is not a base file", styles.AccentTextStyle(path)))
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return err
 	}
 
-	features := GetVersionFeaturesFromPath(hashedPath)
-	var currentFeaturesTurnedOn []string = []string{}
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
 
-	for _, feature := range features {
-		if feature.State == constants.STATE_ON {
-			currentFeaturesTurnedOn = append(currentFeaturesTurnedOn, feature.Id)
-		}
+	if err != nil {
+		return err
 	}
 
-	tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return err
+	}
 
 	var statesNames [][]string = [][]string{}
 	var statesIds []string = []string{}
@@ -524,7 +667,7 @@ func VersionDelete(path string, finalMessage bool) {
 			for _, feature := range features {
 				if feature.Id == id {
 					names = append(names, feature.Name)
-					break;			
+					break;
 				}
 			}
 		}
@@ -533,7 +676,7 @@ func VersionDelete(path string, finalMessage bool) {
 	}
 
 	var options []components.ListItem = []components.ListItem{}
-	
+
 	for i := 0 ; i < len(statesIds); i++ {
 		featuresId := workingtree.StringToStringSlice(statesIds[i])
 
@@ -549,11 +692,15 @@ func VersionDelete(path string, finalMessage bool) {
 	sort.Slice(options, func(i, j int) bool {
 		return len(options[i].ItemTitle) > len(options[j].ItemTitle)
 	})
-	
-	selectedIds := components.PickerList("Select a feature/state to delete", options)
+
+	selectedIds, err := selectState("Select a feature/state to delete", options, featureName, "--feature", "the feature of %s to delete", path)
+
+	if err != nil {
+		return err
+	}
 
 	if selectedIds.ItemTitle == "" {
-		os.Exit(0)
+		return errs.ErrCanceled
 	}
 
 	selectedIdsSlice := workingtree.StringToStringSlice(selectedIds.ItemValue)
@@ -570,282 +717,335 @@ func VersionDelete(path string, finalMessage bool) {
 			}
 		}
 	}
-	
+
 	for key, workingTreeValue := range tree {
+		var matches bool
+
 		if len(selectedIdsSlice) == 1 {
-			if(strings.Contains(key, selectedIdsSlice[0])) {
-				filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
-				workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), key)
-			}
+			matches = strings.Contains(key, selectedIdsSlice[0])
 		} else {
-			parsedKey := workingtree.StringToStringSlice(key)
+			matches = reflect.DeepEqual(workingtree.StringToStringSlice(key), selectedIdsSlice)
+		}
 
-			if reflect.DeepEqual(parsedKey, selectedIdsSlice) {
-				filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
-				workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), key)
+		if matches {
+			if err := removeState(rootDir, path, key, workingTreeValue); err != nil {
+				return err
 			}
 		}
 	}
 
 	if len(selectedIdsSlice) == 1 {
-		filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", selectedIdsSlice[0])))
+		if err := filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", selectedIdsSlice[0]))); err != nil {
+			return err
+		}
 	}
 
-	BuildBaseForFile(path)
+	if err := BuildBaseForFile(rootDir, path); err != nil {
+		return err
+	}
 
 	if finalMessage {
 		logger.Success[string](fmt.Sprintf("deleted feature %s on %s", styles.AccentTextStyle(selectedStringName), styles.AccentTextStyle(path)))
 	}
+
+	return nil
 }
 
-func BuildBaseForFile(path string) {
-	workspaceExists := CheckWorkspaceFolder()
+// removeState drops a feature/state from the working tree of path with its saved file.
+func removeState(rootDir string, path string, key string, workingTreeValue workingtree.WorkingTreeValue) error {
+	hashedPath := utils.HashPath(path)
+
+	if err := filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 
-	var rootDir string = git.GetRepositoryRoot()
+	return workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), key)
+}
 
-	if !workspaceExists {
-		logger.Result[string]("workspace not found, use flag init")
+func BuildBaseForFile(rootDir string, path string) error {
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return err
 	}
 
 	hashedPath := utils.HashPath(path)
 
-	baseExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	featuresTurnedOn, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
 
-	if !baseExists {
-		logger.Result[string](fmt.Sprintf("%s is not a base file", path))
+	if err != nil {
+		return err
 	}
 
-	featuresTurnedOn := GetVersionFeaturesFromPath(hashedPath)
-
 	featuresTurnedOn = utils.ArrayFilter[types.VersionFeature](featuresTurnedOn, func (feature types.VersionFeature) bool {
 		return feature.State == constants.STATE_ON
 	})
 
 	if len(featuresTurnedOn) == 0 {
-		filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, "base"), filepath.Join(rootDir, path))
-	} else {
-		var featureIdsTurnedOn []string = []string{}
-		
-		for _, feature := range featuresTurnedOn {
-			featureIdsTurnedOn = append(featureIdsTurnedOn, feature.Id)
-		}
+		return filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, "base"), filepath.Join(rootDir, path))
+	}
 
-		_, workingTreeValueCurrentState, existsCurrentState := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", hashedPath), featureIdsTurnedOn)
-	
-		if !existsCurrentState {
-			nearPrefix, remaining := workingtree.FindNearestPrefix(filepath.Join(rootDir, ".features", "versions", hashedPath), featureIdsTurnedOn)
-			
-			tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
-			
-			nearPrefixKey := workingtree.NormalizeFeatures(nearPrefix)
-			tempStateWorkingTreeValue, exists := tree[nearPrefixKey]
-			
-			if !exists {
-				logger.Result[string]("build base: couldn't find temp state")
-			}
-			
-			var tempStateName string
-			
-			for _, featureId := range nearPrefix {
-				for _, feature := range featuresTurnedOn {
-					if featureId == feature.Id {
-						if tempStateName == "" {
-							tempStateName = feature.Name
-						} else {
-							tempStateName += fmt.Sprintf("+%s", feature.Name)
-						}
-					}
-				}
-			}
-			
-			filesystem.FileCopy(
-				filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, tempStateWorkingTreeValue.SavedCheckSum),
-				filepath.Join(rootDir, ".features", "merge-tmp"),
-			)
+	var featureIdsTurnedOn []string = []string{}
 
-			for _, featureRemainingId := range remaining {
-				soloFeatureWorkingTreeValue, exists := tree[fmt.Sprintf("[%s]", featureRemainingId)]
+	for _, feature := range featuresTurnedOn {
+		featureIdsTurnedOn = append(featureIdsTurnedOn, feature.Id)
+	}
 
-				if !exists {
-					logger.Result[string]("build base: couldn't find feature for building temp state")
-				}
+	_, workingTreeValueCurrentState, existsCurrentState, err := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", hashedPath), featureIdsTurnedOn)
 
-				var featureName string = ""
+	if err != nil {
+		return err
+	}
 
-				for _, feature := range featuresTurnedOn {
-					if featureRemainingId == feature.Id {
-						featureName = feature.Name
-						break;
-					}
-				}
+	if existsCurrentState {
+		return filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValueCurrentState.SavedCheckSum), filepath.Join(rootDir, path))
+	}
 
-				if featureName == "" {
-					logger.Result[string]("build base: couldn't find feature name for building temp state")
-				}
+	nearPrefix, remaining, err := workingtree.FindNearestPrefix(filepath.Join(rootDir, ".features", "versions", hashedPath), featureIdsTurnedOn)
 
-				styledTempStateName := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(tempStateName).Bold(true)
-				styledFeatureName := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(featureName).Bold(true)
-
-				Merge(
-					filepath.Join(rootDir, ".features", "merge-tmp"),
-					filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, soloFeatureWorkingTreeValue.SavedCheckSum),
-					filepath.Join(rootDir, ".features", "versions", hashedPath, "base"),
-					tempStateName,
-					featureName,
-					fmt.Sprintf("Building a new state for the feature %s and %s", styledTempStateName.Render(), styledFeatureName.Render()),
-				)
-
-				tempStateName += fmt.Sprintf("+%s", featureName)
-				nearPrefix = append(nearPrefix, featureRemainingId)
-				
-				fileCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, ".features", "merge-tmp"))
-				savedCheckSum := utils.GenerateCheckSumFromString(append(nearPrefix, fileCheckSum)...)
-
-				workingtree.Add(
-					filepath.Join(rootDir, ".features", "versions", hashedPath),
-					nearPrefix,
-					workingtree.WorkingTreeValue{ FileCheckSum: fileCheckSum, SavedCheckSum: savedCheckSum },
-				)
-
-				filesystem.FileCopy(filepath.Join(rootDir, ".features", "merge-tmp"), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedCheckSum))
-			}
-		
-			filesystem.FileCopy(filepath.Join(rootDir, ".features", "merge-tmp"), filepath.Join(rootDir, path))
-			filesystem.RemoveFile(filepath.Join(rootDir, ".features", "merge-tmp"))
-			
-			return
-		}
-		
-		filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValueCurrentState.SavedCheckSum), filepath.Join(rootDir, path))		
+	if err != nil {
+		return err
 	}
-}
-
-func VersionsGetCurrentStatePath(path string) (string, string) {
-	workspaceExists := CheckWorkspaceFolder()
 
-	var rootDir string = git.GetRepositoryRoot()
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
 
-	if !workspaceExists {
-		logger.Result[string]("workspace not found, use flag init")
+	if err != nil {
+		return err
 	}
 
-	hashedPath := utils.HashPath(path)
-
-	baseExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	nearPrefixKey := workingtree.NormalizeFeatures(nearPrefix)
+	tempStateWorkingTreeValue, exists := tree[nearPrefixKey]
 
-	if !baseExists {
-		logger.Result[string](fmt.Sprintf("%s is not a base file", path))
+	if !exists {
+		return errs.New(errs.NotFound, "build base: couldn't find temp state")
 	}
 
-	featuresTurnedOn := GetVersionFeaturesFromPath(hashedPath)
-
-	if len(featuresTurnedOn) == 0 {
-		return filepath.Join(rootDir, ".features", "versions", hashedPath, "base"), "Base"
-	} else {
-		featuresTurnedOn = utils.ArrayFilter[types.VersionFeature](featuresTurnedOn, func (feature types.VersionFeature) bool {
-			return feature.State == constants.STATE_ON
-		})
+	var tempStateName string
 
-		var currentStateFeatures []string = []string{}
-			
+	for _, featureId := range nearPrefix {
 		for _, feature := range featuresTurnedOn {
-			currentStateFeatures = append(currentStateFeatures, feature.Id)
+			if featureId == feature.Id {
+				if tempStateName == "" {
+					tempStateName = feature.Name
+				} else {
+					tempStateName += fmt.Sprintf("+%s", feature.Name)
+				}
+			}
 		}
+	}
 
-		_, workingTreeValueCurrentState, exists := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", hashedPath), currentStateFeatures)
+	err = filesystem.FileCopy(
+		filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, tempStateWorkingTreeValue.SavedCheckSum),
+		git.TempPath(rootDir, "merge-tmp"),
+	)
 
-		if !exists {
-			logger.Result[string]("can not find current state")
+	if err != nil {
+		return err
+	}
+
+	for _, featureRemainingId := range remaining {
+		soloFeatureWorkingTreeValue, exists := tree[fmt.Sprintf("[%s]", featureRemainingId)]
+
+		if !exists {
+			return errs.New(errs.NotFound, "build base: couldn't find feature for building temp state")
 		}
 
-		return filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValueCurrentState.SavedCheckSum), GetCurrentStateName(path)
-	}
-}
+		var featureName string = ""
+
+		for _, feature := range featuresTurnedOn {
+			if featureRemainingId == feature.Id {
+				featureName = feature.Name
+				break;
+			}
+		}
 
-func VersionLookForUntrackedChanges(path string) bool {
-	workspaceExists := CheckWorkspaceFolder()
+		if featureName == "" {
+			return errs.New(errs.NotFound, "build base: couldn't find feature name for building temp state")
+		}
+
+		styledTempStateName := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(tempStateName).Bold(true)
+		styledFeatureName := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(featureName).Bold(true)
+
+		err := Merge(
+			rootDir,
+			git.TempPath(rootDir, "merge-tmp"),
+			filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, soloFeatureWorkingTreeValue.SavedCheckSum),
+			filepath.Join(rootDir, ".features", "versions", hashedPath, "base"),
+			tempStateName,
+			featureName,
+			fmt.Sprintf("Building a new state for the feature %s and %s", styledTempStateName.Render(), styledFeatureName.Render()),
+		)
+
+		if err != nil {
+			return err
+		}
 
-	var rootDir string = git.GetRepositoryRoot()
+		tempStateName += fmt.Sprintf("+%s", featureName)
+		nearPrefix = append(nearPrefix, featureRemainingId)
 
-	if !workspaceExists {
-		logger.Result[string]("workspace not found, use flag init")
+		if err := saveMergedState(rootDir, path, nearPrefix); err != nil {
+			return err
+		}
 	}
 
+	if err := filesystem.FileCopy(git.TempPath(rootDir, "merge-tmp"), filepath.Join(rootDir, path)); err != nil {
+		return err
+	}
+
+	return filesystem.RemoveFile(git.TempPath(rootDir, "merge-tmp"))
+}
+
+// saveMergedState saves the result of the last merge as the saved file of a feature/state
+// of path.
+func saveMergedState(rootDir string, path string, featureIds []string) error {
 	hashedPath := utils.HashPath(path)
 
-	baseExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	fileCheckSum, err := filesystem.FileGenerateCheckSum(git.TempPath(rootDir, "merge-tmp"))
 
-	if !baseExists {
-		logger.Result[string](fmt.Sprintf("%s is not a base file", path))
+	if err != nil {
+		return err
 	}
 
-	featuresTurnedOn := GetVersionFeaturesFromPath(hashedPath)
+	savedCheckSum := utils.GenerateCheckSumFromString(append(featureIds, fileCheckSum)...)
 
-	// At this moment it's just all features
-	if len(featuresTurnedOn) == 0 {
-		// Only base exists
-		currentCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, path))
+	err = workingtree.Add(
+		filepath.Join(rootDir, ".features", "versions", hashedPath),
+		featureIds,
+		workingtree.WorkingTreeValue{ FileCheckSum: fileCheckSum, SavedCheckSum: savedCheckSum },
+	)
 
-		baseCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, ".features", "versions", hashedPath, "base"))
-		
-		return !strings.Contains(currentCheckSum, baseCheckSum)
-	} else {
-		featuresTurnedOn = utils.ArrayFilter[types.VersionFeature](featuresTurnedOn, func (feature types.VersionFeature) bool {
-			return feature.State == constants.STATE_ON
-		})
+	if err != nil {
+		return err
+	}
 
-		var currentStateFeatures []string = []string{}
-			
-		for _, feature := range featuresTurnedOn {
-			currentStateFeatures = append(currentStateFeatures, feature.Id)
-		}
+	return filesystem.FileCopy(git.TempPath(rootDir, "merge-tmp"), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedCheckSum))
+}
 
-		_, workingTreeValueCurrentState, exists := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", hashedPath), currentStateFeatures)
+// currentStateValue returns the working tree value of the features of path turned on.
+func currentStateValue(rootDir string, path string, features []types.VersionFeature) (workingtree.WorkingTreeValue, error) {
+	var currentStateFeatures []string = []string{}
 
-		if !exists {
-			logger.Result[string]("can not find current state")
+	for _, feature := range features {
+		if feature.State == constants.STATE_ON {
+			currentStateFeatures = append(currentStateFeatures, feature.Id)
 		}
+	}
+
+	_, workingTreeValueCurrentState, exists, err := workingtree.FindKeyValue(filepath.Join(rootDir, ".features", "versions", utils.HashPath(path)), currentStateFeatures)
 
-		currentCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, path))
+	if err != nil {
+		return workingtree.WorkingTreeValue{}, err
+	}
 
-		return workingTreeValueCurrentState.FileCheckSum != currentCheckSum
+	if !exists {
+		return workingtree.WorkingTreeValue{}, errs.New(errs.NotFound, "can not find current state")
 	}
+
+	return workingTreeValueCurrentState, nil
 }
 
-func RebaseFile(path string, finalMessage bool) {
-	workspaceExists := CheckWorkspaceFolder()
+func VersionsGetCurrentStatePath(rootDir string, path string) (string, string, error) {
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return "", "", err
+	}
+
+	hashedPath := utils.HashPath(path)
+
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(features) == 0 {
+		return filepath.Join(rootDir, ".features", "versions", hashedPath, "base"), "Base", nil
+	}
+
+	workingTreeValueCurrentState, err := currentStateValue(rootDir, path, features)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	name, err := GetCurrentStateName(rootDir, path)
+
+	if err != nil {
+		return "", "", err
+	}
 
-	var rootDir string = git.GetRepositoryRoot()
+	return filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValueCurrentState.SavedCheckSum), name, nil
+}
 
-	if !workspaceExists {
-		logger.Result[string]("workspace not found, use flag init")
+func VersionLookForUntrackedChanges(rootDir string, path string) (bool, error) {
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return false, err
 	}
 
 	hashedPath := utils.HashPath(path)
 
-	baseExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return false, err
+	}
+
+	currentCheckSum, err := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, path))
+
+	if err != nil {
+		return false, err
+	}
+
+	// At this moment it's just all features
+	if len(features) == 0 {
+		// Only base exists
+		baseCheckSum, err := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, ".features", "versions", hashedPath, "base"))
+
+		if err != nil {
+			return false, err
+		}
+
+		return !strings.Contains(currentCheckSum, baseCheckSum), nil
+	}
+
+	workingTreeValueCurrentState, err := currentStateValue(rootDir, path, features)
+
+	if err != nil {
+		return false, err
+	}
 
-	if !baseExists {
-		logger.Result[string](fmt.Sprintf("%s is not a base file", path))
+	return workingTreeValueCurrentState.FileCheckSum != currentCheckSum, nil
+}
+
+func RebaseFile(rootDir string, path string, finalMessage bool) error {
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return err
 	}
 
-	tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	hashedPath := utils.HashPath(path)
+
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return err
+	}
 
 	var warningMessage string = fmt.Sprintf("The rebase process will merge the current state of the file '%s' to all %d states currently saved. The merge process may result in conflicts that will need to be resolved manually.\n\n", path, len(tree))
 
 	logger.Warning[string](warningMessage)
 
-	var proceed bool = components.FormConfirm("Do you want to continue?", "Yes", "No")
+	var proceed bool = confirm("Do you want to continue?", "Yes", "No")
 
 	if !proceed {
-		os.Exit(0)
+		return errs.ErrCanceled
 	}
 
-	features := GetVersionFeaturesFromPath(hashedPath)
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return err
+	}
 
 	for stringFeatureIds, workingTreeValue := range tree {
 		featureIds := workingtree.StringToStringSlice(stringFeatureIds)
-		
+
 		var featureName string
 
 		for _, featureId := range featureIds {
@@ -862,8 +1062,9 @@ func RebaseFile(path string, finalMessage bool) {
 
 		styledNewbase := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString("new base").Bold(true)
 		styledFeatureName := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(featureName).Bold(true)
-		
-		Merge(
+
+		err := Merge(
+			rootDir,
 			filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum),
 			filepath.Join(rootDir, path),
 			filepath.Join(rootDir, ".features", "versions", hashedPath, "base"),
@@ -872,36 +1073,45 @@ func RebaseFile(path string, finalMessage bool) {
 			fmt.Sprintf("Merging %s with the new %s", styledFeatureName.Render(), styledNewbase.Render()),
 		)
 
-		fileCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, ".features", "merge-tmp"))
-		savedCheckSum := utils.GenerateCheckSumFromString(append(featureIds, fileCheckSum)...)
+		if err != nil {
+			return err
+		}
 
-		filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
+		if err := filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum)); err != nil {
+			return err
+		}
 
-		workingtree.Add(
-			filepath.Join(rootDir, ".features", "versions", hashedPath),
-			featureIds,
-			workingtree.WorkingTreeValue{ FileCheckSum: fileCheckSum, SavedCheckSum: savedCheckSum },
-		)
+		if err := saveMergedState(rootDir, path, featureIds); err != nil {
+			return err
+		}
+	}
 
-		filesystem.FileCopy(filepath.Join(rootDir, ".features", "merge-tmp"), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedCheckSum))
+	if err := filesystem.RemoveFile(git.TempPath(rootDir, "merge-tmp")); err != nil {
+		return err
 	}
 
-	filesystem.RemoveFile(filepath.Join(rootDir, ".features", "merge-tmp"))
-	
-	BuildBaseForFile(path)
+	if err := BuildBaseForFile(rootDir, path); err != nil {
+		return err
+	}
 
 	if finalMessage {
 		logger.Success[string](fmt.Sprintf("%s rebased", styles.AccentTextStyle(path)))
 	}
+
+	return nil
 }
 
-func GetCurrentStateName(path string) string {
+func GetCurrentStateName(rootDir string, path string) (string, error) {
 	hashedPath := utils.HashPath(path)
 
-	features := GetVersionFeaturesFromPath(hashedPath)
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return "", err
+	}
 
 	if len(features) == 0 {
-		return "Base"
+		return "Base", nil
 	}
 
 	var currentFeaturesNamesTurnedOn []string = []string{}
@@ -912,17 +1122,15 @@ func GetCurrentStateName(path string) string {
 		}
 	}
 
-	return strings.Join(currentFeaturesNamesTurnedOn, "+")
+	return strings.Join(currentFeaturesNamesTurnedOn, "+"), nil
 }
 
-func AllVersionFeatureDetails() {
-	exists := CheckWorkspaceFolder()
-
-	if !exists {
-		logger.Result[string]("workspace not found, use flag init")
+func AllVersionFeatureDetails(rootDir string) error {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return err
 	}
 
-	var titleStyle = 
+	var titleStyle =
 		lipgloss.
 		NewStyle().
 		Padding(0, 1).
@@ -933,39 +1141,31 @@ func AllVersionFeatureDetails() {
 
 	fmt.Printf("\n\n%s\n\n", titleStyle.Render())
 
-	var rootDir string = git.GetRepositoryRoot()
+	return walkVersionBases(rootDir, func(folder string, path string) error {
+		return VersionFeatureDetailsFromPath(rootDir, path)
+	})
+}
 
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "versions"), func (path string, d os.DirEntry, err error) error {
-		if err != nil {
-			logger.Fatal[error](err)
-		}
+// VersionRecordsFromPath returns a record for each feature and state of a version base.
+func VersionRecordsFromPath(rootDir string, path string) ([]types.FeatureRecord, error) {
+	hashedPath := utils.HashPath(path)
 
-		if d.IsDir() && filepath.Join(rootDir, ".features", "versions") != path {
-			recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
-			VersionFeatureDetailsFromPath(recoveredPath)
-			return fs.SkipDir
-		}
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return nil, err
+	}
 
-		return nil
-	})
+	author, date, err := git.GetLastCommitInfo(rootDir, path)
 
 	if err != nil {
-		logger.Fatal[error](err)
+		return nil, err
 	}
-}
 
-func VersionFeatureDetailsFromPath(path string) {
-	var rootDir string = git.GetRepositoryRoot()
-	hashedPath := utils.HashPath(path)
-	author, date := git.GetLastCommitInfo(path) 
-
-	baseExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
 
-	if !baseExists {
-		logger.Result[string](fmt.Sprintf("%s is not a version base", path))
+	if err != nil {
+		return nil, err
 	}
 
-	features := GetVersionFeaturesFromPath(hashedPath)
 	var currentFeaturesIdTurnedOn []string = []string{}
 
 	for _, feature := range features {
@@ -974,10 +1174,13 @@ func VersionFeatureDetailsFromPath(path string) {
 		}
 	}
 
-	tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
-	
-	headers := []string{"NAME", "TYPE", "STATE", "AUTHOR", "DATE"}
-	var data [][]string = [][]string{}
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []types.FeatureRecord = []types.FeatureRecord{}
 
 	for key, _ := range tree {
 		ids := workingtree.StringToStringSlice(key)
@@ -988,56 +1191,110 @@ func VersionFeatureDetailsFromPath(path string) {
 			for _, feature := range features {
 				if feature.Id == id {
 					names = append(names, feature.Name)
-					break;			
+					break;
 				}
 			}
 		}
 
-		var featureOrState string
-
-		if len(ids) == 1 {
-			featureOrState = "FEATURE"
-		} else {
-			featureOrState = "STATE"
+		record := types.FeatureRecord{
+			Path: path,
+			Feature: strings.Join(names, "+"),
+			Id: strings.Join(ids, "+"),
+			Kind: "version",
+			Author: author,
+			Date: date.Format(time.RFC3339),
 		}
 
 		if len(ids) == 1 {
-			var state string = "OFF"
+			record.Type = "FEATURE"
+			record.State = "OFF"
 
 			for _, featureIdTurnedOn := range currentFeaturesIdTurnedOn {
 				if featureIdTurnedOn == ids[0] {
-					state = "ON"
+					record.State = "ON"
+					record.Active = true
 					break;
 				}
 			}
-
-			data = append(data, []string{strings.Join(names, "+"), featureOrState, state, author, date})
 		} else {
-			var state string = "NOT ACTIVE"
+			record.Type = "STATE"
+			record.State = "NOT ACTIVE"
 
 			if reflect.DeepEqual(currentFeaturesIdTurnedOn, ids) {
-				state = "ACTIVE"
+				record.State = "ACTIVE"
+				record.Active = true
 			}
+		}
+
+		records = append(records, record)
+	}
 
-			data = append(data, []string{strings.Join(names, "+"), featureOrState, state, author, date})
+	sort.SliceStable(records, func (i, j int) bool {
+		if len(records[i].Feature) != len(records[j].Feature) {
+			return len(records[i].Feature) > len(records[j].Feature)
 		}
+
+		return records[i].Feature < records[j].Feature
+	})
+
+	return records, nil
+}
+
+// AllVersionRecords returns a record for each feature and state of every version base.
+func AllVersionRecords(rootDir string) ([]types.FeatureRecord, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
 	}
 
-	sort.Slice(data, func (i, j int) bool {
-		return len(data[i][0]) > len(data[j][0])
+	var records []types.FeatureRecord = []types.FeatureRecord{}
+
+	err := walkVersionBases(rootDir, func(folder string, path string) error {
+		pathRecords, err := VersionRecordsFromPath(rootDir, path)
+
+		if err != nil {
+			return err
+		}
+
+		records = append(records, pathRecords...)
+
+		return nil
 	})
 
+	return records, err
+}
+
+func VersionFeatureDetailsFromPath(rootDir string, path string) error {
+	records, err := VersionRecordsFromPath(rootDir, path)
+
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"NAME", "TYPE", "STATE", "AUTHOR", "DATE"}
+	var data [][]string = [][]string{}
+
+	for _, record := range records {
+		data = append(data, []string{record.Feature, record.Type, record.State, record.Author, tableDate(record.Date)})
+	}
+
 	if len(data) > 0 {
 		fmt.Printf("%s\n", styles.AccentTextStyle(path))
 		table.RenderTable(headers, data)
 	}
+
+	return nil
 }
 
-func selectFeatureState(title string) string {
-	featureStateListByPath := ListAllFeatureStateOptions()
+func selectFeatureState(rootDir string, title string, state string) (string, error) {
+	featureStateListByPath, err := ListAllFeatureStateOptions(rootDir)
+
+	if err != nil {
+		return "", err
+	}
+
 	var featureStateSet map[string]FeatureStateOption = make(map[string]FeatureStateOption)
 
-	for _, featureStateMap := range featureStateListByPath {		
+	for _, featureStateMap := range featureStateListByPath {
 		for _, featureState := range featureStateMap {
 			featureStateSet[strings.Join(featureState.Ids, "+")] = featureState
 		}
@@ -1064,26 +1321,19 @@ func selectFeatureState(title string) string {
 	sort.Slice(options, func(i, j int) bool {
 		return len(options[i].ItemTitle) > len(options[j].ItemTitle)
 	})
-	
-	selected := components.PickerList(title, options)
 
-	return selected.ItemValue
-}
-
-func VersionDemoteOnPath(internalFeaturePath string, path string, featuresNamesToDemote []string) []string {
-	var rootDir string = git.GetRepositoryRoot()
-	hashedPath := utils.HashPath(path)
+	selected, err := selectState(title, options, state, "--feature", "%s", strings.ToLower(title))
 
-	features := GetVersionFeaturesFromPath(hashedPath)
-	tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
-	var found bool = false
-	var foundedIds []string = []string{}
-	var foldersToDelete []string = []string{}
+	return selected.ItemValue, err
+}
 
-	for ids := range tree {
+// findStateByNames returns the ids of the feature/state of the tree named by names and
+// its working tree value.
+func findStateByNames(tree workingtree.WorkingTree, features []types.VersionFeature, featureNames []string) ([]string, workingtree.WorkingTreeValue, bool) {
+	for ids, workingTreeValue := range tree {
 		idsSlice := workingtree.StringToStringSlice(ids)
 
-		if len(idsSlice) == len(featuresNamesToDemote) {
+		if len(idsSlice) == len(featureNames) {
 			var names []string = []string{}
 			var tempIds []string = []string{}
 
@@ -1097,295 +1347,397 @@ func VersionDemoteOnPath(internalFeaturePath string, path string, featuresNamesT
 				}
 			}
 
-			if reflect.DeepEqual(names, featuresNamesToDemote) {
-				foundedIds = tempIds
-				found = true
-				break
+			if reflect.DeepEqual(names, featureNames) {
+				return tempIds, workingTreeValue, true
 			}
 		}
 	}
 
-	if found {
-		for ids, workingTreeValue := range tree {
-			idsSlice := workingtree.StringToStringSlice(ids)
+	return nil, workingtree.WorkingTreeValue{}, false
+}
 
-			for _, idSlice := range idsSlice {
-				var idFound bool = false
+// removeStatesWithIds drops every feature/state of path that uses one of the ids, with
+// the .feature files of the ids.
+func removeStatesWithIds(rootDir string, path string, tree workingtree.WorkingTree, foundedIds []string) error {
+	hashedPath := utils.HashPath(path)
 
-				for _, foundId := range foundedIds {
-					if idSlice == foundId {
-						idFound = true
-						break;
-					}
-				}
+	for ids, workingTreeValue := range tree {
+		idsSlice := workingtree.StringToStringSlice(ids)
 
-				if idFound {
-					featureExists := filesystem.FileExists(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", idSlice)))
+		for _, idSlice := range idsSlice {
+			var idFound bool = false
 
-					if featureExists {
-						filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", idSlice)))
-					}
-					
-					workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), ids)
-					filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
-					break
+			for _, foundId := range foundedIds {
+				if idSlice == foundId {
+					idFound = true
+					break;
 				}
 			}
-		}
 
-		newTree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+			if idFound {
+				featureExists := filesystem.FileExists(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", idSlice)))
 
-		if len(newTree) == 0 {
-			// restore base and mark to delete folder
+				if featureExists {
+					if err := filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", idSlice))); err != nil {
+						return err
+					}
+				}
 
-			filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, "base"), filepath.Join(rootDir, path))
-			foldersToDelete = append(foldersToDelete, internalFeaturePath)
-		} else {
-			// Build a new base
+				if err := removeState(rootDir, path, ids, workingTreeValue); err != nil {
+					return err
+				}
 
-			BuildBaseForFile(path)
+				break
+			}
 		}
 	}
 
-	return foldersToDelete
+	return nil
 }
 
-func VersionPromoteOnPath(internalFeaturePath string, path string, featureNamesToPromote []string) []string {
-	var rootDir string = git.GetRepositoryRoot()
+func VersionDemoteOnPath(rootDir string, internalFeaturePath string, path string, featuresNamesToDemote []string) ([]string, error) {
 	hashedPath := utils.HashPath(path)
 
-	features := GetVersionFeaturesFromPath(hashedPath)
-	tree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return nil, err
+	}
 
-	var found bool = false
-	var foundedIds []string = []string{}
 	var foldersToDelete []string = []string{}
 
-	for ids, workingTreeValue := range tree {
-		idsSlice := workingtree.StringToStringSlice(ids)
+	foundedIds, _, found := findStateByNames(tree, features, featuresNamesToDemote)
 
-		if len(idsSlice) == len(featureNamesToPromote) {
-			var names []string = []string{}
-			var tempIds []string = []string{}
+	if !found {
+		return foldersToDelete, nil
+	}
 
-			for _, id := range idsSlice {
-				for _, feature := range features {
-					if feature.Id  == id {
-						tempIds = append(tempIds, feature.Id)
-						names = append(names, feature.Name)
-						break;
-					}
-				}
-			}
+	if err := removeStatesWithIds(rootDir, path, tree, foundedIds); err != nil {
+		return nil, err
+	}
 
-			if reflect.DeepEqual(names, featureNamesToPromote) {
-				foundedIds = tempIds
-				found = true
+	newTree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
 
-				// make copy
+	if err != nil {
+		return nil, err
+	}
 
-				filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum), filepath.Join(rootDir, ".features", "feature-tmp"))
-				
-				break
-			}
+	if len(newTree) == 0 {
+		// restore base and mark to delete folder
+
+		if err := filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, "base"), filepath.Join(rootDir, path)); err != nil {
+			return nil, err
+		}
+
+		foldersToDelete = append(foldersToDelete, internalFeaturePath)
+	} else {
+		// Build a new base
+
+		if err := BuildBaseForFile(rootDir, path); err != nil {
+			return nil, err
 		}
 	}
 
-	if found {
-		for ids, workingTreeValue := range tree {
-			idsSlice := workingtree.StringToStringSlice(ids)
+	return foldersToDelete, nil
+}
 
-			for _, idSlice := range idsSlice {
-				var idFound bool = false
+func VersionPromoteOnPath(rootDir string, internalFeaturePath string, path string, featureNamesToPromote []string) ([]string, error) {
+	hashedPath := utils.HashPath(path)
 
-				for _, foundId := range foundedIds {
-					if idSlice == foundId {
-						idFound = true
-						break;
-					}
-				}
+	features, err := GetVersionFeaturesFromPath(rootDir, hashedPath)
 
-				if idFound {
-					featureExists := filesystem.FileExists(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", idSlice)))
+	if err != nil {
+		return nil, err
+	}
 
-					if featureExists {
-						filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, fmt.Sprintf("%s.feature", idSlice)))
-					}
-					
-					workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), ids)
-					filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
-					break
-				}
-			}
+	tree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var foldersToDelete []string = []string{}
+
+	foundedIds, promotedValue, found := findStateByNames(tree, features, featureNamesToPromote)
+
+	if !found {
+		return foldersToDelete, nil
+	}
+
+	// make copy
+
+	if err := filesystem.FileCopy(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, promotedValue.SavedCheckSum), git.TempPath(rootDir, "feature-tmp")); err != nil {
+		return nil, err
+	}
+
+	// Clean Up
+	defer func() {
+		if filesystem.FileExists(git.TempPath(rootDir, "feature-tmp")) {
+			filesystem.RemoveFile(git.TempPath(rootDir, "feature-tmp"))
 		}
 
-		newTree := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+		if filesystem.FileExists(git.TempPath(rootDir, "merge-tmp")) {
+			filesystem.RemoveFile(git.TempPath(rootDir, "merge-tmp"))
+		}
+	}()
 
-		if len(newTree) == 0 {
-			// restore base and mark to delete folder
+	if err := removeStatesWithIds(rootDir, path, tree, foundedIds); err != nil {
+		return nil, err
+	}
 
-			filesystem.FileCopy(filepath.Join(rootDir, ".features", "feature-tmp"), filepath.Join(rootDir, path))
-			foldersToDelete = append(foldersToDelete, internalFeaturePath)
-		} else {
-			for ids, workingTreeValue := range newTree {
-				idsSlice := workingtree.StringToStringSlice(ids)
-				var names []string = []string{}
-
-				for _, id := range idsSlice {
-					for _, feature := range features {
-						if id == feature.Id {
-							names = append(names, feature.Name)
-						}
-					}
-				}
+	newTree, err := workingtree.LoadWorkingTree(filepath.Join(rootDir, ".features", "versions", hashedPath))
+
+	if err != nil {
+		return nil, err
+	}
 
-				styledFeatureNamesToPromote := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(strings.Join(featureNamesToPromote, "+")).Bold(true)
-				styledNames := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(strings.Join(names, "+")).Bold(true)
+	if len(newTree) == 0 {
+		// restore base and mark to delete folder
 
-				Merge(
-					filepath.Join(rootDir, ".features", "feature-tmp"),
-					filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum),
-					filepath.Join(rootDir, ".features", "versions", hashedPath, "base"),
-					strings.Join(featureNamesToPromote, "+"),
-					strings.Join(names, "+"),
-					fmt.Sprintf("Merging promoted feature/state %s with %s", styledFeatureNamesToPromote.Render(), styledNames.Render()),
-				)
+		if err := filesystem.FileCopy(git.TempPath(rootDir, "feature-tmp"), filepath.Join(rootDir, path)); err != nil {
+			return nil, err
+		}
 
-				workingtree.Remove(filepath.Join(rootDir, ".features", "versions", hashedPath), ids)
-				filesystem.RemoveFile(filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum))
+		foldersToDelete = append(foldersToDelete, internalFeaturePath)
 
-				fileCheckSum := filesystem.FileGenerateCheckSum(filepath.Join(rootDir, ".features", "merge-tmp"))
-				savedChecksum := utils.GenerateCheckSumFromString(append(idsSlice, fileCheckSum)...)
+		return foldersToDelete, nil
+	}
 
-				workingtree.Add(
-					filepath.Join(rootDir, ".features", "versions", hashedPath),
-					idsSlice,
-					workingtree.WorkingTreeValue{ FileCheckSum: fileCheckSum, SavedCheckSum: savedChecksum },
-				)
+	for ids, workingTreeValue := range newTree {
+		idsSlice := workingtree.StringToStringSlice(ids)
+		var names []string = []string{}
 
-				filesystem.FileCopy(filepath.Join(rootDir, ".features", "merge-tmp"), filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, savedChecksum))
+		for _, id := range idsSlice {
+			for _, feature := range features {
+				if id == feature.Id {
+					names = append(names, feature.Name)
+				}
 			}
+		}
 
-			// Change base to the feature/state promoted
+		styledFeatureNamesToPromote := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(strings.Join(featureNamesToPromote, "+")).Bold(true)
+		styledNames := lipgloss.NewStyle().Foreground(lipgloss.Color(constants.AccentColor)).SetString(strings.Join(names, "+")).Bold(true)
 
-			filesystem.FileCopy(filepath.Join(rootDir, ".features", "feature-tmp"), filepath.Join(rootDir, ".features", "versions", hashedPath, "base"))
+		err := Merge(
+			rootDir,
+			git.TempPath(rootDir, "feature-tmp"),
+			filepath.Join(rootDir, ".features", "versions", hashedPath, constants.WorkingTreeDirectory, workingTreeValue.SavedCheckSum),
+			filepath.Join(rootDir, ".features", "versions", hashedPath, "base"),
+			strings.Join(featureNamesToPromote, "+"),
+			strings.Join(names, "+"),
+			fmt.Sprintf("Merging promoted feature/state %s with %s", styledFeatureNamesToPromote.Render(), styledNames.Render()),
+		)
 
-			// Build a new base
-			
-			BuildBaseForFile(path)
+		if err != nil {
+			return nil, err
 		}
 
-		// Clean Up
-		
-		if filesystem.FileExists(filepath.Join(rootDir, ".features", "feature-tmp")) {
-			filesystem.RemoveFile(filepath.Join(rootDir, ".features", "feature-tmp"))
+		if err := removeState(rootDir, path, ids, workingTreeValue); err != nil {
+			return nil, err
 		}
 
-		if filesystem.FileExists(filepath.Join(rootDir, ".features", "merge-tmp")) {
-			filesystem.RemoveFile(filepath.Join(rootDir, ".features", "merge-tmp"))
+		if err := saveMergedState(rootDir, path, idsSlice); err != nil {
+			return nil, err
 		}
 	}
 
-	return foldersToDelete
-}
+	// Change base to the feature/state promoted
 
-func VersionPromote(finalMessage bool) {
-	exists := CheckWorkspaceFolder()
+	if err := filesystem.FileCopy(git.TempPath(rootDir, "feature-tmp"), filepath.Join(rootDir, ".features", "versions", hashedPath, "base")); err != nil {
+		return nil, err
+	}
 
-	if !exists {
-		logger.Result[string]("workspace not found, use flag init")
+	// Build a new base
+
+	if err := BuildBaseForFile(rootDir, path); err != nil {
+		return nil, err
+	}
+
+	return foldersToDelete, nil
+}
+
+// resolveVersions promotes or demotes the selected feature/state on every version base.
+func resolveVersions(rootDir string, title string, state string, resolveOnPath func(rootDir string, folder string, path string, names []string) ([]string, error)) ([]string, error) {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return nil, err
 	}
 
 	var foldersToDelete []string = []string{}
-	selected := selectFeatureState("Select a feature or state to promote")
+
+	selected, err := selectFeatureState(rootDir, title, state)
+
+	if err != nil {
+		return nil, err
+	}
 
 	if len(selected) == 0 {
-		os.Exit(0)
+		return nil, errs.ErrCanceled
 	}
 
 	parsedSelectsNames := strings.Split(selected, "@_separator_@")
 
-	var rootDir string = git.GetRepositoryRoot()
+	err = walkVersionBases(rootDir, func(folder string, path string) error {
+		folderToDelete, err := resolveOnPath(rootDir, folder, path, parsedSelectsNames)
 
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "versions"), func (path string, d os.DirEntry, err error) error {
 		if err != nil {
-			logger.Fatal[error](err)
+			return err
 		}
 
-		if d.IsDir() && filepath.Join(rootDir, ".features", "versions") != path {
-			recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
+		foldersToDelete = append(foldersToDelete, folderToDelete...)
 
-			folderToDelete := VersionPromoteOnPath(path, recoveredPath, parsedSelectsNames)
+		return nil
+	})
 
-			foldersToDelete = append(foldersToDelete, folderToDelete...)
+	if err != nil {
+		return nil, err
+	}
 
-			return fs.SkipDir
+	for _, folderToDelete := range foldersToDelete {
+		if err := filesystem.FileDeleteFolder(folderToDelete); err != nil {
+			return nil, err
 		}
+	}
 
-		return nil
-	})
+	return parsedSelectsNames, nil
+}
+
+// resolveVersionsOnPath promotes or demotes the feature/state named by state on a
+// single version base, an empty state asks for it.
+func resolveVersionsOnPath(rootDir string, path string, title string, state string, resolveOnPath func(rootDir string, folder string, path string, names []string) ([]string, error)) ([]string, error) {
+	if err := requireVersionBase(rootDir, path); err != nil {
+		return nil, err
+	}
+
+	hashedPath := utils.HashPath(path)
+
+	featureStateList, err := GetVersionFeaturesStatesFromPath(rootDir, path)
 
 	if err != nil {
-		logger.Fatal[error](err)
+		return nil, err
+	}
+
+	var options []components.ListItem = []components.ListItem{}
+
+	for _, featureState := range featureStateList {
+		var desc string = "feature"
+
+		if len(featureState.Names) > 1 {
+			desc = "state"
+		}
+
+		options = append(options, components.ListItem{
+			ItemTitle: strings.Join(featureState.Names, "+"),
+			ItemDesc: desc,
+			ItemValue: strings.Join(featureState.Names, "@_separator_@"),
+		})
+	}
+
+	selected, err := selectState(title, options, state, "--feature", "%s on %s", strings.ToLower(title), path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if selected.ItemValue == "" {
+		return nil, errs.ErrCanceled
+	}
+
+	names := strings.Split(selected.ItemValue, "@_separator_@")
+
+	foldersToDelete, err := resolveOnPath(rootDir, filepath.Join(rootDir, ".features", "versions", hashedPath), path, names)
+
+	if err != nil {
+		return nil, err
 	}
 
 	for _, folderToDelete := range foldersToDelete {
-		filesystem.FileDeleteFolder(folderToDelete)
+		if err := filesystem.FileDeleteFolder(folderToDelete); err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// VersionPromoteFile promotes the feature/state named by state on the version base
+// path, an empty state asks for it.
+func VersionPromoteFile(rootDir string, path string, state string, finalMessage bool) error {
+	names, err := resolveVersionsOnPath(rootDir, path, "Select a feature or state to promote", state, VersionPromoteOnPath)
+
+	if err != nil {
+		return err
 	}
 
 	if finalMessage {
 		var plural string
 
-		if len(parsedSelectsNames) > 1 {
+		if len(names) > 1 {
 			plural = "s"
 		}
 
-		logger.Success[string](fmt.Sprintf("feature%s %s %s", plural, styles.AccentTextStyle(strings.Join(parsedSelectsNames, "+")), styles.GreenTextStyle("promoted")))
+		logger.Success[string](fmt.Sprintf("feature%s %s %s on %s", plural, styles.AccentTextStyle(strings.Join(names, "+")), styles.GreenTextStyle("promoted"), styles.AccentTextStyle(path)))
 	}
+
+	return nil
 }
 
-func VersionDemote(finalMessage bool) {
-	exists := CheckWorkspaceFolder()
+// VersionDemoteFile demotes the feature/state named by state on the version base path,
+// an empty state asks for it.
+func VersionDemoteFile(rootDir string, path string, state string, finalMessage bool) error {
+	names, err := resolveVersionsOnPath(rootDir, path, "Select a feature or state to demote", state, VersionDemoteOnPath)
 
-	if !exists {
-		logger.Result[string]("workspace not found, use flag init")
+	if err != nil {
+		return err
 	}
 
-	var foldersToDelete []string = []string{}
-	selected := selectFeatureState("Select a feature or state to demote")
+	if finalMessage {
+		var plural string
 
-	if len(selected) == 0 {
-		os.Exit(0)
+		if len(names) > 1 {
+			plural = "s"
+		}
+
+		logger.Success[string](fmt.Sprintf("feature%s %s %s on %s", plural, styles.AccentTextStyle(strings.Join(names, "+")), styles.RedTextStyle("demoted"), styles.AccentTextStyle(path)))
 	}
 
-	parsedSelectsNames := strings.Split(selected, "@_separator_@")
+	return nil
+}
 
-	var rootDir string = git.GetRepositoryRoot()
+// VersionPromote promotes the feature/state named by state on every version base, an
+// empty state asks for it.
+func VersionPromote(rootDir string, state string, finalMessage bool) error {
+	parsedSelectsNames, err := resolveVersions(rootDir, "Select a feature or state to promote", state, VersionPromoteOnPath)
 
-	err := filepath.WalkDir(filepath.Join(rootDir, ".features", "versions"), func (path string, d os.DirEntry, err error) error {
-		if err != nil {
-			logger.Fatal[error](err)
-		}
+	if err != nil {
+		return err
+	}
 
-		if d.IsDir() && filepath.Join(rootDir, ".features", "versions") != path {
-			recoveredPath := filesystem.FileRead(filepath.Join(path, "_path"))
+	if finalMessage {
+		var plural string
 
-			folderToDelete := VersionDemoteOnPath(path, recoveredPath, parsedSelectsNames)
+		if len(parsedSelectsNames) > 1 {
+			plural = "s"
+		}
 
-			foldersToDelete = append(foldersToDelete, folderToDelete...)
+		logger.Success[string](fmt.Sprintf("feature%s %s %s", plural, styles.AccentTextStyle(strings.Join(parsedSelectsNames, "+")), styles.GreenTextStyle("promoted")))
+	}
 
-			return fs.SkipDir
-		}
+	return nil
+}
 
-		return nil
-	})
+// VersionDemote demotes the feature/state named by state on every version base, an
+// empty state asks for it.
+func VersionDemote(rootDir string, state string, finalMessage bool) error {
+	parsedSelectsNames, err := resolveVersions(rootDir, "Select a feature or state to demote", state, VersionDemoteOnPath)
 
 	if err != nil {
-		logger.Fatal[error](err)
-	}
-
-	for _, folderToDelete := range foldersToDelete {
-		filesystem.FileDeleteFolder(folderToDelete)
+		return err
 	}
 
 	if finalMessage {
@@ -1397,12 +1749,29 @@ func VersionDemote(finalMessage bool) {
 
 		logger.Success[string](fmt.Sprintf("feature%s %s %s", plural, styles.AccentTextStyle(strings.Join(parsedSelectsNames, "+")), styles.RedTextStyle("demoted")))
 	}
+
+	return nil
 }
 
-func Merge(pathA string, pathB string, pathBase string, featureA string, featureB string, title string) {
-	hasConflicts := git.GitMerge(pathBase, pathA, pathB, featureA, featureB)
+// Merge merges the two versions of a file with the merge strategy selected and writes
+// the merged file on git.TempPath("merge-tmp"). Conflicts are solved interactively on
+// the hunks of the merge, or fail when prompts are disabled, before anything is written.
+func Merge(rootDir string, pathA string, pathB string, pathBase string, featureA string, featureB string, title string) error {
+	result, err := merge.Files(pathBase, pathA, pathB, featureA, featureB)
 
-	if hasConflicts {
-		conflict.Resolve(title)	
+	if err != nil {
+		return err
 	}
-}
\ No newline at end of file
+
+	var merged string = result.Text()
+
+	if result.HasConflicts() && !interactive {
+		return errs.New(errs.MergeConflict, "%s: the merge has conflicts and prompts are disabled", title)
+	} else if result.HasConflicts() {
+		if merged, err = conflict.Resolve(title, result); err != nil {
+			return err
+		}
+	}
+
+	return filesystem.FileWriteContentToFile(git.TempPath(rootDir, "merge-tmp"), merged)
+}
@@ -5,126 +5,238 @@ import (
 	"path/filepath"
 
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/git"
 	"github.com/costaluu/flag/logger"
 	"github.com/costaluu/flag/types"
 )
 
-var delimeters types.Delimeters = map[string]types.Delimeter{
-		".xqy": {
-			Start: "(:~ ",
-			End: " ~:)",
-		},
-		".xml": {
-			Start: "<!-- ",
-			End: " -->",
-		},
-		".html": {
-			Start: "<!-- ",
-			End: " -->",
-		},
-		".cc": {
-			Start: "// ",
-			End: " //",
-		},
-		".cpp": {
-			Start: "// ",
-			End: " //",
-		},
-		".go": {
-			Start: "// ",
-			End: " //",
-		},
-		".py": {
-			Start: "# ",
-			End: " #",
-		},
-		"default": {
-			Start: "// ",
-			End: " //",
-		},
+// delimeters is the table written on new workspaces. Rules are tried by exact file name,
+// glob and extension before falling back to default.
+var delimeters types.Delimeters = map[string]types.DelimeterList{
+		// Exact file names
+		"Makefile": {{Start: "# ", End: " #"}},
+		"Dockerfile": {{Start: "# ", End: " #"}},
+		"Gemfile": {{Start: "# ", End: " #"}},
+		"Rakefile": {{Start: "# ", End: " #"}},
+		"Jenkinsfile": {{Start: "// ", End: " //"}},
+		"CMakeLists.txt": {{Start: "# ", End: " #"}},
+
+		// Globs
+		"**/Dockerfile*": {{Start: "# ", End: " #"}},
+		"*.env*": {{Start: "# ", End: " #"}},
+
+		// Extensions
+		".xqy": {{Start: "(:~ ", End: " ~:)"}},
+		".xml": {{Start: "<!-- ", End: " -->"}},
+		".svg": {{Start: "<!-- ", End: " -->"}},
+		".md": {{Start: "<!-- ", End: " -->"}},
+		".html": {{Start: "<!-- ", End: " -->"}, {Start: "/* ", End: " */"}, {Start: "// ", End: " //"}},
+		".vue": {{Start: "<!-- ", End: " -->"}, {Start: "/* ", End: " */"}, {Start: "// ", End: " //"}},
+		".svelte": {{Start: "<!-- ", End: " -->"}, {Start: "/* ", End: " */"}, {Start: "// ", End: " //"}},
+		".css": {{Start: "/* ", End: " */"}},
+		".scss": {{Start: "/* ", End: " */"}, {Start: "// ", End: " //"}},
+		".less": {{Start: "/* ", End: " */"}, {Start: "// ", End: " //"}},
+		".c": {{Start: "// ", End: " //"}, {Start: "/* ", End: " */"}},
+		".h": {{Start: "// ", End: " //"}, {Start: "/* ", End: " */"}},
+		".cc": {{Start: "// ", End: " //"}},
+		".cpp": {{Start: "// ", End: " //"}},
+		".hpp": {{Start: "// ", End: " //"}},
+		".cs": {{Start: "// ", End: " //"}},
+		".go": {{Start: "// ", End: " //"}},
+		".rs": {{Start: "// ", End: " //"}},
+		".java": {{Start: "// ", End: " //"}},
+		".kt": {{Start: "// ", End: " //"}},
+		".swift": {{Start: "// ", End: " //"}},
+		".scala": {{Start: "// ", End: " //"}},
+		".dart": {{Start: "// ", End: " //"}},
+		".php": {{Start: "// ", End: " //"}, {Start: "# ", End: " #"}},
+		".js": {{Start: "// ", End: " //"}},
+		".jsx": {{Start: "// ", End: " //"}, {Start: "/* ", End: " */"}},
+		".ts": {{Start: "// ", End: " //"}},
+		".tsx": {{Start: "// ", End: " //"}, {Start: "/* ", End: " */"}},
+		".mjs": {{Start: "// ", End: " //"}},
+		".cjs": {{Start: "// ", End: " //"}},
+		".py": {{Start: "# ", End: " #"}},
+		".rb": {{Start: "# ", End: " #"}},
+		".pl": {{Start: "# ", End: " #"}},
+		".r": {{Start: "# ", End: " #"}},
+		".ex": {{Start: "# ", End: " #"}},
+		".exs": {{Start: "# ", End: " #"}},
+		".sh": {{Start: "# ", End: " #"}},
+		".bash": {{Start: "# ", End: " #"}},
+		".zsh": {{Start: "# ", End: " #"}},
+		".fish": {{Start: "# ", End: " #"}},
+		".ps1": {{Start: "# ", End: " #"}},
+		".yml": {{Start: "# ", End: " #"}},
+		".yaml": {{Start: "# ", End: " #"}},
+		".toml": {{Start: "# ", End: " #"}},
+		".tf": {{Start: "# ", End: " #"}, {Start: "// ", End: " //"}},
+		".properties": {{Start: "# ", End: " #"}},
+		".conf": {{Start: "# ", End: " #"}},
+		".gitignore": {{Start: "# ", End: " #"}},
+		".dockerignore": {{Start: "# ", End: " #"}},
+		".ini": {{Start: "; ", End: " ;"}, {Start: "# ", End: " #"}},
+		".sql": {{Start: "-- ", End: " --"}},
+		".lua": {{Start: "-- ", End: " --"}},
+		".hs": {{Start: "-- ", End: " --"}},
+		".elm": {{Start: "-- ", End: " --"}},
+
+		// Files without a rule
+		"default": {{Start: "// ", End: " //"}},
 }
 
 var presets types.Presets = make(types.Presets)
 
-func CheckWorkspaceFolder() bool {
-	rootDir := git.GetRepositoryRoot()
+var featureRegistry types.Registry = make(types.Registry)
 
+// workspacePart is a folder or a file of a workspace, content is what a missing file is
+// created with and it is nil for folders.
+type workspacePart struct {
+	name    string
+	content any
+}
+
+var workspaceParts []workspacePart = []workspacePart{
+	{name: "blocks"},
+	{name: "versions"},
+	{name: "delimeters", content: delimeters},
+	{name: "presets", content: presets},
+	{name: "registry", content: featureRegistry},
+}
+
+func (part workspacePart) path(rootDir string) string {
+	return filepath.Join(rootDir, ".features", part.name)
+}
+
+func (part workspacePart) create(rootDir string) error {
+	if part.content == nil {
+		return filesystem.FileCreateFolder(part.path(rootDir))
+	}
+
+	return filesystem.FileWriteJSONToFile(part.path(rootDir), part.content)
+}
+
+// probeWorkspace reports if the repository has a workspace and the parts it misses,
+// nothing is written.
+func probeWorkspace(rootDir string) (bool, []workspacePart, error) {
 	featuresPath := filepath.Join(rootDir, ".features")
 
 	// Check if the .features directory exists
 	if _, err := os.Stat(featuresPath); os.IsNotExist(err) {
-		return false
+		return false, nil, nil
 	} else if err != nil {
-		logger.Fatal[error](err)
+		return false, nil, err
 	}
 
-	versionsExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "versions"))
-	blocksExists := filesystem.FileFolderExists(filepath.Join(rootDir, ".features", "blocks"))
-	delimetersExists := filesystem.FileExists(filepath.Join(rootDir, ".features", "delimeters"))
-	presetsExists := filesystem.FileExists(filepath.Join(rootDir, ".features", "delimeters"))
+	var missing []workspacePart = []workspacePart{}
+	var absent map[string]bool = make(map[string]bool)
 
-	if !versionsExists && !blocksExists && !delimetersExists {
-		return false
+	for _, part := range workspaceParts {
+		if _, err := os.Stat(part.path(rootDir)); os.IsNotExist(err) {
+			missing = append(missing, part)
+			absent[part.name] = true
+		} else if err != nil {
+			return false, nil, err
+		}
 	}
 
-	if !versionsExists {
-		filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "versions"))
+	// A .features folder without blocks, versions and delimeters is not a workspace
+	if absent["blocks"] && absent["versions"] && absent["delimeters"] {
+		return false, nil, nil
 	}
 
-	if !blocksExists {
-		filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "blocks"))
+	return true, missing, nil
+}
+
+// CheckWorkspaceFolder reports if the repository has a workspace, nothing is written.
+func CheckWorkspaceFolder(rootDir string) (bool, error) {
+	exists, _, err := probeWorkspace(rootDir)
+
+	return exists, err
+}
+
+// RepairWorkspace creates the missing parts of an existing workspace, it reports if the
+// repository has one.
+func RepairWorkspace(rootDir string) (bool, error) {
+	exists, missing, err := probeWorkspace(rootDir)
+
+	if err != nil || !exists {
+		return exists, err
 	}
 
-	if !delimetersExists {
-		filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "delimeters"), delimeters)
+	for _, part := range missing {
+		if err := part.create(rootDir); err != nil {
+			return false, err
+		}
 	}
 
-	if !presetsExists {
-		filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "presets"), delimeters)
+	return true, nil
+}
+
+// RequireWorkspace returns errs.ErrWorkspaceNotFound when the repository has no workspace.
+func RequireWorkspace(rootDir string) error {
+	exists, err := CheckWorkspaceFolder(rootDir)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return errs.ErrWorkspaceNotFound
 	}
 
-	return true
+	return nil
 }
 
-func CreateNewWorkspace() {
-	var rootDir string = git.GetRepositoryRoot()
+func CreateNewWorkspace(rootDir string) error {
+	if err := filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features")); err != nil {
+		return err
+	}
 
-	filesystem.FileDeleteFolder(filepath.Join(rootDir, ".features"))
+	if err := filesystem.FileCreateFolder(filepath.Join(rootDir, ".features")); err != nil {
+		return err
+	}
 
-	filesystem.FileCreateFolder(filepath.Join(rootDir, ".features"))
-	filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "blocks"))
-	filesystem.FileCreateFolder(filepath.Join(rootDir, ".features", "versions"))
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "delimeters"), delimeters)
-	filesystem.FileWriteJSONToFile(filepath.Join(rootDir, ".features", "presets"), presets)
+	for _, part := range workspaceParts {
+		if err := part.create(rootDir); err != nil {
+			return err
+		}
+	}
 
 	logger.Success[string]("folder .features created")
+
+	return nil
 }
 
-func WorkspaceReport() {
-	exists := CheckWorkspaceFolder()
+func WorkspaceReport(rootDir string) error {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return err
+	}
 
-	if !exists {
-		logger.Result[string]("workspace not found, use flag init")
+	if err := AllBlocksDetails(rootDir); err != nil {
+		return err
 	}
 
-	AllBlocksDetails()
-	AllVersionFeatureDetails()
+	return AllVersionFeatureDetails(rootDir)
 }
 
-func GlobalToggle(featureName string, state string) {
-	exists := CheckWorkspaceFolder()
+func GlobalToggle(rootDir string, featureName string, state string) error {
+	if err := RequireWorkspace(rootDir); err != nil {
+		return err
+	}
 
-	if !exists {
-		logger.Result[string]("workspace not found, use flag init")
+	if err := ValidateFeatureState(rootDir, featureName, state); err != nil {
+		return err
 	}
 
-	ToggleBlockFeature(featureName, state) // on | off | dev
+	if err := ToggleBlockFeature(rootDir, featureName, state); err != nil { // on | off | dev | variant
+		return err
+	}
 
 	if state == constants.STATE_DEV {
-		ToggleVersionFeature(featureName, constants.STATE_ON) // on | off
-	} else {
-		ToggleVersionFeature(featureName, state) // on | off
+		return ToggleVersionFeature(rootDir, featureName, constants.STATE_ON) // on | off
 	}
-}
\ No newline at end of file
+
+	return ToggleVersionFeature(rootDir, featureName, state) // on | off
+}
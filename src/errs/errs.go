@@ -0,0 +1,157 @@
+// Package errs holds the errors returned by the flag packages. Every failure is an
+// *Error with a Kind, so callers can tell a missing workspace from an unknown feature
+// with errors.Is and the CLI can map each kind to its own exit code.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Kind int
+
+const (
+	Internal Kind = iota
+	InvalidArgument
+	WorkspaceNotFound
+	UnknownFeature
+	InvalidState
+	NotBaseFile
+	MergeConflict
+	NotFound
+	AlreadyExists
+	Canceled
+	Inconsistent
+	Locked
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case InvalidArgument:
+		return "invalid argument"
+	case WorkspaceNotFound:
+		return "workspace not found"
+	case UnknownFeature:
+		return "unknown feature"
+	case InvalidState:
+		return "invalid state"
+	case NotBaseFile:
+		return "not a base file"
+	case MergeConflict:
+		return "merge conflict"
+	case NotFound:
+		return "not found"
+	case AlreadyExists:
+		return "already exists"
+	case Canceled:
+		return "canceled"
+	case Inconsistent:
+		return "inconsistent workspace"
+	case Locked:
+		return "workspace locked"
+	default:
+		return "internal error"
+	}
+}
+
+// exitCodes are the exit codes of the CLI for each kind, scripts can rely on them.
+var exitCodes map[Kind]int = map[Kind]int{
+	Internal:          1,
+	InvalidArgument:   2,
+	WorkspaceNotFound: 3,
+	UnknownFeature:    4,
+	InvalidState:      5,
+	NotBaseFile:       6,
+	MergeConflict:     7,
+	NotFound:          8,
+	AlreadyExists:     9,
+	Canceled:          0,
+	Inconsistent:      10,
+	Locked:            11,
+}
+
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	} else if e.Message == "" {
+		return e.Kind.String()
+	} else if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Err)
+	}
+
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors of the same kind, so errors.Is(err, errs.ErrUnknownFeature) holds
+// for any unknown feature error.
+func (e *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+
+	return ok && other.Kind == e.Kind
+}
+
+// Sentinels to compare with errors.Is.
+var (
+	ErrInvalidArgument   = &Error{Kind: InvalidArgument}
+	ErrWorkspaceNotFound = &Error{Kind: WorkspaceNotFound, Message: "workspace not found, use flag init"}
+	ErrUnknownFeature    = &Error{Kind: UnknownFeature}
+	ErrInvalidState      = &Error{Kind: InvalidState}
+	ErrNotBaseFile       = &Error{Kind: NotBaseFile}
+	ErrMergeConflict     = &Error{Kind: MergeConflict}
+	ErrNotFound          = &Error{Kind: NotFound}
+	ErrAlreadyExists     = &Error{Kind: AlreadyExists}
+	ErrCanceled          = &Error{Kind: Canceled, Message: "canceled"}
+	ErrInconsistent      = &Error{Kind: Inconsistent}
+	ErrLocked            = &Error{Kind: Locked}
+)
+
+func New(kind Kind, format string, args ...any) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap adds a message to err. Errors that already have a kind keep it, the other ones
+// are internal errors.
+func Wrap(err error, format string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+
+	var kind Kind = Internal
+	var typed *Error
+
+	if errors.As(err, &typed) {
+		kind = typed.Kind
+	}
+
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// KindOf returns the kind of err, errors that are not an *Error are internal errors.
+func KindOf(err error) Kind {
+	var typed *Error
+
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+
+	return Internal
+}
+
+// ExitCode returns the exit code of the CLI for err, 0 when err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	return exitCodes[KindOf(err)]
+}
@@ -0,0 +1,37 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrapKeepsKind(t *testing.T) {
+	err := Wrap(New(UnknownFeature, "feature %s does not exists", "checkout"), "main.go")
+
+	if !errors.Is(err, ErrUnknownFeature) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("unexpected kind for %v", err)
+	}
+
+	if err.Error() != "main.go: feature checkout does not exists" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	if ExitCode(fmt.Errorf("sync: %w", err)) != 4 {
+		t.Errorf("unexpected exit code %d", ExitCode(err))
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if ExitCode(nil) != 0 || ExitCode(ErrCanceled) != 0 {
+		t.Errorf("nil and canceled errors should exit with 0")
+	}
+
+	if ExitCode(errors.New("git failed")) != 1 || KindOf(Wrap(errors.New("git failed"), "sync")) != Internal {
+		t.Errorf("untyped errors should be internal errors")
+	}
+
+	if ExitCode(ErrWorkspaceNotFound) != 3 {
+		t.Errorf("unexpected exit code %d", ExitCode(ErrWorkspaceNotFound))
+	}
+}
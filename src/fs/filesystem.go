@@ -11,7 +11,6 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/costaluu/flag/logger"
 )
 
 var fileMutex sync.Mutex = sync.Mutex{}
@@ -23,7 +22,7 @@ func FileDeleteFolder(path string) error {
 	_, err := os.Getwd()
 	
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
 
     // Check if the folder exists
@@ -32,11 +31,19 @@ func FileDeleteFolder(path string) error {
         return nil
     }
 
+    if err := record(path); err != nil {
+        return err
+    }
+
+    if err := written(path, stateMissing); err != nil {
+        return err
+    }
+
     // Attempt to delete the folder and all its contents
     err = os.RemoveAll(path)
 
     if err != nil {
-        logger.Fatal[error](err)
+        return err
     }
 
     return nil
@@ -70,34 +77,23 @@ func FileCopy(src, dst string) error {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
 
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
 	// Open the source file
 	sourceFile, err := os.Open(src)
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
 	defer sourceFile.Close()
 
-	// Create the destination file
-	destinationFile, err := os.Create(dst)
-	if err != nil {
-		logger.Fatal[error](err)
-	}
-	defer destinationFile.Close()
-
 	// Copy the content from the source to the destination
-	_, err = io.Copy(destinationFile, sourceFile)
-	if err != nil {
-		logger.Fatal[error](err)
-	}
+	return atomicWrite(dst, func(destinationFile io.Writer) error {
+		_, err := io.Copy(destinationFile, sourceFile)
 
-	// Flush writes to disk
-	err = destinationFile.Sync()
-
-	if err != nil {
-		logger.Fatal[error](err)
-	}
-
-	return nil
+		return err
+	})
 }
 
 // RemoveFile removes the file at the given path.
@@ -105,64 +101,135 @@ func RemoveFile(filePath string) error {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
 
+	if err := record(filePath); err != nil {
+		return err
+	}
+
+	if err := written(filePath, stateMissing); err != nil {
+		return err
+	}
+
 	// Remove the file
 	err := os.Remove(filePath)
 
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
 	
 	return nil
 }
 
 func FileWriteContentToFile(filePath string, content string) error {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
     // Write the content to the file
-    err := os.WriteFile(filePath, []byte(content), 0644)
-    
-	if err != nil {
-        logger.Fatal[error](err)
-    }
-    
-	return nil
+    return atomicWrite(filePath, func(file io.Writer) error {
+		_, err := io.WriteString(file, content)
+
+		return err
+	})
 }
 
-// WriteFileFromReader writes data from an io.Reader to a file at the given path.
-func FileWrite(reader io.Reader, filePath string) error {
+// FileAtomicWriteContentToFile writes the content to a temporary file next to filePath
+// and renames it over filePath, readers never see a partially written file.
+func FileAtomicWriteContentToFile(filePath string, content string) error {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
 
-	// Create the destination file
-	file, err := os.Create(filePath)
+	return atomicWrite(filePath, func(file io.Writer) error {
+		_, err := io.WriteString(file, content)
 
-	if err != nil {
-		logger.Fatal[error](err)
+		return err
+	})
+}
+
+// atomicWrite writes a temporary file next to filePath with write and renames it over
+// filePath, keeping its mode. The previous content is recorded on the journal first.
+func atomicWrite(filePath string, write func(file io.Writer) error) error {
+	if err := record(filePath); err != nil {
+		return err
 	}
-	
-	defer file.Close()
 
-	// Copy the contents from the reader to the file
-	_, err = io.Copy(file, reader)
+	var mode os.FileMode = 0644
+
+	if info, err := os.Stat(filePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), fmt.Sprintf(".%s.tmp-*", filepath.Base(filePath)))
+
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
 
-	// Ensure all data is written to disk
-	err = file.Sync()
-	
+	defer os.Remove(tmpFile.Name())
+
+	if err := write(tmpFile); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmpFile.Name(), mode); err != nil {
+		return err
+	}
+
+	checksum, err := FileGenerateCheckSum(tmpFile.Name())
+
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
+	}
+
+	if err := written(filePath, contentState(checksum)); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), filePath); err != nil {
+		return err
 	}
 
+	syncFolder(filepath.Dir(filePath))
+
 	return nil
 }
 
-func FileListDir(rootDir string) ([]string) {
+// syncFolder flushes a rename to disk, it is skipped where folders can't be synced.
+func syncFolder(path string) {
+	if folder, err := os.Open(path); err == nil {
+		folder.Sync()
+		folder.Close()
+	}
+}
+
+// WriteFileFromReader writes data from an io.Reader to a file at the given path.
+func FileWrite(reader io.Reader, filePath string) error {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	// Copy the contents from the reader to the file
+	return atomicWrite(filePath, func(file io.Writer) error {
+		_, err := io.Copy(file, reader)
+
+		return err
+	})
+}
+
+func FileListDir(rootDir string) ([]string, error) {
 	var filePaths []string
 
 	entries, err := os.ReadDir(rootDir)
 	
 	if err != nil {
-		logger.Fatal[error](err)
+		return nil, err
 	}
 
 	for _, entry := range entries {
@@ -178,7 +245,7 @@ func FileListDir(rootDir string) ([]string) {
 		}
 	}
 
-	return filePaths
+	return filePaths, nil
 }
 
 // Function to write a JSON object to a file at the given path
@@ -190,24 +257,15 @@ func FileWriteJSONToFile(filePath string, data interface{}) error {
 	jsonData, err := json.MarshalIndent(data, "", "  ")
 	
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
 
-	// Create or open the file at the given path
-	file, err := os.Create(filePath)
-	if err != nil {
-		logger.Fatal[error](err)
-	}
-	defer file.Close()
-
 	// Write the JSON data to the file
-	_, err = file.Write(jsonData)
-	
-	if err != nil {
-		logger.Fatal[error](err)
-	}
+	return atomicWrite(filePath, func(file io.Writer) error {
+		_, err := file.Write(jsonData)
 
-	return nil
+		return err
+	})
 }
 
 // Function to read JSON from a file and unmarshal into the provided variable
@@ -217,58 +275,69 @@ func FileReadJSONFromFile(filePath string, result interface{}) error {
 
 	fileContent, err := os.ReadFile(filePath)
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
 
 	// Unmarshal the JSON into the result interface
 	err = json.Unmarshal(fileContent, result)
 	
 	if err != nil {
-		logger.Fatal[error](err)
+		return err
 	}
 
 	return nil
 }
 
 func FileCreateFolder(path string) error {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	if err := record(path); err != nil {
+		return err
+	}
+
+	if err := written(path, stateFolder); err != nil {
+		return err
+	}
+
     // Create the folder with 0755 permissions
     err := os.Mkdir(path, 0755)
 
     if err != nil {
-        logger.Fatal[error](err)
+        return err
     }
 
     return nil
 }
 
-func FileGenerateCheckSum(path string) string {
+func FileGenerateCheckSum(path string) (string, error) {
 	f, err := os.Open(path)
 
     if err != nil {
-        logger.Fatal[error](err)
+        return "", err
     }
     defer f.Close()
 
     h := sha256.New()
 	
     if _, err := io.Copy(h, f); err != nil {
-        logger.Fatal[error](err)
+        return "", err
     }
 
-    return fmt.Sprintf("%x", h.Sum(nil))
+    return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
-func FileRead(path string) string {
+func FileRead(path string) (string, error) {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
 
 	data, err := os.ReadFile(path)
 	
 	if err != nil {
-		logger.Fatal[error](err)
+		return "", err
 	}
 
-	return string(data)
+	return string(data), nil
 }
 
 // ReplaceLinesInFile replaces lines in a file between startLineToReplace and endLineToReplace with the given linesToReplace.
@@ -306,7 +375,13 @@ func FileReplaceLinesInFile(filePath string, startLineToReplace int, endLineToRe
 	}
 
 	// Write the modified lines back to the file
-	if err := os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+	err = atomicWrite(filePath, func(output io.Writer) error {
+		_, err := io.WriteString(output, strings.Join(lines, "\n"))
+
+		return err
+	})
+
+	if err != nil {
 		return fmt.Errorf("failed to write to file: %v", err)
 	}
 
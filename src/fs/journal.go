@@ -0,0 +1,550 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// journalManifestFile lists the entries of a journal, one JSON line each in the order
+// they were recorded. Lines are appended, a line cut by a crash is ignored.
+const journalManifestFile = "manifest"
+
+// journalLine is a line of the manifest. The first one holds the operation, then an
+// entry is a file or folder changed by the operation, Backup is the copy of what it was
+// before the change and is empty when it did not exist. Written lines hold the state an
+// operation is about to leave an entry on, the last one is the state a rollback expects.
+type journalLine struct {
+	Operation string `json:"operation,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	Written   string `json:"written,omitempty"`
+}
+
+// journalEntry is a path changed by an operation with the state it left it on, which is
+// empty when the change was not recorded.
+type journalEntry struct {
+	Path    string
+	Backup  string
+	Written string
+}
+
+// journal keeps the previous state of every path written on root while an operation
+// runs.
+type journal struct {
+	root     string
+	folder   string
+	skip     []string
+	manifest *os.File
+	entries  int
+	recorded map[string]bool
+	// depth counts the operations that joined the journal, it ends with the first one.
+	depth int
+}
+
+// journals are the journals of the operations in progress by their root, operations on
+// different trees run at the same time.
+var journals map[string]*journal = make(map[string]*journal)
+
+// changeHook is told the path of every file and folder the package changes, rollbacks
+// included.
+var changeHook func(path string)
+
+// OnChange sets the function told the absolute path of every file and folder the package
+// is about to change. It runs with the package lock held and must not call back into it.
+func OnChange(hook func(path string)) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	changeHook = hook
+}
+
+func isInside(path string, folder string) bool {
+	return path == folder || strings.HasPrefix(path, folder+string(filepath.Separator))
+}
+
+// record saves the current state of path before it is written on the journal of the
+// innermost root that holds it, fileMutex must be held.
+func record(path string) error {
+	if len(journals) == 0 && changeHook == nil {
+		return nil
+	}
+
+	path, err := filepath.Abs(path)
+
+	if err != nil {
+		return err
+	}
+
+	if changeHook != nil {
+		changeHook(path)
+	}
+
+	var found *journal
+
+	for root, j := range journals {
+		if isInside(path, root) && (found == nil || len(root) > len(found.root)) {
+			found = j
+		}
+	}
+
+	if found == nil {
+		return nil
+	}
+
+	return found.record(path)
+}
+
+// record saves the current state of path, an absolute path, before it is written. Paths
+// are recorded once, the first state is the one a rollback restores.
+func (j *journal) record(path string) error {
+	if j.recorded[path] || !j.journaled(path) {
+		return nil
+	}
+
+	var line journalLine = journalLine{Path: path}
+
+	if _, err := os.Lstat(path); err == nil {
+		line.Backup = fmt.Sprintf("%d", j.entries)
+
+		if err := copyTree(path, filepath.Join(j.folder, line.Backup)); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	j.entries++
+	j.recorded[path] = true
+
+	// The entry is on disk before the write it protects
+	return j.append(line)
+}
+
+// journaled reports if the changes of path are kept on the journal.
+func (j *journal) journaled(path string) bool {
+	if isInside(path, j.folder) {
+		return false
+	}
+
+	for _, skip := range j.skip {
+		if isInside(path, skip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (j *journal) append(line journalLine) error {
+	data, err := json.Marshal(line)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.manifest.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	return j.manifest.Sync()
+}
+
+// written saves the state the operation is about to leave path on, before it changes
+// it. A rollback only restores a path that is still on that state.
+func written(path string, state string) error {
+	if len(journals) == 0 {
+		return nil
+	}
+
+	path, err := filepath.Abs(path)
+
+	if err != nil {
+		return err
+	}
+
+	for root, j := range journals {
+		if isInside(path, root) && j.recorded[path] {
+			return j.append(journalLine{Path: path, Written: state})
+		}
+	}
+
+	return nil
+}
+
+// Path states saved on the journal, a file is saved with the checksum of its content.
+const (
+	stateMissing = "missing"
+	stateFolder  = "folder"
+)
+
+// contentState is the state of a file with content.
+func contentState(checksum string) string {
+	return "file " + checksum
+}
+
+// pathState returns the state of path, the content of a folder is part of it except
+// for the journal folder.
+func pathState(path string, journalFolder string) (string, error) {
+	info, err := os.Lstat(path)
+
+	if os.IsNotExist(err) {
+		return stateMissing, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		link, err := os.Readlink(path)
+
+		return "link " + link, err
+	} else if !info.IsDir() {
+		checksum, err := FileGenerateCheckSum(path)
+
+		return contentState(checksum), err
+	}
+
+	entries, err := os.ReadDir(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string = []string{}
+
+	for _, entry := range entries {
+		if isInside(filepath.Join(path, entry.Name()), journalFolder) {
+			continue
+		}
+
+		state, err := pathState(filepath.Join(path, entry.Name()), journalFolder)
+
+		if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, entry.Name()+" "+state)
+	}
+
+	if len(parts) == 0 {
+		return stateFolder, nil
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+
+	return fmt.Sprintf("%s %x", stateFolder, hash), nil
+}
+
+// copyTree copies a file, a symbolic link or a folder with its content.
+func copyTree(src string, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(src, path)
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, relative)
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		}
+
+		source, err := os.Open(path)
+
+		if err != nil {
+			return err
+		}
+
+		defer source.Close()
+
+		destination, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(destination, source); err != nil {
+			destination.Close()
+			return err
+		}
+
+		if err := destination.Sync(); err != nil {
+			destination.Close()
+			return err
+		}
+
+		return destination.Close()
+	})
+}
+
+// BeginJournal starts the journal of an operation on folder, every path of root written
+// until EndJournal is recorded except the ones inside of skip. An operation on root that
+// begins while another one runs joins its journal.
+func BeginJournal(root string, folder string, operation string, skip ...string) error {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	root, err := filepath.Abs(root)
+
+	if err != nil {
+		return err
+	}
+
+	if active, exists := journals[root]; exists {
+		active.depth++
+
+		return nil
+	}
+
+	folder, err = filepath.Abs(folder)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(folder); err == nil {
+		return fmt.Errorf("the journal %s already exists, roll it back first", folder)
+	}
+
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return err
+	}
+
+	var skipPaths []string = []string{}
+
+	for _, path := range skip {
+		if path, err := filepath.Abs(path); err == nil {
+			skipPaths = append(skipPaths, path)
+		}
+	}
+
+	manifest, err := os.OpenFile(filepath.Join(folder, journalManifestFile), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		os.RemoveAll(folder)
+
+		return err
+	}
+
+	j := &journal{
+		root:     root,
+		folder:   folder,
+		skip:     skipPaths,
+		manifest: manifest,
+		recorded: make(map[string]bool),
+		depth:    1,
+	}
+
+	if err := j.append(journalLine{Operation: operation}); err != nil {
+		manifest.Close()
+		os.RemoveAll(folder)
+
+		return err
+	}
+
+	syncFolder(folder)
+
+	journals[root] = j
+
+	return nil
+}
+
+// EndJournal ends the operation that began the journal of root. The journal is removed
+// when commit is true, otherwise the recorded paths are restored first and the ones that
+// changed since the operation wrote them are returned, they are kept as they are.
+func EndJournal(root string, commit bool) ([]string, error) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	root, err := filepath.Abs(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	active, exists := journals[root]
+
+	if !exists {
+		return nil, nil
+	}
+
+	if active.depth--; active.depth > 0 {
+		return nil, nil
+	}
+
+	folder := active.folder
+	delete(journals, root)
+
+	if err := active.manifest.Close(); err != nil {
+		return nil, err
+	}
+
+	if !commit {
+		return rollbackJournal(folder)
+	}
+
+	return nil, os.RemoveAll(folder)
+}
+
+// JournalActive reports if an operation of this process on root is being journaled.
+func JournalActive(root string) bool {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	root, err := filepath.Abs(root)
+
+	if err != nil {
+		return false
+	}
+
+	_, exists := journals[root]
+
+	return exists
+}
+
+// readJournalManifest returns the operation of the manifest on folder and its entries,
+// each one with the last state written on it.
+func readJournalManifest(folder string) (string, []journalEntry, error) {
+	data, err := os.ReadFile(filepath.Join(folder, journalManifestFile))
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	var operation string
+	var entries []journalEntry = []journalEntry{}
+	var positions map[string]int = make(map[string]int)
+
+	for _, text := range strings.Split(string(data), "\n") {
+		var line journalLine
+
+		// A line cut by a crash was never followed by the change it protects
+		if strings.TrimSpace(text) == "" || json.Unmarshal([]byte(text), &line) != nil {
+			continue
+		}
+
+		if line.Path == "" {
+			operation = line.Operation
+		} else if position, exists := positions[line.Path]; exists && line.Written != "" {
+			entries[position].Written = line.Written
+		} else if !exists {
+			positions[line.Path] = len(entries)
+			entries = append(entries, journalEntry{Path: line.Path, Backup: line.Backup})
+		}
+	}
+
+	return operation, entries, nil
+}
+
+// ReadJournal returns the operation of the journal on folder, exists is false when
+// there is none.
+func ReadJournal(folder string) (string, bool, error) {
+	operation, _, err := readJournalManifest(folder)
+
+	if os.IsNotExist(err) {
+		// A journal interrupted before its manifest was written has no changes
+		if _, err := os.Stat(folder); err == nil {
+			return "", true, nil
+		}
+
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return operation, true, nil
+}
+
+// RollbackJournal restores the paths recorded on the journal of folder, left by an
+// operation that was interrupted, and removes it. The paths that changed since the
+// operation wrote them are returned, they are kept as they are.
+func RollbackJournal(folder string) ([]string, error) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+
+	return rollbackJournal(folder)
+}
+
+func rollbackJournal(folder string) ([]string, error) {
+	_, entries, err := readJournalManifest(folder)
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var kept []string = []string{}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+
+		current, err := pathState(entry.Path, folder)
+
+		if err != nil {
+			return kept, err
+		}
+
+		var previous string = stateMissing
+
+		if entry.Backup != "" {
+			if previous, err = pathState(filepath.Join(folder, entry.Backup), folder); err != nil {
+				return kept, err
+			}
+		}
+
+		if current == previous {
+			continue
+		} else if current != entry.Written {
+			// Changed after the operation, by hand or by another command
+			kept = append(kept, entry.Path)
+
+			continue
+		}
+
+		if changeHook != nil {
+			changeHook(entry.Path)
+		}
+
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return kept, err
+		}
+
+		if entry.Backup == "" {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+			return kept, err
+		}
+
+		if err := copyTree(filepath.Join(folder, entry.Backup), entry.Path); err != nil {
+			return kept, err
+		}
+	}
+
+	return kept, os.RemoveAll(folder)
+}
@@ -0,0 +1,233 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestJournalRollback(t *testing.T) {
+	root := t.TempDir()
+	folder := filepath.Join(root, ".features", "journal")
+
+	changed := filepath.Join(root, "main.go")
+	removed := filepath.Join(root, "removed.block")
+	createdFolder := filepath.Join(root, "blocks")
+	skipped := filepath.Join(root, "merge-tmp")
+
+	for path, content := range map[string]string{changed: "before", removed: "block"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := BeginJournal(root, folder, "toggle", skipped); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []func() error{
+		func() error { return FileWriteContentToFile(changed, "after") },
+		func() error { return FileWriteContentToFile(changed, "after again") },
+		func() error { return RemoveFile(removed) },
+		func() error { return FileCreateFolder(createdFolder) },
+		func() error { return FileWriteJSONToFile(filepath.Join(createdFolder, "_path"), "main.go") },
+		func() error { return FileWriteContentToFile(skipped, "merged") },
+		// A nested operation joins the journal
+		func() error { return BeginJournal(root, folder, "sync") },
+		func() error {
+			_, err := EndJournal(root, true)
+
+			return err
+		},
+	}
+
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(folder); err != nil {
+		t.Fatalf("the nested operation ended the journal: %v", err)
+	}
+
+	operation, exists, err := ReadJournal(folder)
+
+	if err != nil || !exists || operation != "toggle" {
+		t.Fatalf("ReadJournal() = %q, %v, %v", operation, exists, err)
+	}
+
+	// The process dies before the journal ends
+	delete(journals, root)
+
+	if kept, err := RollbackJournal(folder); err != nil || len(kept) != 0 {
+		t.Fatalf("RollbackJournal() = %v, %v", kept, err)
+	}
+
+	if content := readFile(t, changed); content != "before" {
+		t.Errorf("main.go = %q, want before", content)
+	}
+
+	if content := readFile(t, removed); content != "block" {
+		t.Errorf("removed.block = %q, want block", content)
+	}
+
+	if FileExists(createdFolder) {
+		t.Errorf("the folder created by the operation was not removed")
+	}
+
+	if content := readFile(t, skipped); content != "merged" {
+		t.Errorf("merge-tmp = %q, skipped paths are not restored", content)
+	}
+
+	if FileExists(folder) {
+		t.Errorf("the journal was not removed")
+	}
+}
+
+func TestEndJournal(t *testing.T) {
+	root := t.TempDir()
+	folder := filepath.Join(root, "journal")
+	path := filepath.Join(root, "presets")
+
+	for _, commit := range []bool{false, true} {
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := BeginJournal(root, folder, "presets"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := FileWriteContentToFile(path, `{"release":{}}`); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := EndJournal(root, commit); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "{}"
+
+		if commit {
+			want = `{"release":{}}`
+		}
+
+		if content := readFile(t, path); content != want {
+			t.Errorf("EndJournal(%v): presets = %q, want %q", commit, content, want)
+		}
+
+		if FileExists(folder) || JournalActive(root) {
+			t.Errorf("EndJournal(%v) left the journal behind", commit)
+		}
+	}
+}
+
+func TestJournalRoots(t *testing.T) {
+	roots := []string{t.TempDir(), t.TempDir()}
+
+	for _, root := range roots {
+		if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("before"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := BeginJournal(root, filepath.Join(root, "journal"), "toggle"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := FileWriteContentToFile(filepath.Join(root, "main.go"), "after"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each root rolls back its own changes only
+	if _, err := EndJournal(roots[0], false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := EndJournal(roots[1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{"before", "after"} {
+		if content := readFile(t, filepath.Join(roots[i], "main.go")); content != want {
+			t.Errorf("root %d: main.go = %q, want %q", i, content, want)
+		}
+
+		if JournalActive(roots[i]) || FileExists(filepath.Join(roots[i], "journal")) {
+			t.Errorf("root %d: the journal was left behind", i)
+		}
+	}
+}
+
+func TestRollbackKeepsChangedFiles(t *testing.T) {
+	root := t.TempDir()
+	folder := filepath.Join(root, "journal")
+	edited := filepath.Join(root, "edited.go")
+	untouched := filepath.Join(root, "untouched.go")
+	created := filepath.Join(root, "created")
+
+	for _, path := range []string{edited, untouched} {
+		if err := os.WriteFile(path, []byte("before"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := BeginJournal(root, folder, "toggle"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{edited, untouched} {
+		if err := FileWriteContentToFile(path, "after"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := FileCreateFolder(created); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process dies and the files are edited before the next command
+	delete(journals, root)
+
+	if err := os.WriteFile(edited, []byte("after\nedited by hand"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(created, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	kept, err := RollbackJournal(folder)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(kept, ",") != created+","+edited {
+		t.Errorf("RollbackJournal() kept %v, want %s and %s", kept, created, edited)
+	}
+
+	for path, want := range map[string]string{edited: "after\nedited by hand", untouched: "before", filepath.Join(created, "notes.txt"): "notes"} {
+		if content := readFile(t, path); content != want {
+			t.Errorf("%s = %q, want %q", path, content, want)
+		}
+	}
+
+	if FileExists(folder) {
+		t.Errorf("the journal was not removed")
+	}
+}
@@ -0,0 +1,230 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Commit is the commit that last changed a file.
+type Commit struct {
+	Id     string
+	Author string
+	// When is the author date, on the time zone of the author.
+	When time.Time
+}
+
+// Status lists the changed files of a working tree, relative to its root.
+type Status struct {
+	// Modified holds the files with staged or unstaged changes.
+	Modified  []string
+	Untracked []string
+	// Deleted holds the tracked files that are missing from the working tree.
+	Deleted []string
+}
+
+// Backend reads a git repository. The exec backend runs the git binary for every call,
+// the native backend reads the repository in process and falls back to the exec
+// backend for what it can not answer.
+type Backend interface {
+	// Root returns the root of the working tree that contains dir.
+	Root(dir string) (string, error)
+	// Status returns the changed files of the working tree at root.
+	Status(root string) (Status, error)
+	// LastCommit returns the last commit of HEAD that changed path, relative to root.
+	// found is false when no commit changed it.
+	LastCommit(root string, path string) (Commit, bool, error)
+	// ReadBlob returns the content of path, relative to root, on the commit rev.
+	ReadBlob(root string, rev string, path string) ([]byte, error)
+}
+
+// Names of the backends for SelectBackend.
+const (
+	BackendNative = "native"
+	BackendExec   = "exec"
+)
+
+var backendMutex sync.Mutex = sync.Mutex{}
+
+var backend Backend = newNativeBackend(execBackend{})
+
+// SelectBackend sets the backend used to read repositories by its name.
+func SelectBackend(name string) error {
+	switch name {
+	case "", BackendNative:
+		SetBackend(newNativeBackend(execBackend{}))
+	case BackendExec:
+		SetBackend(execBackend{})
+	default:
+		return fmt.Errorf("invalid git backend %s, use %s or %s", name, BackendNative, BackendExec)
+	}
+
+	return nil
+}
+
+// SetBackend sets the backend used to read repositories.
+func SetBackend(b Backend) {
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+
+	backend = b
+
+	rootMutex.Lock()
+	roots = make(map[string]string)
+	rootMutex.Unlock()
+}
+
+func currentBackend() Backend {
+	backendMutex.Lock()
+	defer backendMutex.Unlock()
+
+	return backend
+}
+
+// execBackend answers every call with the git binary.
+type execBackend struct{}
+
+func (execBackend) Root(dir string) (string, error) {
+	cmd := gitCommand(dir, "rev-parse", "--show-toplevel")
+
+	out, err := cmd.Output()
+
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (execBackend) Status(root string) (Status, error) {
+	// --no-optional-locks keeps status from refreshing the index while a hook runs
+	out, err := gitCommand(root, "--no-optional-locks", "status", "--porcelain", "-z", "--untracked-files=all").Output()
+
+	if err != nil {
+		return Status{}, fmt.Errorf("git status failed: %w", err)
+	}
+
+	return parseStatus(string(out)), nil
+}
+
+// parseStatus reads the output of git status --porcelain -z.
+func parseStatus(out string) Status {
+	var status Status = Status{Modified: []string{}, Untracked: []string{}, Deleted: []string{}}
+
+	entries := strings.Split(out, "\x00")
+
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+
+		if len(entry) < 4 {
+			continue
+		}
+
+		x, y, path := entry[0], entry[1], entry[3:]
+
+		// Renames and copies are followed by their source
+		if x == 'R' || x == 'C' {
+			i++
+		}
+
+		switch {
+		case x == '?':
+			status.Untracked = append(status.Untracked, path)
+		case x == '!':
+		default:
+			status.Modified = append(status.Modified, path)
+
+			if y == 'D' {
+				status.Deleted = append(status.Deleted, path)
+			}
+		}
+	}
+
+	return status
+}
+
+func (execBackend) LastCommit(root string, path string) (Commit, bool, error) {
+	out, err := gitCommand(root, "log", "-1", "--format=%H%x00%an%x00%aI", "--", filepath.Join(root, path)).Output()
+
+	if err != nil {
+		return Commit{}, false, fmt.Errorf("git log failed: %w", err)
+	}
+
+	fields := strings.Split(strings.TrimSpace(string(out)), "\x00")
+
+	if len(fields) != 3 {
+		return Commit{}, false, nil
+	}
+
+	when, err := time.Parse(time.RFC3339, fields[2])
+
+	if err != nil {
+		return Commit{}, false, fmt.Errorf("invalid commit date %s: %w", fields[2], err)
+	}
+
+	return Commit{Id: fields[0], Author: fields[1], When: when}, true, nil
+}
+
+func (execBackend) ReadBlob(root string, rev string, path string) ([]byte, error) {
+	out, err := gitCommand(root, "cat-file", "blob", rev+":"+filepath.ToSlash(path)).Output()
+
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %w", err)
+	}
+
+	return out, nil
+}
+
+// GetStatus returns the changed files of the repository at root, the workspace left out.
+func GetStatus(root string) (Status, error) {
+	status, err := currentBackend().Status(root)
+
+	if err != nil {
+		return Status{}, err
+	}
+
+	var outsideWorkspace func(path string) bool = func(path string) bool {
+		return !strings.Contains(path, ".features")
+	}
+
+	status.Modified = arrayFilter[string](status.Modified, outsideWorkspace)
+	status.Untracked = arrayFilter[string](status.Untracked, outsideWorkspace)
+	status.Deleted = arrayFilter[string](status.Deleted, outsideWorkspace)
+
+	return status, nil
+}
+
+// TableDateLayout is the short layout of the dates shown on tables, reports write dates
+// with time.RFC3339.
+const TableDateLayout = "01/02/06 15:04:05"
+
+// GetLastCommitInfo returns the author and the date of the last commit that changed
+// path. A file no commit changed has the author NOT FOUND and its modification time.
+func GetLastCommitInfo(repoRoot string, path string) (string, time.Time, error) {
+	commit, found, err := currentBackend().LastCommit(repoRoot, path)
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if found {
+		return commit.Author, commit.When, nil
+	}
+
+	fileInfo, err := os.Stat(filepath.Join(repoRoot, path))
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return "NOT FOUND", fileInfo.ModTime().Local(), nil
+}
+
+// ReadBlob returns the content of path, relative to root, on the commit rev, like git
+// show rev:path.
+func ReadBlob(root string, rev string, path string) ([]byte, error) {
+	return currentBackend().ReadBlob(root, rev, path)
+}
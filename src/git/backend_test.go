@@ -0,0 +1,230 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runGit(t *testing.T, root string, env []string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", root}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s failed: %v %s", strings.Join(args, " "), err, out)
+	}
+}
+
+// newHistory creates a repository with a few commits, a merge and a tag.
+func newHistory(t *testing.T) string {
+	root := t.TempDir()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	runGit(t, root, nil, "init", "-q", "-b", "main")
+	runGit(t, root, nil, "config", "user.name", "c")
+	runGit(t, root, nil, "config", "user.email", "c@b.c")
+
+	var commit int = 0
+
+	write := func(path string, content string) {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commitAll := func(author string, zone string) {
+		commit++
+		date := fmt.Sprintf("%d %s", 1700000000+commit*3600, zone)
+		env := []string{"GIT_AUTHOR_NAME=" + author, "GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}
+
+		runGit(t, root, env, "add", "-A")
+		runGit(t, root, env, "commit", "-q", "-m", fmt.Sprintf("commit %d", commit))
+	}
+
+	// A big file changed a little on each commit gives deltas once packed
+	var lines []string
+
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+
+	write("big.txt", strings.Join(lines, "\n"))
+	write("a.txt", "a")
+	commitAll("Ana, Souza", "+0200")
+
+	lines[10] = "changed"
+	write("big.txt", strings.Join(lines, "\n"))
+	write("src/b.txt", "b")
+	commitAll("Bruno", "-0330")
+
+	runGit(t, root, nil, "checkout", "-q", "-b", "side")
+	write("src/b.txt", "side")
+	write("c.txt", "c")
+	commitAll("Carla", "+0000")
+
+	runGit(t, root, nil, "checkout", "-q", "main")
+	lines[20] = "changed"
+	write("big.txt", strings.Join(lines, "\n"))
+	commitAll("Davi", "+0530")
+
+	commit++
+	date := fmt.Sprintf("%d +0000", 1700000000+commit*3600)
+	runGit(t, root, []string{"GIT_AUTHOR_NAME=Eva", "GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}, "merge", "-q", "--no-ff", "-m", "merge", "side")
+	runGit(t, root, nil, "tag", "-a", "-m", "v1", "v1")
+
+	write("a.txt", "a2")
+	commitAll("Fabio", "-0800")
+
+	return root
+}
+
+func compareBackends(t *testing.T, root string) {
+	t.Helper()
+
+	native := newNativeBackend(execBackend{})
+
+	for _, path := range []string{"a.txt", "big.txt", "src/b.txt", "c.txt", "src", "missing.txt"} {
+		expected, expectedFound, err := execBackend{}.LastCommit(root, path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commit, found, err := native.nativeLastCommit(root, path)
+
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		if found != expectedFound || commit.Id != expected.Id || commit.Author != expected.Author || !commit.When.Equal(expected.When) || commit.When.Format("-0700") != expected.When.Format("-0700") {
+			t.Errorf("%s: expected %v %v, got %v %v", path, expected, expectedFound, commit, found)
+		}
+	}
+
+	for _, read := range [][2]string{{"HEAD", "a.txt"}, {"v1", "big.txt"}, {"side", "src/b.txt"}, {"main", "src/b.txt"}} {
+		expected, err := execBackend{}.ReadBlob(root, read[0], read[1])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := native.nativeReadBlob(root, read[0], read[1])
+
+		if err != nil {
+			t.Fatalf("%s:%s: %v", read[0], read[1], err)
+		}
+
+		if !bytes.Equal(content, expected) {
+			t.Errorf("%s:%s: expected %q, got %q", read[0], read[1], expected, content)
+		}
+	}
+}
+
+func TestNativeBackend(t *testing.T) {
+	root := newHistory(t)
+
+	t.Run("loose", func(t *testing.T) {
+		compareBackends(t, root)
+	})
+
+	runGit(t, root, nil, "gc", "-q", "--aggressive")
+
+	t.Run("packed", func(t *testing.T) {
+		compareBackends(t, root)
+	})
+
+	expected, err := execBackend{}.Root(filepath.Join(root, "src"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err := newNativeBackend(execBackend{}).nativeRoot(filepath.Join(root, "src")); err != nil || found != expected {
+		t.Errorf("expected root %s, got %s %v", expected, found, err)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	status := parseStatus(" M a.txt\x00M  b.txt\x00 D c.txt\x00R  new.txt\x00old.txt\x00?? d.txt\x00")
+
+	expected := Status{
+		Modified:  []string{"a.txt", "b.txt", "c.txt", "new.txt"},
+		Untracked: []string{"d.txt"},
+		Deleted:   []string{"c.txt"},
+	}
+
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %v, got %v", expected, status)
+	}
+}
+
+func TestLastCommitInfoDate(t *testing.T) {
+	root := newHistory(t)
+
+	if err := os.WriteFile(filepath.Join(root, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 13th of a month can't be read as a month
+	modTime := time.Date(2024, time.March, 13, 10, 20, 30, 0, time.Local)
+
+	if err := os.Chtimes(filepath.Join(root, "new.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	author, date, err := GetLastCommitInfo(root, "new.txt")
+
+	if err != nil || author != "NOT FOUND" || date.Format(TableDateLayout) != "03/13/24 10:20:30" {
+		t.Errorf("expected the modification time of a file without commits, got %q %q %v", author, date, err)
+	}
+
+	author, date, err = GetLastCommitInfo(root, "a.txt")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last commit was made at 1700021600 -0800
+	if author != "Fabio" || date.Format(time.RFC3339) != "2023-11-14T20:13:20-08:00" || date.Format(TableDateLayout) != "11/14/23 20:13:20" {
+		t.Errorf("expected the last commit of a.txt, got %q %q", author, date)
+	}
+}
+
+func TestWorkingTreeStateUntrackedContent(t *testing.T) {
+	root := newHistory(t)
+
+	if err := os.WriteFile(filepath.Join(root, "new.txt"), []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := WorkingTreeState(root)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "new.txt"), []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := WorkingTreeState(root)
+
+	if err != nil || before == after {
+		t.Errorf("expected the state to change with the content of an untracked file, got %s %s %v", before, after, err)
+	}
+}
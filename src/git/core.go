@@ -2,22 +2,39 @@ package git
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-
-	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/logger"
+	"sync"
 )
 
-func runGitCommand(args ...string) ([]string, error) {
+var rootMutex sync.Mutex = sync.Mutex{}
+
+// roots are the repository roots found for each directory, a sync asks for the root of
+// every file it changes and the root is found once.
+var roots map[string]string = make(map[string]string)
+
+// gitPaths are the paths found by GitPath by repository and name, the index asks for
+// them on every load.
+var gitPaths map[string]string = make(map[string]string)
+
+// gitCommand runs git on the repository at root.
+func gitCommand(root string, args ...string) *exec.Cmd {
 	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+
+	return cmd
+}
+
+func runGitCommand(root string, args ...string) ([]string, error) {
+	cmd := gitCommand(root, args...)
 	out, err := cmd.Output()
 
 	if err != nil {
-		logger.Fatal[error](err)
+		return nil, fmt.Errorf("git %s failed: %w", strings.Join(args, " "), err)
 	}
 
 	if len(out) == 0 {
@@ -29,59 +46,91 @@ func runGitCommand(args ...string) ([]string, error) {
 	return lines, nil
 }
 
-func GetLastCommitInfo(path string) (string, string) {
-	repoRoot := GetRepositoryRoot()
-	commitInfo, err := runGitCommand("log", "-1", "--pretty=format:'%an,%ad'", "--date=format:'%x %X'", "--", filepath.Join(repoRoot, path))
-	
+// GetUserName returns the configured git user, or an empty string when it is not set.
+func GetUserName(root string) string {
+	out, err := gitCommand(root, "config", "user.name").Output()
+
 	if err != nil {
-		logger.Fatal[error](err)
+		return ""
 	}
 
-	author := "NOT FOUND"
-	date := "NOT FOUND"
+	return strings.TrimSpace(string(out))
+}
+
+// RepositoryRoot returns the root of the repository of the current directory.
+func RepositoryRoot() (string, error) {
+	dir, err := os.Getwd()
 
-	if len(commitInfo) > 0 {
-		commitInfo = strings.Split(commitInfo[0], ",")
-		
-		author = commitInfo[0][1:]
-		date = commitInfo[1][1:len(commitInfo[1]) - 2]
+	if err != nil {
+		return "", err
 	}
 
-	if date == "NOT FOUND" {
-		fileInfo, err := os.Stat(filepath.Join(repoRoot, path))
+	return FindRepositoryRoot(dir)
+}
+
+// FindRepositoryRoot returns the root of the repository that contains dir.
+func FindRepositoryRoot(dir string) (string, error) {
+	rootMutex.Lock()
+	root, cached := roots[dir]
+	rootMutex.Unlock()
 
-		if err != nil {
-			logger.Fatal[error](err)
-		}
+	if cached {
+		return root, nil
+	}
 
-		lastModified := fileInfo.ModTime()
+	root, err := currentBackend().Root(dir)
 
-		formattedTime := lastModified.Local().Format("02/01/06 15:04:05")
-		date = formattedTime
+	if err != nil {
+		return "", err
 	}
 
-	return author, date
+	rootMutex.Lock()
+	roots[dir] = root
+	rootMutex.Unlock()
+
+	return root, nil
 }
 
-func GetRepositoryRoot() (string) {
-	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
-	out, err := cmd.Output()
+// GitPath returns the path of name on the git folder of the repository at root, for the
+// files flag keeps for itself and never commits.
+func GitPath(root string, name string) (string, error) {
+	key := filepath.Join(root, name)
+
+	rootMutex.Lock()
+	path, cached := gitPaths[key]
+	rootMutex.Unlock()
+
+	if cached {
+		return path, nil
+	}
+
+	out, err := gitCommand(root, "rev-parse", "--git-path", name).Output()
 
 	if err != nil {
-		logger.Fatal[error](err)
+		return "", fmt.Errorf("git rev-parse --git-path failed: %w", err)
 	}
 
-	return strings.TrimSpace(string(out))
+	path = strings.TrimSpace(string(out))
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+
+	rootMutex.Lock()
+	gitPaths[key] = path
+	rootMutex.Unlock()
+
+	return path, nil
 }
 
-func CheckGitRepository() bool {
-	// Run the git command to check if the current directory is inside a git repository
-    cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
+func CheckGitRepository(root string) bool {
+	// Run the git command to check if root is inside a git repository
+    cmd := gitCommand(root, "rev-parse", "--is-inside-work-tree")
 
 	out, err := cmd.Output()
     
 	if err != nil {
-		logger.Fatal[error](err)
+		return false
     }
     
 	result := strings.TrimSpace(string(out))
@@ -103,75 +152,6 @@ func arrayFilter[T any](slice []T, predicate func(T) bool) []T {
     return result
 }
 
-func GetDeletedFiles() []string {
-	repoRoot := GetRepositoryRoot()
-
-	// git -C C:\Pessoal\switch ls-files --full-name --others --exclude-standard
-
-	// Get deleted files
-	deleted, err := runGitCommand("-C", repoRoot, "ls-files", "--deleted", "--full-name")
-
-	if err != nil {
-		logger.Fatal[error](err)
-	}
-	
-
-	return arrayFilter[string](deleted, func (path string) bool {
-		return !strings.Contains(path, ".features")
-	})
-}
-
-func GetModifedFiles() []string {	
-	// Get modified files
-	modified, err := runGitCommand("diff", "--name-only")
-
-	if err != nil {
-		logger.Fatal[error](err)
-	}
-
-	return arrayFilter[string](modified, func (path string) bool {
-		return !strings.Contains(path, ".features")
-	})
-}
-
-func GetUntrackedFiles() []string {
-	repoRoot := GetRepositoryRoot()
-
-	// Get untracked files
-	untracked, err := runGitCommand("-C", repoRoot, "ls-files", "--others", "--exclude-standard", "--full-name")
-	
-	if err != nil {
-		logger.Fatal[error](err)
-	}
-
-	return arrayFilter[string](untracked, func (path string) bool {
-		return !strings.Contains(path, ".features")
-	})
-}
-
-func isAlreadyCommitted(err error) bool {
-	return err != nil && bytes.Contains([]byte(err.Error()), []byte("nothing to commit"))
-}
-
-func isBranchExists(err error) bool {
-	return err != nil && bytes.Contains([]byte(err.Error()), []byte("already exists"))
-}
-
-func personalizeConflictMarkers(repoPath, versionALabel, versionBLabel string) bool {
-    tmpFile := "merge-tmp"
-
-	filePath := filepath.Join(repoPath, tmpFile)
-	
-	content := filesystem.FileRead(filePath)
-
-	customContent := strings.ReplaceAll(content, "<<<<<<< HEAD", fmt.Sprintf("<<<<<<< %s", versionALabel))
-	customContent = strings.ReplaceAll(customContent, ">>>>>>> version-b", fmt.Sprintf(">>>>>>> %s", versionBLabel))
-
-	filesystem.FileWriteContentToFile(filePath, customContent)
-
-	return strings.Contains(customContent, "<<<<<<< ")
-}
-
 func GitDiff(fileAPath string, fileBPath string) string {
 	cmd := exec.Command("git", "diff", "--no-index", "--minimal", "--patience", fileAPath, fileBPath)
 
@@ -193,103 +173,150 @@ func GitDiff(fileAPath string, fileBPath string) string {
 	return strings.Join(linesFiltered, "\n")
 }
 
-func GitMerge(basePath string, versionAPath string, versionBPath string, versionALabel string, versionBLabel string) bool {
-	// Define the repository path
-	repoRoot := GetRepositoryRoot()
-	repoPath := filepath.Join(repoRoot, ".features", "tmp-folder")
-
-	var err error
+// ListFiles returns the tracked and untracked files of the repository that are not
+// ignored, relative to its root and without the workspace.
+func ListFiles(root string) ([]string, error) {
+	out, err := gitCommand(root, "ls-files", "-z", "--cached", "--others", "--exclude-standard", "--full-name").Output()
 
-	if !filesystem.FileFolderExists(repoPath) {
-		filesystem.FileCreateFolder(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files failed: %w", err)
 	}
 
-	run := func(args ...string) error {
-		cmd := exec.Command("git", args...)
-		cmd.Dir = repoPath
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
+	var files []string = []string{}
+	var seen map[string]bool = make(map[string]bool)
 
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("git %s failed: %s", args, stderr.String())
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file == "" || seen[file] || file == ".features" || strings.HasPrefix(file, ".features/") {
+			continue
 		}
 
-		return nil
+		seen[file] = true
+		files = append(files, file)
 	}
 
-	err = run("init")
+	return files, nil
+}
 
-	if err != nil {
-		logger.Result[string]("something went wrong during the merge of files")
+// MergeFile merges the two versions of a file with their base without a repository and
+// returns the result. It reports if the result has conflicts.
+func MergeFile(basePath string, versionAPath string, versionBPath string, versionALabel string, versionBLabel string) (string, bool, error) {
+	cmd := exec.Command("git", "merge-file", "-p", "-L", versionALabel, "-L", "base", "-L", versionBLabel, versionAPath, basePath, versionBPath)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+
+	if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() > 0 && exitError.ExitCode() < 128 {
+		return string(out), true, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("git merge-file failed: %s", stderr.String())
 	}
 
-	tmpFile := "merge-tmp"
+	return string(out), false, nil
+}
 
-	filesystem.FileCopy(basePath, filepath.Join(repoPath, tmpFile))
+// HooksPath returns the folder of the git hooks of the repository, core.hooksPath included.
+func HooksPath(repoRoot string) (string, error) {
+	out, err := runGitCommand(repoRoot, "rev-parse", "--git-path", "hooks")
 
-	err = run("add", tmpFile)
+	if err != nil || len(out) == 0 {
+		return "", fmt.Errorf("couldn't find the hooks folder: %w", err)
+	}
 
-	if err != nil {
-		fmt.Println(err)
-		logger.Result[string]("something went wrong during the merge of files")
+	if filepath.IsAbs(out[0]) {
+		return out[0], nil
 	}
 
-	err = run("commit", "-m", "Base file", "--allow-empty")
+	return filepath.Join(repoRoot, out[0]), nil
+}
+
+// WorkingTreeState returns a checksum of the unstaged changes and of the untracked files
+// with their content, it changes when a file of the working tree is written.
+func WorkingTreeState(repoRoot string) (string, error) {
+	diff, err := gitCommand(repoRoot, "diff", "--no-ext-diff", "--binary").Output()
 
-	if err != nil && !isAlreadyCommitted(err) {
-		fmt.Println(err)
-		logger.Result[string]("something went wrong during the merge of files")
+	if err != nil {
+		return "", fmt.Errorf("git diff failed: %w", err)
 	}
 
-	err = run("checkout", "-b", "version-a")
+	untracked, err := gitCommand(repoRoot, "ls-files", "-z", "--others", "--exclude-standard", "--full-name").Output()
 
-	if err != nil && !isBranchExists(err) {
-		fmt.Println(err)
-		logger.Result[string]("something went wrong during the merge of files")
+	if err != nil {
+		return "", fmt.Errorf("git ls-files failed: %w", err)
 	}
 
-	filesystem.FileCopy(versionAPath, filepath.Join(repoPath, tmpFile))
+	hash := sha256.New()
+	hash.Write(diff)
 
-	err = run("commit", "-am", "Version A", "--allow-empty")
+	for _, path := range strings.Split(string(untracked), "\x00") {
+		if path == "" {
+			continue
+		}
 
-	if err != nil && !isAlreadyCommitted(err) {
-		fmt.Println(err)
-		logger.Result[string]("something went wrong during the merge of files")
-	}
+		content, err := untrackedContent(filepath.Join(repoRoot, filepath.FromSlash(path)))
 
-	err = run("checkout", "-b", "version-b", "master")
+		if err != nil {
+			return "", err
+		}
 
-	if err != nil && !isBranchExists(err) {
-		fmt.Println(err)
-		logger.Result[string]("something went wrong during the merge of files")
+		fmt.Fprintf(hash, "\x00%s\x00%x", path, sha256.Sum256(content))
 	}
 
-	filesystem.FileCopy(versionBPath, filepath.Join(repoPath, tmpFile))
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
 
-	err = run("commit", "-am", "Version B", "--allow-empty")
+// untrackedContent returns the content of an untracked file, the target of a symbolic
+// link, or nothing when the file was removed since it was listed.
+func untrackedContent(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
 
-	if err != nil && !isAlreadyCommitted(err) {
-		fmt.Println(err)
-		logger.Result[string]("something went wrong during the merge of files")
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	err = run("checkout", "master")
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(path)
+
+		return []byte(link), err
+	} else if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	return os.ReadFile(path)
+}
+
+// GetUnstagedFiles returns the files under path, relative to the repository root, with
+// changes that are not staged, untracked files included.
+func GetUnstagedFiles(root string, path string) ([]string, error) {
+	out, err := gitCommand(root, "status", "--porcelain", "-z", "--untracked-files=all", "--", path).Output()
 
 	if err != nil {
-		fmt.Println(err)
-		logger.Result[string]("something went wrong during the merge of files")
+		return nil, fmt.Errorf("git status failed: %w", err)
 	}
 
-	run("merge", "--no-commit", "version-a")
-	run("merge", "--no-commit", "version-b")
+	var unstaged []string = []string{}
 
-	hasConflicts := personalizeConflictMarkers(repoPath, versionALabel, versionBLabel)
+	entries := strings.Split(string(out), "\x00")
 
-	mergedFilePath := filepath.Join(repoPath, tmpFile)
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
 
-	filesystem.FileCopy(mergedFilePath, filepath.Join(repoRoot, ".features", "merge-tmp"))
+		if len(entry) < 4 {
+			continue
+		}
 
-	filesystem.FileDeleteFolder(repoPath)
+		if entry[1] != ' ' {
+			unstaged = append(unstaged, entry[3:])
+		}
 
-	return hasConflicts
-}
\ No newline at end of file
+		// Renames and copies are followed by the original path
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++
+		}
+	}
+
+	return unstaged, nil
+}
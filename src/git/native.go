@@ -0,0 +1,558 @@
+package git
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// errUnsupported is returned by the native backend for repositories it can not read,
+// the exec backend answers them.
+var errUnsupported = errors.New("unsupported by the native git backend")
+
+// nativeRepository is a repository opened by the native backend, its objects and refs
+// are read with go-git.
+type nativeRepository struct {
+	repository *gogit.Repository
+	// shallow holds the commits of a shallow clone whose parents were not fetched.
+	shallow map[plumbing.Hash]bool
+}
+
+// nativeBackend reads repositories in process, the status of the working tree and every
+// repository it can not read are left to fallback.
+type nativeBackend struct {
+	fallback     Backend
+	mutex        sync.Mutex
+	repositories map[string]*nativeRepository
+}
+
+func newNativeBackend(fallback Backend) *nativeBackend {
+	return &nativeBackend{fallback: fallback, repositories: make(map[string]*nativeRepository)}
+}
+
+// gitEnvironmentSet reports if the environment changes how git finds the repository,
+// like it does while a hook runs.
+func gitEnvironmentSet() bool {
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE", "GIT_COMMON_DIR", "GIT_OBJECT_DIRECTORY", "GIT_ALTERNATE_OBJECT_DIRECTORIES", "GIT_CEILING_DIRECTORIES"} {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findGitDir returns the git folder of the working tree at root, .git may be a file
+// that points to it like on linked worktrees and submodules.
+func findGitDir(root string) (string, bool) {
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+
+	if err != nil {
+		return "", false
+	}
+
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(dotGit, "HEAD")); err != nil {
+			return "", false
+		}
+
+		return dotGit, true
+	}
+
+	content, err := os.ReadFile(dotGit)
+
+	if err != nil {
+		return "", false
+	}
+
+	gitDir, found := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir:")
+
+	if !found {
+		return "", false
+	}
+
+	gitDir = strings.TrimSpace(gitDir)
+
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(root, gitDir)
+	}
+
+	return gitDir, true
+}
+
+func (b *nativeBackend) nativeRoot(dir string) (string, error) {
+	if gitEnvironmentSet() {
+		return "", errUnsupported
+	}
+
+	if dir == "" {
+		wd, err := os.Getwd()
+
+		if err != nil {
+			return "", err
+		}
+
+		dir = wd
+	}
+
+	// git answers with the physical path of the root
+	dir, err := filepath.EvalSymlinks(dir)
+
+	if err != nil {
+		return "", err
+	}
+
+	dir, err = filepath.Abs(dir)
+
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		// git refuses to find a working tree from inside a git folder
+		if filepath.Base(dir) == ".git" {
+			return "", errUnsupported
+		}
+
+		if _, found := findGitDir(dir); found {
+			return dir, nil
+		}
+
+		parent := filepath.Dir(dir)
+
+		if parent == dir {
+			return "", errUnsupported
+		}
+
+		dir = parent
+	}
+}
+
+func (b *nativeBackend) Root(dir string) (string, error) {
+	root, err := b.nativeRoot(dir)
+
+	if err != nil {
+		return b.fallback.Root(dir)
+	}
+
+	return root, nil
+}
+
+// Status is left to the git binary, a status needs the index, the ignore rules, the
+// filters and the line endings of the repository like git applies them, which go-git
+// does not, and sync runs it once per command.
+func (b *nativeBackend) Status(root string) (Status, error) {
+	return b.fallback.Status(root)
+}
+
+func (b *nativeBackend) LastCommit(root string, path string) (Commit, bool, error) {
+	commit, found, err := b.nativeLastCommit(root, path)
+
+	if err != nil {
+		b.forget(root)
+
+		return b.fallback.LastCommit(root, path)
+	}
+
+	return commit, found, nil
+}
+
+func (b *nativeBackend) ReadBlob(root string, rev string, path string) ([]byte, error) {
+	content, err := b.nativeReadBlob(root, rev, path)
+
+	if err != nil {
+		b.forget(root)
+
+		return b.fallback.ReadBlob(root, rev, path)
+	}
+
+	return content, nil
+}
+
+// forget drops the opened repository of root, it is read again on the next call. A
+// repository changes under a long running process, git gc replaces its packs.
+func (b *nativeBackend) forget(root string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.repositories, root)
+}
+
+// open returns the repository of the working tree at root, it is opened once.
+func (b *nativeBackend) open(root string) (*nativeRepository, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if repository, exists := b.repositories[root]; exists {
+		return repository, nil
+	}
+
+	if gitEnvironmentSet() {
+		return nil, errUnsupported
+	}
+
+	gitDir, found := findGitDir(root)
+
+	if !found {
+		return nil, errUnsupported
+	}
+
+	commonDir := gitDir
+
+	if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(common))
+
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	config, err := os.ReadFile(filepath.Join(commonDir, "config"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Other object formats, reftables and partial clones are left to git
+	lowerConfig := strings.ToLower(string(config))
+
+	for _, unsupported := range []string{"objectformat", "refstorage", "partialclone"} {
+		if strings.Contains(lowerConfig, unsupported) {
+			return nil, errUnsupported
+		}
+	}
+
+	// Replace refs and grafts change the history that git log shows
+	for _, path := range []string{filepath.Join("refs", "replace"), filepath.Join("info", "grafts")} {
+		if _, err := os.Stat(filepath.Join(commonDir, path)); err == nil {
+			return nil, errUnsupported
+		}
+	}
+
+	if strings.Contains(readPackedRefs(commonDir), " refs/replace/") {
+		return nil, errUnsupported
+	}
+
+	opened, err := gogit.PlainOpenWithOptions(root, &gogit.PlainOpenOptions{EnableDotGitCommonDir: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var repository *nativeRepository = &nativeRepository{repository: opened, shallow: make(map[plumbing.Hash]bool)}
+
+	shallow, err := opened.Storer.Shallow()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range shallow {
+		repository.shallow[id] = true
+	}
+
+	b.repositories[root] = repository
+
+	return repository, nil
+}
+
+func readPackedRefs(commonDir string) string {
+	content, err := os.ReadFile(filepath.Join(commonDir, "packed-refs"))
+
+	if err != nil {
+		return ""
+	}
+
+	return string(content)
+}
+
+func isObjectId(value string) bool {
+	if len(value) != 40 {
+		return false
+	}
+
+	_, err := hex.DecodeString(value)
+
+	return err == nil
+}
+
+// resolveRevision returns the commit of rev. Only HEAD, refs, branches, tags and full
+// object ids are read, other revisions are left to git.
+func (r *nativeRepository) resolveRevision(rev string) (plumbing.Hash, error) {
+	if isObjectId(rev) {
+		commit, err := r.repository.CommitObject(plumbing.NewHash(rev))
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return commit.Hash, nil
+	}
+
+	if rev == "" || strings.ContainsAny(rev, "~^:@{}") {
+		return plumbing.ZeroHash, errUnsupported
+	}
+
+	// Annotated tags are peeled to their commit
+	id, err := r.repository.ResolveRevision(plumbing.Revision(rev))
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return *id, nil
+}
+
+// nativeCommit is a commit with the parents the history follows.
+type nativeCommit struct {
+	id        plumbing.Hash
+	tree      *object.Tree
+	parents   []plumbing.Hash
+	author    string
+	when      time.Time
+	committed int64
+}
+
+func (r *nativeRepository) readCommit(id plumbing.Hash) (nativeCommit, error) {
+	commit, err := r.repository.CommitObject(id)
+
+	if err != nil {
+		return nativeCommit{}, err
+	}
+
+	tree, err := commit.Tree()
+
+	if err != nil {
+		return nativeCommit{}, err
+	}
+
+	var parents []plumbing.Hash = commit.ParentHashes
+
+	if r.shallow[id] {
+		parents = nil
+	}
+
+	return nativeCommit{
+		id:        id,
+		tree:      tree,
+		parents:   parents,
+		author:    commit.Author.Name,
+		when:      commit.Author.When,
+		committed: commit.Committer.When.Unix(),
+	}, nil
+}
+
+// treeEntry returns the entry of path on the tree, nil when it is not there.
+func treeEntry(tree *object.Tree, path string) (*object.TreeEntry, error) {
+	entry, err := tree.FindEntry(path)
+
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// sameEntry reports if a path is the same on two trees, missing from both included.
+func sameEntry(a *object.TreeEntry, b *object.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Hash == b.Hash
+}
+
+// commitQueue orders commits by commit date like git log, ties keep the order in which
+// they were queued.
+type commitQueue []queuedCommit
+
+type queuedCommit struct {
+	commit nativeCommit
+	order  int
+}
+
+func (q commitQueue) Len() int { return len(q) }
+
+func (q commitQueue) Less(i, j int) bool {
+	if q[i].commit.committed != q[j].commit.committed {
+		return q[i].commit.committed > q[j].commit.committed
+	}
+
+	return q[i].order < q[j].order
+}
+
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x any) { *q = append(*q, x.(queuedCommit)) }
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+
+	return last
+}
+
+// nativeLastCommit walks the history of HEAD like git log -1 -- path. A merge with a
+// parent that has the same path is skipped and only that parent is followed, go-git's
+// own log walks every parent and answers with another commit than git on merges.
+func (b *nativeBackend) nativeLastCommit(root string, path string) (Commit, bool, error) {
+	repository, err := b.open(root)
+
+	if err != nil {
+		return Commit{}, false, err
+	}
+
+	head, err := repository.repository.Reference(plumbing.HEAD, true)
+
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return Commit{}, false, nil
+	} else if err != nil {
+		return Commit{}, false, err
+	}
+
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	if path == "." || strings.HasPrefix(path, "../") || filepath.IsAbs(path) {
+		return Commit{}, false, errUnsupported
+	}
+
+	var queue commitQueue = commitQueue{}
+	var seen map[plumbing.Hash]bool = map[plumbing.Hash]bool{}
+	var order int = 0
+
+	push := func(id plumbing.Hash) error {
+		if seen[id] {
+			return nil
+		}
+
+		seen[id] = true
+
+		commit, err := repository.readCommit(id)
+
+		if err != nil {
+			return err
+		}
+
+		heap.Push(&queue, queuedCommit{commit: commit, order: order})
+		order++
+
+		return nil
+	}
+
+	if err := push(head.Hash()); err != nil {
+		return Commit{}, false, err
+	}
+
+	for queue.Len() > 0 {
+		commit := heap.Pop(&queue).(queuedCommit).commit
+
+		entry, err := treeEntry(commit.tree, path)
+
+		if err != nil {
+			return Commit{}, false, err
+		}
+
+		var changed bool = true
+		var follow []plumbing.Hash = commit.parents
+
+		for _, parentId := range commit.parents {
+			parent, err := repository.readCommit(parentId)
+
+			if err != nil {
+				return Commit{}, false, err
+			}
+
+			parentEntry, err := treeEntry(parent.tree, path)
+
+			if err != nil {
+				return Commit{}, false, err
+			}
+
+			if sameEntry(parentEntry, entry) {
+				changed = false
+				follow = []plumbing.Hash{parentId}
+
+				break
+			}
+		}
+
+		// A root commit changed the paths it has
+		if len(commit.parents) == 0 {
+			changed = entry != nil
+		}
+
+		if changed {
+			return Commit{Id: commit.id.String(), Author: commit.author, When: commit.when}, true, nil
+		}
+
+		for _, parentId := range follow {
+			if err := push(parentId); err != nil {
+				return Commit{}, false, err
+			}
+		}
+	}
+
+	return Commit{}, false, nil
+}
+
+func (b *nativeBackend) nativeReadBlob(root string, rev string, path string) ([]byte, error) {
+	repository, err := b.open(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := repository.resolveRevision(rev)
+
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repository.readCommit(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := treeEntry(commit.tree, filepath.ToSlash(filepath.Clean(path)))
+
+	if err != nil {
+		return nil, err
+	} else if entry == nil {
+		return nil, fmt.Errorf("%s does not exist on %s", path, rev)
+	} else if entry.Mode == filemode.Dir || entry.Mode == filemode.Submodule {
+		return nil, fmt.Errorf("%s is not a file on %s", path, rev)
+	}
+
+	blob, err := repository.repository.BlobObject(entry.Hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := blob.Reader()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,83 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	filesystem "github.com/costaluu/flag/fs"
+)
+
+// TempFolderPrefix starts the name of the temporary folders on .features, the pid of
+// the process that owns the folder follows it.
+const TempFolderPrefix = "tmp-"
+
+var tempMutex sync.Mutex = sync.Mutex{}
+
+// tempFolders are the temporary folders created by this process.
+var tempFolders map[string]bool = make(map[string]bool)
+
+// TempFolder returns the temporary folder of this process on the workspace of the
+// repository at root, merges keep their files there so flag runs at the same time never
+// share them.
+func TempFolder(root string) string {
+	return filepath.Join(root, ".features", fmt.Sprintf("%s%d", TempFolderPrefix, os.Getpid()))
+}
+
+// TempPath returns the path of name on TempFolder. The folder is created on first use,
+// when that fails the error comes from the first write on it.
+func TempPath(root string, name string) string {
+	tempMutex.Lock()
+	defer tempMutex.Unlock()
+
+	folder := TempFolder(root)
+
+	if !tempFolders[folder] {
+		// A folder with this pid was left by a process that died
+		if filesystem.FileDeleteFolder(folder) == nil && filesystem.FileCreateFolder(folder) == nil {
+			tempFolders[folder] = true
+		}
+	}
+
+	return filepath.Join(folder, name)
+}
+
+// TempFolderPid returns the pid of the process that owns the temporary folder name.
+func TempFolderPid(name string) (int, bool) {
+	if !strings.HasPrefix(name, TempFolderPrefix) {
+		return 0, false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimPrefix(name, TempFolderPrefix))
+
+	return pid, err == nil && pid > 0
+}
+
+// RemoveTempFolders removes the temporary folders created by this process.
+func RemoveTempFolders() {
+	tempMutex.Lock()
+	defer tempMutex.Unlock()
+
+	for folder := range tempFolders {
+		filesystem.FileDeleteFolder(folder)
+	}
+
+	tempFolders = make(map[string]bool)
+}
+
+// RemoveTempFolder removes the temporary folder of this process on the workspace of the
+// repository at root.
+func RemoveTempFolder(root string) {
+	tempMutex.Lock()
+	defer tempMutex.Unlock()
+
+	folder := TempFolder(root)
+
+	if tempFolders[folder] {
+		filesystem.FileDeleteFolder(folder)
+		delete(tempFolders, folder)
+	}
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"runtime/debug"
 
@@ -43,31 +44,37 @@ var sucessStyle =
 	
 var chevronRight = styles.SecondaryTextStyle[string]("›")
 
-func Info[T any](msg T) {
-	fmt.Printf("%s  🔎  %s  %v\n", chevronRight, styles.InfoTextStyle("info"), styles.SecondaryTextStyle(msg))
+// output receives every message, embedders can silence it with SetOutput(io.Discard).
+var output io.Writer = os.Stdout
+
+func SetOutput(w io.Writer) {
+	output = w
 }
 
-func Result[T any](msg T) {
-	fmt.Printf("%s  🔎  %s  %v\n", chevronRight, styles.InfoTextStyle("info"), styles.SecondaryTextStyle(msg))
-	os.Exit(0)
+func Output() io.Writer {
+	return output
+}
+
+func Info[T any](msg T) {
+	fmt.Fprintf(output, "%s  🔎  %s  %v\n", chevronRight, styles.InfoTextStyle("info"), styles.SecondaryTextStyle(msg))
 }
 
 func Error[T any](msg T) {
-	fmt.Printf("%s  ❌  %s  %v\n", chevronRight, styles.RedTextStyle("error"), styles.SecondaryTextStyle(msg))
+	fmt.Fprintf(output, "%s  ❌  %s  %v\n", chevronRight, styles.RedTextStyle("error"), styles.SecondaryTextStyle(msg))
 }
 
 func Fatal[T any](msg T) {
 	fmt.Printf("%s  ❌  %s  %v\n", chevronRight, styles.RedTextStyle("fatal"), styles.SecondaryTextStyle(msg))
 	debug.PrintStack()
-	os.Exit(0)
+	os.Exit(1)
 }
 
 func Warning[T any](msg T) {
-	fmt.Printf("%s  🚧  %s  %v\n", chevronRight, styles.WarningTextStyle("warning"), styles.SecondaryTextStyle(msg))
+	fmt.Fprintf(output, "%s  🚧  %s  %v\n", chevronRight, styles.WarningTextStyle("warning"), styles.SecondaryTextStyle(msg))
 }
 
 func Success[T any](msg T) {
-	fmt.Printf("%s  ✅  %s  %v\n", chevronRight, styles.SuccessTextStyle("success"), styles.SecondaryTextStyle(msg))
+	fmt.Fprintf(output, "%s  ✅  %s  %v\n", chevronRight, styles.SuccessTextStyle("success"), styles.SecondaryTextStyle(msg))
 }
 
 func Debug() {
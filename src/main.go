@@ -1,17 +1,26 @@
 package main
 
 import (
-	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/costaluu/flag/commands"
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/merge"
 	"github.com/urfave/cli/v2"
 )
 
 var VERSION = "dev"
 
 func main() {
+	// A closed stdout, like flag toggle | head -1, must not kill a command before its
+	// journal is committed, the writes fail instead
+	signal.Ignore(syscall.SIGPIPE)
+
 	app := &cli.App{
 		Name:    constants.APP_NAME,
 		Version: VERSION,
@@ -21,20 +30,67 @@ func main() {
 			},
 		},
 		Usage: "flag is a configuration-based feature flag manager",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name: "non-interactive",
+				Aliases: []string{"yes"},
+				EnvVars: []string{"FLAG_NON_INTERACTIVE"},
+				Usage: "never prompt, confirmations are accepted and missing decisions fail",
+			},
+			&cli.DurationFlag{
+				Name: "lock-timeout",
+				EnvVars: []string{"FLAG_LOCK_TIMEOUT"},
+				Value: core.DefaultLockTimeout,
+				Usage: "how long to wait for another flag command that is changing the workspace",
+			},
+			&cli.StringFlag{
+				Name: "git-backend",
+				EnvVars: []string{"FLAG_GIT_BACKEND"},
+				Value: git.BackendNative,
+				Usage: "how flag reads the repository: native reads it in process and runs git only for what it can not read, exec always runs git",
+			},
+			&cli.StringFlag{
+				Name: "merge-strategy",
+				EnvVars: []string{"FLAG_MERGE_STRATEGY"},
+				Value: merge.StrategyNative,
+				Usage: "how versions are merged: native runs a diff3 merge in memory, git runs git merge-file",
+			},
+		},
+		Before: func(ctx *cli.Context) error {
+			core.SetInteractive(!ctx.Bool("non-interactive"))
+			core.SetLockTimeout(ctx.Duration("lock-timeout"))
+
+			if err := git.SelectBackend(ctx.String("git-backend")); err != nil {
+				return errs.New(errs.InvalidArgument, "%v", err)
+			}
+
+			if err := merge.SelectStrategy(ctx.String("merge-strategy")); err != nil {
+				return errs.New(errs.InvalidArgument, "%v", err)
+			}
+
+			return nil
+		},
 		Commands: []*cli.Command{
 			commands.InitCommand,
 			commands.SyncCommand,
 			commands.ReportCommand,
 			commands.DelimeterCommand,
 			commands.PresetCommand,
+			commands.FeaturesCommand,
+			commands.VariantsCommand,
 			commands.BlocksFeaturesCommand,
 			commands.VersionsFeaturesCommand,
 			commands.ToggleCommand,
+			commands.RenderCommand,
+			commands.HooksCommand,
+			commands.CheckCommand,
+			commands.DoctorCommand,
 			commands.UpdateCommand,
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
-	}
+	err := app.Run(os.Args)
+
+	git.RemoveTempFolders()
+	commands.Exit(err)
 }
\ No newline at end of file
@@ -0,0 +1,554 @@
+package merge
+
+import "unicode"
+
+// Diff3 merges in memory. Each side is compared with the base by a Myers diff, the
+// changes of both sides that overlap or touch become a conflict unless they are equal.
+// Like git merge-file, the sides of a conflict are compared to leave out the lines they
+// share, and conflicts apart by a few lines, or by lines without letters and digits,
+// are joined.
+type Diff3 struct{}
+
+// change is a range of the base replaced by a range of a side, the ranges are half
+// open.
+type change struct {
+	baseLo, baseHi int
+	lo, hi         int
+}
+
+const (
+	segmentMerged = iota
+	// segmentChanged is a change of one side, or the same change of both.
+	segmentChanged
+	segmentConflict
+)
+
+// segment is a part of the merge before it becomes hunks.
+type segment struct {
+	kind              int
+	lines             []string
+	current, incoming []string
+	// baseLo and baseHi are the range of the base changed by both sides of a conflict.
+	baseLo, baseHi int
+}
+
+// maxJoinedLines is the most lines between two conflicts that are joined.
+const maxJoinedLines = 3
+
+func (Diff3) Merge(base []byte, current []byte, incoming []byte, currentLabel string, incomingLabel string) (Result, error) {
+	baseLines, currentLines, incomingLines := splitLines(base), splitLines(current), splitLines(incoming)
+
+	// Lines are compared by id, equal lines of the three files share one
+	var ids map[string]int = make(map[string]int)
+
+	toIds := func(lines []string) []int {
+		var result []int = make([]int, len(lines))
+
+		for i, line := range lines {
+			id, exists := ids[line]
+
+			if !exists {
+				id = len(ids)
+				ids[line] = id
+			}
+
+			result[i] = id
+		}
+
+		return result
+	}
+
+	baseIds := toIds(baseLines)
+	currentChanges := diffChanges(baseIds, toIds(currentLines))
+	incomingChanges := diffChanges(baseIds, toIds(incomingLines))
+
+	var segments []segment = []segment{}
+	var baseIndex, currentDelta, incomingDelta int = 0, 0, 0
+	var i, j int = 0, 0
+
+	for i < len(currentChanges) || j < len(incomingChanges) {
+		// The region starts at the first change left and grows while the next change
+		// overlaps or touches it
+		var regionLo, regionHi int
+
+		if j >= len(incomingChanges) || (i < len(currentChanges) && currentChanges[i].baseLo <= incomingChanges[j].baseLo) {
+			regionLo, regionHi = currentChanges[i].baseLo, currentChanges[i].baseHi
+		} else {
+			regionLo, regionHi = incomingChanges[j].baseLo, incomingChanges[j].baseHi
+		}
+
+		currentLo, incomingLo := regionLo+currentDelta, regionLo+incomingDelta
+		var currentChanged, incomingChanged bool = false, false
+
+		for {
+			if i < len(currentChanges) && currentChanges[i].baseLo <= regionHi {
+				regionHi = max(regionHi, currentChanges[i].baseHi)
+				currentDelta = currentChanges[i].hi - currentChanges[i].baseHi
+				currentChanged = true
+				i++
+			} else if j < len(incomingChanges) && incomingChanges[j].baseLo <= regionHi {
+				regionHi = max(regionHi, incomingChanges[j].baseHi)
+				incomingDelta = incomingChanges[j].hi - incomingChanges[j].baseHi
+				incomingChanged = true
+				j++
+			} else {
+				break
+			}
+		}
+
+		segments = append(segments, segment{kind: segmentMerged, lines: baseLines[baseIndex:regionLo]})
+		baseIndex = regionHi
+
+		currentSide := currentLines[currentLo : regionHi+currentDelta]
+		incomingSide := incomingLines[incomingLo : regionHi+incomingDelta]
+
+		if !incomingChanged || (currentChanged && equalLines(currentSide, incomingSide)) {
+			segments = append(segments, segment{kind: segmentChanged, lines: currentSide})
+		} else if !currentChanged {
+			segments = append(segments, segment{kind: segmentChanged, lines: incomingSide})
+		} else {
+			segments = append(segments, refineConflict(currentSide, incomingSide, regionLo, regionHi, toIds)...)
+		}
+	}
+
+	segments = append(segments, segment{kind: segmentMerged, lines: baseLines[baseIndex:]})
+
+	var result Result = Result{Hunks: []Hunk{}, CurrentLabel: currentLabel, IncomingLabel: incomingLabel}
+
+	for _, s := range joinConflicts(segments) {
+		if s.kind == segmentConflict {
+			result.Hunks = append(result.Hunks, Hunk{
+				Conflict: true,
+				Base:     append([]string{}, baseLines[s.baseLo:s.baseHi]...),
+				Current:  append([]string{}, s.current...),
+				Incoming: append([]string{}, s.incoming...),
+			})
+		} else if len(s.lines) == 0 {
+			continue
+		} else if last := len(result.Hunks) - 1; last >= 0 && !result.Hunks[last].Conflict {
+			// Merged lines that follow each other are kept on one hunk
+			result.Hunks[last].Lines = append(result.Hunks[last].Lines, s.lines...)
+		} else {
+			result.Hunks = append(result.Hunks, Hunk{Lines: append([]string{}, s.lines...)})
+		}
+	}
+
+	return result, nil
+}
+
+// refineConflict compares both sides of a conflict, the lines they share are left out
+// of it and split it in smaller conflicts.
+func refineConflict(currentSide []string, incomingSide []string, baseLo int, baseHi int, toIds func(lines []string) []int) []segment {
+	var segments []segment = []segment{}
+
+	if len(currentSide) == 0 || len(incomingSide) == 0 {
+		return append(segments, segment{kind: segmentConflict, current: currentSide, incoming: incomingSide, baseLo: baseLo, baseHi: baseHi})
+	}
+
+	var index int = 0
+
+	for _, c := range diffChanges(toIds(currentSide), toIds(incomingSide)) {
+		segments = append(segments,
+			segment{kind: segmentMerged, lines: currentSide[index:c.baseLo]},
+			segment{kind: segmentConflict, current: currentSide[c.baseLo:c.baseHi], incoming: incomingSide[c.lo:c.hi], baseLo: baseLo, baseHi: baseHi},
+		)
+
+		index = c.baseHi
+	}
+
+	return append(segments, segment{kind: segmentMerged, lines: currentSide[index:]})
+}
+
+func containsAlphanumeric(lines []string) bool {
+	for _, line := range lines {
+		for _, r := range line {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// joinConflicts joins two conflicts when only a few merged lines, or lines without
+// letters and digits, are between them.
+func joinConflicts(segments []segment) []segment {
+	var joined []segment = []segment{}
+
+	for i := 0; i < len(segments); i++ {
+		s := segments[i]
+
+		if s.kind != segmentConflict {
+			joined = append(joined, s)
+
+			continue
+		}
+
+		for {
+			var gap []string = []string{}
+			next := i + 1
+
+			for next < len(segments) && segments[next].kind == segmentMerged {
+				gap = append(gap, segments[next].lines...)
+				next++
+			}
+
+			if next >= len(segments) || segments[next].kind != segmentConflict || (len(gap) > maxJoinedLines && containsAlphanumeric(gap)) {
+				break
+			}
+
+			following := segments[next]
+
+			s = segment{
+				kind:     segmentConflict,
+				current:  append(append(append([]string{}, s.current...), gap...), following.current...),
+				incoming: append(append(append([]string{}, s.incoming...), gap...), following.incoming...),
+				baseLo:   min(s.baseLo, following.baseLo),
+				baseHi:   max(s.baseHi, following.baseHi),
+			}
+
+			i = next
+		}
+
+		joined = append(joined, s)
+	}
+
+	return joined
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// diffChanges returns the changes that turn base into side.
+func diffChanges(base []int, side []int) []change {
+	var d differ = differ{a: base, b: side, matches: make([]int, len(base))}
+
+	for i := range d.matches {
+		d.matches[i] = -1
+	}
+
+	d.compare(0, len(base), 0, len(side))
+
+	var baseChanged, sideChanged []bool = make([]bool, len(base)), make([]bool, len(side))
+	var matched []bool = make([]bool, len(side))
+
+	for i, j := range d.matches {
+		if j < 0 {
+			baseChanged[i] = true
+		} else {
+			matched[j] = true
+		}
+	}
+
+	for j := range side {
+		sideChanged[j] = !matched[j]
+	}
+
+	compactChanges(base, baseChanged, sideChanged)
+	compactChanges(side, sideChanged, baseChanged)
+
+	var changes []change = []change{}
+	var i, j int = 0, 0
+
+	for i < len(base) || j < len(side) {
+		if i < len(base) && j < len(side) && !baseChanged[i] && !sideChanged[j] {
+			i++
+			j++
+
+			continue
+		}
+
+		var c change = change{baseLo: i, lo: j}
+
+		for i < len(base) && baseChanged[i] {
+			i++
+		}
+
+		for j < len(side) && sideChanged[j] {
+			j++
+		}
+
+		c.baseHi, c.hi = i, j
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+// changeGroup is a run of changed lines of a file, empty between two unchanged lines.
+type changeGroup struct {
+	start, end int
+}
+
+func firstGroup(changed []bool) changeGroup {
+	var g changeGroup
+
+	for g.end < len(changed) && changed[g.end] {
+		g.end++
+	}
+
+	return g
+}
+
+func (g *changeGroup) next(changed []bool) bool {
+	if g.end == len(changed) {
+		return false
+	}
+
+	g.start = g.end + 1
+	g.end = g.start
+
+	for g.end < len(changed) && changed[g.end] {
+		g.end++
+	}
+
+	return true
+}
+
+func (g *changeGroup) previous(changed []bool) bool {
+	if g.start == 0 {
+		return false
+	}
+
+	g.end = g.start - 1
+	g.start = g.end
+
+	for g.start > 0 && changed[g.start-1] {
+		g.start--
+	}
+
+	return true
+}
+
+func (g *changeGroup) slideDown(lines []int, changed []bool) bool {
+	if g.end >= len(changed) || lines[g.start] != lines[g.end] {
+		return false
+	}
+
+	changed[g.start] = false
+	changed[g.end] = true
+	g.start++
+	g.end++
+
+	for g.end < len(changed) && changed[g.end] {
+		g.end++
+	}
+
+	return true
+}
+
+func (g *changeGroup) slideUp(lines []int, changed []bool) bool {
+	if g.start == 0 || lines[g.start-1] != lines[g.end-1] {
+		return false
+	}
+
+	g.start--
+	g.end--
+	changed[g.start] = true
+	changed[g.end] = false
+
+	for g.start > 0 && changed[g.start-1] {
+		g.start--
+	}
+
+	return true
+}
+
+// compactChanges moves each group of changed lines of a file as far down as it goes,
+// or next to a group of the other file when it can reach one, like git does before it
+// merges. A diff has many equal answers, this follows the heuristic of git but not its
+// diff, so a conflict can hold other lines than the one of git merge-file.
+func compactChanges(lines []int, changed []bool, otherChanged []bool) {
+	g, other := firstGroup(changed), firstGroup(otherChanged)
+
+	for {
+		if g.end != g.start {
+			var size, earliestEnd, endMatchingOther int
+
+			for {
+				size = g.end - g.start
+				endMatchingOther = -1
+
+				for g.slideUp(lines, changed) {
+					other.previous(otherChanged)
+				}
+
+				earliestEnd = g.end
+
+				if other.end > other.start {
+					endMatchingOther = g.end
+				}
+
+				for g.slideDown(lines, changed) {
+					other.next(otherChanged)
+
+					if other.end > other.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if size == g.end-g.start {
+					break
+				}
+			}
+
+			if g.end != earliestEnd && endMatchingOther != -1 {
+				for other.end == other.start {
+					g.slideUp(lines, changed)
+					other.previous(otherChanged)
+				}
+			}
+		}
+
+		if !g.next(changed) {
+			break
+		}
+
+		other.next(otherChanged)
+	}
+}
+
+// differ finds the longest common subsequence of a and b with the linear space Myers
+// algorithm, matches[i] is the line of b that matches the line i of a or -1.
+type differ struct {
+	a, b    []int
+	matches []int
+}
+
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.matches[aLo] = bLo
+		aLo++
+		bLo++
+	}
+
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		d.matches[aHi-1] = bHi - 1
+		aHi--
+		bHi--
+	}
+
+	if aLo == aHi || bLo == bHi {
+		return
+	}
+
+	x, y, found := d.bisect(aLo, aHi, bLo, bHi)
+
+	// Without a split that makes the problem smaller the lines are left unmatched
+	if !found || (x == aLo && y == bLo) || (x == aHi && y == bHi) {
+		return
+	}
+
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+// bisect finds the middle snake of a[aLo:aHi] and b[bLo:bHi] by walking the edit graph
+// from both ends, it returns where the paths meet.
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	a, b := d.a[aLo:aHi], d.b[bLo:bHi]
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	length := 2*maxD + 2
+	forward, backward := make([]int, length), make([]int, length)
+
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+	// With an odd delta the forward path finds the overlap, else the backward path
+	oddDelta := delta%2 != 0
+
+	var forwardStart, forwardEnd, backwardStart, backwardEnd int = 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		for k := -step + forwardStart; k <= step-forwardEnd; k += 2 {
+			index := offset + k
+			var x int
+
+			if k == -step || (k != step && forward[index-1] < forward[index+1]) {
+				x = forward[index+1]
+			} else {
+				x = forward[index-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			forward[index] = x
+
+			if x > n {
+				forwardEnd += 2
+			} else if y > m {
+				forwardStart += 2
+			} else if oddDelta {
+				backwardIndex := offset + delta - k
+
+				if backwardIndex >= 0 && backwardIndex < length && backward[backwardIndex] != -1 && x >= n-backward[backwardIndex] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -step + backwardStart; k <= step-backwardEnd; k += 2 {
+			index := offset + k
+			var x int
+
+			if k == -step || (k != step && backward[index-1] < backward[index+1]) {
+				x = backward[index+1]
+			} else {
+				x = backward[index-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+
+			backward[index] = x
+
+			if x > n {
+				backwardEnd += 2
+			} else if y > m {
+				backwardStart += 2
+			} else if !oddDelta {
+				forwardIndex := offset + delta - k
+
+				if forwardIndex >= 0 && forwardIndex < length && forward[forwardIndex] != -1 {
+					forwardX := forward[forwardIndex]
+					forwardY := offset + forwardX - forwardIndex
+
+					if forwardX >= n-x {
+						return aLo + forwardX, bLo + forwardY, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,79 @@
+package merge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/costaluu/flag/git"
+)
+
+// GitMergeFile merges with git merge-file and reads the conflicts back from its
+// markers.
+type GitMergeFile struct{}
+
+func (GitMergeFile) Merge(base []byte, current []byte, incoming []byte, currentLabel string, incomingLabel string) (Result, error) {
+	folder, err := os.MkdirTemp("", "flag-merge-")
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	defer os.RemoveAll(folder)
+
+	var paths [3]string
+
+	for i, content := range [][]byte{base, current, incoming} {
+		paths[i] = filepath.Join(folder, []string{"base", "current", "incoming"}[i])
+
+		if err := os.WriteFile(paths[i], content, 0644); err != nil {
+			return Result{}, err
+		}
+	}
+
+	text, _, err := git.MergeFile(paths[0], paths[1], paths[2], currentLabel, incomingLabel)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return parseMarkers(text, currentLabel, incomingLabel), nil
+}
+
+// parseMarkers reads the hunks of a file merged with git conflict markers.
+func parseMarkers(text string, currentLabel string, incomingLabel string) Result {
+	var result Result = Result{Hunks: []Hunk{}, CurrentLabel: currentLabel, IncomingLabel: incomingLabel}
+	var merged []string = []string{}
+	var conflict *Hunk
+	var inIncoming bool = false
+
+	for _, line := range splitLines([]byte(text)) {
+		switch {
+		case conflict == nil && strings.HasPrefix(line, "<<<<<<<"):
+			if len(merged) > 0 {
+				result.Hunks = append(result.Hunks, Hunk{Lines: merged})
+				merged = []string{}
+			}
+
+			conflict = &Hunk{Conflict: true, Current: []string{}, Incoming: []string{}}
+			inIncoming = false
+		case conflict != nil && !inIncoming && strings.HasPrefix(line, "======="):
+			inIncoming = true
+		case conflict != nil && inIncoming && strings.HasPrefix(line, ">>>>>>>"):
+			result.Hunks = append(result.Hunks, *conflict)
+			conflict = nil
+		case conflict != nil && inIncoming:
+			conflict.Incoming = append(conflict.Incoming, line)
+		case conflict != nil:
+			conflict.Current = append(conflict.Current, line)
+		default:
+			merged = append(merged, line)
+		}
+	}
+
+	if len(merged) > 0 {
+		result.Hunks = append(result.Hunks, Hunk{Lines: merged})
+	}
+
+	return result
+}
@@ -0,0 +1,174 @@
+// Package merge merges two versions of a file with their common base. The native
+// strategy runs a diff3 merge in memory, the git strategy runs git merge-file. Both
+// return the merged file as hunks, a conflict keeps the lines of each side instead of
+// marker text.
+package merge
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Hunk is a part of a merged file, merged lines or a conflict between both sides. Lines
+// keep their line endings.
+type Hunk struct {
+	// Lines are the merged lines of a hunk without conflict.
+	Lines    []string
+	Conflict bool
+	// Base holds the lines of the base changed by both sides, when the strategy knows them.
+	Base     []string
+	Current  []string
+	Incoming []string
+}
+
+// Result is a merged file.
+type Result struct {
+	Hunks         []Hunk
+	CurrentLabel  string
+	IncomingLabel string
+}
+
+// Merger merges the current and the incoming versions of a file with their base.
+type Merger interface {
+	Merge(base []byte, current []byte, incoming []byte, currentLabel string, incomingLabel string) (Result, error)
+}
+
+// Names of the strategies for SelectStrategy.
+const (
+	StrategyNative = "native"
+	StrategyGit    = "git"
+)
+
+var strategyMutex sync.Mutex = sync.Mutex{}
+
+var strategy Merger = Diff3{}
+
+// SelectStrategy sets the merger used by Files by its name.
+func SelectStrategy(name string) error {
+	switch name {
+	case "", StrategyNative:
+		SetStrategy(Diff3{})
+	case StrategyGit:
+		SetStrategy(GitMergeFile{})
+	default:
+		return fmt.Errorf("invalid merge strategy %s, use %s or %s", name, StrategyNative, StrategyGit)
+	}
+
+	return nil
+}
+
+// SetStrategy sets the merger used by Files.
+func SetStrategy(m Merger) {
+	strategyMutex.Lock()
+	defer strategyMutex.Unlock()
+
+	strategy = m
+}
+
+// Files merges the files at currentPath and incomingPath with the file at basePath.
+func Files(basePath string, currentPath string, incomingPath string, currentLabel string, incomingLabel string) (Result, error) {
+	var contents [3][]byte
+
+	for i, path := range []string{basePath, currentPath, incomingPath} {
+		content, err := os.ReadFile(path)
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		contents[i] = content
+	}
+
+	strategyMutex.Lock()
+	merger := strategy
+	strategyMutex.Unlock()
+
+	return merger.Merge(contents[0], contents[1], contents[2], currentLabel, incomingLabel)
+}
+
+// HasConflicts reports if a hunk of the result is a conflict.
+func (r Result) HasConflicts() bool {
+	for _, hunk := range r.Hunks {
+		if hunk.Conflict {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withLineEnding ends the last line of a side of a conflict, so the marker after it
+// starts a line.
+func withLineEnding(lines []string) []string {
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		lines = append(lines[:len(lines)-1:len(lines)-1], lines[len(lines)-1]+"\n")
+	}
+
+	return lines
+}
+
+// conflictLines returns the lines of a conflict with git conflict markers.
+func (r Result) conflictLines(hunk Hunk) []string {
+	var lines []string = []string{fmt.Sprintf("<<<<<<< %s\n", r.CurrentLabel)}
+
+	lines = append(lines, withLineEnding(hunk.Current)...)
+	lines = append(lines, "=======\n")
+	lines = append(lines, withLineEnding(hunk.Incoming)...)
+
+	return append(lines, fmt.Sprintf(">>>>>>> %s\n", r.IncomingLabel))
+}
+
+// Text returns the merged file, conflicts are written with git conflict markers.
+func (r Result) Text() string {
+	var text strings.Builder
+
+	for _, hunk := range r.Hunks {
+		lines := hunk.Lines
+
+		if hunk.Conflict {
+			lines = r.conflictLines(hunk)
+		}
+
+		for _, line := range lines {
+			text.WriteString(line)
+		}
+	}
+
+	return text.String()
+}
+
+// ConflictText returns a conflict hunk with git conflict markers and without the last
+// line ending, like the conflict resolver shows it.
+func (r Result) ConflictText(hunk Hunk) string {
+	lines := r.conflictLines(hunk)
+	content := make([]string, len(lines))
+
+	for i, line := range lines {
+		content[i] = strings.TrimRight(line, "\r\n")
+	}
+
+	return strings.Join(content, "\n")
+}
+
+// splitLines splits content in lines that keep their line endings.
+func splitLines(content []byte) []string {
+	var lines []string = []string{}
+	text := string(content)
+
+	for len(text) > 0 {
+		end := strings.IndexByte(text, '\n')
+
+		if end < 0 {
+			lines = append(lines, text)
+
+			break
+		}
+
+		lines = append(lines, text[:end+1])
+		text = text[end+1:]
+	}
+
+	return lines
+}
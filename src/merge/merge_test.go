@@ -0,0 +1,89 @@
+package merge
+
+import (
+	"os/exec"
+	"testing"
+)
+
+var mergeCases = []struct {
+	name                    string
+	base, current, incoming string
+	expected                string
+	conflicts               int
+}{
+	{"unchanged", "a\nb\n", "a\nb\n", "a\nb\n", "a\nb\n", 0},
+	{"current only", "a\nb\nc\n", "a\nB\nc\n", "a\nb\nc\n", "a\nB\nc\n", 0},
+	{"incoming only", "a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\nd\n", "a\nb\nc\nd\n", 0},
+	{"both apart", "a\nb\nc\nd\ne\n", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", 0},
+	{"same change", "a\nb\nc\n", "a\nX\nc\n", "a\nX\nc\n", "a\nX\nc\n", 0},
+	{"conflict", "a\nb\nc\n", "a\nB1\nc\n", "a\nB2\nc\n", "a\n<<<<<<< one\nB1\n=======\nB2\n>>>>>>> two\nc\n", 1},
+	{"touching", "a\nb\nc\nd\n", "a\nB\nc\nd\n", "a\nb\nC\nd\n", "a\n<<<<<<< one\nB\nc\n=======\nb\nC\n>>>>>>> two\nd\n", 1},
+	{"shared edges", "a\nb\nc\n", "a\nx\nB1\ny\nc\n", "a\nx\nB2\ny\nc\n", "a\nx\n<<<<<<< one\nB1\n=======\nB2\n>>>>>>> two\ny\nc\n", 1},
+	{"deleted and changed", "a\nb\nc\n", "a\nc\n", "a\nB\nc\n", "a\n<<<<<<< one\n=======\nB\n>>>>>>> two\nc\n", 1},
+	{"no newline", "a\nb", "a\nb1", "a\nb2", "a\n<<<<<<< one\nb1\n=======\nb2\n>>>>>>> two\n", 1},
+	{"joined conflicts", "a\nb\nc\nd\ne\n", "1\nb\nc\nd\n5\n", "2\nb\nc\nd\n6\n", "<<<<<<< one\n1\nb\nc\nd\n5\n=======\n2\nb\nc\nd\n6\n>>>>>>> two\n", 1},
+	{"two conflicts", "a\nb\nc\nd\ne\nf\n", "1\nb\nc\nd\ne\n6\n", "2\nb\nc\nd\ne\n7\n", "<<<<<<< one\n1\n=======\n2\n>>>>>>> two\nb\nc\nd\ne\n<<<<<<< one\n6\n=======\n7\n>>>>>>> two\n", 2},
+	{"joined by symbols", "a\n}\n}\n}\n}\nf\n", "1\n}\n}\n}\n}\n6\n", "2\n}\n}\n}\n}\n7\n", "<<<<<<< one\n1\n}\n}\n}\n}\n6\n=======\n2\n}\n}\n}\n}\n7\n>>>>>>> two\n", 1},
+	{"split conflict", "x\n", "1\nk\nl\nm\nn\n5\n", "2\nk\nl\nm\nn\n6\n", "<<<<<<< one\n1\n=======\n2\n>>>>>>> two\nk\nl\nm\nn\n<<<<<<< one\n5\n=======\n6\n>>>>>>> two\n", 2},
+	{"empty base", "", "a\n", "a\n", "a\n", 0},
+}
+
+func TestDiff3(t *testing.T) {
+	for _, c := range mergeCases {
+		result, err := Diff3{}.Merge([]byte(c.base), []byte(c.current), []byte(c.incoming), "one", "two")
+
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if text := result.Text(); text != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.name, c.expected, text)
+		}
+
+		if conflicts := countConflicts(result); conflicts != c.conflicts || result.HasConflicts() != (c.conflicts > 0) {
+			t.Errorf("%s: expected %d conflicts, got %d", c.name, c.conflicts, conflicts)
+		}
+	}
+}
+
+func TestGitMergeFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	for _, c := range mergeCases {
+		result, err := GitMergeFile{}.Merge([]byte(c.base), []byte(c.current), []byte(c.incoming), "one", "two")
+
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if text := result.Text(); text != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.name, c.expected, text)
+		}
+
+		if conflicts := countConflicts(result); conflicts != c.conflicts {
+			t.Errorf("%s: expected %d conflicts, got %d", c.name, c.conflicts, conflicts)
+		}
+	}
+}
+
+func countConflicts(result Result) int {
+	var count int = 0
+
+	for _, hunk := range result.Hunks {
+		if hunk.Conflict {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestConflictText(t *testing.T) {
+	result, _ := Diff3{}.Merge([]byte("a\nb\nc\n"), []byte("a\nB1\nc\n"), []byte("a\nB2\nc\n"), "one", "two")
+
+	if len(result.Hunks) != 3 || !result.Hunks[1].Conflict || result.ConflictText(result.Hunks[1]) != "<<<<<<< one\nB1\n=======\nB2\n>>>>>>> two" {
+		t.Errorf("unexpected hunks %+v", result.Hunks)
+	}
+}
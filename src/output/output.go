@@ -0,0 +1,165 @@
+// Package output writes the records of a report as json, yaml or csv. Records are
+// structs, their json tags name the fields on every format.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/costaluu/flag/errs"
+)
+
+type Format string
+
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	YAML  Format = "yaml"
+	CSV   Format = "csv"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(value)); format {
+	case "", Table:
+		return Table, nil
+	case JSON, YAML, CSV:
+		return format, nil
+	}
+
+	return "", errs.New(errs.InvalidArgument, "invalid output %s, use table, json, yaml or csv", value)
+}
+
+type field struct {
+	name  string
+	index int
+}
+
+func fieldsOf(recordType reflect.Type) []field {
+	var fields []field = []field{}
+
+	for i := 0; i < recordType.NumField(); i++ {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+
+		if name == "" {
+			name = recordType.Field(i).Name
+		}
+
+		fields = append(fields, field{name: name, index: i})
+	}
+
+	return fields
+}
+
+// scalar encodes a value as json, which is also a valid yaml scalar.
+func scalar(value reflect.Value) (string, error) {
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value.Interface()); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
+
+func writeJSON(w io.Writer, records any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(records)
+}
+
+func writeYAML(w io.Writer, records reflect.Value, fields []field) error {
+	if records.Len() == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+
+		return err
+	}
+
+	for i := 0; i < records.Len(); i++ {
+		for j, field := range fields {
+			value, err := scalar(records.Index(i).Field(field.index))
+
+			if err != nil {
+				return err
+			}
+
+			var prefix string = "  "
+
+			if j == 0 {
+				prefix = "- "
+			}
+
+			if _, err := fmt.Fprintf(w, "%s%s: %s\n", prefix, field.name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeCSV(w io.Writer, records reflect.Value, fields []field) error {
+	writer := csv.NewWriter(w)
+
+	var header []string = []string{}
+
+	for _, field := range fields {
+		header = append(header, field.name)
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i := 0; i < records.Len(); i++ {
+		var row []string = []string{}
+
+		for _, field := range fields {
+			row = append(row, fmt.Sprint(records.Index(i).Field(field.index).Interface()))
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// Write writes records, a slice of structs, to w on format. Tables are rendered by
+// each report.
+func Write(w io.Writer, format Format, records any) error {
+	value := reflect.ValueOf(records)
+
+	if value.Kind() != reflect.Slice || value.Type().Elem().Kind() != reflect.Struct {
+		return errs.New(errs.Internal, "output records must be a slice of structs, got %T", records)
+	}
+
+	fields := fieldsOf(value.Type().Elem())
+
+	switch format {
+	case JSON:
+		if value.IsNil() {
+			records = []struct{}{}
+		}
+
+		return writeJSON(w, records)
+	case YAML:
+		return writeYAML(w, value, fields)
+	case CSV:
+		return writeCSV(w, value, fields)
+	}
+
+	return errs.New(errs.Internal, "output %s is rendered by the report", format)
+}
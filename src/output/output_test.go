@@ -0,0 +1,45 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/costaluu/flag/errs"
+)
+
+type record struct {
+	Name   string `json:"name"`
+	Active bool   `json:"active"`
+}
+
+func TestWrite(t *testing.T) {
+	var records []record = []record{{Name: "check,out", Active: true}, {Name: "beta"}}
+
+	tests := []struct {
+		format   Format
+		records  []record
+		expected string
+	}{
+		{JSON, nil, "[]\n"},
+		{YAML, records, "- name: \"check,out\"\n  active: true\n- name: \"beta\"\n  active: false\n"},
+		{YAML, nil, "[]\n"},
+		{CSV, records, "name,active\n\"check,out\",true\nbeta,false\n"},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+
+		if err := Write(&buffer, test.format, test.records); err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+
+		if buffer.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.format, test.expected, buffer.String())
+		}
+	}
+
+	if _, err := ParseFormat("xml"); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Errorf("expected an invalid argument error, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package parser
+
+import "fmt"
+
+// Position points to a byte in the parsed content. Line and Column start at 1.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Delimeter is a pair of comment markers that wrap block markers, like `// ` and ` //`.
+type Delimeter struct {
+	Start string
+	End   string
+}
+
+type TokenKind int
+
+const (
+	TokenFeature TokenKind = iota
+	TokenDefault
+	TokenVariant
+	TokenEnd
+)
+
+func (kind TokenKind) String() string {
+	switch kind {
+	case TokenFeature:
+		return "@feature"
+	case TokenDefault:
+		return "@default"
+	case TokenVariant:
+		return "@variant"
+	default:
+		return "!feature"
+	}
+}
+
+// BlockForm tells how a block is written. Inline blocks hold one content on the code
+// before the marker and the other on the marker, next line blocks hold one content on
+// the marker and the other on the line that follows it.
+type BlockForm int
+
+const (
+	FormBlock BlockForm = iota
+	FormInline
+	FormNextLine
+)
+
+// Token is a single block marker, from the start delimiter to the end delimiter.
+// Name is the normalized text of Expression, Value is set on `name=value` headers.
+// Inline and next line markers also carry the offsets of the content written on the
+// marker and of the code they apply to.
+type Token struct {
+	Kind         TokenKind
+	Form         BlockForm
+	Delimeter    Delimeter
+	Name         string
+	Value        string
+	Expression   Expression
+	Id           string
+	Start        Position
+	End          Position
+	ContentStart int
+	ContentEnd   int
+	CodeStart    int
+	CodeEnd      int
+}
+
+// Section is the content that follows a @feature, @variant or @default marker,
+// Blocks holds the blocks declared inside of it.
+type Section struct {
+	Marker       Token
+	Value        string
+	Content      string
+	ContentStart int
+	ContentEnd   int
+	Blocks       []*Block
+}
+
+// Block is a feature block. Inline and next line blocks have both sections, Visible
+// is the one that is code on the file and Separator the text between the code and the
+// marker. Delimeter is the pair used by the marker that opens the block.
+type Block struct {
+	Id         string
+	Name       string
+	Expression Expression
+	Form       BlockForm
+	Delimeter  Delimeter
+	Feature    *Section
+	Variants   []*Section
+	Default    *Section
+	Visible    *Section
+	Separator  string
+	Close      Token
+	Start      Position
+	End        Position
+	Parent     *Block
+}
+
+// IsMultivariate reports if the block selects between `name=value` variants.
+func (b *Block) IsMultivariate() bool {
+	return b.Feature != nil && b.Feature.Value != ""
+}
+
+// Sections returns the sections of the block in the order they appear.
+func (b *Block) Sections() []*Section {
+	var sections []*Section = []*Section{}
+
+	if b.Feature != nil {
+		sections = append(sections, b.Feature)
+	}
+
+	sections = append(sections, b.Variants...)
+
+	if b.Default != nil {
+		sections = append(sections, b.Default)
+	}
+
+	return sections
+}
+
+// Children returns the blocks declared directly inside the sections of the block.
+func (b *Block) Children() []*Block {
+	var children []*Block = []*Block{}
+
+	for _, section := range b.Sections() {
+		children = append(children, section.Blocks...)
+	}
+
+	return children
+}
+
+type ParseError struct {
+	Position Position
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Position.Line, e.Position.Column, e.Message)
+}
+
+type Document struct {
+	Content string
+	Blocks  []*Block
+	Errors  []*ParseError
+}
+
+// AllBlocks returns every block of the document, parents before their children.
+func (d *Document) AllBlocks() []*Block {
+	var result []*Block = []*Block{}
+
+	var walk func(blocks []*Block)
+
+	walk = func(blocks []*Block) {
+		for _, block := range blocks {
+			result = append(result, block)
+			walk(block.Children())
+		}
+	}
+
+	walk(d.Blocks)
+
+	return result
+}
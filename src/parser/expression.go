@@ -0,0 +1,361 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/costaluu/flag/constants"
+)
+
+// Expression is the content of a @feature or @default header, like
+// `checkout && !legacyPayments`. A plain feature name is an Identifier.
+type Expression interface {
+	String() string
+	// Evaluate returns ON, OFF or DEV for the given feature states. DEV is treated as
+	// unknown, so `a && b` is OFF when a is OFF even if b is DEV.
+	Evaluate(states map[string]string) string
+	// Substitute replaces a feature by a constant value and simplifies the expression.
+	Substitute(name string, value bool) Expression
+	collect(names map[string]bool)
+}
+
+type Identifier struct {
+	Name string
+}
+
+type Not struct {
+	Operand Expression
+}
+
+type And struct {
+	Left  Expression
+	Right Expression
+}
+
+type Or struct {
+	Left  Expression
+	Right Expression
+}
+
+type Constant struct {
+	Value bool
+}
+
+// Features returns the sorted names of the features used by the expression.
+func Features(expression Expression) []string {
+	var names map[string]bool = make(map[string]bool)
+
+	expression.collect(names)
+
+	var result []string = []string{}
+
+	for name := range names {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// ConstantValue reports the value of an expression that doesn't depend on any feature.
+func ConstantValue(expression Expression) (bool, bool) {
+	constant, ok := expression.(Constant)
+
+	return constant.Value, ok
+}
+
+func not(state string) string {
+	if state == constants.STATE_ON {
+		return constants.STATE_OFF
+	} else if state == constants.STATE_OFF {
+		return constants.STATE_ON
+	}
+
+	return constants.STATE_DEV
+}
+
+func (e Identifier) String() string { return e.Name }
+
+func (e Identifier) Evaluate(states map[string]string) string {
+	state, exists := states[e.Name]
+
+	if !exists {
+		return constants.STATE_DEV
+	}
+
+	return state
+}
+
+func (e Identifier) Substitute(name string, value bool) Expression {
+	if e.Name == name {
+		return Constant{Value: value}
+	}
+
+	return e
+}
+
+func (e Identifier) collect(names map[string]bool) { names[e.Name] = true }
+
+func (e Not) String() string {
+	switch e.Operand.(type) {
+	case And, Or:
+		return fmt.Sprintf("!(%s)", e.Operand.String())
+	default:
+		return "!" + e.Operand.String()
+	}
+}
+
+func (e Not) Evaluate(states map[string]string) string {
+	return not(e.Operand.Evaluate(states))
+}
+
+func (e Not) Substitute(name string, value bool) Expression {
+	operand := e.Operand.Substitute(name, value)
+
+	if constant, ok := ConstantValue(operand); ok {
+		return Constant{Value: !constant}
+	}
+
+	return Not{Operand: operand}
+}
+
+func (e Not) collect(names map[string]bool) { e.Operand.collect(names) }
+
+func (e And) String() string {
+	return fmt.Sprintf("%s && %s", wrapOr(e.Left), wrapOr(e.Right))
+}
+
+func (e And) Evaluate(states map[string]string) string {
+	left := e.Left.Evaluate(states)
+	right := e.Right.Evaluate(states)
+
+	if left == constants.STATE_OFF || right == constants.STATE_OFF {
+		return constants.STATE_OFF
+	} else if left == constants.STATE_ON && right == constants.STATE_ON {
+		return constants.STATE_ON
+	}
+
+	return constants.STATE_DEV
+}
+
+func (e And) Substitute(name string, value bool) Expression {
+	left := e.Left.Substitute(name, value)
+	right := e.Right.Substitute(name, value)
+
+	if constant, ok := ConstantValue(left); ok {
+		if !constant {
+			return Constant{Value: false}
+		}
+
+		return right
+	}
+
+	if constant, ok := ConstantValue(right); ok {
+		if !constant {
+			return Constant{Value: false}
+		}
+
+		return left
+	}
+
+	return And{Left: left, Right: right}
+}
+
+func (e And) collect(names map[string]bool) {
+	e.Left.collect(names)
+	e.Right.collect(names)
+}
+
+func (e Or) String() string {
+	return fmt.Sprintf("%s || %s", e.Left.String(), e.Right.String())
+}
+
+func (e Or) Evaluate(states map[string]string) string {
+	return not(And{Left: Not{Operand: e.Left}, Right: Not{Operand: e.Right}}.Evaluate(states))
+}
+
+func (e Or) Substitute(name string, value bool) Expression {
+	left := e.Left.Substitute(name, value)
+	right := e.Right.Substitute(name, value)
+
+	if constant, ok := ConstantValue(left); ok {
+		if constant {
+			return Constant{Value: true}
+		}
+
+		return right
+	}
+
+	if constant, ok := ConstantValue(right); ok {
+		if constant {
+			return Constant{Value: true}
+		}
+
+		return left
+	}
+
+	return Or{Left: left, Right: right}
+}
+
+func (e Or) collect(names map[string]bool) {
+	e.Left.collect(names)
+	e.Right.collect(names)
+}
+
+func (e Constant) String() string {
+	if e.Value {
+		return "true"
+	}
+
+	return "false"
+}
+
+func (e Constant) Evaluate(states map[string]string) string {
+	if e.Value {
+		return constants.STATE_ON
+	}
+
+	return constants.STATE_OFF
+}
+
+func (e Constant) Substitute(name string, value bool) Expression { return e }
+
+func (e Constant) collect(names map[string]bool) {}
+
+func wrapOr(expression Expression) string {
+	if _, ok := expression.(Or); ok {
+		return fmt.Sprintf("(%s)", expression.String())
+	}
+
+	return expression.String()
+}
+
+type expressionParser struct {
+	input  string
+	cursor int
+}
+
+// ParseExpression parses a header expression. Operators are `!`, `&&`, `||` and
+// parentheses, `&&` binds tighter than `||`.
+func ParseExpression(input string) (Expression, error) {
+	p := &expressionParser{input: input}
+
+	expression, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+
+	if p.cursor < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.input[p.cursor:], p.cursor+1)
+	}
+
+	return expression, nil
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.cursor < len(p.input) && unicode.IsSpace(rune(p.input[p.cursor])) {
+		p.cursor++
+	}
+}
+
+func (p *expressionParser) consume(operator string) bool {
+	p.skipSpaces()
+
+	if strings.HasPrefix(p.input[p.cursor:], operator) {
+		p.cursor += len(operator)
+
+		return true
+	}
+
+	return false
+}
+
+func (p *expressionParser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("||") {
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = Or{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = And{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (Expression, error) {
+	if p.consume("!") {
+		operand, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return Not{Operand: operand}, nil
+	}
+
+	if p.consume("(") {
+		expression, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing ')' at position %d", p.cursor+1)
+		}
+
+		return expression, nil
+	}
+
+	p.skipSpaces()
+
+	start := p.cursor
+
+	for p.cursor < len(p.input) && !strings.ContainsRune("()!&|= \t", rune(p.input[p.cursor])) {
+		p.cursor++
+	}
+
+	if start == p.cursor {
+		if p.cursor == len(p.input) {
+			return nil, fmt.Errorf("expected a feature name at the end")
+		}
+
+		return nil, fmt.Errorf("expected a feature name at position %d", p.cursor+1)
+	}
+
+	return Identifier{Name: p.input[start:p.cursor]}, nil
+}
@@ -0,0 +1,432 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/costaluu/flag/constants"
+)
+
+var keywords map[string]TokenKind = map[string]TokenKind{
+	"@feature(": TokenFeature,
+	"@default(": TokenDefault,
+	"@variant(": TokenVariant,
+	"!feature":  TokenEnd,
+}
+
+// nextLineKeywords start a block that applies only to the line after the marker.
+var nextLineKeywords map[string]TokenKind = map[string]TokenKind{
+	"@feature-next(": TokenFeature,
+	"@default-next(": TokenDefault,
+}
+
+// lineMarker holds the offsets of an inline or next line marker, the content written
+// on the marker and the code it applies to.
+type lineMarker struct {
+	contentStart int
+	contentEnd   int
+	codeStart    int
+	codeEnd      int
+}
+
+type lexer struct {
+	data         string
+	delimeters   []Delimeter
+	lineStarts   []int
+	lastTokenEnd int
+	tokens       []Token
+	errors       []*ParseError
+}
+
+func newLexer(data string, delimeters []Delimeter) *lexer {
+	var lineStarts []int = []int{0}
+
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	return &lexer{
+		data:       data,
+		delimeters: delimeters,
+		lineStarts: lineStarts,
+	}
+}
+
+func (l *lexer) position(offset int) Position {
+	line := sort.Search(len(l.lineStarts), func(i int) bool {
+		return l.lineStarts[i] > offset
+	})
+
+	return Position{
+		Offset: offset,
+		Line:   line,
+		Column: offset - l.lineStarts[line-1] + 1,
+	}
+}
+
+func (l *lexer) errorf(offset int, format string, args ...any) {
+	l.errors = append(l.errors, &ParseError{
+		Position: l.position(offset),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// lineEnd returns the offset of the next line break after offset, or the end of the data.
+func (l *lexer) lineEnd(offset int) int {
+	index := strings.IndexByte(l.data[offset:], '\n')
+
+	if index == -1 {
+		return len(l.data)
+	}
+
+	return offset + index
+}
+
+// lineStart returns the offset of the first byte of the line that holds offset.
+func (l *lexer) lineStart(offset int) int {
+	return strings.LastIndexByte(l.data[:offset], '\n') + 1
+}
+
+// trimRange shrinks [start, end) to skip the spaces around the text.
+func (l *lexer) trimRange(start int, end int) (int, int) {
+	for start < end && unicode.IsSpace(rune(l.data[start])) {
+		start++
+	}
+
+	for end > start && unicode.IsSpace(rune(l.data[end-1])) {
+		end--
+	}
+
+	return start, end
+}
+
+// isGeneratedId reports if text looks like an id written by sync.
+func isGeneratedId(text string) bool {
+	if len(text) != constants.ID_LENGTH {
+		return false
+	}
+
+	for i := 0; i < len(text); i++ {
+		if !strings.ContainsRune("0123456789abcdef", rune(text[i])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitLineMarker splits the text of an inline or next line marker, `id: content`,
+// returning the offset where the content starts. The id is optional.
+func (l *lexer) splitLineMarker(start int, end int) (string, int) {
+	start, end = l.trimRange(start, end)
+
+	text := l.data[start:end]
+
+	if len(text) > constants.ID_LENGTH && text[constants.ID_LENGTH] == ':' && isGeneratedId(text[:constants.ID_LENGTH]) {
+		return text[:constants.ID_LENGTH], start + constants.ID_LENGTH + 1
+	}
+
+	return "", start
+}
+
+func markerName(kind TokenKind, form BlockForm) string {
+	if form == FormNextLine {
+		return kind.String() + "-next"
+	}
+
+	return kind.String()
+}
+
+// lexMarker tries to read a marker that starts at offset and returns the offset
+// where scanning should resume.
+func (l *lexer) lexMarker(offset int, delimeter Delimeter) int {
+	cursor := offset + len(delimeter.Start)
+
+	var kind TokenKind
+	var form BlockForm = FormBlock
+	var keyword string
+	var found bool = false
+
+	for candidate, candidateKind := range keywords {
+		if strings.HasPrefix(l.data[cursor:], candidate) {
+			keyword = candidate
+			kind = candidateKind
+			found = true
+			break
+		}
+	}
+
+	for candidate, candidateKind := range nextLineKeywords {
+		if strings.HasPrefix(l.data[cursor:], candidate) {
+			keyword = candidate
+			kind = candidateKind
+			form = FormNextLine
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return offset + 1
+	}
+
+	cursor += len(keyword)
+	lineEnd := l.lineEnd(cursor)
+
+	if kind == TokenEnd {
+		if !strings.HasPrefix(l.data[cursor:], delimeter.End) {
+			l.errorf(offset, "expected %q after !feature", delimeter.End)
+
+			return cursor
+		}
+
+		end := cursor + len(delimeter.End)
+
+		l.tokens = append(l.tokens, Token{
+			Kind:      kind,
+			Delimeter: delimeter,
+			Start:     l.position(offset),
+			End:       l.position(end),
+		})
+
+		l.lastTokenEnd = end
+
+		return end
+	}
+
+	closeIndex := matchingParen(l.data[cursor:lineEnd])
+
+	if closeIndex == -1 {
+		l.errorf(offset, "missing ')' on %s marker", markerName(kind, form))
+
+		return lineEnd
+	}
+
+	name := l.data[cursor : cursor+closeIndex]
+	cursor += closeIndex + 1
+
+	endIndex := strings.Index(l.data[cursor:lineEnd], delimeter.End)
+
+	if endIndex == -1 {
+		l.errorf(offset, "missing %q at the end of %s(%s) marker", delimeter.End, markerName(kind, form), name)
+
+		return lineEnd
+	}
+
+	id := strings.TrimSpace(l.data[cursor : cursor+endIndex])
+	end := cursor + endIndex + len(delimeter.End)
+
+	var line lineMarker
+
+	// A @feature or @default with code before it on the same line holds the other content of the line
+	if form == FormBlock && (kind == TokenFeature || kind == TokenDefault) && id != "" && !isGeneratedId(id) {
+		codeStart, codeEnd := l.trimRange(max(l.lineStart(offset), l.lastTokenEnd), offset)
+
+		if codeStart < codeEnd {
+			form = FormInline
+			line.codeStart, line.codeEnd = codeStart, codeEnd
+		}
+	}
+
+	if form == FormNextLine {
+		if codeStart, _ := l.trimRange(l.lineStart(offset), offset); codeStart != offset {
+			l.errorf(offset, "%s(%s) should be alone on its line", markerName(kind, form), name)
+
+			return end
+		}
+
+		if rest := l.data[end:lineEnd]; strings.TrimSpace(rest) != "" {
+			l.errorf(offset, "unexpected text %q after %s(%s) marker", strings.TrimSpace(rest), markerName(kind, form), name)
+
+			return lineEnd
+		}
+
+		if lineEnd == len(l.data) {
+			l.errorf(offset, "%s(%s) has no line after it", markerName(kind, form), name)
+
+			return end
+		}
+
+		line.codeStart, line.codeEnd = l.trimRange(lineEnd+1, l.lineEnd(lineEnd+1))
+
+		if line.codeStart == line.codeEnd {
+			l.errorf(offset, "%s(%s) is followed by an empty line", markerName(kind, form), name)
+
+			return end
+		}
+	}
+
+	if form != FormBlock {
+		var contentStart int
+
+		id, contentStart = l.splitLineMarker(cursor, cursor+endIndex)
+		line.contentStart, line.contentEnd = l.trimRange(contentStart, cursor+endIndex)
+	} else if strings.ContainsAny(id, " \t") {
+		l.errorf(offset, "unexpected text %q on %s(%s) marker", id, kind, name)
+
+		return end
+	}
+
+	var value string
+
+	if index := strings.IndexByte(name, '='); index != -1 {
+		header := name
+		value = strings.TrimSpace(name[index+1:])
+		name = strings.TrimSpace(name[:index])
+
+		if form != FormBlock {
+			l.errorf(offset, "%s(%s) can't select a variant, variants need a full block", markerName(kind, form), header)
+
+			return end
+		}
+
+		if kind == TokenDefault {
+			l.errorf(offset, "@default(%s) can't select a variant, use @default(%s)", header, name)
+
+			return end
+		}
+
+		if value == "" || strings.ContainsAny(value, " \t()!&|=") {
+			l.errorf(offset, "invalid variant %q on %s(%s) marker", value, kind, name)
+
+			return end
+		}
+	} else if kind == TokenVariant {
+		l.errorf(offset, "expected name=value on @variant(%s) marker", name)
+
+		return end
+	}
+
+	expression, err := ParseExpression(name)
+
+	if err != nil {
+		l.errorf(offset, "invalid expression %q on %s marker: %s", name, markerName(kind, form), err)
+
+		return end
+	}
+
+	if _, ok := expression.(Identifier); value != "" && !ok {
+		l.errorf(offset, "variants need a single feature name, found %q", name)
+
+		return end
+	}
+
+	for _, feature := range Features(expression) {
+		if len(feature) < constants.MIN_FEATURE_CHARACTERS {
+			l.errorf(offset, "feature name %q should have at least %d characters", feature, constants.MIN_FEATURE_CHARACTERS)
+
+			return end
+		}
+	}
+
+	l.tokens = append(l.tokens, Token{
+		Kind:         kind,
+		Form:         form,
+		Delimeter:    delimeter,
+		Name:         expression.String(),
+		Value:        value,
+		Expression:   expression,
+		Id:           id,
+		Start:        l.position(offset),
+		End:          l.position(end),
+		ContentStart: line.contentStart,
+		ContentEnd:   line.contentEnd,
+		CodeStart:    line.codeStart,
+		CodeEnd:      line.codeEnd,
+	})
+
+	l.lastTokenEnd = end
+
+	// The line that follows a next line marker is its content, not a place for markers
+	if form == FormNextLine {
+		return line.codeEnd
+	}
+
+	return end
+}
+
+// matchingParen returns the index of the ')' that closes a header, skipping the
+// parentheses of the expression, or -1 when it isn't closed.
+func matchingParen(text string) int {
+	depth := 0
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+
+			depth--
+		}
+	}
+
+	return -1
+}
+
+// Tokenize walks the content once and returns every block marker found on it.
+func Tokenize(data string, delimeters ...Delimeter) ([]Token, []*ParseError) {
+	l := newLexer(data, delimeters)
+	l.run()
+
+	return l.tokens, l.errors
+}
+
+// nextMarker returns the offset of the first start delimeter found from offset and the
+// delimeters that start there, longer start delimeters first.
+func (l *lexer) nextMarker(offset int) (int, []Delimeter) {
+	var first int = -1
+	var candidates []Delimeter
+
+	for _, delimeter := range l.delimeters {
+		if len(delimeter.Start) == 0 {
+			continue
+		}
+
+		index := strings.Index(l.data[offset:], delimeter.Start)
+
+		if index == -1 {
+			continue
+		}
+
+		if first == -1 || offset+index < first {
+			first = offset + index
+			candidates = []Delimeter{delimeter}
+		} else if offset+index == first {
+			candidates = append(candidates, delimeter)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].Start) > len(candidates[j].Start)
+	})
+
+	return first, candidates
+}
+
+func (l *lexer) run() {
+	offset := 0
+
+	for offset < len(l.data) {
+		index, candidates := l.nextMarker(offset)
+
+		if index == -1 {
+			break
+		}
+
+		offset = index + 1
+
+		for _, delimeter := range candidates {
+			if next := l.lexMarker(index, delimeter); next != index+1 {
+				offset = next
+				break
+			}
+		}
+	}
+}
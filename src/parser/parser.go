@@ -0,0 +1,191 @@
+package parser
+
+import "sort"
+
+type parser struct {
+	*lexer
+	blocks []*Block
+	stack  []*Block
+}
+
+// Parse builds the block tree of a content using the given delimeters.
+// Malformed blocks are not returned as blocks, they are reported on Document.Errors.
+func Parse(data string, delimeterStart string, delimeterEnd string) *Document {
+	return ParseWithDelimeters(data, []Delimeter{{Start: delimeterStart, End: delimeterEnd}})
+}
+
+// ParseWithDelimeters builds the block tree of a content where markers may use any of
+// the delimeters, like html files that mix `<!-- -->`, `/* */` and `//` comments.
+func ParseWithDelimeters(data string, delimeters []Delimeter) *Document {
+	p := &parser{lexer: newLexer(data, delimeters)}
+
+	p.lexer.run()
+	p.run()
+
+	sort.SliceStable(p.errors, func(i, j int) bool {
+		return p.errors[i].Position.Offset < p.errors[j].Position.Offset
+	})
+
+	return &Document{
+		Content: data,
+		Blocks:  p.blocks,
+		Errors:  p.errors,
+	}
+}
+
+func (p *parser) newSection(token Token) *Section {
+	return &Section{
+		Marker:       token,
+		Value:        token.Value,
+		ContentStart: token.End.Offset,
+	}
+}
+
+func (p *parser) closeSection(section *Section, offset int) {
+	section.ContentEnd = offset
+	section.Content = p.data[section.ContentStart:offset]
+}
+
+func (p *parser) peek() *Block {
+	if len(p.stack) == 0 {
+		return nil
+	}
+
+	return p.stack[len(p.stack)-1]
+}
+
+// openSection returns the section of the block that is still receiving content.
+func openSection(block *Block) *Section {
+	sections := block.Sections()
+
+	return sections[len(sections)-1]
+}
+
+func (p *parser) push(token Token) {
+	block := &Block{
+		Id:         token.Id,
+		Name:       token.Name,
+		Expression: token.Expression,
+		Delimeter:  token.Delimeter,
+		Start:      token.Start,
+	}
+
+	if token.Kind == TokenFeature {
+		block.Feature = p.newSection(token)
+	} else {
+		block.Default = p.newSection(token)
+	}
+
+	p.stack = append(p.stack, block)
+}
+
+// lineBlock builds the block of an inline or next line marker. On inline blocks the
+// keyword names the content written on the marker, on next line blocks it names the
+// content of the line after the marker.
+func (p *parser) lineBlock(token Token) *Block {
+	marker := &Section{Marker: token, ContentStart: token.ContentStart, ContentEnd: token.ContentEnd}
+	code := &Section{Marker: token, ContentStart: token.CodeStart, ContentEnd: token.CodeEnd}
+
+	p.closeSection(marker, token.ContentEnd)
+	p.closeSection(code, token.CodeEnd)
+
+	block := &Block{
+		Id:         token.Id,
+		Name:       token.Name,
+		Expression: token.Expression,
+		Form:       token.Form,
+		Delimeter:  token.Delimeter,
+		Visible:    code,
+		Close:      token,
+	}
+
+	if (token.Form == FormInline) == (token.Kind == TokenFeature) {
+		block.Feature, block.Default = marker, code
+	} else {
+		block.Feature, block.Default = code, marker
+	}
+
+	if token.Form == FormInline {
+		block.Start = p.position(token.CodeStart)
+		block.End = token.End
+		block.Separator = p.data[token.CodeEnd:token.Start.Offset]
+	} else {
+		block.Start = token.Start
+		block.End = p.position(token.CodeEnd)
+		block.Separator = p.data[token.End.Offset:token.CodeStart]
+	}
+
+	return block
+}
+
+// attach adds a closed block to the section that is open or to the document.
+func (p *parser) attach(block *Block) {
+	parent := p.peek()
+
+	if parent == nil {
+		p.blocks = append(p.blocks, block)
+	} else {
+		block.Parent = parent
+		section := openSection(parent)
+		section.Blocks = append(section.Blocks, block)
+	}
+}
+
+func (p *parser) run() {
+	for _, token := range p.tokens {
+		if token.Form != FormBlock {
+			p.attach(p.lineBlock(token))
+
+			continue
+		}
+
+		switch token.Kind {
+		case TokenFeature:
+			p.push(token)
+		case TokenDefault:
+			current := p.peek()
+
+			// A @default that doesn't belong to the current block starts a new block inside of it
+			if current == nil || current.Default != nil || current.Name != token.Name {
+				p.push(token)
+
+				continue
+			}
+
+			p.closeSection(openSection(current), token.Start.Offset)
+			current.Default = p.newSection(token)
+		case TokenVariant:
+			current := p.peek()
+
+			if current == nil || !current.IsMultivariate() || current.Default != nil || current.Name != token.Name {
+				p.errorf(token.Start.Offset, "@variant(%s=%s) without a @feature(%s=...)", token.Name, token.Value, token.Name)
+
+				continue
+			}
+
+			p.closeSection(openSection(current), token.Start.Offset)
+			current.Variants = append(current.Variants, p.newSection(token))
+		case TokenEnd:
+			current := p.peek()
+
+			if current == nil {
+				p.errorf(token.Start.Offset, "!feature without a @feature or @default")
+
+				continue
+			}
+
+			p.stack = p.stack[:len(p.stack)-1]
+
+			p.closeSection(openSection(current), token.Start.Offset)
+
+			current.Close = token
+			current.End = token.End
+
+			p.attach(current)
+		}
+	}
+
+	for _, block := range p.stack {
+		p.errorf(block.Start.Offset, "block %s is never closed with !feature", block.Name)
+	}
+}
@@ -0,0 +1,326 @@
+package parser
+
+import "testing"
+
+func TestParseFeatureAndDefault(t *testing.T) {
+	data := "a\n// @feature(checkout) abc //\nnew\n// @default(checkout) abc //\nold\n// !feature //\nb\n"
+
+	document := Parse(data, "// ", " //")
+
+	if len(document.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", document.Errors)
+	}
+
+	if len(document.Blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(document.Blocks))
+	}
+
+	block := document.Blocks[0]
+
+	if block.Name != "checkout" || block.Id != "abc" {
+		t.Errorf("unexpected block header %q %q", block.Name, block.Id)
+	}
+
+	if block.Feature.Content != "\nnew\n" || block.Default.Content != "\nold\n" {
+		t.Errorf("unexpected contents %q %q", block.Feature.Content, block.Default.Content)
+	}
+
+	if block.Start.Line != 2 || block.Start.Column != 1 {
+		t.Errorf("unexpected start position %+v", block.Start)
+	}
+
+	if data[block.Start.Offset:block.End.Offset] != "// @feature(checkout) abc //\nnew\n// @default(checkout) abc //\nold\n// !feature //" {
+		t.Errorf("unexpected block offsets %+v %+v", block.Start, block.End)
+	}
+}
+
+func TestParseOnlyDefault(t *testing.T) {
+	document := Parse("# @default(checkout) #\nold\n# !feature #", "# ", " #")
+
+	if len(document.Blocks) != 1 || document.Blocks[0].Feature != nil || document.Blocks[0].Default.Content != "\nold\n" {
+		t.Fatalf("unexpected document %+v", document)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"unclosed":           "// @feature(checkout) //\nnew\n",
+		"orphan end":         "new\n// !feature //\n",
+		"name mismatch":      "// @feature(checkout) //\nnew\n// @default(payments) //\nold\n// !feature //",
+		"short name":         "// @feature(a) //\nnew\n// !feature //",
+		"missing delim":      "// @feature(checkout)\nnew\n// !feature //",
+		"missing paren":      "// @feature(checkout //\nnew\n// !feature //",
+		"duplicated default": "// @default(checkout) //\nold\n// @default(checkout) //\nold\n// !feature //",
+	}
+
+	for name, data := range cases {
+		document := Parse(data, "// ", " //")
+
+		if len(document.Errors) == 0 {
+			t.Errorf("%s: expected a parse error", name)
+		}
+
+		if len(document.Blocks) != 0 {
+			t.Errorf("%s: malformed block should not be returned", name)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	document := Parse("a\nb\n  // !feature //", "// ", " //")
+
+	if len(document.Errors) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(document.Errors))
+	}
+
+	if document.Errors[0].Position.Line != 3 || document.Errors[0].Position.Column != 3 {
+		t.Errorf("unexpected position %+v", document.Errors[0].Position)
+	}
+}
+
+func TestParseNestedBlocks(t *testing.T) {
+	data := "// @feature(outer) //\na\n// @feature(inner) //\nb\n// @default(inner) //\nc\n// !feature //\n// @default(outer) //\nd\n// @default(other) //\ne\n// !feature //\n// !feature //"
+
+	document := Parse(data, "// ", " //")
+
+	if len(document.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", document.Errors)
+	}
+
+	if len(document.Blocks) != 1 {
+		t.Fatalf("expected 1 top level block, got %d", len(document.Blocks))
+	}
+
+	outer := document.Blocks[0]
+
+	if len(outer.Feature.Blocks) != 1 || outer.Feature.Blocks[0].Name != "inner" || outer.Feature.Blocks[0].Parent != outer {
+		t.Errorf("inner block not found on the feature section")
+	}
+
+	if len(outer.Default.Blocks) != 1 || outer.Default.Blocks[0].Name != "other" || outer.Default.Blocks[0].Feature != nil {
+		t.Errorf("other block not found on the default section")
+	}
+
+	all := document.AllBlocks()
+
+	if len(all) != 3 || all[0] != outer || all[1].Name != "inner" || all[2].Name != "other" {
+		t.Errorf("unexpected walk order")
+	}
+
+	if outer.Default.Content != "\nd\n// @default(other) //\ne\n// !feature //\n" {
+		t.Errorf("unexpected outer default content %q", outer.Default.Content)
+	}
+}
+
+func TestRewriteByOffset(t *testing.T) {
+	data := "// @feature(first) //\nx\n// !feature //\n// @feature(second) //\nx\n// @feature(inner) //\ny\n// !feature //\n// !feature //\n"
+
+	document := Parse(data, "// ", " //")
+
+	result := document.Rewrite(func(block *Block, contents BlockContents) (string, bool) {
+		if block.Name == "inner" {
+			return "INNER", true
+		}
+
+		if block.Name == "second" {
+			return "[" + contents.Feature + "]", true
+		}
+
+		return "", false
+	})
+
+	expected := "// @feature(first) //\nx\n// !feature //\n[\nx\nINNER\n]\n"
+
+	if result != expected {
+		t.Errorf("unexpected rewrite %q", result)
+	}
+}
+
+func TestParseExpressionHeader(t *testing.T) {
+	document := Parse("// @feature((checkout||beta1)&&!legacyPayments) abc //\nnew\n// @default((checkout || beta1) && !legacyPayments) abc //\nold\n// !feature //", "// ", " //")
+
+	if len(document.Errors) != 0 || len(document.Blocks) != 1 {
+		t.Fatalf("unexpected result %v %d", document.Errors, len(document.Blocks))
+	}
+
+	block := document.Blocks[0]
+
+	if block.Name != "(checkout || beta1) && !legacyPayments" || block.Default == nil {
+		t.Errorf("unexpected block %q", block.Name)
+	}
+
+	if features := Features(block.Expression); len(features) != 3 || features[0] != "beta1" {
+		t.Errorf("unexpected features %v", features)
+	}
+}
+
+func TestParseInvalidExpression(t *testing.T) {
+	document := Parse("// @feature(checkout &&) //\nnew\n// !feature //", "// ", " //")
+
+	if len(document.Errors) != 2 {
+		t.Errorf("expected the invalid header and the orphan !feature, got %v", document.Errors)
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	expression, err := ParseExpression("checkout && !legacyPayments")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		checkout string
+		legacy   string
+		expected string
+	}{
+		{"ON", "OFF", "ON"},
+		{"ON", "ON", "OFF"},
+		{"OFF", "DEV", "OFF"},
+		{"ON", "DEV", "DEV"},
+	}
+
+	for _, c := range cases {
+		result := expression.Evaluate(map[string]string{"checkout": c.checkout, "legacyPayments": c.legacy})
+
+		if result != c.expected {
+			t.Errorf("checkout=%s legacyPayments=%s: expected %s, got %s", c.checkout, c.legacy, c.expected, result)
+		}
+	}
+}
+
+func TestSubstituteExpression(t *testing.T) {
+	expression, _ := ParseExpression("(checkout || beta1) && !legacyPayments")
+
+	if result := expression.Substitute("legacyPayments", false).String(); result != "checkout || beta1" {
+		t.Errorf("unexpected simplified expression %q", result)
+	}
+
+	if value, ok := ConstantValue(expression.Substitute("legacyPayments", true)); !ok || value {
+		t.Errorf("expected a constant false expression")
+	}
+}
+
+func TestParseVariants(t *testing.T) {
+	data := "// @feature(theme=dark) //\ndark\n// @variant(theme=light) //\nlight\n// @variant(theme=contrast) //\ncontrast\n// @default(theme) //\nplain\n// !feature //"
+
+	document := Parse(data, "// ", " //")
+
+	if len(document.Errors) != 0 || len(document.Blocks) != 1 {
+		t.Fatalf("unexpected result %v %d", document.Errors, len(document.Blocks))
+	}
+
+	block := document.Blocks[0]
+
+	if !block.IsMultivariate() || block.Name != "theme" || block.Feature.Value != "dark" {
+		t.Errorf("unexpected block %q %q", block.Name, block.Feature.Value)
+	}
+
+	if len(block.Variants) != 2 || block.Variants[1].Value != "contrast" || block.Variants[1].Content != "\ncontrast\n" {
+		t.Errorf("unexpected variants %+v", block.Variants)
+	}
+
+	if block.Default == nil || block.Default.Content != "\nplain\n" {
+		t.Errorf("unexpected default section %+v", block.Default)
+	}
+
+	result := document.Rewrite(func(block *Block, contents BlockContents) (string, bool) {
+		return "", false
+	})
+
+	if result != data {
+		t.Errorf("rewrite without changes modified the content %q", result)
+	}
+}
+
+func TestParseVariantErrors(t *testing.T) {
+	document := Parse("// @feature(theme) //\na\n// @variant(theme=light) //\nb\n// !feature //\n// @variant(theme) //\n", "// ", " //")
+
+	if len(document.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %v", document.Errors)
+	}
+}
+
+func TestParseInlineBlock(t *testing.T) {
+	data := "timeout = 30    // @feature(fastTimeout) timeout = 5 //\nx := 1 // @default(fastTimeout) 0123456789abcdef012345678: x := 2 //\n"
+
+	document := Parse(data, "// ", " //")
+
+	if len(document.Errors) != 0 || len(document.Blocks) != 2 {
+		t.Fatalf("unexpected result %v %d", document.Errors, len(document.Blocks))
+	}
+
+	first := document.Blocks[0]
+
+	if first.Form != FormInline || first.Feature.Content != "timeout = 5" || first.Default.Content != "timeout = 30" || first.Visible != first.Default {
+		t.Errorf("unexpected block %+v", first)
+	}
+
+	if first.Separator != "    " || data[first.Start.Offset:first.End.Offset] != "timeout = 30    // @feature(fastTimeout) timeout = 5 //" {
+		t.Errorf("unexpected block offsets %q", data[first.Start.Offset:first.End.Offset])
+	}
+
+	second := document.Blocks[1]
+
+	if second.Id != "0123456789abcdef012345678" || second.Feature.Content != "x := 1" || second.Default.Content != "x := 2" || second.Visible != second.Feature {
+		t.Errorf("unexpected block %+v", second)
+	}
+}
+
+func TestParseNextLineBlock(t *testing.T) {
+	data := "// @feature(outer) //\n\t// @feature-next(useCache) return slow() //\n\treturn cached()\n// !feature //\n"
+
+	document := Parse(data, "// ", " //")
+
+	if len(document.Errors) != 0 || len(document.Blocks) != 1 {
+		t.Fatalf("unexpected result %v %d", document.Errors, len(document.Blocks))
+	}
+
+	inner := document.Blocks[0].Children()
+
+	if len(inner) != 1 || inner[0].Form != FormNextLine {
+		t.Fatalf("expected a next line block inside outer, got %+v", inner)
+	}
+
+	if inner[0].Feature.Content != "return cached()" || inner[0].Default.Content != "return slow()" || inner[0].Separator != "\n\t" {
+		t.Errorf("unexpected block %+v", inner[0])
+	}
+}
+
+func TestParseLineBlockErrors(t *testing.T) {
+	cases := map[string]string{
+		"variant":      "x := 1 // @feature(theme=dark) x := 2 //",
+		"code before":  "x := 1 // @feature-next(useCache) y //\nz\n",
+		"no next line": "// @feature-next(useCache) y //",
+		"text after":   "// @feature-next(useCache) y // z\nw\n",
+		"empty next":   "// @feature-next(useCache) y //\n\n",
+	}
+
+	for name, data := range cases {
+		document := Parse(data, "// ", " //")
+
+		if len(document.Errors) == 0 || len(document.Blocks) != 0 {
+			t.Errorf("%s: expected a parse error, got %v %d", name, document.Errors, len(document.Blocks))
+		}
+	}
+}
+
+func TestParseWithDelimeters(t *testing.T) {
+	data := "<!-- @feature(newHeader) -->\n<style>\n/* @feature(darkMode) */\na\n/* !feature */\n</style>\nx // @feature(newHeader) y //\n<!-- !feature -->\n"
+
+	document := ParseWithDelimeters(data, []Delimeter{{Start: "<!-- ", End: " -->"}, {Start: "/* ", End: " */"}, {Start: "// ", End: " //"}})
+
+	if len(document.Errors) != 0 || len(document.Blocks) != 1 {
+		t.Fatalf("unexpected result %v %d", document.Errors, len(document.Blocks))
+	}
+
+	children := document.Blocks[0].Children()
+
+	if document.Blocks[0].Delimeter.Start != "<!-- " || len(children) != 2 {
+		t.Fatalf("unexpected block %+v", document.Blocks[0])
+	}
+
+	if children[0].Delimeter.End != " */" || children[1].Delimeter.Start != "// " || children[1].Form != FormInline {
+		t.Errorf("unexpected inner blocks %+v %+v", children[0], children[1])
+	}
+}
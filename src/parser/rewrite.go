@@ -0,0 +1,93 @@
+package parser
+
+import "strings"
+
+// BlockContents holds the content of each section of a block with the inner blocks
+// already rewritten, Variants follows the order of Block.Variants.
+type BlockContents struct {
+	Feature  string
+	Variants []string
+	Default  string
+}
+
+// RenderFunc receives a block and the content of its sections. It returns the new
+// text of the block, or false to keep its markers.
+type RenderFunc func(block *Block, contents BlockContents) (string, bool)
+
+// Rewrite returns the document content with the blocks rendered again by render.
+// Blocks are replaced by their offsets, inner blocks are rendered before the blocks
+// that hold them.
+func (d *Document) Rewrite(render RenderFunc) string {
+	return d.rewriteRange(0, len(d.Content), d.Blocks, render)
+}
+
+func (d *Document) rewriteRange(start int, end int, blocks []*Block, render RenderFunc) string {
+	var builder strings.Builder
+
+	cursor := start
+
+	for _, block := range blocks {
+		builder.WriteString(d.Content[cursor:block.Start.Offset])
+		builder.WriteString(d.rewriteBlock(block, render))
+
+		cursor = block.End.Offset
+	}
+
+	builder.WriteString(d.Content[cursor:end])
+
+	return builder.String()
+}
+
+func (d *Document) rewriteSection(section *Section, render RenderFunc) string {
+	if section == nil {
+		return ""
+	}
+
+	return d.rewriteRange(section.ContentStart, section.ContentEnd, section.Blocks, render)
+}
+
+func (d *Document) rewriteBlock(block *Block, render RenderFunc) string {
+	sections := block.Sections()
+
+	var rewritten []string = []string{}
+
+	for _, section := range sections {
+		rewritten = append(rewritten, d.rewriteSection(section, render))
+	}
+
+	var contents BlockContents = BlockContents{Variants: []string{}}
+
+	for i, section := range sections {
+		if section == block.Feature {
+			contents.Feature = rewritten[i]
+		} else if section == block.Default {
+			contents.Default = rewritten[i]
+		} else {
+			contents.Variants = append(contents.Variants, rewritten[i])
+		}
+	}
+
+	if text, ok := render(block, contents); ok {
+		return text
+	}
+
+	// Inline and next line blocks have no blocks inside of them
+	if block.Form != FormBlock {
+		return d.Content[block.Start.Offset:block.End.Offset]
+	}
+
+	var builder strings.Builder
+
+	cursor := block.Start.Offset
+
+	for i, section := range sections {
+		builder.WriteString(d.Content[cursor:section.ContentStart])
+		builder.WriteString(rewritten[i])
+
+		cursor = section.ContentEnd
+	}
+
+	builder.WriteString(d.Content[cursor:block.End.Offset])
+
+	return builder.String()
+}
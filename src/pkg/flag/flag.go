@@ -0,0 +1,330 @@
+// Package flag drives a flag workspace from Go without shelling out to the binary.
+//
+// A Workspace is bound to an explicit repository root. Operations never prompt, like
+// flag --non-interactive a decision that would need one fails with an *errs.Error
+// instead, and nothing is printed. Operations on the same repository are serialized,
+// operations on different repositories run at the same time. Toggle, TogglePreset and
+// Sync restore the files they wrote when they fail, and hold the lock of the workspace
+// like the commands of the CLI.
+package flag
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+	"github.com/costaluu/flag/git"
+	"github.com/costaluu/flag/logger"
+)
+
+var mu sync.Mutex = sync.Mutex{}
+
+// repositories holds a mutex for each repository root, mu must be held to use it.
+var repositories map[string]*sync.Mutex = make(map[string]*sync.Mutex)
+
+// running counts the operations in progress, prompts and output are off while one runs.
+var running int = 0
+
+var wasInteractive bool
+
+var output io.Writer
+
+// Workspace is the .features workspace of a git repository.
+type Workspace struct {
+	root string
+}
+
+// Block is a block of a source file.
+type Block struct {
+	// Path is relative to the repository root.
+	Path string
+	Id   string
+	// Name is the header of the block, a feature or an expression like a && !b.
+	Name  string
+	State string
+	// Value is the selected variant of a multivariate block.
+	Value string
+	// Features holds the state of each feature of an expression.
+	Features map[string]string
+	// Variants lists the values of a multivariate block.
+	Variants []string
+}
+
+// Version is a feature saved on a version base.
+type Version struct {
+	// Path is the version base, relative to the repository root.
+	Path  string
+	Id    string
+	Name  string
+	State string
+}
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	// All also checks the files tracked by flag without git changes, like flag sync --all.
+	All bool
+	// OnUntracked is the action for untracked changes on version bases, like flag sync
+	// --on-untracked: save-current, save:<state>, new-feature:<name>, rebase,
+	// update-base, restore or fail.
+	OnUntracked string
+	// Jobs is the number of files scanned at the same time, like flag sync --jobs. Zero
+	// uses one per CPU.
+	Jobs int
+}
+
+func resolveRoot(root string) (string, error) {
+	absolute, err := filepath.Abs(root)
+
+	if err != nil {
+		return "", errs.Wrap(err, "invalid repository root %s", root)
+	}
+
+	repositoryRoot, err := git.FindRepositoryRoot(absolute)
+
+	if err != nil {
+		return "", errs.Wrap(err, "%s is not a git repository", root)
+	}
+
+	return repositoryRoot, nil
+}
+
+// Open opens the workspace of the repository at root, root may be any folder of the
+// repository. It fails with errs.ErrWorkspaceNotFound when flag init was never run.
+func Open(root string) (*Workspace, error) {
+	repositoryRoot, err := resolveRoot(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &Workspace{root: repositoryRoot}
+
+	if err := ws.run(context.Background(), core.RequireWorkspace); err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// Init creates the workspace of the repository at root, unlike flag init it fails with
+// errs.ErrAlreadyExists instead of replacing an existing workspace.
+func Init(root string) (*Workspace, error) {
+	repositoryRoot, err := resolveRoot(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &Workspace{root: repositoryRoot}
+
+	err = ws.run(context.Background(), func(rootDir string) error {
+		exists, err := core.CheckWorkspaceFolder(rootDir)
+
+		if err != nil {
+			return err
+		} else if exists {
+			return errs.New(errs.AlreadyExists, "%s already has a workspace", rootDir)
+		}
+
+		return core.CreateNewWorkspace(rootDir)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// Root returns the root of the repository.
+func (ws *Workspace) Root() string {
+	return ws.root
+}
+
+// begin waits for the operations on the repository of ws and turns prompts and output
+// off for the first operation that runs.
+func (ws *Workspace) begin() *sync.Mutex {
+	mu.Lock()
+
+	repository, exists := repositories[ws.root]
+
+	if !exists {
+		repository = &sync.Mutex{}
+		repositories[ws.root] = repository
+	}
+
+	mu.Unlock()
+
+	repository.Lock()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if running++; running == 1 {
+		wasInteractive = core.IsInteractive()
+		output = logger.Output()
+
+		core.SetInteractive(false)
+		logger.SetOutput(io.Discard)
+	}
+
+	return repository
+}
+
+// end lets the next operation on the repository of ws run, prompts and output come back
+// with the last operation.
+func (ws *Workspace) end(repository *sync.Mutex) {
+	git.RemoveTempFolder(ws.root)
+
+	mu.Lock()
+
+	if running--; running == 0 {
+		core.SetInteractive(wasInteractive)
+		logger.SetOutput(output)
+	}
+
+	mu.Unlock()
+
+	repository.Unlock()
+}
+
+// run waits for the other operations on the repository of ws and runs fn on its root
+// unless ctx is done.
+func (ws *Workspace) run(ctx context.Context, fn func(rootDir string) error) error {
+	repository := ws.begin()
+	defer ws.end(repository)
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return fn(ws.root)
+}
+
+// Toggle sets a feature to on, off, dev or one of its variants on blocks and versions,
+// like flag toggle.
+func (ws *Workspace) Toggle(ctx context.Context, name string, state string) error {
+	return ws.run(ctx, func(rootDir string) error {
+		if err := core.CheckFeatureName(rootDir, name); err != nil {
+			return err
+		}
+
+		return core.Journaled(rootDir, "toggle "+name, func() error {
+			return core.GlobalToggle(rootDir, name, core.NormalizeState(state))
+		})
+	})
+}
+
+// TogglePreset toggles every feature of a preset, like flag toggle --preset.
+func (ws *Workspace) TogglePreset(ctx context.Context, preset string) error {
+	return ws.run(ctx, func(rootDir string) error {
+		presets, err := core.ReadPresets(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		features, exists := presets[preset]
+
+		if !exists {
+			return errs.New(errs.NotFound, "preset %s does not exists", preset)
+		}
+
+		return core.Journaled(rootDir, "toggle preset "+preset, func() error {
+			for name, state := range features {
+				if err := core.GlobalToggle(rootDir, name, state); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+// Blocks lists the blocks of every file, sorted by path.
+func (ws *Workspace) Blocks() ([]Block, error) {
+	var blocks []Block = []Block{}
+
+	err := ws.run(context.Background(), func(rootDir string) error {
+		blocksByPath, err := core.ListAllBlocks(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		for path, blockList := range blocksByPath {
+			for _, block := range blockList {
+				var variants []string
+
+				for _, variant := range block.Variants {
+					variants = append(variants, variant.Value)
+				}
+
+				blocks = append(blocks, Block{
+					Path:     path,
+					Id:       block.Id,
+					Name:     block.Name,
+					State:    block.State,
+					Value:    block.Value,
+					Features: block.Features,
+					Variants: variants,
+				})
+			}
+		}
+
+		return nil
+	})
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Path < blocks[j].Path
+	})
+
+	return blocks, err
+}
+
+// Versions lists the features of every version base, sorted by path.
+func (ws *Workspace) Versions() ([]Version, error) {
+	var versions []Version = []Version{}
+
+	err := ws.run(context.Background(), func(rootDir string) error {
+		versionsByPath, err := core.ListAllVersionsFeature(rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		for path, features := range versionsByPath {
+			for _, feature := range features {
+				versions = append(versions, Version{
+					Path:  path,
+					Id:    feature.Id,
+					Name:  feature.Name,
+					State: feature.State,
+				})
+			}
+		}
+
+		return nil
+	})
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Path < versions[j].Path
+	})
+
+	return versions, err
+}
+
+// Sync updates blocks and versions of the changed files, like flag sync. Untracked
+// changes on a version base fail unless opts.OnUntracked decides what to do.
+func (ws *Workspace) Sync(ctx context.Context, opts SyncOptions) error {
+	return ws.run(ctx, func(rootDir string) error {
+		return core.Journaled(rootDir, "sync", func() error {
+			return core.Sync(rootDir, core.SyncOptions{All: opts.All, OnUntracked: opts.OnUntracked, Jobs: opts.Jobs})
+		})
+	})
+}
@@ -0,0 +1,344 @@
+package flag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/costaluu/flag/core"
+	"github.com/costaluu/flag/errs"
+)
+
+func newRepository(t *testing.T) string {
+	root := t.TempDir()
+
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Skipf("git is not available: %v %s", err, out)
+	}
+
+	return root
+}
+
+func TestWorkspace(t *testing.T) {
+	root := newRepository(t)
+	ctx := context.Background()
+
+	if _, err := Open(root); !errors.Is(err, errs.ErrWorkspaceNotFound) {
+		t.Fatalf("expected a workspace not found error, got %v", err)
+	}
+
+	ws, err := Init(root)
+
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	if _, err := Init(root); !errors.Is(err, errs.ErrAlreadyExists) {
+		t.Fatalf("expected an already exists error, got %v", err)
+	}
+
+	source := "a := 0\n// @feature(checkout) //\nb := 1\n// @default(checkout) //\nb := 2\n// !feature //\n"
+
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.Sync(ctx, SyncOptions{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	blocks, err := ws.Blocks()
+
+	if err != nil || len(blocks) != 1 {
+		t.Fatalf("expected 1 block, got %v %v", blocks, err)
+	}
+
+	if blocks[0].Path != "main.go" || blocks[0].Name != "checkout" || blocks[0].State != "DEV" {
+		t.Errorf("unexpected block %+v", blocks[0])
+	}
+
+	if err := ws.Toggle(ctx, "checkout", "off"); err != nil {
+		t.Fatalf("toggle failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "main.go"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "b := 1") || !strings.Contains(string(data), "b := 2") {
+		t.Errorf("unexpected content after toggle\n%s", data)
+	}
+
+	if err := ws.Toggle(ctx, "checkou", "on"); !errors.Is(err, errs.ErrUnknownFeature) {
+		t.Errorf("expected an unknown feature error, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := ws.Toggle(canceled, "checkout", "on"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled context error, got %v", err)
+	}
+}
+
+func TestWorkspaceLock(t *testing.T) {
+	root := newRepository(t)
+	ctx := context.Background()
+
+	ws, err := Init(root)
+
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	source := "// @feature(checkout) //\nb := 1\n// @default(checkout) //\nb := 2\n// !feature //\n"
+
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.Sync(ctx, SyncOptions{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	host, _ := os.Hostname()
+	lock := filepath.Join(root, ".features", "lock")
+
+	// A process that exited leaves a stale lock
+	exited := exec.Command("git", "--version")
+
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	core.SetLockTimeout(0)
+	defer core.SetLockTimeout(core.DefaultLockTimeout)
+
+	for _, test := range []struct {
+		pid    int
+		locked bool
+	}{
+		{pid: os.Getppid(), locked: true},
+		{pid: exited.Process.Pid, locked: false},
+	} {
+		holder := fmt.Sprintf(`{"pid":%d,"host":%q,"operation":"flag sync"}`, test.pid, host)
+
+		if err := os.WriteFile(lock, []byte(holder), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := ws.Toggle(ctx, "checkout", "off")
+
+		if test.locked && !errors.Is(err, errs.ErrLocked) {
+			t.Errorf("pid %d: expected a locked error, got %v", test.pid, err)
+		} else if !test.locked && err != nil {
+			t.Errorf("pid %d: the stale lock was not taken over: %v", test.pid, err)
+		}
+
+		if _, err := os.Stat(lock); test.locked != (err == nil) {
+			t.Errorf("pid %d: the lock exists = %v, want %v", test.pid, err == nil, test.locked)
+		}
+	}
+}
+
+func TestWorkspacesInParallel(t *testing.T) {
+	ctx := context.Background()
+	source := "// @feature(checkout) //\nb := 1\n// @default(checkout) //\nb := 2\n// !feature //\n"
+
+	var workspaces []*Workspace
+
+	for i := 0; i < 2; i++ {
+		root := newRepository(t)
+
+		ws, err := Init(root)
+
+		if err != nil {
+			t.Fatalf("init failed: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		workspaces = append(workspaces, ws)
+	}
+
+	states := []string{"on", "off"}
+	results := make(chan error, len(workspaces))
+
+	for i, ws := range workspaces {
+		go func(ws *Workspace, state string) {
+			if err := ws.Sync(ctx, SyncOptions{}); err != nil {
+				results <- err
+
+				return
+			}
+
+			results <- ws.Toggle(ctx, "checkout", state)
+		}(ws, states[i])
+	}
+
+	for range workspaces {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, ws := range workspaces {
+		blocks, err := ws.Blocks()
+
+		if err != nil || len(blocks) != 1 || blocks[0].State != strings.ToUpper(states[i]) {
+			t.Errorf("workspace %d: expected the block %s, got %+v %v", i, states[i], blocks, err)
+		}
+	}
+
+	if _, err := Open(t.TempDir()); err == nil {
+		t.Errorf("expected an error outside of a repository")
+	}
+}
+
+func TestSyncDeletedFiles(t *testing.T) {
+	root := newRepository(t)
+	ctx := context.Background()
+
+	ws, err := Init(root)
+
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	source := "// @feature(checkout) //\nb := 1\n// @default(checkout) //\nb := 2\n// !feature //\n"
+
+	for _, name := range []string{"main.go", "theme.go"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ws.Sync(ctx, SyncOptions{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	if out, err := exec.Command("git", "-C", root, "-c", "user.name=flag", "-c", "user.email=flag@example.com", "add", "main.go").CombinedOutput(); err != nil {
+		t.Fatalf("git add failed: %v %s", err, out)
+	}
+
+	if out, err := exec.Command("git", "-C", root, "-c", "user.name=flag", "-c", "user.email=flag@example.com", "commit", "-q", "-m", "main").CombinedOutput(); err != nil {
+		t.Fatalf("git commit failed: %v %s", err, out)
+	}
+
+	for _, name := range []string{"main.go", "theme.go"} {
+		if err := os.Remove(filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// git reports main.go as deleted, theme.go was never committed and only --all finds it
+	for _, test := range []struct {
+		opts    SyncOptions
+		missing []string
+	}{
+		{opts: SyncOptions{}, missing: []string{"theme.go"}},
+		{opts: SyncOptions{All: true}, missing: []string{}},
+	} {
+		if err := ws.Sync(ctx, test.opts); err != nil {
+			t.Fatalf("sync %+v failed: %v", test.opts, err)
+		}
+
+		problems, err := core.CheckRecords(root)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var missing []string = []string{}
+
+		for _, problem := range problems {
+			if problem.Check != core.CheckMissingPath {
+				t.Errorf("sync %+v: unexpected problem %+v", test.opts, problem)
+			}
+
+			missing = append(missing, problem.Path)
+		}
+
+		if strings.Join(missing, ",") != strings.Join(test.missing, ",") {
+			t.Errorf("sync %+v: %v are still tracked, want %v", test.opts, missing, test.missing)
+		}
+	}
+}
+
+func TestDoctorOrphanFolders(t *testing.T) {
+	root := newRepository(t)
+	ctx := context.Background()
+
+	ws, err := Init(root)
+
+	if err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	source := "// @feature(checkout) //\nb := 1\n// @default(checkout) //\nb := 2\n// !feature //\n"
+
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.Sync(ctx, SyncOptions{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, ".features", "blocks"))
+
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected 1 blocks folder, got %v %v", entries, err)
+	}
+
+	// A version base of main.go, doctor reads its _path first
+	versions := filepath.Join(root, ".features", "versions", entries[0].Name())
+	orphans := []string{filepath.Join(root, ".features", "blocks", entries[0].Name()), versions}
+
+	if err := os.MkdirAll(versions, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(versions, "_path"), []byte("main.go"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(root, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fix := range []bool{false, true} {
+		records, err := core.Doctor(root, fix)
+
+		if err != nil {
+			t.Fatalf("doctor %v failed: %v", fix, err)
+		}
+
+		var found int = 0
+
+		for _, record := range records {
+			if record.Problem == core.DoctorOrphanFolder && record.Fixed == fix {
+				found++
+			}
+		}
+
+		if found != len(orphans) {
+			t.Errorf("doctor %v: expected %d orphan folders, got %+v", fix, len(orphans), records)
+		}
+
+		for _, folder := range orphans {
+			if _, err := os.Stat(folder); fix == (err == nil) {
+				t.Errorf("doctor %v: %s exists = %v", fix, folder, err == nil)
+			}
+		}
+	}
+}
@@ -28,7 +28,7 @@ func SecondaryTextStyle[T any](msg T) string {
 	var defaultStyle = 
 		lipgloss.
 			NewStyle().
-			SetString(fmt.Sprintf("%s", msg)).
+			SetString(fmt.Sprintf("%v", msg)).
 			Foreground(lipgloss.Color("242"))
 	
 	return defaultStyle.Render()
@@ -23,6 +23,12 @@ func RenderTable(headers []string, rows [][]string) {
 		"NOT ACTIVE": lipgloss.Color("160"),
 	}
 
+	fixedWidthHeaders := map[string]bool{
+		"STATE": true,
+		"TYPE": true,
+		"START": true,
+	}
+
 	fullHeaders := []string{"#"}
 	fullHeaders = append(fullHeaders, headers...)
 
@@ -58,7 +64,8 @@ func RenderTable(headers []string, rows [][]string) {
 				style = style.Width(3)
 			}
 
-			if col == 2 {
+			// Only short columns like states get a fixed width, free text wraps
+			if col == 2 && fixedWidthHeaders[fullHeaders[2]] {
 				if len(data[0]) == 6 {
 					style = style.Width(10)
 				} else {
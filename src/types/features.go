@@ -1,5 +1,7 @@
 package types
 
+import "encoding/json"
+
 type Match struct {
 	Id             string
 	FeatureName    string
@@ -9,8 +11,14 @@ type Match struct {
 	MatchContent   string
 	FeatureContent string
 	DefaultContent string
+	Variants       []Variant
+	Separator      string
 	DelimeterStart string
 	DelimeterEnd   string
+	Start          int
+	End            int
+	Line           int
+	Column         int
 }
 
 type Delimeter struct {
@@ -18,21 +26,74 @@ type Delimeter struct {
 	End   string `json:"end"`
 }
 
-type Delimeters map[string]Delimeter
+// DelimeterList holds every delimeter pair accepted for a file extension.
+type DelimeterList []Delimeter
+
+// UnmarshalJSON also reads workspaces where an extension had a single pair.
+func (list *DelimeterList) UnmarshalJSON(data []byte) error {
+	var single Delimeter
+
+	if err := json.Unmarshal(data, &single); err == nil {
+		*list = DelimeterList{single}
+
+		return nil
+	}
+
+	var pairs []Delimeter
+
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
+	}
+
+	*list = pairs
+
+	return nil
+}
+
+type Delimeters map[string]DelimeterList
 
 type Presets map[string]map[string]string
 
+// FeatureVariants holds the values declared for each multivariate feature.
+type FeatureVariants map[string][]string
+
+// RegistryFeature documents a feature on .features/registry. States lists the states
+// allowed for the feature, multivariate features list their values instead.
+type RegistryFeature struct {
+	Description string   `json:"description"`
+	Owner       string   `json:"owner"`
+	CreatedAt   string   `json:"createdAt"`
+	States      []string `json:"states"`
+	Tags        []string `json:"tags"`
+}
+
+type Registry map[string]RegistryFeature
+
 type Feature struct {
 	Name  string
 	State string
 }
 
+// Variant is a `name=value` branch of a multivariate block.
+type Variant struct {
+	Value   string `json:"value"`
+	Content string `json:"content"`
+}
+
+// BlockFeature is the .block file of a block. Name is the header expression, State is
+// its evaluated state and Features holds the state of each feature of an expression
+// like `checkout && !legacyPayments`, it is empty when Name is a single feature.
+// Multivariate blocks list every variant on Variants, with the content of the ones
+// that are not visible, and the selected variant on Value.
 type BlockFeature struct {
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	State       string `json:"state"`
-	Synced      bool   `json:"synced"`
-	SwapContent string `json:"swapContent"`
+	Id          string            `json:"id"`
+	Name        string            `json:"name"`
+	State       string            `json:"state"`
+	Value       string            `json:"value,omitempty"`
+	Features    map[string]string `json:"features,omitempty"`
+	Variants    []Variant         `json:"variants,omitempty"`
+	Synced      bool              `json:"synced"`
+	SwapContent string            `json:"swapContent"`
 }
 
 type VersionFeature struct {
@@ -46,9 +107,58 @@ type Conflict struct {
 	LineStart int
 	LineEnd   int
 	Content   string
+	// Hunk is the position of the conflict on the hunks of its merge, Before and After
+	// count the lines of the hunks around it added to Content as context.
+	Hunk   int
+	Before int
+	After  int
 }
 
 type FilePathCategory struct {
 	Path   string
 	Action []string
-}
\ No newline at end of file
+}
+// FeatureRecord is a row of the machine readable reports. Kind is block or version,
+// Type is FEATURE or STATE, a state is a combination of features saved on a version
+// base and lists their names and ids joined by +.
+type FeatureRecord struct {
+	Path    string `json:"path"`
+	Feature string `json:"feature"`
+	Id      string `json:"id"`
+	Kind    string `json:"kind"`
+	Type    string `json:"type"`
+	State   string `json:"state"`
+	Active  bool   `json:"active"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+}
+
+type PresetRecord struct {
+	Preset  string `json:"preset"`
+	Feature string `json:"feature"`
+	State   string `json:"state"`
+}
+
+type DelimeterRecord struct {
+	Rule  string `json:"rule"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Type  string `json:"type"`
+}
+
+// ProblemRecord is an inconsistency found by flag check, Check names the kind of problem.
+type ProblemRecord struct {
+	Path    string `json:"path"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// DiagnosisRecord is a problem found by flag doctor, Fix is the repair of
+// doctor --fix and is empty when it has to be repaired by hand.
+type DiagnosisRecord struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+	Message string `json:"message"`
+	Fix     string `json:"fix"`
+	Fixed   bool   `json:"fixed"`
+}
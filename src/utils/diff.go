@@ -86,7 +86,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.viewport = viewport.New(msg.Width, msg.Height-verticalMarginHeight)
 			m.viewport.YPosition = headerHeight
 			m.viewport.HighPerformanceRendering = useHighPerformanceRenderer
-			m.viewport.Style = lipgloss.NewStyle().Foreground(lipgloss.Color(42))
+			m.viewport.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
 
 			buf := new(bytes.Buffer)
 			
@@ -149,9 +149,7 @@ func max(a, b int) int {
 	return b
 }
 
-func DiffCurrentTrackedVersionWithCurrentVersion(currentStateTitle string, currentTrackedVersionPath string, currentVersionPath string) {
-	var rootDir string = git.GetRepositoryRoot()
-
+func DiffCurrentTrackedVersionWithCurrentVersion(rootDir string, currentStateTitle string, currentTrackedVersionPath string, currentVersionPath string) {
 	filesystem.FileCopy(currentTrackedVersionPath, filepath.Join(rootDir, ".features", "Current Tracked Version"))
 	filesystem.FileCopy(currentVersionPath, filepath.Join(rootDir, ".features", "Current Version"))
 
@@ -10,11 +10,14 @@ import (
 	"github.com/costaluu/flag/logger"
 )
 
-func PickModifedOrUntrackedFiles(title string) components.FileListItem {
-	modified := git.GetModifedFiles()
-	untracked := git.GetUntrackedFiles()
+func PickModifedOrUntrackedFiles(rootDir string, title string) components.FileListItem {
+	status, err := git.GetStatus(rootDir)
 
-	var rootDir string = git.GetRepositoryRoot()
+	if err != nil {
+		logger.Fatal[error](err)
+	}
+
+	modified, untracked := status.Modified, status.Untracked
 
 	var items []components.FileListItem = []components.FileListItem{}
 
@@ -73,10 +76,8 @@ func PickModifedOrUntrackedFiles(title string) components.FileListItem {
 	return result
 }
 
-func PickAllFiles(title string) components.FileListItem {
-	files := FileListAllFiles()
-
-	var rootDir string = git.GetRepositoryRoot()
+func PickAllFiles(rootDir string, title string) components.FileListItem {
+	files := FileListAllFiles(rootDir)
 
 	var items []components.FileListItem = []components.FileListItem{}
 
@@ -12,7 +12,6 @@ import (
 
 	"github.com/costaluu/flag/constants"
 	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/git"
 	"github.com/costaluu/flag/logger"
 	"github.com/gobwas/glob"
 )
@@ -110,17 +109,20 @@ func ShouldIgnorePath(path string, rootDir string, patterns []string) bool {
     return false
 }
 
-func FileListAllFiles() []string {
+func FileListAllFiles(rootDir string) []string {
 	var files []string
 
-	var rootDir string = git.GetRepositoryRoot()
-
 	checkGitIgnore := filesystem.FileExists(filepath.Join(rootDir, ".gitignore"))
 
 	var ignorePatterns []string = []string{".features", ".git", ".gitignore"}
 
 	if checkGitIgnore {
-		data := filesystem.FileRead(filepath.Join(rootDir, ".gitignore"))
+		data, err := filesystem.FileRead(filepath.Join(rootDir, ".gitignore"))
+
+		if err != nil {
+			logger.Fatal[error](err)
+		}
+
 		ignorePatterns = append(ignorePatterns, strings.Split(data, "\n")...)
 	}
 	
@@ -7,8 +7,8 @@ import (
 	"strings"
 
 	"github.com/costaluu/flag/constants"
+	"github.com/costaluu/flag/errs"
 	filesystem "github.com/costaluu/flag/fs"
-	"github.com/costaluu/flag/logger"
 )
 
 type WorkingTreeValue struct {
@@ -20,30 +20,32 @@ type WorkingTreeValue struct {
 type WorkingTree map[string]WorkingTreeValue
 
 // Creates the working tree in the file directory
-func CreateWorkingTree(path string) {
+func CreateWorkingTree(path string) error {
 	var tree WorkingTree = make(WorkingTree)
 
-	filesystem.FileWriteJSONToFile(filepath.Join(path, constants.WorkingTreeFile), tree)
+	return filesystem.FileWriteJSONToFile(filepath.Join(path, constants.WorkingTreeFile), tree)
 }
 
 // LoadWorkingTree loads the working tree from the JSON file.
-func LoadWorkingTree(path string) WorkingTree {
+func LoadWorkingTree(path string) (WorkingTree, error) {
 	fileExists := filesystem.FileExists(filepath.Join(path, constants.WorkingTreeFile))
 
 	if !fileExists {
-		logger.Result[string]("working tree file not found")
+		return nil, errs.New(errs.NotFound, "working tree file not found")
 	}
 
 	var tree WorkingTree
 
-	filesystem.FileReadJSONFromFile(filepath.Join(path, constants.WorkingTreeFile), &tree)
+	if err := filesystem.FileReadJSONFromFile(filepath.Join(path, constants.WorkingTreeFile), &tree); err != nil {
+		return nil, err
+	}
 
-    return tree
+    return tree, nil
 }
 
 // SaveWorkingTree saves the working tree to the JSON file.
-func SaveWorkingTree(path string, tree WorkingTree) {
-    filesystem.FileWriteJSONToFile(filepath.Join(path, constants.WorkingTreeFile), tree)    
+func SaveWorkingTree(path string, tree WorkingTree) error {
+    return filesystem.FileWriteJSONToFile(filepath.Join(path, constants.WorkingTreeFile), tree)    
 }
 
 // NormalizeFeatures sorts the slice of features and returns it as a string.
@@ -53,19 +55,27 @@ func NormalizeFeatures(features []string) string {
 }
 
 // Add adds a new feature set to the working tree.
-func Add(path string, features []string, value WorkingTreeValue) {
-    tree := LoadWorkingTree(path)
+func Add(path string, features []string, value WorkingTreeValue) error {
+    tree, err := LoadWorkingTree(path)
+
+	if err != nil {
+		return err
+	}
 
     key := NormalizeFeatures(features)
     
 	tree[key] = value
     
-	SaveWorkingTree(path, tree)
+	return SaveWorkingTree(path, tree)
 }
 
 // Remove removes all occurrences of a specific feature from the working tree.
-func Remove(path string, featureId string) {
-    tree := LoadWorkingTree(path)
+func Remove(path string, featureId string) error {
+    tree, err := LoadWorkingTree(path)
+
+	if err != nil {
+		return err
+	}
     
 	for key := range tree {
         if strings.Contains(key, featureId) {
@@ -73,31 +83,39 @@ func Remove(path string, featureId string) {
         }
     }
     
-	SaveWorkingTree(path, tree)
+	return SaveWorkingTree(path, tree)
 }
 
 // Update updates an existing entry or adds a new one.
-func Update(path string, features []string, value WorkingTreeValue) {
-    tree := LoadWorkingTree(path)
+func Update(path string, features []string, value WorkingTreeValue) error {
+    tree, err := LoadWorkingTree(path)
+
+	if err != nil {
+		return err
+	}
 
 	key := NormalizeFeatures(features)
 	tree[key] = value
     
-	SaveWorkingTree(path, tree)
+	return SaveWorkingTree(path, tree)
 }
 
 // FindKeyValue returns the key and value for the given array of feature names.
-func FindKeyValue(path string, features []string) (string, WorkingTreeValue, bool) {
-    tree := LoadWorkingTree(path)
+func FindKeyValue(path string, features []string) (string, WorkingTreeValue, bool, error) {
+    tree, err := LoadWorkingTree(path)
+
+	if err != nil {
+		return "", WorkingTreeValue{}, false, err
+	}
     
     key := NormalizeFeatures(features)
     value, exists := tree[key]
  
 	if !exists {
-        return "", WorkingTreeValue{}, false
+        return "", WorkingTreeValue{}, false, nil
     }
     
-	return key, value, true
+	return key, value, true, nil
 }
 
 func min(a, b int) int {
@@ -115,12 +133,17 @@ func StringToStringSlice(features string) []string {
 	return elements
 }
 
-func FindNearestPrefix(path string, target []string) ([]string, []string) {
+func FindNearestPrefix(path string, target []string) ([]string, []string, error) {
 	if len(target) == 0 {
-		return []string{}, []string{}
+		return []string{}, []string{}, nil
+	}
+
+	tree, err := LoadWorkingTree(path)
+
+	if err != nil {
+		return nil, nil, err
 	}
 
-	tree := LoadWorkingTree(path)
 	var bestPrefix []string = []string{}
 	var currentPrefix []string = []string{}
 
@@ -158,5 +181,5 @@ func FindNearestPrefix(path string, target []string) ([]string, []string) {
 		}
 	}
 
-	return bestPrefix, remaining
+	return bestPrefix, remaining, nil
 }
\ No newline at end of file